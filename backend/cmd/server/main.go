@@ -6,18 +6,29 @@ import (
 	"os"
 	"os/signal"
 	"path/filepath"
+	"strings"
 	"syscall"
 	"time"
 
+	"photobooth/internal/albumsync"
 	"photobooth/internal/api"
 	"photobooth/internal/app"
 	"photobooth/internal/camera"
+	"photobooth/internal/captive"
 	"photobooth/internal/config"
+	"photobooth/internal/diskpolicy"
 	"photobooth/internal/dns"
+	"photobooth/internal/export"
 	"photobooth/internal/imaging"
 	"photobooth/internal/logging"
+	"photobooth/internal/mirror"
+	"photobooth/internal/mqtt"
 	"photobooth/internal/network"
+	"photobooth/internal/share"
+	"photobooth/internal/share/email"
 	"photobooth/internal/storage"
+	"photobooth/internal/upload"
+	"photobooth/internal/webhook"
 	"photobooth/internal/websocket"
 )
 
@@ -69,16 +80,94 @@ func main() {
 
 	// App Controller (Orchestrator)
 	application := app.NewApp(cfg, cam, img, store, hub)
+	application.ReconcileIndexes()
+	application.Trash.Start()
 
-	// Network (WiFi + DNS)
+	// Free space guardrails (alerts, capture stop, automatic cleanup)
+	policy := diskpolicy.NewPolicy(cfg.Storage, photosBase, hub, application.Trash, func() string {
+		return config.SanitizeAlbumName(cfg.Booth.CurrentAlbum)
+	})
+	policy.Start()
+	application.Policy = policy
+	defer storage.CloseAllIndexes()
+
+	// Guest share links (QR codes on the preview screen)
+	shareMgr := share.NewManager(cfg.Share, cfg.Wifi, photosBase)
+	shareMgr.OnMissingPreview = application.QueueDerivatives
+	application.Share = shareMgr
+
+	// Email delivery (persistent outbox per album)
+	mailQueue := email.NewQueue(cfg.Share.Email, photosBase, nil)
+	mailQueue.Start()
+	application.Email = mailQueue
+
+	// Background upload to S3-compatible storage
+	uploader := upload.NewUploader(cfg.Upload, photosBase, func() bool {
+		return application.GetState() != app.StateIdle
+	})
+	uploader.Start()
+	application.Upload = uploader
+	application.OnPhotoReady(uploader.EnqueuePhoto)
+
+	// Live mirror of every capture to a second drive
+	mirrorTarget := mirror.NewMirror(cfg.Mirror, photosBase)
+	mirrorTarget.Start()
+	application.Mirror = mirrorTarget
+
+	// USB export jobs, hotplug events for the dashboard and auto-export rules
+	exporter := export.NewManager(photosBase, hub, func(album string) string {
+		return cfg.Booth.AlbumDisplayNames[album]
+	})
+	exporter.Start()
+	application.Export = exporter
+	application.StartUsbWatcher()
+
+	// WebDAV / Nextcloud album sync
+	syncer := albumsync.NewSyncer(cfg.Sync, photosBase, hub, func() string {
+		return config.SanitizeAlbumName(cfg.Booth.CurrentAlbum)
+	})
+	syncer.Start()
+	application.Sync = syncer
+	application.OnPhotoReady(syncer.OnPhotoReady)
+
+	// Outbound webhooks (same events as the websocket stream)
+	hooks := webhook.NewDispatcher(cfg.Webhooks, photosBase)
+	hooks.Start(hub)
+	application.Hooks = hooks
+
+	// MQTT (lighting cues, remote trigger)
+	mqttClient := mqtt.NewClient(cfg.Mqtt)
+	mqttClient.OnTrigger = application.Trigger
+	mqttClient.OnCancel = application.Cancel
+	mqttClient.Start(hub)
+	application.Mqtt = mqttClient
+
+	// Network (WiFi hotspot or venue network + DNS)
 	if cfg.Wifi.Enabled {
-		network.SetupWifi(cfg.Wifi)
-		defer network.TeardownWifi() // Clean up on exit
+		netMgr := network.NewManager(cfg.Wifi, hub)
 
 		// Start Captive Portal DNS
 		dnsServer := dns.NewServer(cfg.Wifi)
 		dnsServer.Start()
 		defer dnsServer.Stop()
+
+		netMgr.OnConfig = dnsServer.SetConfig
+		netMgr.Start()
+		defer netMgr.Stop() // Clean up on exit
+		application.Network = netMgr
+
+		// Sign-in sheet for phones on the hotspot; on a venue network the
+		// probes never reach the booth
+		application.Portal = captive.NewPortal(func() config.WifiConfig {
+			wifi := netMgr.Config()
+			wifi.CaptivePortal = wifi.CaptivePortal && netMgr.Status().Active == network.ActiveHotspot
+			return wifi
+		})
+		for host, addr := range cfg.Wifi.Dns.Records {
+			if addr == "" || addr == cfg.Wifi.IpAddress {
+				application.Portal.AddHostNames(host)
+			}
+		}
 	}
 
 	// 5. Setup Routes
@@ -90,6 +179,14 @@ func main() {
 	// Wait, I made api.Handler struct with RegisterRoutes method
 	apiHandler.RegisterRoutes(mux)
 
+	// Guest download portal
+	shareMgr.RegisterRoutes(mux)
+
+	// Captive portal probes (must win over the SPA fallback)
+	if application.Portal != nil {
+		application.Portal.RegisterRoutes(mux)
+	}
+
 	// WebSocket
 	mux.HandleFunc("/ws", func(w http.ResponseWriter, r *http.Request) {
 		hub.ServeWs(w, r)
@@ -98,7 +195,7 @@ func main() {
 	// Static Files (Frontend) - Served at root with SPA fallback
 	frontendDir := "./public/frontend"
 	fs := http.FileServer(http.Dir(frontendDir))
-	mux.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+	spa := func(w http.ResponseWriter, r *http.Request) {
 		path := filepath.Join(frontendDir, r.URL.Path)
 		_, err := os.Stat(path)
 		if os.IsNotExist(err) && r.URL.Path != "/" {
@@ -108,7 +205,11 @@ func main() {
 		}
 		// Otherwise let FileServer handle it
 		fs.ServeHTTP(w, r)
-	})
+	}
+	if application.Portal != nil {
+		spa = application.Portal.Wrap(spa)
+	}
+	mux.HandleFunc("/", spa)
 
 	// Legacy Client - Served at /legacy/
 	legacyFs := http.FileServer(http.Dir("./public/legacy"))
@@ -123,10 +224,23 @@ func main() {
 			return
 		}
 
-		// Get current album directory dynamically
+		// Get current album directory dynamically (or an explicitly requested one)
 		albumDir := application.GetAlbumDir()
+		if album := r.URL.Query().Get("album"); album != "" {
+			albumDir = filepath.Join(cfg.Booth.PhotosBasePath, config.SanitizeAlbumName(album))
+		}
 		fullPath := filepath.Join(albumDir, path)
 
+		// Previews and thumbnails of old albums may have been removed to free
+		// space: rebuild them in the background and serve the original meanwhile
+		if sub, name, ok := strings.Cut(path, "/"); ok && (sub == "preview" || sub == "thumb") {
+			if _, err := os.Stat(fullPath); os.IsNotExist(err) {
+				application.QueueDerivatives(albumDir, filepath.Base(name))
+				fullPath = filepath.Join(albumDir, "original", filepath.Base(name))
+				w.Header().Set("Cache-Control", "no-store") // not what the URL will show later
+			}
+		}
+
 		http.ServeFile(w, r, fullPath)
 	})
 
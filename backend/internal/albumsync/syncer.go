@@ -0,0 +1,408 @@
+package albumsync
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"photobooth/internal/config"
+	"photobooth/internal/logging"
+	"photobooth/internal/storage"
+	"photobooth/internal/websocket"
+)
+
+// TargetStatus is the public view of a sync target. It never contains credentials.
+type TargetStatus struct {
+	Name        string    `json:"name"`
+	Type        string    `json:"type"`
+	Url         string    `json:"url"`
+	Mode        string    `json:"mode"`
+	Enabled     bool      `json:"enabled"`
+	Running     bool      `json:"running"`
+	LastRun     time.Time `json:"lastRun,omitempty"`
+	LastAlbum   string    `json:"lastAlbum,omitempty"`
+	LastError   string    `json:"lastError,omitempty"`
+	LastCopied  int       `json:"lastCopied"`
+	LastSkipped int       `json:"lastSkipped"`
+	RetryAt     time.Time `json:"retryAt,omitempty"` // next attempt after a failed sync
+}
+
+// A failed sync is retried after retryBase, doubling per failure up to retryMax.
+var (
+	retryBase = 30 * time.Second
+	retryMax  = 30 * time.Minute
+)
+
+type target struct {
+	cfg     config.SyncTarget
+	client  *davClient
+	wake    chan struct{}
+	mu      sync.Mutex
+	pending map[string]bool // albums waiting to be synced
+	retry   map[string]time.Time
+	fails   map[string]int // failed syncs in a row per album
+	status  TargetStatus
+}
+
+// Syncer mirrors album folders to remote WebDAV targets (e.g. Nextcloud).
+type Syncer struct {
+	targets      []*target
+	basePath     string
+	hub          *websocket.Hub
+	currentAlbum func() string
+	log          *logging.Logger
+}
+
+// NewSyncer prepares all configured targets. currentAlbum returns the active album id
+// and is used by scheduled targets.
+func NewSyncer(cfg config.SyncConfig, photosBase string, hub *websocket.Hub, currentAlbum func() string) *Syncer {
+	s := &Syncer{
+		basePath:     photosBase,
+		hub:          hub,
+		currentAlbum: currentAlbum,
+		log:          logging.Get(),
+	}
+
+	for _, tc := range cfg.Targets {
+		if tc.Type != "" && tc.Type != "webdav" {
+			s.log.Warn("sync", "Sync target '%s' has unsupported type '%s'", tc.Name, tc.Type)
+			continue
+		}
+		client, err := newDavClient(tc.Url, tc.Username, tc.Password)
+		if err != nil {
+			s.log.Error("sync", "Sync target '%s' disabled: %v", tc.Name, err)
+			continue
+		}
+		if tc.Mode == "" {
+			tc.Mode = "manual"
+		}
+		s.targets = append(s.targets, &target{
+			cfg:     tc,
+			client:  client,
+			wake:    make(chan struct{}, 1),
+			pending: make(map[string]bool),
+			retry:   make(map[string]time.Time),
+			fails:   make(map[string]int),
+			status: TargetStatus{
+				Name:    tc.Name,
+				Type:    "webdav",
+				Url:     redactURL(tc.Url),
+				Mode:    tc.Mode,
+				Enabled: tc.Enabled,
+			},
+		})
+	}
+	return s
+}
+
+// Start launches one worker per enabled target plus the schedulers.
+func (s *Syncer) Start() {
+	for _, t := range s.targets {
+		if !t.cfg.Enabled {
+			continue
+		}
+		go s.worker(t)
+
+		if t.cfg.Mode == "schedule" {
+			interval := time.Duration(t.cfg.IntervalMinutes) * time.Minute
+			if interval < time.Minute {
+				interval = 15 * time.Minute
+			}
+			go func(t *target) {
+				for range time.Tick(interval) {
+					s.enqueue(t, s.currentAlbum())
+				}
+			}(t)
+		}
+		s.log.Info("sync", "Sync target '%s' active (%s, mode=%s)", t.cfg.Name, t.status.Url, t.cfg.Mode)
+	}
+}
+
+// OnPhotoReady schedules a sync of the album for all "onCapture" targets.
+func (s *Syncer) OnPhotoReady(album, filename string) {
+	for _, t := range s.targets {
+		if t.cfg.Enabled && t.cfg.Mode == "onCapture" {
+			s.enqueue(t, album)
+		}
+	}
+}
+
+// Run schedules a sync of an album to the named target, or to all enabled targets if name is empty.
+func (s *Syncer) Run(name, album string) error {
+	found := false
+	for _, t := range s.targets {
+		if !t.cfg.Enabled || (name != "" && t.cfg.Name != name) {
+			continue
+		}
+		s.enqueue(t, album)
+		found = true
+	}
+	if !found {
+		return fmt.Errorf("no enabled sync target %q", name)
+	}
+	return nil
+}
+
+// Status lists all targets.
+func (s *Syncer) Status() []TargetStatus {
+	res := make([]TargetStatus, 0, len(s.targets))
+	for _, t := range s.targets {
+		t.mu.Lock()
+		res = append(res, t.status)
+		t.mu.Unlock()
+	}
+	return res
+}
+
+// MoveAlbum carries a pending sync of an album over to its new name after the
+// album was renamed or merged into another.
+func (s *Syncer) MoveAlbum(from, to string) {
+	for _, t := range s.targets {
+		t.mu.Lock()
+		if t.pending[from] {
+			delete(t.pending, from)
+			t.pending[to] = true
+		}
+		if at, ok := t.retry[from]; ok {
+			delete(t.retry, from)
+			t.retry[to] = at
+		}
+		if n, ok := t.fails[from]; ok {
+			delete(t.fails, from)
+			t.fails[to] = n
+		}
+		t.mu.Unlock()
+	}
+}
+
+func (s *Syncer) enqueue(t *target, album string) {
+	t.mu.Lock()
+	t.pending[album] = true
+	t.mu.Unlock()
+	select {
+	case t.wake <- struct{}{}:
+	default:
+	}
+}
+
+// worker syncs the pending albums of a target one after another. An album
+// whose sync failed comes back on its own once its retry is due.
+func (s *Syncer) worker(t *target) {
+	for {
+		timer := time.NewTimer(t.untilRetry())
+		select {
+		case <-t.wake:
+		case <-timer.C:
+		}
+		timer.Stop()
+
+		t.mu.Lock()
+		now := time.Now()
+		for album, at := range t.retry {
+			if !at.After(now) {
+				delete(t.retry, album)
+				t.pending[album] = true
+			}
+		}
+		t.mu.Unlock()
+
+		for {
+			t.mu.Lock()
+			album := ""
+			for a := range t.pending {
+				album = a
+				break
+			}
+			if album == "" {
+				t.mu.Unlock()
+				break
+			}
+			delete(t.pending, album)
+			t.status.Running = true
+			t.mu.Unlock()
+
+			copied, skipped, err := s.syncAlbum(t, album)
+
+			t.mu.Lock()
+			t.status.Running = false
+			t.status.LastRun = time.Now()
+			t.status.LastAlbum = album
+			t.status.LastCopied = copied
+			t.status.LastSkipped = skipped
+			t.status.LastError = ""
+			t.status.RetryAt = time.Time{}
+			if err != nil {
+				t.status.LastError = err.Error()
+				t.fails[album]++
+				delay := retryBase << uint(min(t.fails[album]-1, 6))
+				if delay > retryMax {
+					delay = retryMax
+				}
+				t.retry[album] = time.Now().Add(delay)
+				t.status.RetryAt = t.retry[album]
+			} else {
+				delete(t.fails, album)
+				delete(t.retry, album)
+			}
+			retryAt := t.status.RetryAt
+			t.mu.Unlock()
+			if err != nil {
+				s.log.Info("sync", "Retrying album '%s' on '%s' at %s", album, t.cfg.Name, retryAt.Format("15:04:05"))
+			}
+		}
+	}
+}
+
+// untilRetry is the time until the next retry of a failed album is due.
+func (t *target) untilRetry() time.Duration {
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	wait := time.Hour
+	for _, at := range t.retry {
+		if d := time.Until(at); d < wait {
+			wait = d
+		}
+	}
+	if wait < 0 {
+		wait = 0
+	}
+	return wait
+}
+
+type pendingFile struct {
+	local  string
+	remote string
+	size   int64
+}
+
+// syncAlbum uploads every file that is missing remotely or differs in size.
+func (s *Syncer) syncAlbum(t *target, album string) (int, int, error) {
+	subs := []string{"original"}
+	if t.cfg.IncludePreviews {
+		subs = append(subs, "preview")
+	}
+
+	s.broadcast("sync_start", map[string]interface{}{"target": t.cfg.Name, "album": album})
+
+	// 1. Compare local and remote listings
+	var todo []pendingFile
+	var totalBytes int64
+	skipped := 0
+	for _, sub := range subs {
+		localDir := filepath.Join(s.basePath, album, sub)
+		entries, err := os.ReadDir(localDir)
+		if err != nil {
+			continue
+		}
+
+		remoteDir := path.Join(album, sub)
+		if err := t.client.MkdirAll(remoteDir); err != nil {
+			return s.fail(t, album, err)
+		}
+		remote, err := t.client.List(remoteDir)
+		if err != nil {
+			return s.fail(t, album, err)
+		}
+
+		for _, e := range entries {
+			if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			if rf, ok := remote[e.Name()]; ok && rf.Size == info.Size() {
+				skipped++
+				continue
+			}
+			todo = append(todo, pendingFile{
+				local:  filepath.Join(localDir, e.Name()),
+				remote: path.Join(remoteDir, e.Name()),
+				size:   info.Size(),
+			})
+			totalBytes += info.Size()
+		}
+	}
+
+	// 2. Upload the difference
+	start := time.Now()
+	var copiedBytes int64
+	for i, f := range todo {
+		if err := t.client.Put(f.remote, f.local); err != nil {
+			return s.fail(t, album, err)
+		}
+		copiedBytes += f.size
+
+		var etaSecs int64
+		if elapsed := time.Since(start).Seconds(); copiedBytes > 0 && elapsed > 0 {
+			etaSecs = int64(float64(totalBytes-copiedBytes) / (float64(copiedBytes) / elapsed))
+		}
+		s.broadcast("sync_progress", map[string]interface{}{
+			"target":       t.cfg.Name,
+			"album":        album,
+			"copiedBytes":  copiedBytes,
+			"totalBytes":   totalBytes,
+			"copiedFiles":  i + 1,
+			"totalFiles":   len(todo),
+			"skippedFiles": skipped,
+			"etaSeconds":   etaSecs,
+		})
+	}
+
+	// The album manifest is tiny, so it is simply uploaded on every run
+	if manifest := storage.ManifestPath(filepath.Join(s.basePath, album)); fileExists(manifest) {
+		if err := t.client.Put(path.Join(album, filepath.Base(manifest)), manifest); err != nil {
+			return s.fail(t, album, err)
+		}
+	}
+
+	if len(todo) > 0 {
+		s.log.Info("sync", "Synced album '%s' to '%s': %d uploaded, %d unchanged", album, t.cfg.Name, len(todo), skipped)
+	}
+	s.broadcast("sync_success", map[string]interface{}{
+		"target":       t.cfg.Name,
+		"album":        album,
+		"copiedFiles":  len(todo),
+		"skippedFiles": skipped,
+	})
+	return len(todo), skipped, nil
+}
+
+func (s *Syncer) fail(t *target, album string, err error) (int, int, error) {
+	s.log.Error("sync", "Sync of album '%s' to '%s' failed: %v", album, t.cfg.Name, err)
+	s.broadcast("sync_error", map[string]interface{}{
+		"target":  t.cfg.Name,
+		"album":   album,
+		"message": err.Error(),
+	})
+	return 0, 0, err
+}
+
+func (s *Syncer) broadcast(eventType string, data interface{}) {
+	s.hub.Broadcast <- websocket.Event{
+		Type:      eventType,
+		Data:      data,
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
+
+// redactURL strips any user:password@ part from a URL before it is shown in the UI.
+func redactURL(raw string) string {
+	if i := strings.Index(raw, "://"); i >= 0 {
+		rest := raw[i+3:]
+		if at := strings.Index(rest, "@"); at >= 0 && at < strings.Index(rest+"/", "/") {
+			return raw[:i+3] + rest[at+1:]
+		}
+	}
+	return raw
+}
@@ -0,0 +1,177 @@
+package albumsync
+
+import (
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path"
+	"strings"
+	"time"
+)
+
+// davClient speaks the small subset of WebDAV needed to mirror a folder:
+// PROPFIND (Depth: 1), MKCOL and PUT.
+type davClient struct {
+	base     *url.URL
+	username string
+	password string
+	http     *http.Client
+}
+
+// remoteFile is one entry of a PROPFIND listing.
+type remoteFile struct {
+	Name string
+	Size int64
+}
+
+func newDavClient(rawURL, username, password string) (*davClient, error) {
+	u, err := url.Parse(strings.TrimRight(rawURL, "/"))
+	if err != nil || u.Host == "" {
+		return nil, fmt.Errorf("invalid WebDAV url %q", rawURL)
+	}
+	return &davClient{
+		base:     u,
+		username: username,
+		password: password,
+		http:     &http.Client{Timeout: 10 * time.Minute},
+	}, nil
+}
+
+func (c *davClient) url(rel string) string {
+	u := *c.base
+	u.Path = strings.TrimRight(u.Path, "/") + "/" + strings.TrimLeft(rel, "/")
+	return u.String()
+}
+
+func (c *davClient) do(method, rel string, body io.Reader, headers map[string]string) (*http.Response, error) {
+	req, err := http.NewRequest(method, c.url(rel), body)
+	if err != nil {
+		return nil, err
+	}
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+	for k, v := range headers {
+		req.Header.Set(k, v)
+	}
+	return c.http.Do(req)
+}
+
+type davMultistatus struct {
+	Responses []struct {
+		Href     string `xml:"href"`
+		Propstat []struct {
+			Prop struct {
+				ContentLength int64     `xml:"getcontentlength"`
+				ResourceType  *struct{} `xml:"resourcetype>collection"`
+			} `xml:"prop"`
+		} `xml:"propstat"`
+	} `xml:"response"`
+}
+
+const propfindBody = `<?xml version="1.0" encoding="utf-8"?>
+<d:propfind xmlns:d="DAV:"><d:prop><d:getcontentlength/><d:resourcetype/></d:prop></d:propfind>`
+
+// List returns the files (not collections) directly inside rel.
+// A missing folder is reported as an empty listing.
+func (c *davClient) List(rel string) (map[string]remoteFile, error) {
+	resp, err := c.do("PROPFIND", rel+"/", strings.NewReader(propfindBody), map[string]string{
+		"Depth":        "1",
+		"Content-Type": "application/xml; charset=utf-8",
+	})
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode == http.StatusNotFound {
+		return map[string]remoteFile{}, nil
+	}
+	if resp.StatusCode != http.StatusMultiStatus {
+		return nil, fmt.Errorf("PROPFIND %s: %s", rel, resp.Status)
+	}
+
+	var ms davMultistatus
+	if err := xml.NewDecoder(resp.Body).Decode(&ms); err != nil {
+		return nil, fmt.Errorf("PROPFIND %s: %v", rel, err)
+	}
+
+	files := make(map[string]remoteFile)
+	for _, r := range ms.Responses {
+		isDir := false
+		var size int64
+		for _, ps := range r.Propstat {
+			if ps.Prop.ResourceType != nil {
+				isDir = true
+			}
+			if ps.Prop.ContentLength > 0 {
+				size = ps.Prop.ContentLength
+			}
+		}
+		if isDir {
+			continue
+		}
+		href, err := url.PathUnescape(r.Href)
+		if err != nil {
+			href = r.Href
+		}
+		name := path.Base(strings.TrimRight(href, "/"))
+		files[name] = remoteFile{Name: name, Size: size}
+	}
+	return files, nil
+}
+
+// MkdirAll creates rel and all missing parents.
+func (c *davClient) MkdirAll(rel string) error {
+	parts := strings.Split(strings.Trim(rel, "/"), "/")
+	cur := ""
+	for _, p := range parts {
+		cur += "/" + p
+		resp, err := c.do("MKCOL", cur+"/", nil, nil)
+		if err != nil {
+			return err
+		}
+		resp.Body.Close()
+		// 201 Created, 405 Method Not Allowed = already exists
+		if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusMethodNotAllowed {
+			return fmt.Errorf("MKCOL %s: %s", cur, resp.Status)
+		}
+	}
+	return nil
+}
+
+// Put uploads a local file to rel.
+func (c *davClient) Put(rel, localPath string) error {
+	f, err := os.Open(localPath)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	info, err := f.Stat()
+	if err != nil {
+		return err
+	}
+
+	req, err := http.NewRequest("PUT", c.url(rel), f)
+	if err != nil {
+		return err
+	}
+	req.ContentLength = info.Size()
+	if c.username != "" {
+		req.SetBasicAuth(c.username, c.password)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return err
+	}
+	resp.Body.Close()
+	if resp.StatusCode != http.StatusCreated && resp.StatusCode != http.StatusNoContent && resp.StatusCode != http.StatusOK {
+		return fmt.Errorf("PUT %s: %s", rel, resp.Status)
+	}
+	return nil
+}
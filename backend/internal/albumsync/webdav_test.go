@@ -0,0 +1,169 @@
+package albumsync
+
+import (
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+// davServer is an in-memory WebDAV stand-in that knows PROPFIND (Depth: 1),
+// MKCOL and PUT the way Nextcloud answers them. failPuts makes the next PUTs
+// fail with 503, like a server under maintenance. The target folder /Events
+// exists, as the user created it when setting up the target.
+type davServer struct {
+	*httptest.Server
+
+	mu       sync.Mutex
+	dirs     map[string]bool
+	files    map[string][]byte
+	methods  []string
+	failPuts int
+}
+
+func newDavServer(t *testing.T) *davServer {
+	d := &davServer{dirs: map[string]bool{"/": true, "/Events": true}, files: make(map[string][]byte)}
+	d.Server = httptest.NewServer(http.HandlerFunc(d.serve))
+	t.Cleanup(d.Close)
+	return d
+}
+
+func (d *davServer) serve(w http.ResponseWriter, r *http.Request) {
+	if user, pass, _ := r.BasicAuth(); user != "booth" || pass != "secret" {
+		http.Error(w, "", http.StatusUnauthorized)
+		return
+	}
+	p := path.Clean(r.URL.Path)
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.methods = append(d.methods, r.Method+" "+p)
+
+	switch r.Method {
+	case "PROPFIND":
+		if r.Header.Get("Depth") != "1" {
+			http.Error(w, "", http.StatusBadRequest)
+			return
+		}
+		if !d.dirs[p] {
+			http.NotFound(w, r)
+			return
+		}
+		w.WriteHeader(http.StatusMultiStatus)
+		fmt.Fprint(w, `<?xml version="1.0"?><d:multistatus xmlns:d="DAV:">`)
+		fmt.Fprintf(w, `<d:response><d:href>%s/</d:href><d:propstat><d:prop><d:resourcetype><d:collection/></d:resourcetype></d:prop></d:propstat></d:response>`, (&url.URL{Path: p}).EscapedPath())
+		for name, data := range d.files {
+			if path.Dir(name) == p {
+				fmt.Fprintf(w, `<d:response><d:href>%s</d:href><d:propstat><d:prop><d:getcontentlength>%d</d:getcontentlength><d:resourcetype/></d:prop></d:propstat></d:response>`, (&url.URL{Path: name}).EscapedPath(), len(data))
+			}
+		}
+		fmt.Fprint(w, `</d:multistatus>`)
+	case "MKCOL":
+		switch {
+		case d.dirs[p]:
+			w.WriteHeader(http.StatusMethodNotAllowed)
+		case !d.dirs[path.Dir(p)]:
+			w.WriteHeader(http.StatusConflict)
+		default:
+			d.dirs[p] = true
+			w.WriteHeader(http.StatusCreated)
+		}
+	case "PUT":
+		if d.failPuts > 0 {
+			d.failPuts--
+			http.Error(w, "", http.StatusServiceUnavailable)
+			return
+		}
+		if !d.dirs[path.Dir(p)] {
+			w.WriteHeader(http.StatusConflict)
+			return
+		}
+		data, _ := io.ReadAll(r.Body)
+		d.files[p] = data
+		w.WriteHeader(http.StatusCreated)
+	default:
+		w.WriteHeader(http.StatusMethodNotAllowed)
+	}
+}
+
+// file returns an uploaded file and whether it exists.
+func (d *davServer) file(name string) ([]byte, bool) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	data, ok := d.files[name]
+	return data, ok
+}
+
+func TestDavClient(t *testing.T) {
+	srv := newDavServer(t)
+	c, err := newDavClient(srv.URL+"/Events/", "booth", "secret")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// A folder that does not exist yet lists as empty
+	files, err := c.List("party/original")
+	if err != nil || len(files) != 0 {
+		t.Fatalf("List of missing folder = %v, %v", files, err)
+	}
+
+	if err := c.MkdirAll("party/original"); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.MkdirAll("party/original"); err != nil {
+		t.Errorf("MkdirAll of existing folder: %v", err)
+	}
+
+	local := filepath.Join(t.TempDir(), "IMG 0001.jpg")
+	if err := os.WriteFile(local, []byte("jpeg data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := c.Put("party/original/IMG 0001.jpg", local); err != nil {
+		t.Fatal(err)
+	}
+	if data, _ := srv.file("/Events/party/original/IMG 0001.jpg"); string(data) != "jpeg data" {
+		t.Errorf("uploaded content = %q", data)
+	}
+
+	files, err = c.List("party/original")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(files) != 1 || files["IMG 0001.jpg"].Size != 9 {
+		t.Errorf("List = %+v, want IMG 0001.jpg with 9 bytes", files)
+	}
+	if _, ok := files["original"]; ok {
+		t.Error("the listed folder itself is reported as a file")
+	}
+
+	// Wrong credentials and server errors surface as errors
+	bad, _ := newDavClient(srv.URL+"/Events", "booth", "wrong")
+	if _, err := bad.List("party"); err == nil {
+		t.Error("List with wrong password succeeded")
+	}
+	srv.mu.Lock()
+	srv.failPuts = 1
+	srv.mu.Unlock()
+	if err := c.Put("party/original/IMG 0002.jpg", local); err == nil {
+		t.Error("Put succeeded on 503")
+	}
+
+	srv.mu.Lock()
+	methods := append([]string(nil), srv.methods...)
+	srv.mu.Unlock()
+	for _, m := range []string{"MKCOL", "PROPFIND", "PUT"} {
+		found := false
+		for _, got := range methods {
+			found = found || strings.HasPrefix(got, m+" ")
+		}
+		if !found {
+			t.Errorf("no %s request sent", m)
+		}
+	}
+}
@@ -3,7 +3,10 @@ package api
 import (
 	"context"
 	"encoding/json"
+	"errors"
+	"net"
 	"net/http"
+	"os"
 	"path/filepath"
 	"strconv"
 	"strings"
@@ -11,19 +14,28 @@ import (
 	"time"
 
 	"photobooth/internal/app"
+	"photobooth/internal/archive"
+	"photobooth/internal/captive"
 	"photobooth/internal/config"
 	"photobooth/internal/disk"
+	"photobooth/internal/export"
 	"photobooth/internal/logging"
+	"photobooth/internal/network"
+	"photobooth/internal/storage"
 	"photobooth/internal/websocket"
 )
 
 type Handler struct {
 	app *app.App
 
-	// USB export concurrency guard
-	exportMu     sync.Mutex
-	exportActive bool
-	exportCancel context.CancelFunc
+	// Import job guard
+	importMu     sync.Mutex
+	importActive bool
+	importCancel context.CancelFunc
+
+	// Album verification guard
+	verifyMu     sync.Mutex
+	verifyActive bool
 }
 
 func NewHandler(a *app.App) *Handler {
@@ -33,19 +45,50 @@ func NewHandler(a *app.App) *Handler {
 func (h *Handler) RegisterRoutes(mux *http.ServeMux) {
 	mux.HandleFunc("/api/status", h.handleStatus)
 	mux.HandleFunc("/api/trigger", h.handleTrigger)
+	mux.HandleFunc("/api/cancel", h.handleCancel)
 	mux.HandleFunc("/api/photos", h.handlePhotos)
 	mux.HandleFunc("/api/photos/latest", h.handleLatestPhoto)
+	mux.HandleFunc("/api/photos/delete", h.handlePhotoDelete)
+	mux.HandleFunc("/api/photos/hide", h.handlePhotoHide)
+	mux.HandleFunc("/api/photos/favorite", h.handlePhotoFavorite)
+	mux.HandleFunc("/api/photos/rotate", h.handlePhotoRotate)
 	mux.HandleFunc("/api/logs", h.handleLogs)
 	mux.HandleFunc("/api/settings", h.handleSettings)
 	mux.HandleFunc("/api/legacy/poll", h.handleLegacyPoll)
 	mux.HandleFunc("/api/gallery/count", h.handleGalleryCount)
 	mux.HandleFunc("/api/gallery/empty", h.handleGalleryEmpty)
 	mux.HandleFunc("/api/gallery/delete", h.handleGalleryDelete)
+	mux.HandleFunc("/api/albums/rename", h.handleAlbumRename)
+	mux.HandleFunc("/api/albums/merge", h.handleAlbumMerge)
+	mux.HandleFunc("/api/albums/move", h.handleAlbumMove)
+	mux.HandleFunc("/api/albums/meta", h.handleAlbumMeta)
+	mux.HandleFunc("/api/albums/verify", h.handleAlbumVerify)
+	mux.HandleFunc("/api/albums/", h.handleAlbumDownload) // /api/albums/{id}/download
+	mux.HandleFunc("/api/trash", h.handleTrashList)
+	mux.HandleFunc("/api/trash/restore", h.handleTrashRestore)
+	mux.HandleFunc("/api/trash/purge", h.handleTrashPurge)
 	mux.HandleFunc("/api/usb/devices", h.handleUsbDevices)
 	mux.HandleFunc("/api/usb/export", h.handleUsbExport)
+	mux.HandleFunc("/api/usb/export/jobs", h.handleUsbExportJobs)
 	mux.HandleFunc("/api/usb/export/cancel", h.handleUsbExportCancel)
 	mux.HandleFunc("/api/usb/unmount", h.handleUsbUnmount)
+	mux.HandleFunc("/api/import", h.handleImport)
+	mux.HandleFunc("/api/import/cancel", h.handleImportCancel)
 	mux.HandleFunc("/api/camera/files", h.handleCameraFiles)
+	mux.HandleFunc("/api/share", h.handleShare)
+	mux.HandleFunc("/api/share/revoke", h.handleShareRevoke)
+	mux.HandleFunc("/api/share/email", h.handleEmailSubmit)
+	mux.HandleFunc("/api/share/email/status", h.handleEmailStatus)
+	mux.HandleFunc("/api/share/email/retry", h.handleEmailRetry)
+	mux.HandleFunc("/api/share/email/export", h.handleEmailExport)
+	mux.HandleFunc("/api/upload/album", h.handleUploadAlbum)
+	mux.HandleFunc("/api/sync", h.handleSyncStatus)
+	mux.HandleFunc("/api/sync/run", h.handleSyncRun)
+	mux.HandleFunc("/api/webhooks/test", h.handleWebhookTest)
+	mux.HandleFunc("/api/network", h.handleNetwork)
+	mux.HandleFunc("/api/network/scan", h.handleNetworkScan)
+	mux.HandleFunc("/api/network/saved", h.handleNetworkSaved)
+	mux.HandleFunc("/api/network/reconnect", h.handleNetworkReconnect)
 }
 
 func (h *Handler) handleStatus(w http.ResponseWriter, r *http.Request) {
@@ -63,6 +106,25 @@ func (h *Handler) handleStatus(w http.ResponseWriter, r *http.Request) {
 		"disk":      usage,
 		"lastPhoto": h.app.GetLastPhoto(),
 	}
+	if h.app.Upload != nil {
+		status["upload"] = h.app.Upload.Status()
+	}
+	if h.app.Mirror != nil && h.app.Mirror.Enabled() {
+		status["mirror"] = h.app.Mirror.Status()
+	}
+	if h.app.Policy != nil {
+		status["storage"] = h.app.Policy.Status()
+	}
+	status["export"] = h.app.Export.Status()
+	if h.app.Hooks != nil {
+		status["webhooksPending"] = h.app.Hooks.Pending()
+	}
+	if h.app.Mqtt != nil && h.app.Config.Mqtt.Enabled {
+		status["mqttConnected"] = h.app.Mqtt.Connected()
+	}
+	if h.app.Network != nil {
+		status["network"] = h.app.Network.Status()
+	}
 	jsonResponse(w, status)
 }
 
@@ -90,13 +152,102 @@ func (h *Handler) handleTrigger(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, map[string]string{"status": "triggered"})
 }
 
+func (h *Handler) handleCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if !h.app.Cancel() {
+		http.Error(w, "Nothing to cancel", http.StatusConflict)
+		return
+	}
+	jsonResponse(w, map[string]string{"status": "cancelled"})
+}
+
+// handlePhotos lists photos. Without query parameters it returns the plain array of
+// the current album (legacy clients); with any parameter it returns a ListResult page.
+//
+//	?album=  ?limit=  ?cursor=  ?since=<unix ms|RFC3339>  ?sort=newest|oldest
+//	?favorite=true|false  ?hidden=true|false|all  ?hasRaw=true|false  ?mediaType=jpeg|png|raw
+//
+// Hidden photos are left out unless ?hidden= asks for them.
 func (h *Handler) handlePhotos(w http.ResponseWriter, r *http.Request) {
-	photos, err := h.app.Storage.List()
+	q := r.URL.Query()
+	if len(q) == 0 {
+		photos, err := h.app.Storage.List()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		jsonResponse(w, photos)
+		return
+	}
+
+	opts := storage.ListOptions{
+		Cursor:    q.Get("cursor"),
+		Oldest:    q.Get("sort") == "oldest",
+		MediaType: q.Get("mediaType"),
+		Favorite:  boolParam(q.Get("favorite")),
+		Hidden:    boolParam(q.Get("hidden")),
+		AllHidden: q.Get("hidden") == "all",
+		HasRaw:    boolParam(q.Get("hasRaw")),
+	}
+	if v := q.Get("limit"); v != "" {
+		n, err := strconv.Atoi(v)
+		if err != nil || n < 0 {
+			http.Error(w, "invalid limit", http.StatusBadRequest)
+			return
+		}
+		opts.Limit = n
+	}
+	if v := q.Get("since"); v != "" {
+		if ms, err := strconv.ParseInt(v, 10, 64); err == nil {
+			opts.Since = time.UnixMilli(ms)
+		} else if t, err := time.Parse(time.RFC3339, v); err == nil {
+			opts.Since = t
+		} else {
+			http.Error(w, "invalid since", http.StatusBadRequest)
+			return
+		}
+	}
+
+	album := config.SanitizeAlbumName(h.app.Config.Booth.CurrentAlbum)
+	if v := q.Get("album"); v != "" {
+		album = config.SanitizeAlbumName(v)
+	}
+	albumDir := filepath.Join(h.app.Config.Booth.PhotosBasePath, album)
+	if _, err := os.Stat(albumDir); err != nil {
+		http.Error(w, "Album not found", http.StatusNotFound)
+		return
+	}
+	idx, err := storage.OpenIndex(albumDir)
 	if err != nil {
 		http.Error(w, err.Error(), http.StatusInternalServerError)
 		return
 	}
-	jsonResponse(w, photos)
+	res, err := idx.Query(opts)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+
+	// /photos/ serves the current album; other albums need an explicit ?album=
+	if album != config.SanitizeAlbumName(h.app.Config.Booth.CurrentAlbum) {
+		for i := range res.Photos {
+			res.Photos[i].Url = withQuery(res.Photos[i].Url, "album="+album)
+			res.Photos[i].ThumbUrl = withQuery(res.Photos[i].ThumbUrl, "album="+album)
+		}
+	}
+	jsonResponse(w, res)
+}
+
+// boolParam parses an optional true/false query parameter.
+func boolParam(v string) *bool {
+	b, err := strconv.ParseBool(v)
+	if err != nil {
+		return nil
+	}
+	return &b
 }
 
 func (h *Handler) handleLatestPhoto(w http.ResponseWriter, r *http.Request) {
@@ -108,6 +259,104 @@ func (h *Handler) handleLatestPhoto(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, photo)
 }
 
+// photoParams reads ?album= and ?photo= of a per-photo action. It writes the error
+// response itself and returns ok=false if the request is invalid.
+func (h *Handler) photoParams(w http.ResponseWriter, r *http.Request) (album, filename string, ok bool) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return "", "", false
+	}
+	filename = r.URL.Query().Get("photo")
+	if filename == "" || filename != filepath.Base(filename) || strings.HasPrefix(filename, ".") {
+		http.Error(w, "photo required", http.StatusBadRequest)
+		return "", "", false
+	}
+	album = r.URL.Query().Get("album")
+	if album == "" {
+		album = h.app.Config.Booth.CurrentAlbum
+	}
+	return album, filename, true
+}
+
+// photoError maps storage errors of per-photo actions to HTTP responses.
+func (h *Handler) photoError(w http.ResponseWriter, action, filename string, err error) {
+	if os.IsNotExist(err) {
+		http.Error(w, "Photo not found", http.StatusNotFound)
+		return
+	}
+	if errors.Is(err, storage.ErrNoJpegtran) {
+		http.Error(w, err.Error(), http.StatusNotImplemented)
+		return
+	}
+	h.app.Log.Error("api", "Failed to %s photo %s: %v", action, filename, err)
+	http.Error(w, err.Error(), http.StatusInternalServerError)
+}
+
+func (h *Handler) handlePhotoDelete(w http.ResponseWriter, r *http.Request) {
+	album, filename, ok := h.photoParams(w, r)
+	if !ok {
+		return
+	}
+	if err := h.app.DeletePhoto(album, filename, clientName(r)); err != nil {
+		h.photoError(w, "delete", filename, err)
+		return
+	}
+	jsonResponse(w, map[string]string{"status": "deleted"})
+}
+
+// handlePhotoHide hides a photo from the guest gallery; ?hidden=false shows it again.
+func (h *Handler) handlePhotoHide(w http.ResponseWriter, r *http.Request) {
+	album, filename, ok := h.photoParams(w, r)
+	if !ok {
+		return
+	}
+	hidden := r.URL.Query().Get("hidden") != "false"
+	photo, err := h.app.SetPhotoHidden(album, filename, hidden)
+	if err != nil {
+		h.photoError(w, "hide", filename, err)
+		return
+	}
+	jsonResponse(w, photo)
+}
+
+// handlePhotoFavorite marks a photo as favourite; ?favorite=false removes the mark.
+func (h *Handler) handlePhotoFavorite(w http.ResponseWriter, r *http.Request) {
+	album, filename, ok := h.photoParams(w, r)
+	if !ok {
+		return
+	}
+	favorite := r.URL.Query().Get("favorite") != "false"
+	photo, err := h.app.SetPhotoFavorite(album, filename, favorite)
+	if err != nil {
+		h.photoError(w, "favorite", filename, err)
+		return
+	}
+	jsonResponse(w, photo)
+}
+
+// handlePhotoRotate rotates a photo clockwise by ?degrees=90|180|270 (default 90).
+func (h *Handler) handlePhotoRotate(w http.ResponseWriter, r *http.Request) {
+	album, filename, ok := h.photoParams(w, r)
+	if !ok {
+		return
+	}
+	degrees := 90
+	if v := r.URL.Query().Get("degrees"); v != "" {
+		d, err := strconv.Atoi(v)
+		if err != nil || (d != 90 && d != 180 && d != 270) {
+			http.Error(w, "degrees must be 90, 180 or 270", http.StatusBadRequest)
+			return
+		}
+		degrees = d
+	}
+	photo, err := h.app.RotatePhoto(album, filename, degrees)
+	if err != nil {
+		h.photoError(w, "rotate", filename, err)
+		return
+	}
+	jsonResponse(w, photo)
+}
+
 func (h *Handler) handleLogs(w http.ResponseWriter, r *http.Request) {
 	limitStr := r.URL.Query().Get("limit")
 	limit := 100
@@ -270,7 +519,7 @@ func (h *Handler) handleGalleryEmpty(w http.ResponseWriter, r *http.Request) {
 	if name == "" {
 		name = h.app.Config.Booth.CurrentAlbum
 	}
-	if err := h.app.EmptyGallery(name); err != nil {
+	if err := h.app.EmptyGallery(name, clientName(r)); err != nil {
 		h.app.Log.Error("api", "Failed to empty gallery %s: %v", name, err)
 		http.Error(w, "Failed to empty gallery", http.StatusInternalServerError)
 		return
@@ -288,7 +537,7 @@ func (h *Handler) handleGalleryDelete(w http.ResponseWriter, r *http.Request) {
 		http.Error(w, "Album name required", http.StatusBadRequest)
 		return
 	}
-	if err := h.app.DeleteGallery(name); err != nil {
+	if err := h.app.DeleteGallery(name, clientName(r)); err != nil {
 		h.app.Log.Error("api", "Failed to delete gallery %s: %v", name, err)
 		http.Error(w, err.Error(), http.StatusBadRequest) // e.g. "cannot delete default"
 		return
@@ -296,6 +545,327 @@ func (h *Handler) handleGalleryDelete(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, map[string]string{"status": "deleted"})
 }
 
+// handleAlbumRename renames ?album= to ?name= (display name; the folder follows the sanitized name).
+func (h *Handler) handleAlbumRename(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id, err := h.app.RenameAlbum(r.URL.Query().Get("album"), r.URL.Query().Get("name"))
+	if err != nil {
+		h.app.Log.Error("api", "Failed to rename album: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonResponse(w, map[string]interface{}{"status": "renamed", "id": id, "albums": h.app.ListAlbums()})
+}
+
+// handleAlbumMerge moves all photos of ?album= into ?into= and trashes the empty album.
+func (h *Handler) handleAlbumMerge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	q := r.URL.Query()
+	moved, err := h.app.MergeAlbums(q.Get("album"), q.Get("into"), clientName(r))
+	if err != nil {
+		h.app.Log.Error("api", "Failed to merge album: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonResponse(w, map[string]interface{}{"status": "merged", "moved": moved, "albums": h.app.ListAlbums()})
+}
+
+func (h *Handler) handleAlbumMove(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		From   string   `json:"from"`
+		To     string   `json:"to"`
+		Photos []string `json:"photos"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.From == "" {
+		req.From = h.app.Config.Booth.CurrentAlbum
+	}
+	if req.To == "" || len(req.Photos) == 0 {
+		http.Error(w, "to and photos required", http.StatusBadRequest)
+		return
+	}
+	moved, err := h.app.MovePhotos(req.From, req.To, req.Photos)
+	if err != nil {
+		h.app.Log.Error("api", "Failed to move photos: %v", err)
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonResponse(w, map[string]interface{}{"status": "moved", "moved": moved})
+}
+
+// handleAlbumMeta reads (GET) or replaces (POST) the manifest of ?album=.
+func (h *Handler) handleAlbumMeta(w http.ResponseWriter, r *http.Request) {
+	album := r.URL.Query().Get("album")
+	if album == "" {
+		album = h.app.Config.Booth.CurrentAlbum
+	}
+
+	switch r.Method {
+	case "GET":
+		m, err := h.app.GetAlbumManifest(album)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusNotFound)
+			return
+		}
+		jsonResponse(w, m)
+	case "POST":
+		var m storage.Manifest
+		if err := json.NewDecoder(r.Body).Decode(&m); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		if err := h.app.SetAlbumManifest(album, &m); err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		jsonResponse(w, m)
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+// handleAlbumVerify starts an integrity check of an album (?album=, default current).
+// Progress and the report are sent over the websocket; the report is also stored
+// in the album manifest.
+func (h *Handler) handleAlbumVerify(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	album := r.URL.Query().Get("album")
+	if album == "" {
+		album = h.app.Config.Booth.CurrentAlbum
+	}
+	sanitizedAlbum := config.SanitizeAlbumName(album)
+	if !fileExists(filepath.Join(h.app.Config.Booth.PhotosBasePath, sanitizedAlbum)) {
+		http.Error(w, "Album not found", http.StatusNotFound)
+		return
+	}
+
+	h.verifyMu.Lock()
+	if h.verifyActive {
+		h.verifyMu.Unlock()
+		http.Error(w, "A verification is already running", http.StatusConflict)
+		return
+	}
+	h.verifyActive = true
+	h.verifyMu.Unlock()
+
+	go func() {
+		defer func() {
+			h.verifyMu.Lock()
+			h.verifyActive = false
+			h.verifyMu.Unlock()
+		}()
+
+		h.app.Log.Info("storage", "Verifying album '%s'...", sanitizedAlbum)
+		h.app.Hub.Broadcast <- websocket.Event{
+			Type:      "verify_start",
+			Data:      map[string]string{"album": sanitizedAlbum},
+			Timestamp: time.Now().UnixMilli(),
+		}
+
+		lastSent := time.Time{}
+		report, err := h.app.VerifyAlbum(context.Background(), sanitizedAlbum, func(checked, total int) {
+			// Small files verify quickly; do not flood the websocket
+			if checked < total && time.Since(lastSent) < 250*time.Millisecond {
+				return
+			}
+			lastSent = time.Now()
+			h.app.Hub.Broadcast <- websocket.Event{
+				Type:      "verify_progress",
+				Data:      map[string]interface{}{"album": sanitizedAlbum, "checkedFiles": checked, "totalFiles": total},
+				Timestamp: time.Now().UnixMilli(),
+			}
+		})
+		if err != nil {
+			h.app.Log.Error("storage", "Verification of album '%s' failed: %v", sanitizedAlbum, err)
+			h.app.Hub.Broadcast <- websocket.Event{Type: "verify_error", Data: map[string]string{"album": sanitizedAlbum, "message": err.Error()}, Timestamp: time.Now().UnixMilli()}
+			return
+		}
+		h.app.Hub.Broadcast <- websocket.Event{
+			Type:      "verify_done",
+			Data:      map[string]interface{}{"album": sanitizedAlbum, "report": report},
+			Timestamp: time.Now().UnixMilli(),
+		}
+	}()
+
+	jsonResponse(w, map[string]string{"status": "verify_started"})
+}
+
+// handleAlbumDownload streams an album as ZIP: GET /api/albums/{id}/download
+// ?include=originals,previews,raw,composites (default: originals). Range requests
+// are supported, so browsers and download managers can resume.
+func (h *Handler) handleAlbumDownload(w http.ResponseWriter, r *http.Request) {
+	id, action, _ := strings.Cut(strings.TrimPrefix(r.URL.Path, "/api/albums/"), "/")
+	if id == "" || action != "download" {
+		http.NotFound(w, r)
+		return
+	}
+	if r.Method != "GET" && r.Method != "HEAD" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
+	var include []string
+	if v := r.URL.Query().Get("include"); v != "" {
+		include = strings.Split(v, ",")
+	}
+	zip, albumId, err := h.app.AlbumArchive(id, include)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	defer zip.Close()
+
+	w.Header().Set("Content-Type", "application/zip")
+	w.Header().Set("Content-Disposition", `attachment; filename="`+albumId+`.zip"`)
+	w.Header().Set("ETag", zip.ETag())
+
+	if r.Method == "HEAD" {
+		http.ServeContent(w, r, albumId+".zip", time.Time{}, zip)
+		return
+	}
+
+	client := clientName(r)
+	p := &downloadProgress{Zip: zip, hub: h.app.Hub, album: albumId, client: client, start: time.Now()}
+	h.app.Hub.Broadcast <- websocket.Event{
+		Type:      "album_download_start",
+		Data:      map[string]interface{}{"album": albumId, "client": client, "totalBytes": zip.Size()},
+		Timestamp: time.Now().UnixMilli(),
+	}
+
+	http.ServeContent(w, r, albumId+".zip", time.Time{}, p)
+
+	h.app.Log.Info("api", "Album '%s' download by %s ended (%d bytes sent)", albumId, client, p.sent)
+	h.app.Hub.Broadcast <- websocket.Event{
+		Type:      "album_download_done",
+		Data:      map[string]interface{}{"album": albumId, "client": client, "sentBytes": p.sent, "complete": p.complete()},
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+// downloadProgress reports streaming progress of an album ZIP at most once per second.
+type downloadProgress struct {
+	*archive.Zip
+	hub    *websocket.Hub
+	album  string
+	client string
+	start  time.Time
+	from   int64 // where the current read started
+	pos    int64
+	sent   int64
+	last   time.Time
+}
+
+func (p *downloadProgress) Seek(offset int64, whence int) (int64, error) {
+	pos, err := p.Zip.Seek(offset, whence)
+	p.pos, p.from = pos, pos
+	return pos, err
+}
+
+// complete reports whether the whole archive went out in one piece, not just a
+// range that happens to end at EOF (a resumed download or a tail probe).
+func (p *downloadProgress) complete() bool {
+	size := p.Zip.Size()
+	return p.from == 0 && p.pos == size && p.sent == size
+}
+
+func (p *downloadProgress) Read(b []byte) (int, error) {
+	n, err := p.Zip.Read(b)
+	p.pos += int64(n)
+	p.sent += int64(n)
+
+	if time.Since(p.last) >= time.Second {
+		p.last = time.Now()
+		total := p.Zip.Size()
+		var etaSecs int64
+		if elapsed := time.Since(p.start).Seconds(); p.sent > 0 && elapsed > 0 {
+			etaSecs = int64(float64(total-p.pos) / (float64(p.sent) / elapsed))
+		}
+		p.hub.Broadcast <- websocket.Event{
+			Type: "album_download_progress",
+			Data: map[string]interface{}{
+				"album":       p.album,
+				"client":      p.client,
+				"copiedBytes": p.pos,
+				"totalBytes":  total,
+				"etaSeconds":  etaSecs,
+			},
+			Timestamp: time.Now().UnixMilli(),
+		}
+	}
+	return n, err
+}
+
+func (h *Handler) handleTrashList(w http.ResponseWriter, r *http.Request) {
+	items, err := h.app.Trash.List()
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, items)
+}
+
+func (h *Handler) handleTrashRestore(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	item, err := h.app.RestoreTrash(r.URL.Query().Get("id"))
+	if os.IsNotExist(err) {
+		http.Error(w, "Trash item not found", http.StatusNotFound)
+		return
+	}
+	if err != nil {
+		h.app.Log.Error("api", "Failed to restore trash item: %v", err)
+		http.Error(w, err.Error(), http.StatusConflict) // e.g. "album already exists"
+		return
+	}
+	jsonResponse(w, item)
+}
+
+// handleTrashPurge deletes one item (?id=) for good, or the whole trash without an id.
+func (h *Handler) handleTrashPurge(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	id := r.URL.Query().Get("id")
+	if id == "" {
+		n, err := h.app.Trash.PurgeAll()
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.app.Log.Info("trash", "Trash emptied by %s (%d items)", clientName(r), n)
+		jsonResponse(w, map[string]interface{}{"status": "purged", "items": n})
+		return
+	}
+	if err := h.app.Trash.Purge(id); err != nil {
+		if os.IsNotExist(err) {
+			http.Error(w, "Trash item not found", http.StatusNotFound)
+			return
+		}
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, map[string]interface{}{"status": "purged", "items": 1})
+}
+
 func (h *Handler) handleUsbDevices(w http.ResponseWriter, r *http.Request) {
 	devices, err := disk.GetUsbDevices()
 	if err != nil {
@@ -306,11 +876,16 @@ func (h *Handler) handleUsbDevices(w http.ResponseWriter, r *http.Request) {
 
 	// Auto-mount any unmounted USB devices only if requested via ?mount=true
 	if r.URL.Query().Get("mount") == "true" {
+		failed := make(map[string]*disk.UsbError)
 		for _, d := range devices {
-			if d.MountPoint == "" {
-				h.app.Log.Info("usb", "Auto-mounting %s...", d.Name)
+			if d.MountPoint == "" && d.Problem != disk.ProblemNoFilesystem && d.Problem != disk.ProblemUnsupportedFs {
+				h.app.Log.Info("usb", "Auto-mounting %s (%s)...", d.Name, d.FsType)
 				if _, err := disk.MountUsb(d.Name); err != nil {
 					h.app.Log.Warn("usb", "Auto-mount of %s failed: %v", d.Name, err)
+					var ue *disk.UsbError
+					if errors.As(err, &ue) {
+						failed[d.Name] = ue
+					}
 				}
 			}
 		}
@@ -321,89 +896,199 @@ func (h *Handler) handleUsbDevices(w http.ResponseWriter, r *http.Request) {
 			http.Error(w, err.Error(), http.StatusInternalServerError)
 			return
 		}
+		for i := range devices {
+			if ue := failed[devices[i].Name]; ue != nil {
+				devices[i].Problem, devices[i].Detail = ue.Problem, ue.Detail
+			}
+		}
 	}
 	jsonResponse(w, devices)
 }
 
+// handleUsbExport queues an export job: {deviceName, albumName} or {deviceName,
+// albums: [...], contents: [...], format, nameTemplate, slideshow}. Contents default
+// to originals, RAWs and manifest; format, template and slideshow to the config.
 func (h *Handler) handleUsbExport(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
 
+	var req struct {
+		DeviceName   string   `json:"deviceName"`
+		AlbumName    string   `json:"albumName"`
+		Albums       []string `json:"albums"`
+		Contents     []string `json:"contents"`
+		Format       string   `json:"format"`
+		NameTemplate *string  `json:"nameTemplate"`
+		Slideshow    *bool    `json:"slideshow"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	albums := req.Albums
+	if req.AlbumName != "" {
+		albums = append([]string{req.AlbumName}, albums...)
+	}
+	if req.DeviceName == "" || len(albums) == 0 {
+		http.Error(w, "deviceName and albumName or albums required", http.StatusBadRequest)
+		return
+	}
+
+	status := "export_started"
+	if h.app.Export.Busy("") {
+		status = "export_queued" // runs after the current job
+	}
+	exp := export.Request{
+		Device:       req.DeviceName,
+		Albums:       albums,
+		Contents:     req.Contents,
+		Format:       req.Format,
+		NameTemplate: h.app.Config.Usb.NameTemplate,
+		Slideshow:    h.app.Config.Usb.Slideshow,
+	}
+	if exp.Format == "" {
+		exp.Format = h.app.Config.Usb.Format
+	}
+	if req.NameTemplate != nil {
+		exp.NameTemplate = *req.NameTemplate
+	}
+	if req.Slideshow != nil {
+		exp.Slideshow = *req.Slideshow
+	}
+	job, err := h.app.Export.Submit(exp)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonResponse(w, map[string]interface{}{"status": status, "job": job})
+}
+
+// handleUsbExportJobs lists queued, running and finished export jobs, newest first.
+func (h *Handler) handleUsbExportJobs(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "GET" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	jsonResponse(w, h.app.Export.Jobs())
+}
+
+// handleUsbExportCancel cancels the job with the given id ({id}), or the running
+// job if no id is sent.
+func (h *Handler) handleUsbExportCancel(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	var req struct {
+		ID string `json:"id"`
+	}
+	if r.ContentLength > 0 {
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+	}
+	if !h.app.Export.Cancel(req.ID) {
+		http.Error(w, "No active export", http.StatusConflict)
+		return
+	}
+	jsonResponse(w, map[string]string{"status": "cancelling"})
+}
+
+// handleImport copies photos from a USB device (deviceName, optionally a sub folder
+// in path) or a local folder (absolute path) into an album.
+func (h *Handler) handleImport(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+
 	var req struct {
 		DeviceName string `json:"deviceName"`
+		Path       string `json:"path"`
 		AlbumName  string `json:"albumName"`
 	}
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
 		http.Error(w, "Invalid request body", http.StatusBadRequest)
 		return
 	}
-	if req.DeviceName == "" || req.AlbumName == "" {
-		http.Error(w, "deviceName and albumName required", http.StatusBadRequest)
+	if req.DeviceName == "" && !filepath.IsAbs(req.Path) {
+		http.Error(w, "deviceName or an absolute path required", http.StatusBadRequest)
 		return
 	}
+	if req.AlbumName == "" {
+		req.AlbumName = h.app.Config.Booth.CurrentAlbum
+	}
+	sanitizedAlbum := config.SanitizeAlbumName(req.AlbumName)
+	albumDir := filepath.Join(h.app.Config.Booth.PhotosBasePath, sanitizedAlbum)
+
+	// Importing from inside the photo store would feed on its own output
+	if req.DeviceName == "" {
+		base, _ := filepath.Abs(h.app.Config.Booth.PhotosBasePath)
+		if rel, err := filepath.Rel(base, filepath.Clean(req.Path)); err == nil && !strings.HasPrefix(rel, "..") {
+			http.Error(w, "Cannot import from the photo folder itself", http.StatusBadRequest)
+			return
+		}
+	}
 
-	// --- Concurrency guard: only one export at a time ---
-	h.exportMu.Lock()
-	if h.exportActive {
-		h.exportMu.Unlock()
-		http.Error(w, "An export is already running", http.StatusConflict)
+	h.importMu.Lock()
+	if h.importActive {
+		h.importMu.Unlock()
+		http.Error(w, "An import is already running", http.StatusConflict)
 		return
 	}
 	ctx, cancel := context.WithCancel(context.Background())
-	h.exportActive = true
-	h.exportCancel = cancel
-	h.exportMu.Unlock()
-
-	sanitizedAlbum := config.SanitizeAlbumName(req.AlbumName)
-	// Only copy the original folder
-	srcDir := filepath.Join(h.app.Config.Booth.PhotosBasePath, sanitizedAlbum, "original")
+	h.importActive = true
+	h.importCancel = cancel
+	h.importMu.Unlock()
 
 	go func() {
 		defer func() {
-			h.exportMu.Lock()
-			h.exportActive = false
-			h.exportCancel = nil
-			h.exportMu.Unlock()
-			cancel() // always release resources
+			h.importMu.Lock()
+			h.importActive = false
+			h.importCancel = nil
+			h.importMu.Unlock()
+			cancel()
 		}()
 
-		h.app.Log.Info("usb", "Starting export of album '%s' (original only) to USB device '%s'...", req.AlbumName, req.DeviceName)
-		h.app.Hub.Broadcast <- websocket.Event{
-			Type:      "usb_export_start",
-			Data:      map[string]string{"album": req.AlbumName},
-			Timestamp: time.Now().UnixMilli(),
+		fail := func(msg string) {
+			h.app.Hub.Broadcast <- websocket.Event{Type: "import_error", Data: map[string]string{"album": sanitizedAlbum, "message": msg}, Timestamp: time.Now().UnixMilli()}
 		}
 
-		// 1. Mount device
-		mountPoint, err := disk.MountUsb(req.DeviceName)
-		if err != nil {
-			h.app.Log.Error("usb", "Failed to mount device %s: %v", req.DeviceName, err)
-			h.app.Hub.Broadcast <- websocket.Event{Type: "usb_export_error", Data: map[string]string{"message": "Mount failed: " + err.Error()}, Timestamp: time.Now().UnixMilli()}
+		srcDir := filepath.Clean(req.Path)
+		if req.DeviceName != "" {
+			mountPoint, err := disk.MountUsb(req.DeviceName)
+			if err != nil {
+				h.app.Log.Error("import", "Failed to mount device %s: %v", req.DeviceName, err)
+				h.app.Hub.Broadcast <- websocket.Event{Type: "import_error", Data: map[string]string{"album": sanitizedAlbum, "message": "Mount failed: " + err.Error(), "code": disk.ProblemOf(err)}, Timestamp: time.Now().UnixMilli()}
+				return
+			}
+			srcDir = filepath.Join(mountPoint, filepath.Clean("/"+req.Path))
+		}
+		if info, err := os.Stat(srcDir); err != nil || !info.IsDir() {
+			fail("Source folder not found")
 			return
 		}
 
-		// 2. Destination
-		dstDir := filepath.Join(mountPoint, "Photobooth_Export", req.AlbumName)
+		h.app.Log.Info("import", "Importing photos from '%s' into album '%s'...", srcDir, sanitizedAlbum)
+		h.app.Hub.Broadcast <- websocket.Event{
+			Type:      "import_start",
+			Data:      map[string]string{"album": sanitizedAlbum, "source": srcDir},
+			Timestamp: time.Now().UnixMilli(),
+		}
 
-		// Track start time for ETA
 		startTime := time.Now()
-
-		// 3. Copy just the original folder with progress
-		err = disk.CopyDirWithProgress(ctx, srcDir, dstDir, func(copiedBytes, totalBytes, copiedFiles, totalFiles int64) {
+		res, err := h.app.ImportPhotos(ctx, albumDir, srcDir, func(copiedBytes, totalBytes, copiedFiles, totalFiles int64) {
 			var etaSecs int64
-			if copiedBytes > 0 && totalBytes > 0 {
-				elapsed := time.Since(startTime).Seconds()
-				bytesPerSec := float64(copiedBytes) / elapsed
-				if bytesPerSec > 0 {
-					etaSecs = int64(float64(totalBytes-copiedBytes) / bytesPerSec)
-				}
+			if elapsed := time.Since(startTime).Seconds(); copiedBytes > 0 && elapsed > 0 {
+				etaSecs = int64(float64(totalBytes-copiedBytes) / (float64(copiedBytes) / elapsed))
 			}
 			h.app.Hub.Broadcast <- websocket.Event{
-				Type: "usb_export_progress",
+				Type: "import_progress",
 				Data: map[string]interface{}{
-					"album":       req.AlbumName,
+					"album":       sanitizedAlbum,
 					"copiedBytes": copiedBytes,
 					"totalBytes":  totalBytes,
 					"copiedFiles": copiedFiles,
@@ -415,42 +1100,39 @@ func (h *Handler) handleUsbExport(w http.ResponseWriter, r *http.Request) {
 		})
 
 		if err != nil {
-			msg := "Copy failed"
+			msg := "Import failed"
 			if ctx.Err() != nil {
-				msg = "Export cancelled"
-				h.app.Log.Info("usb", "Export of album '%s' was cancelled.", req.AlbumName)
+				msg = "Import cancelled"
+				h.app.Log.Info("import", "Import into '%s' was cancelled after %d photos.", sanitizedAlbum, res.Imported)
 			} else {
-				h.app.Log.Error("usb", "Failed to copy files to USB: %v", err)
+				h.app.Log.Error("import", "Import into '%s' failed: %v", sanitizedAlbum, err)
 			}
-			h.app.Hub.Broadcast <- websocket.Event{Type: "usb_export_error", Data: map[string]string{"message": msg}, Timestamp: time.Now().UnixMilli()}
+			fail(msg)
 			return
 		}
 
-		// 4. Sync + do NOT auto-unmount – let the user press "Safely Remove"
-		// Just flush buffers
-		h.app.Log.Info("usb", "Export done. Flushing buffers...")
+		h.app.Log.Info("import", "Import into '%s' done: %d imported, %d duplicates skipped, %d failed", sanitizedAlbum, res.Imported, res.Duplicates, res.Failed)
 		h.app.Hub.Broadcast <- websocket.Event{
-			Type:      "usb_export_success",
-			Data:      map[string]interface{}{"album": req.AlbumName, "path": dstDir},
+			Type:      "import_success",
+			Data:      map[string]interface{}{"album": sanitizedAlbum, "imported": res.Imported, "duplicates": res.Duplicates, "failed": res.Failed},
 			Timestamp: time.Now().UnixMilli(),
 		}
 	}()
 
-	jsonResponse(w, map[string]string{"status": "export_started"})
+	jsonResponse(w, map[string]string{"status": "import_started"})
 }
 
-func (h *Handler) handleUsbExportCancel(w http.ResponseWriter, r *http.Request) {
+func (h *Handler) handleImportCancel(w http.ResponseWriter, r *http.Request) {
 	if r.Method != "POST" {
 		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		return
 	}
-	h.exportMu.Lock()
-	active := h.exportActive
-	cancel := h.exportCancel
-	h.exportMu.Unlock()
+	h.importMu.Lock()
+	cancel := h.importCancel
+	h.importMu.Unlock()
 
-	if !active || cancel == nil {
-		http.Error(w, "No active export", http.StatusConflict)
+	if cancel == nil {
+		http.Error(w, "No active import", http.StatusConflict)
 		return
 	}
 	cancel()
@@ -472,10 +1154,7 @@ func (h *Handler) handleUsbUnmount(w http.ResponseWriter, r *http.Request) {
 	}
 
 	// Prevent unmounting a device that's being exported to
-	h.exportMu.Lock()
-	active := h.exportActive
-	h.exportMu.Unlock()
-	if active {
+	if h.app.Export.Busy(req.DeviceName) {
 		http.Error(w, "Cannot unmount while export is running", http.StatusConflict)
 		return
 	}
@@ -507,6 +1186,448 @@ func (h *Handler) handleUsbUnmount(w http.ResponseWriter, r *http.Request) {
 	jsonResponse(w, map[string]string{"status": "unmounted"})
 }
 
+// handleShare creates (or returns) the share link of ?photo= in ?album=. POST
+// only, since the link is stored for good.
+func (h *Handler) handleShare(w http.ResponseWriter, r *http.Request) {
+	if h.app.Share == nil || !h.app.Share.Enabled() {
+		http.Error(w, "Sharing is disabled", http.StatusNotFound)
+		return
+	}
+	album, filename, ok := h.photoParams(w, r)
+	if !ok {
+		return
+	}
+	link, err := h.app.SharePhoto(album, filename)
+	if err != nil {
+		h.photoError(w, "share", filename, err)
+		return
+	}
+	jsonResponse(w, map[string]string{
+		"token": link.Token,
+		"url":   h.app.Share.URL(link.Token),
+		"qrUrl": "/p/" + link.Token + "/qr.png",
+	})
+}
+
+func (h *Handler) handleShareRevoke(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.app.Share == nil {
+		http.Error(w, "Sharing is disabled", http.StatusNotFound)
+		return
+	}
+	album := r.URL.Query().Get("album")
+	if album == "" {
+		http.Error(w, "Album name required", http.StatusBadRequest)
+		return
+	}
+	removed, err := h.app.Share.RevokeAlbum(config.SanitizeAlbumName(album))
+	if err != nil {
+		h.app.Log.Error("share", "Failed to revoke share links for %s: %v", album, err)
+		http.Error(w, "Failed to revoke share links", http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, map[string]interface{}{"status": "revoked", "count": removed})
+}
+
+func (h *Handler) handleEmailSubmit(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.app.Email == nil || !h.app.Email.Enabled() {
+		http.Error(w, "Email delivery is disabled", http.StatusNotFound)
+		return
+	}
+
+	var req struct {
+		Album string `json:"album"`
+		Photo string `json:"photo"`
+		Email string `json:"email"`
+	}
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		http.Error(w, "Invalid request body", http.StatusBadRequest)
+		return
+	}
+	if req.Album == "" {
+		req.Album = h.app.Config.Booth.CurrentAlbum
+	}
+
+	msg, err := h.app.Email.Submit(config.SanitizeAlbumName(req.Album), req.Photo, req.Email)
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusBadRequest)
+		return
+	}
+	jsonResponse(w, msg)
+}
+
+func (h *Handler) handleEmailStatus(w http.ResponseWriter, r *http.Request) {
+	if h.app.Email == nil {
+		http.Error(w, "Email delivery is disabled", http.StatusNotFound)
+		return
+	}
+	album := r.URL.Query().Get("album")
+	if album == "" {
+		album = h.app.Config.Booth.CurrentAlbum
+	}
+	jsonResponse(w, h.app.Email.Status(config.SanitizeAlbumName(album)))
+}
+
+func (h *Handler) handleEmailRetry(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.app.Email == nil {
+		http.Error(w, "Email delivery is disabled", http.StatusNotFound)
+		return
+	}
+	album := r.URL.Query().Get("album")
+	if album == "" {
+		album = h.app.Config.Booth.CurrentAlbum
+	}
+	n, err := h.app.Email.Retry(config.SanitizeAlbumName(album))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, map[string]interface{}{"status": "requeued", "count": n})
+}
+
+func (h *Handler) handleEmailExport(w http.ResponseWriter, r *http.Request) {
+	if h.app.Email == nil {
+		http.Error(w, "Email delivery is disabled", http.StatusNotFound)
+		return
+	}
+	album := r.URL.Query().Get("album")
+	if album == "" {
+		album = h.app.Config.Booth.CurrentAlbum
+	}
+	sanitized := config.SanitizeAlbumName(album)
+
+	w.Header().Set("Content-Type", "text/csv; charset=utf-8")
+	w.Header().Set("Content-Disposition", `attachment; filename="outbox_`+sanitized+`.csv"`)
+	if err := h.app.Email.ExportCSV(sanitized, w); err != nil {
+		h.app.Log.Error("email", "CSV export failed: %v", err)
+	}
+}
+
+func (h *Handler) handleUploadAlbum(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.app.Upload == nil || !h.app.Upload.Enabled() {
+		http.Error(w, "Upload is disabled", http.StatusNotFound)
+		return
+	}
+	album := r.URL.Query().Get("album")
+	if album == "" {
+		album = h.app.Config.Booth.CurrentAlbum
+	}
+	n, err := h.app.Upload.EnqueueAlbum(config.SanitizeAlbumName(album))
+	if err != nil {
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, map[string]interface{}{"status": "queued", "count": n})
+}
+
+func (h *Handler) handleSyncStatus(w http.ResponseWriter, r *http.Request) {
+	if h.app.Sync == nil {
+		jsonResponse(w, []interface{}{})
+		return
+	}
+	jsonResponse(w, h.app.Sync.Status())
+}
+
+func (h *Handler) handleSyncRun(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.app.Sync == nil {
+		http.Error(w, "No sync targets configured", http.StatusNotFound)
+		return
+	}
+	album := r.URL.Query().Get("album")
+	if album == "" {
+		album = h.app.Config.Booth.CurrentAlbum
+	}
+	if err := h.app.Sync.Run(r.URL.Query().Get("target"), config.SanitizeAlbumName(album)); err != nil {
+		http.Error(w, err.Error(), http.StatusNotFound)
+		return
+	}
+	jsonResponse(w, map[string]string{"status": "sync_started"})
+}
+
+func (h *Handler) handleWebhookTest(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.app.Hooks == nil {
+		http.Error(w, "No webhooks configured", http.StatusNotFound)
+		return
+	}
+	jsonResponse(w, h.app.Hooks.Test(r.URL.Query().Get("name")))
+}
+
+// handleNetwork shows (GET) or changes (POST) the WiFi settings. Changed hotspot
+// settings are applied right away; unless a device connects to the restarted
+// hotspot within rollbackSeconds (default 60) the old ones come back.
+func (h *Handler) handleNetwork(w http.ResponseWriter, r *http.Request) {
+	if h.app.Network == nil {
+		http.Error(w, "WiFi is not managed", http.StatusNotFound)
+		return
+	}
+	switch r.Method {
+	case "GET":
+		cfg := h.app.Network.Config()
+		stations, err := h.app.Network.Stations()
+		if err != nil {
+			h.app.Log.Debug("network", "Failed to list hotspot clients: %v", err)
+			stations = []network.Station{}
+		}
+		leases, err := h.app.Network.Leases()
+		if err != nil {
+			h.app.Log.Debug("network", "Failed to read DHCP leases: %v", err)
+		}
+		portalClients := []captive.Client{}
+		if h.app.Portal != nil {
+			portalClients = h.app.Portal.Accepted()
+		}
+		jsonResponse(w, map[string]interface{}{
+			"config": map[string]interface{}{
+				"ssid":           cfg.Ssid,
+				"hasPassword":    cfg.Password != "",
+				"band":           cfg.Band,
+				"channel":        cfg.Channel,
+				"interface":      cfg.Interface,
+				"ipAddress":      cfg.IpAddress,
+				"dhcpRangeStart": cfg.DhcpRangeStart,
+				"dhcpRangeEnd":   cfg.DhcpRangeEnd,
+				"captivePortal":  cfg.CaptivePortal,
+				"portalLanding":  cfg.PortalLanding,
+				"mode":           cfg.Mode,
+			},
+			"status":   h.app.Network.Status(),
+			"stations": stations,
+			"leases":   leases,
+			"portal":   portalClients,
+		})
+	case "POST":
+		var req struct {
+			Ssid            *string `json:"ssid"`
+			Password        *string `json:"password"` // "" makes the hotspot open
+			Band            *string `json:"band"`
+			Channel         *int    `json:"channel"`
+			IpAddress       *string `json:"ipAddress"`
+			DhcpRangeStart  *string `json:"dhcpRangeStart"`
+			DhcpRangeEnd    *string `json:"dhcpRangeEnd"`
+			CaptivePortal   *bool   `json:"captivePortal"`
+			PortalLanding   *string `json:"portalLanding"`
+			Mode            *string `json:"mode"`
+			RollbackSeconds *int    `json:"rollbackSeconds"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+
+		cfg := h.app.Network.Config()
+		if req.Ssid != nil {
+			cfg.Ssid = strings.TrimSpace(*req.Ssid)
+		}
+		if req.Password != nil {
+			cfg.Password = *req.Password
+		}
+		if req.Band != nil {
+			cfg.Band = *req.Band
+		}
+		if req.Channel != nil {
+			cfg.Channel = *req.Channel
+		}
+		if req.IpAddress != nil && *req.IpAddress != cfg.IpAddress {
+			cfg.IpAddress = strings.TrimSpace(*req.IpAddress)
+			// A new address needs a DHCP range in its network
+			cfg.DhcpRangeStart, cfg.DhcpRangeEnd = network.DhcpRange(cfg.IpAddress)
+		}
+		if req.DhcpRangeStart != nil {
+			cfg.DhcpRangeStart = *req.DhcpRangeStart
+		}
+		if req.DhcpRangeEnd != nil {
+			cfg.DhcpRangeEnd = *req.DhcpRangeEnd
+		}
+		if req.CaptivePortal != nil {
+			cfg.CaptivePortal = *req.CaptivePortal
+		}
+		if req.PortalLanding != nil {
+			cfg.PortalLanding = *req.PortalLanding
+		}
+		if req.Mode != nil {
+			cfg.Mode = *req.Mode
+		}
+		rollback := 60 * time.Second
+		if req.RollbackSeconds != nil {
+			if *req.RollbackSeconds < 0 || *req.RollbackSeconds > 600 {
+				http.Error(w, "rollbackSeconds must be between 0 and 600", http.StatusBadRequest)
+				return
+			}
+			rollback = time.Duration(*req.RollbackSeconds) * time.Second
+		}
+
+		err := h.app.Network.Apply(cfg, rollback, func(committed config.WifiConfig) {
+			wifi := h.app.Config.Wifi
+			committed.Enabled, committed.Networks = wifi.Enabled, wifi.Networks
+			h.app.Config.UpdateWifi(committed)
+			if err := h.app.Config.Save(); err != nil {
+				h.app.Log.Error("network", "Failed to save WiFi settings: %v", err)
+			}
+		})
+		if errors.Is(err, network.ErrApplyPending) {
+			http.Error(w, err.Error(), http.StatusConflict)
+			return
+		}
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusBadRequest)
+			return
+		}
+		st := h.app.Network.Status()
+		if st.RollbackAt != nil {
+			jsonResponse(w, map[string]interface{}{"status": "applying", "rollbackAt": st.RollbackAt})
+			return
+		}
+		jsonResponse(w, map[string]string{"status": "saved"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) handleNetworkScan(w http.ResponseWriter, r *http.Request) {
+	if h.app.Network == nil {
+		http.Error(w, "WiFi is not managed", http.StatusNotFound)
+		return
+	}
+	aps, err := h.app.Network.Scan()
+	if err != nil {
+		h.app.Log.Warn("network", "WiFi scan failed: %v", err)
+		http.Error(w, err.Error(), http.StatusInternalServerError)
+		return
+	}
+	jsonResponse(w, aps)
+}
+
+// savedNetwork is a saved network as the API shows it; passwords are never sent
+// back. On POST a missing password keeps the one already saved for the SSID.
+type savedNetwork struct {
+	Ssid        string  `json:"ssid"`
+	Password    *string `json:"password,omitempty"`
+	Hidden      bool    `json:"hidden"`
+	HasPassword bool    `json:"hasPassword"`
+}
+
+// handleNetworkSaved lists (GET) or replaces (POST {networks: [...]}) the venue
+// networks used in client and auto mode, in the order they are tried.
+func (h *Handler) handleNetworkSaved(w http.ResponseWriter, r *http.Request) {
+	if h.app.Network == nil {
+		http.Error(w, "WiFi is not managed", http.StatusNotFound)
+		return
+	}
+	wifi := h.app.Config.Wifi
+	switch r.Method {
+	case "GET":
+		list := make([]savedNetwork, 0, len(wifi.Networks))
+		for _, n := range wifi.Networks {
+			list = append(list, savedNetwork{Ssid: n.Ssid, Hidden: n.Hidden, HasPassword: n.Password != ""})
+		}
+		jsonResponse(w, list)
+	case "POST":
+		var req struct {
+			Networks []savedNetwork `json:"networks"`
+		}
+		if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+			http.Error(w, "Invalid request body", http.StatusBadRequest)
+			return
+		}
+		old := make(map[string]string, len(wifi.Networks))
+		for _, n := range wifi.Networks {
+			old[n.Ssid] = n.Password
+		}
+		seen := make(map[string]bool)
+		networks := make([]config.WifiNetwork, 0, len(req.Networks))
+		for _, n := range req.Networks {
+			if n.Ssid == "" || len(n.Ssid) > 32 || seen[n.Ssid] {
+				http.Error(w, "Invalid or duplicate SSID: "+n.Ssid, http.StatusBadRequest)
+				return
+			}
+			seen[n.Ssid] = true
+			pw := old[n.Ssid]
+			if n.Password != nil {
+				pw = *n.Password
+			}
+			if pw != "" && (len(pw) < 8 || len(pw) > 63) {
+				http.Error(w, "WPA password must have 8 to 63 characters: "+n.Ssid, http.StatusBadRequest)
+				return
+			}
+			networks = append(networks, config.WifiNetwork{Ssid: n.Ssid, Password: pw, Hidden: n.Hidden})
+		}
+		wifi.Networks = networks
+		h.app.Config.UpdateWifi(wifi)
+		if err := h.app.Config.Save(); err != nil {
+			h.app.Log.Error("network", "Failed to save WiFi networks: %v", err)
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		h.app.Network.SetNetworks(networks)
+		h.app.Log.Info("network", "Saved %d WiFi networks", len(networks))
+		jsonResponse(w, map[string]string{"status": "saved"})
+	default:
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+	}
+}
+
+func (h *Handler) handleNetworkReconnect(w http.ResponseWriter, r *http.Request) {
+	if r.Method != "POST" {
+		http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
+		return
+	}
+	if h.app.Network == nil {
+		http.Error(w, "WiFi is not managed", http.StatusNotFound)
+		return
+	}
+	h.app.Network.Reconnect()
+	jsonResponse(w, map[string]string{"status": "reconnecting"})
+}
+
+// clientName identifies who made a request, for the trash and logs. Clients may
+// name themselves with X-Client-Name (e.g. "Dashboard"); the address is always included.
+func clientName(r *http.Request) string {
+	addr := r.RemoteAddr
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		addr = host
+	}
+	if name := r.Header.Get("X-Client-Name"); name != "" {
+		return name + " (" + addr + ")"
+	}
+	return addr
+}
+
+func fileExists(path string) bool {
+	_, err := os.Stat(path)
+	return err == nil
+}
+
+// withQuery appends a query parameter to a URL that may already have one.
+func withQuery(u, param string) string {
+	if strings.Contains(u, "?") {
+		return u + "&" + param
+	}
+	return u + "?" + param
+}
+
 func jsonResponse(w http.ResponseWriter, data interface{}) {
 	w.Header().Set("Content-Type", "application/json")
 	json.NewEncoder(w).Encode(data)
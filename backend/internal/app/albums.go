@@ -0,0 +1,497 @@
+package app
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"photobooth/internal/archive"
+	"photobooth/internal/config"
+	"photobooth/internal/importer"
+	"photobooth/internal/storage"
+	"photobooth/internal/websocket"
+)
+
+// albumDir returns the folder of an album id without checking that it exists.
+func (a *App) albumDir(id string) string {
+	return filepath.Join(a.Config.Booth.PhotosBasePath, id)
+}
+
+// existingAlbum sanitizes an album name and makes sure its folder exists.
+func (a *App) existingAlbum(name string) (string, error) {
+	id := config.SanitizeAlbumName(name)
+	if info, err := os.Stat(a.albumDir(id)); err != nil || !info.IsDir() {
+		return "", fmt.Errorf("album '%s' not found", id)
+	}
+	return id, nil
+}
+
+func (a *App) isCurrentAlbum(id string) bool {
+	return id == config.SanitizeAlbumName(a.Config.Booth.CurrentAlbum)
+}
+
+// RenameAlbum gives an album a new display name. If the sanitized id changes too,
+// the folder is renamed and settings and share links are migrated. The default
+// album keeps its folder and only gets a new display name.
+func (a *App) RenameAlbum(name, newName string) (string, error) {
+	oldId, err := a.existingAlbum(name)
+	if err != nil {
+		return "", err
+	}
+	newName = strings.TrimSpace(newName)
+	if newName == "" {
+		return "", fmt.Errorf("new album name required")
+	}
+	current := a.isCurrentAlbum(oldId)
+	if current && a.GetState() != StateIdle {
+		return "", fmt.Errorf("cannot rename the active album during a capture")
+	}
+
+	newId := config.SanitizeAlbumName(newName)
+	if oldId == "default" {
+		newId = oldId
+	}
+
+	if newId != oldId {
+		if _, err := os.Stat(a.albumDir(newId)); err == nil {
+			return "", fmt.Errorf("album '%s' already exists – merge the albums instead", newId)
+		}
+		storage.CloseIndex(a.albumDir(oldId))
+		if err := os.Rename(a.albumDir(oldId), a.albumDir(newId)); err != nil {
+			return "", err
+		}
+
+		if m, ok := a.Config.Booth.AlbumCaptureMethods[oldId]; ok {
+			a.Config.Booth.AlbumCaptureMethods[newId] = m
+			delete(a.Config.Booth.AlbumCaptureMethods, oldId)
+		}
+		delete(a.Config.Booth.AlbumDisplayNames, oldId)
+
+		a.moveQueuedAlbum(oldId, newId)
+	}
+
+	if a.Config.Booth.AlbumDisplayNames == nil {
+		a.Config.Booth.AlbumDisplayNames = make(map[string]string)
+	}
+	a.Config.Booth.AlbumDisplayNames[newId] = newName
+	if current {
+		a.SetAlbum(newName)
+	}
+	a.Config.Save()
+
+	a.Log.Info("settings", "Renamed album '%s' to '%s' (%s)", oldId, newId, newName)
+	a.albumsChanged(oldId, newId)
+	return newId, nil
+}
+
+// MergeAlbums moves every photo of album src into album dst and then moves the
+// emptied src folder to the trash. Manifest fields missing in dst are taken from src.
+func (a *App) MergeAlbums(src, dst, client string) (int, error) {
+	srcId, err := a.existingAlbum(src)
+	if err != nil {
+		return 0, err
+	}
+	dstId, err := a.existingAlbum(dst)
+	if err != nil {
+		return 0, err
+	}
+	if srcId == dstId {
+		return 0, fmt.Errorf("cannot merge an album into itself")
+	}
+	if srcId == "default" {
+		return 0, fmt.Errorf("cannot merge away the default album")
+	}
+	if a.isCurrentAlbum(srcId) {
+		return 0, fmt.Errorf("cannot merge away the active album")
+	}
+
+	idx, err := storage.OpenIndex(a.albumDir(srcId))
+	if err != nil {
+		return 0, err
+	}
+	if _, _, err := idx.Reconcile(); err != nil {
+		return 0, err
+	}
+	recs, err := idx.All()
+	if err != nil {
+		return 0, err
+	}
+	filenames := make([]string, len(recs))
+	for i := range recs {
+		filenames[i] = recs[i].Filename
+	}
+	moved, err := a.movePhotos(srcId, dstId, filenames)
+	if err != nil {
+		return moved, err
+	}
+
+	// What is left queued refers to files that were not in the index
+	a.moveQueuedAlbum(srcId, dstId)
+
+	if err := mergeManifests(a.albumDir(srcId), a.albumDir(dstId)); err != nil {
+		a.Log.Warn("storage", "Failed to merge album metadata of '%s': %v", srcId, err)
+	}
+
+	// Anything left (index, manifest, stray files) goes to the trash with the folder
+	if _, err := a.Trash.TrashAlbum(srcId, a.Config.Booth.AlbumDisplayNames[srcId], a.Config.Booth.AlbumCaptureMethods[srcId], client); err != nil {
+		return moved, err
+	}
+	delete(a.Config.Booth.AlbumDisplayNames, srcId)
+	delete(a.Config.Booth.AlbumCaptureMethods, srcId)
+	a.Config.Save()
+
+	a.Log.Info("storage", "Merged album '%s' into '%s' (%d photos)", srcId, dstId, moved)
+	a.albumsChanged(srcId, dstId)
+	return moved, nil
+}
+
+// MovePhotos moves selected photos (with derivatives and RAW files) to another album.
+func (a *App) MovePhotos(src, dst string, filenames []string) (int, error) {
+	srcId, err := a.existingAlbum(src)
+	if err != nil {
+		return 0, err
+	}
+	dstId, err := a.existingAlbum(dst)
+	if err != nil {
+		return 0, err
+	}
+	if srcId == dstId {
+		return 0, nil
+	}
+
+	moved, err := a.movePhotos(srcId, dstId, filenames)
+	if moved > 0 {
+		a.Log.Info("storage", "Moved %d photo(s) from '%s' to '%s'", moved, srcId, dstId)
+		a.albumsChanged(srcId, dstId)
+	}
+	return moved, err
+}
+
+func (a *App) movePhotos(srcId, dstId string, filenames []string) (int, error) {
+	moved := 0
+	for _, name := range filenames {
+		if name == "" || name != filepath.Base(name) {
+			return moved, fmt.Errorf("invalid filename %q", name)
+		}
+		rec, err := storage.MovePhoto(a.albumDir(srcId), a.albumDir(dstId), name)
+		if err != nil {
+			return moved, fmt.Errorf("move %s: %w", name, err)
+		}
+		moved++
+
+		a.moveQueuedPhoto(srcId, name, dstId, rec.Filename)
+		a.mu.Lock()
+		if a.lastPhoto != nil && a.lastPhoto.Filename == name && a.isCurrentAlbum(srcId) {
+			a.lastPhoto = nil
+		}
+		a.mu.Unlock()
+	}
+	return moved, nil
+}
+
+// moveQueuedAlbum points share links and the outgoing queues (mail, upload,
+// mirror, sync) at the new id of an album, so nothing is sent from or written
+// to a folder that no longer exists.
+func (a *App) moveQueuedAlbum(from, to string) {
+	if a.Share != nil {
+		if err := a.Share.MoveAlbum(from, to); err != nil {
+			a.Log.Warn("share", "Failed to migrate share links of '%s': %v", from, err)
+		}
+	}
+	if a.Email != nil {
+		if err := a.Email.MoveAlbum(from, to); err != nil {
+			a.Log.Warn("email", "Failed to migrate the outbox of '%s': %v", from, err)
+		}
+	}
+	if a.Upload != nil {
+		if err := a.Upload.MoveAlbum(from, to); err != nil {
+			a.Log.Warn("upload", "Failed to migrate queued uploads of '%s': %v", from, err)
+		}
+	}
+	if a.Mirror != nil {
+		if err := a.Mirror.MoveAlbum(from, to); err != nil {
+			a.Log.Warn("mirror", "Failed to migrate queued copies of '%s': %v", from, err)
+		}
+	}
+	if a.Sync != nil {
+		a.Sync.MoveAlbum(from, to)
+	}
+}
+
+// moveQueuedPhoto is moveQueuedAlbum for a single photo.
+func (a *App) moveQueuedPhoto(fromAlbum, fromFile, toAlbum, toFile string) {
+	if a.Share != nil {
+		a.Share.MovePhoto(fromAlbum, fromFile, toAlbum, toFile)
+	}
+	if a.Email != nil {
+		if err := a.Email.MovePhoto(fromAlbum, fromFile, toAlbum, toFile); err != nil {
+			a.Log.Warn("email", "Failed to migrate the mails of %s: %v", fromFile, err)
+		}
+	}
+	if a.Upload != nil {
+		if err := a.Upload.MovePhoto(fromAlbum, fromFile, toAlbum, toFile); err != nil {
+			a.Log.Warn("upload", "Failed to migrate queued uploads of %s: %v", fromFile, err)
+		}
+	}
+	if a.Mirror != nil {
+		if err := a.Mirror.MovePhoto(fromAlbum, fromFile, toAlbum, toFile); err != nil {
+			a.Log.Warn("mirror", "Failed to migrate queued copies of %s: %v", fromFile, err)
+		}
+	}
+}
+
+// GetAlbumManifest returns the metadata of an album.
+func (a *App) GetAlbumManifest(name string) (*storage.Manifest, error) {
+	id, err := a.existingAlbum(name)
+	if err != nil {
+		return nil, err
+	}
+	return storage.ReadManifest(a.albumDir(id))
+}
+
+// SetAlbumManifest validates and stores the metadata of an album.
+func (a *App) SetAlbumManifest(name string, m *storage.Manifest) error {
+	id, err := a.existingAlbum(name)
+	if err != nil {
+		return err
+	}
+	if m.EventDate != "" {
+		if _, err := time.Parse("2006-01-02", m.EventDate); err != nil {
+			return fmt.Errorf("eventDate must be YYYY-MM-DD")
+		}
+	}
+	if m.Cover != "" {
+		idx, err := storage.OpenIndex(a.albumDir(id))
+		if err != nil {
+			return err
+		}
+		if rec, err := idx.Get(m.Cover); err != nil || rec == nil || !rec.IsImage() {
+			return fmt.Errorf("cover photo '%s' not found in album", m.Cover)
+		}
+	}
+	if old, err := storage.ReadManifest(a.albumDir(id)); err == nil {
+		m.Integrity = old.Integrity
+	}
+	if err := storage.WriteManifest(a.albumDir(id), m); err != nil {
+		return err
+	}
+	a.albumsChanged(id)
+	return nil
+}
+
+// ImportPhotos copies the photos below srcDir into an album folder. Every new
+// photo then goes through addCapture like a capture of the booth.
+func (a *App) ImportPhotos(ctx context.Context, albumDir, srcDir string, onProgress importer.ProgressFunc) (importer.Result, error) {
+	im := importer.New(albumDir, a.Imaging)
+	im.OnImported = func(filename string, processErr error) {
+		a.addCapture(albumDir, filename, processErr)
+	}
+	return im.Run(ctx, srcDir, onProgress)
+}
+
+// VerifyAlbum rechecks the originals of an album against their capture checksums
+// and stores the report in the album manifest.
+func (a *App) VerifyAlbum(ctx context.Context, name string, onProgress storage.VerifyProgressFunc) (*storage.VerifyReport, error) {
+	id, err := a.existingAlbum(name)
+	if err != nil {
+		return nil, err
+	}
+	report, err := storage.VerifyAlbum(ctx, a.albumDir(id), onProgress)
+	if err != nil {
+		return nil, err
+	}
+
+	if len(report.Issues) > 0 {
+		a.Log.Error("storage", "Album '%s' verified: %d of %d files have problems", id, len(report.Issues), report.Files)
+		for i, issue := range report.Issues {
+			if i == 20 {
+				a.Log.Warn("storage", "... and %d more", len(report.Issues)-i)
+				break
+			}
+			a.Log.Warn("storage", "%s: %s %s", issue.File, issue.Problem, issue.Detail)
+		}
+	} else {
+		a.Log.Info("storage", "Album '%s' verified: all %d files OK (%d new checksums)", id, report.Files, report.Baselined)
+	}
+
+	m, err := storage.ReadManifest(a.albumDir(id))
+	if err != nil {
+		return report, err
+	}
+	m.Integrity = report
+	if err := storage.WriteManifest(a.albumDir(id), m); err != nil {
+		return report, err
+	}
+	a.albumsChanged(id)
+	return report, nil
+}
+
+// mergeManifests fills empty fields of dst's manifest from src's.
+func mergeManifests(srcDir, dstDir string) error {
+	src, err := storage.ReadManifest(srcDir)
+	if err != nil {
+		return err
+	}
+	dst, err := storage.ReadManifest(dstDir)
+	if err != nil {
+		return err
+	}
+	if *src == (storage.Manifest{}) {
+		return nil
+	}
+	if dst.EventDate == "" {
+		dst.EventDate = src.EventDate
+	}
+	if dst.Customer == "" {
+		dst.Customer = src.Customer
+	}
+	if dst.Cover == "" {
+		dst.Cover = src.Cover
+	}
+	if src.Notes != "" && src.Notes != dst.Notes {
+		dst.Notes = strings.TrimSpace(dst.Notes + "\n" + src.Notes)
+	}
+	return storage.WriteManifest(dstDir, dst)
+}
+
+// albumsChanged tells clients to reload album lists and galleries.
+func (a *App) albumsChanged(ids ...string) {
+	a.Hub.Broadcast <- websocket.Event{
+		Type:      websocket.EventTypeAlbums,
+		Data:      map[string]interface{}{"albums": ids},
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+// Contents that can be selected for an album download.
+const (
+	ContentOriginals  = "originals"
+	ContentPreviews   = "previews"
+	ContentRaw        = "raw"
+	ContentComposites = "composites" // print layouts in the album's composite/ folder, if any
+)
+
+// AlbumArchive lays out a ZIP of the selected contents of an album plus a
+// manifest.json. Nothing is read or written until the archive is streamed.
+func (a *App) AlbumArchive(name string, include []string) (*archive.Zip, string, error) {
+	id, err := a.existingAlbum(name)
+	if err != nil {
+		return nil, "", err
+	}
+	dir := a.albumDir(id)
+	want := make(map[string]bool)
+	for _, c := range include {
+		switch c {
+		case ContentOriginals, ContentPreviews, ContentRaw, ContentComposites:
+			want[c] = true
+		default:
+			return nil, "", fmt.Errorf("unknown content %q", c)
+		}
+	}
+	if len(want) == 0 {
+		want[ContentOriginals] = true
+	}
+
+	idx, err := storage.OpenIndex(dir)
+	if err != nil {
+		return nil, "", err
+	}
+	recs, err := idx.All()
+	if err != nil {
+		return nil, "", err
+	}
+	sort.Slice(recs, func(i, j int) bool {
+		if !recs[i].CapturedAt.Equal(recs[j].CapturedAt) {
+			return recs[i].CapturedAt.Before(recs[j].CapturedAt)
+		}
+		return recs[i].Filename < recs[j].Filename
+	})
+
+	type manifestFile struct {
+		Name       string    `json:"name"`
+		Size       int64     `json:"size"`
+		CapturedAt time.Time `json:"capturedAt"`
+		Favorite   bool      `json:"favorite,omitempty"`
+	}
+	var entries []archive.Entry
+	var files []manifestFile
+	// add puts dir/sub/file into the archive as <album>/<folder>/file
+	// Version carries the file's mtime and, where the index has one, its
+	// checksum: a rotation keeps the size and CapturedAt but must change the ETag
+	add := func(sub, folder, file string, rec *storage.Record) {
+		info, err := os.Stat(filepath.Join(dir, sub, file))
+		if err != nil || !info.Mode().IsRegular() {
+			return
+		}
+		e := archive.Entry{
+			Name:    id + "/" + folder + "/" + file,
+			Path:    filepath.Join(dir, sub, file),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+			Version: strconv.FormatInt(info.ModTime().UnixNano(), 10),
+		}
+		mf := manifestFile{Name: e.Name, Size: e.Size, CapturedAt: info.ModTime()}
+		if rec != nil {
+			e.ModTime = rec.CapturedAt
+			mf.CapturedAt, mf.Favorite = rec.CapturedAt, rec.Favorite
+			switch {
+			case sub == "original" && file == rec.Filename:
+				e.Version += "/" + rec.Checksum
+			case sub == "original" && file == rec.Raw:
+				e.Version += "/" + rec.RawChecksum
+			}
+		}
+		entries = append(entries, e)
+		files = append(files, mf)
+	}
+
+	for i := range recs {
+		r := &recs[i]
+		if r.IsImage() {
+			if want[ContentOriginals] {
+				add("original", "original", r.Filename, r)
+			}
+			if want[ContentPreviews] && r.Preview != "" {
+				add("preview", "preview", r.Preview, r)
+			}
+			if want[ContentRaw] && r.Raw != "" {
+				add("original", "raw", r.Raw, r)
+			}
+		} else if r.MediaType == storage.MediaRAW && want[ContentRaw] {
+			add("original", "raw", r.Filename, r)
+		}
+	}
+	if want[ContentComposites] {
+		if list, err := os.ReadDir(filepath.Join(dir, "composite")); err == nil {
+			for _, e := range list {
+				if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+					add("composite", "composite", e.Name(), nil)
+				}
+			}
+		}
+	}
+
+	meta, _ := storage.ReadManifest(dir)
+	manifest, err := json.MarshalIndent(map[string]interface{}{
+		"album": id,
+		"name":  a.Config.Booth.AlbumDisplayNames[id],
+		"meta":  meta,
+		"files": files,
+	}, "", "  ")
+	if err != nil {
+		return nil, "", err
+	}
+	var modTime time.Time
+	if meta != nil {
+		modTime = meta.UpdatedAt
+	}
+	entries = append(entries, archive.Entry{Name: id + "/manifest.json", Data: manifest, ModTime: modTime})
+
+	return archive.NewZip(entries), id, nil
+}
@@ -1,6 +1,7 @@
 package app
 
 import (
+	"context"
 	"fmt"
 	"os"
 	"path/filepath"
@@ -8,12 +9,24 @@ import (
 	"sync"
 	"time"
 
+	"photobooth/internal/albumsync"
 	"photobooth/internal/camera"
+	"photobooth/internal/captive"
 	"photobooth/internal/config"
 	"photobooth/internal/disk"
+	"photobooth/internal/diskpolicy"
+	"photobooth/internal/export"
 	"photobooth/internal/imaging"
 	"photobooth/internal/logging"
+	"photobooth/internal/mirror"
+	"photobooth/internal/mqtt"
+	"photobooth/internal/network"
+	"photobooth/internal/share"
+	"photobooth/internal/share/email"
 	"photobooth/internal/storage"
+	"photobooth/internal/trash"
+	"photobooth/internal/upload"
+	"photobooth/internal/webhook"
 	"photobooth/internal/websocket"
 )
 
@@ -35,6 +48,18 @@ type App struct {
 	Storage *storage.Manager
 	Hub     *websocket.Hub
 	Log     *logging.Logger
+	Share   *share.Manager // optional, nil disables share links
+	Email   *email.Queue   // optional, nil disables mail delivery
+	Upload  *upload.Uploader
+	Mirror  *mirror.Mirror
+	Export  *export.Manager
+	Policy  *diskpolicy.Policy // optional, nil disables the free space guardrails
+	Sync    *albumsync.Syncer
+	Hooks   *webhook.Dispatcher
+	Mqtt    *mqtt.Client
+	Trash   *trash.Bin
+	Network *network.Manager // optional, nil when WiFi is not managed
+	Portal  *captive.Portal  // optional, nil when WiFi is not managed
 
 	mu                 sync.Mutex
 	state              State
@@ -43,6 +68,12 @@ type App struct {
 	countdownRemaining int
 	countdownTotal     int
 	captureSeq         int
+	cancelCountdown    context.CancelFunc
+	photoListeners     []func(album, filename string)
+	regenMu            sync.Mutex
+	regenQueue         [][2]string     // album dir and filename waiting for new derivatives
+	regenPending       map[string]bool // the same, by path, so a photo is queued once
+	regenRunning       bool
 
 	// Cache for system info
 	cachedCameraInfo camera.CameraInfo
@@ -59,6 +90,7 @@ func NewApp(cfg *config.Config, cam *camera.Controller, img *imaging.Processor,
 		Storage:   store,
 		Hub:       hub,
 		Log:       logger,
+		Trash:     trash.NewBin(cfg.Trash, cfg.Booth.PhotosBasePath),
 		state:     StateIdle,
 		startTime: time.Now(),
 	}
@@ -124,23 +156,93 @@ func (a *App) GetCountdown() (int, int) {
 }
 
 func (a *App) Trigger() {
+	// The policy reads the drive; slow storage must not hold up status calls
+	if a.Policy != nil {
+		if ok, reason := a.Policy.CanCapture(); !ok {
+			a.Log.Error("trigger", "Trigger refused: %s", reason)
+			a.Hub.Broadcast <- websocket.Event{
+				Type:      websocket.TypeError,
+				Data:      map[string]string{"message": "Storage is full", "code": "storage_full"},
+				Timestamp: time.Now().UnixMilli(),
+			}
+			return
+		}
+	}
+
 	a.mu.Lock()
 	if a.state != StateIdle && a.state != StatePreview {
+		state := a.state
 		a.mu.Unlock()
-		a.Log.Warn("trigger", "Trigger ignored: system not idle or preview (state: %s)", a.state)
+		a.Log.Warn("trigger", "Trigger ignored: system not idle or preview (state: %s)", state)
 		return
 	}
 	a.captureSeq++
 	currentSeq := a.captureSeq
+	ctx, cancel := context.WithCancel(context.Background())
+	a.cancelCountdown = cancel
 	a.mu.Unlock()
 
 	a.SetState(StateCountdown)
 	a.Log.Info("trigger", "Capture sequence %d started", currentSeq)
 
-	go a.runCaptureSequence(currentSeq)
+	go a.runCaptureSequence(ctx, currentSeq)
 }
 
-func (a *App) runCaptureSequence(seq int) {
+// Cancel aborts a running countdown or ends the preview early.
+// Once the countdown has finished the capture can no longer be stopped.
+func (a *App) Cancel() bool {
+	a.mu.Lock()
+	state := a.state
+	cancel := a.cancelCountdown
+	a.mu.Unlock()
+
+	switch {
+	case state == StateCountdown && cancel != nil:
+		a.Log.Info("trigger", "Countdown cancelled")
+		cancel()
+		return true
+	case state == StatePreview:
+		a.Log.Info("trigger", "Preview dismissed")
+		a.SetState(StateIdle)
+		return true
+	default:
+		a.Log.Warn("trigger", "Cancel ignored (state: %s)", state)
+		return false
+	}
+}
+
+// abortCountdown returns to idle after a cancelled countdown. If the camera was
+// already fired (negative trigger delay) the photo is kept and stored like any
+// other capture: indexed, mirrored and shown in the gallery.
+func (a *App) abortCountdown(captureChan <-chan capRes) {
+	a.mu.Lock()
+	a.countdownRemaining = 0
+	a.cancelCountdown = nil
+	a.mu.Unlock()
+	a.SetState(StateIdle)
+
+	go func() {
+		res := <-captureChan
+		if res.e != nil {
+			return
+		}
+		a.Log.Warn("camera", "Camera had already fired before cancel – keeping %s", res.f)
+		albumDir := a.GetAlbumDir()
+		err := a.Imaging.Process(filepath.Join(albumDir, "original", res.f), nil)
+		if rec := a.addCapture(albumDir, res.f, err); rec != nil && err == nil {
+			// No preview for a cancelled shot, it just shows up in the gallery
+			a.photoUpdated(filepath.Base(albumDir), rec)
+		}
+	}()
+}
+
+type capRes struct {
+	f string
+	e error
+	d time.Duration
+}
+
+func (a *App) runCaptureSequence(ctx context.Context, seq int) {
 	// 1. Countdown
 	seconds := a.Config.Booth.CountdownSeconds
 	if seconds < 1 {
@@ -178,17 +280,17 @@ func (a *App) runCaptureSequence(seq int) {
 		triggerOffsetMs = 0 // Don't allow triggering before we even start
 	}
 
-	type capRes struct {
-		f string
-		e error
-		d time.Duration
-	}
 	captureChan := make(chan capRes, 1)
 
 	// Launch a background routine to fire the physical camera flash at the exact calculated offset
 	go func() {
 		if triggerOffsetMs > 0 {
-			time.Sleep(time.Duration(triggerOffsetMs) * time.Millisecond)
+			select {
+			case <-time.After(time.Duration(triggerOffsetMs) * time.Millisecond):
+			case <-ctx.Done():
+				captureChan <- capRes{e: ctx.Err()}
+				return
+			}
 		}
 		t0 := time.Now()
 		a.Log.Info("camera", "Physical trigger fired (Offset = %d ms, Delay = %d ms)...", triggerOffsetMs, delay)
@@ -208,12 +310,18 @@ func (a *App) runCaptureSequence(seq int) {
 			Timestamp: time.Now().UnixMilli(),
 		}
 
-		time.Sleep(1 * time.Second)
+		select {
+		case <-time.After(1 * time.Second):
+		case <-ctx.Done():
+			a.abortCountdown(captureChan)
+			return
+		}
 	}
 
 	// The visual countdown has reached 0.
 	a.mu.Lock()
 	a.countdownRemaining = 0
+	a.cancelCountdown = nil
 	a.mu.Unlock()
 
 	a.Hub.Broadcast <- websocket.Event{
@@ -263,6 +371,7 @@ func (a *App) runCaptureSequence(seq int) {
 			ThumbUrl:  "/photos/thumb/" + filename,
 			Timestamp: time.Now(),
 		}
+		a.attachShareLink(a.lastPhoto)
 
 		// 4. Preview (Broadcast immediately)
 		a.SetState(StatePreview)
@@ -289,9 +398,16 @@ func (a *App) runCaptureSequence(seq int) {
 			} else if exists && method == "B" {
 				// Strategy B: Async RAW download
 				a.Log.Info("camera", "Strategy B: Downloading RAW in background for %s", fname)
-				err := a.Camera.DownloadLatestRaw(albumDir)
+				rawName, err := a.Camera.DownloadLatestRaw(albumDir)
 				if err != nil {
 					a.Log.Error("camera", "Failed to download RAW: %v", err)
+				} else if rawName != "" {
+					if err := storage.AttachRaw(albumDir, fname, rawName); err != nil {
+						a.Log.Warn("storage", "Failed to index RAW %s: %v", rawName, err)
+					}
+					if a.Mirror != nil {
+						a.Mirror.Enqueue(filepath.Base(albumDir), rawName)
+					}
 				}
 			}
 		}(filename)
@@ -299,9 +415,8 @@ func (a *App) runCaptureSequence(seq int) {
 
 	processingDuration := time.Since(t1)
 
-	if err != nil {
-		a.Log.Error("imaging", "Processing failed: %v", err)
-	} else {
+	a.addCapture(albumDir, filename, err)
+	if err == nil {
 		// Log detailed stats
 		a.Log.Info("stats", "Capture=%.3fs, Preview=%.3fs, TotalProcessing=%.3fs",
 			captureDuration.Seconds(), previewDuration.Seconds(), processingDuration.Seconds())
@@ -337,6 +452,46 @@ func (a *App) runCaptureSequence(seq int) {
 	}
 }
 
+// addCapture indexes a new original (with its checksum), queues it for the
+// mirror and, if processErr is nil, tells the photo listeners that it is ready.
+// Every photo that lands in an album goes through here. Returns the index
+// record, nil if indexing failed.
+func (a *App) addCapture(albumDir, filename string, processErr error) *storage.Record {
+	album := filepath.Base(albumDir)
+	rec, err := storage.AddPhoto(albumDir, filename)
+	if err != nil {
+		a.Log.Error("storage", "Failed to index %s: %v", filename, err)
+	}
+	// Mirror the original even if the derivatives failed
+	if a.Mirror != nil {
+		a.Mirror.EnqueueCapture(album, filename)
+	}
+	if processErr != nil {
+		a.Log.Error("imaging", "Processing failed: %v", processErr)
+		return rec
+	}
+	a.notifyPhotoReady(album, filename)
+	return rec
+}
+
+// OnPhotoReady registers a callback that is invoked once a new capture and its
+// preview/thumbnail are on disk. Callbacks run in their own goroutine so they
+// can never hold up the capture sequence.
+func (a *App) OnPhotoReady(fn func(album, filename string)) {
+	a.mu.Lock()
+	a.photoListeners = append(a.photoListeners, fn)
+	a.mu.Unlock()
+}
+
+func (a *App) notifyPhotoReady(album, filename string) {
+	a.mu.Lock()
+	listeners := a.photoListeners
+	a.mu.Unlock()
+	for _, fn := range listeners {
+		go fn(album, filename)
+	}
+}
+
 func (a *App) GetLastPhoto() *storage.Photo {
 	if a.lastPhoto != nil {
 		return a.lastPhoto
@@ -344,6 +499,41 @@ func (a *App) GetLastPhoto() *storage.Photo {
 	return a.Storage.GetLatest()
 }
 
+// attachShareLink fills in the guest download URL and QR code for a photo of the current album.
+func (a *App) attachShareLink(p *storage.Photo) {
+	if a.Share == nil || !a.Share.Enabled() || p == nil {
+		return
+	}
+	link, err := a.Share.Token(config.SanitizeAlbumName(a.Config.Booth.CurrentAlbum), p.Filename)
+	if err != nil {
+		a.Log.Warn("share", "Failed to create share link for %s: %v", p.Filename, err)
+		return
+	}
+	p.ShareUrl = a.Share.URL(link.Token)
+	p.QrUrl = "/p/" + link.Token + "/qr.png"
+}
+
+// SharePhoto returns the share link of a photo, creating one if needed. Links
+// persist, so only photos that exist get one.
+func (a *App) SharePhoto(album, filename string) (*share.Link, error) {
+	id, err := a.existingAlbum(album)
+	if err != nil {
+		return nil, os.ErrNotExist
+	}
+	idx, err := storage.OpenIndex(a.albumDir(id))
+	if err != nil {
+		return nil, err
+	}
+	rec, err := idx.Get(filename)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil || !rec.IsImage() {
+		return nil, os.ErrNotExist
+	}
+	return a.Share.Token(id, filename)
+}
+
 // cameraInfoRefreshLoop refreshes camera info dynamically.
 // If camera is connected: every 10s.
 // If camera is disconnected: every 2s (to detect it faster).
@@ -373,12 +563,19 @@ func (a *App) cameraInfoRefreshLoop() {
 		a.cachedDiskInfo = usage
 		a.mu.Unlock()
 
+		info := map[string]interface{}{
+			"camera": camInfo,
+			"disk":   usage,
+		}
+		if a.Mirror != nil && a.Mirror.Enabled() {
+			info["mirror"] = a.Mirror.Status()
+		}
+		if a.Policy != nil {
+			info["storage"] = a.Policy.Status()
+		}
 		a.Hub.Broadcast <- websocket.Event{
-			Type: websocket.EventTypeSystem,
-			Data: map[string]interface{}{
-				"camera": camInfo,
-				"disk":   usage,
-			},
+			Type:      websocket.EventTypeSystem,
+			Data:      info,
 			Timestamp: time.Now().UnixMilli(),
 		}
 	}
@@ -405,54 +602,87 @@ func (a *App) EnsureAlbumDirs() {
 }
 
 type AlbumInfo struct {
-	Id            string `json:"id"`
-	Name          string `json:"name"`
-	Count         int    `json:"count"`
-	Size          int64  `json:"size"`
-	CaptureMethod string `json:"captureMethod"`
+	Id            string            `json:"id"`
+	Name          string            `json:"name"`
+	Count         int               `json:"count"`
+	Size          int64             `json:"size"`
+	CaptureMethod string            `json:"captureMethod"`
+	Meta          *storage.Manifest `json:"meta,omitempty"`
 }
 
-// ListAlbums returns all existing albums with their original display name.
-func (a *App) ListAlbums() []AlbumInfo {
+// albumIds returns the folder names of all albums below PhotosBasePath.
+func (a *App) albumIds() []string {
 	entries, err := os.ReadDir(a.Config.Booth.PhotosBasePath)
 	if err != nil {
-		return []AlbumInfo{}
+		return nil
 	}
 
-	var albums []AlbumInfo
-
+	var ids []string
 	for _, e := range entries {
-		if e.IsDir() {
-			sanitized := e.Name()
-			// Filter out legacy/system folders
-			if sanitized == "original" || sanitized == "preview" || sanitized == "thumb" || sanitized == "css" || sanitized == "js" {
-				continue
-			}
+		if !e.IsDir() {
+			continue
+		}
+		name := e.Name()
+		// Filter out legacy/system folders
+		if name == "original" || name == "preview" || name == "thumb" || name == "css" || name == "js" || strings.HasPrefix(name, ".") {
+			continue
+		}
+		ids = append(ids, name)
+	}
+	return ids
+}
 
-			// Get original name from config map, fallback to sanitized name
-			originalName := sanitized
-			if name, ok := a.Config.Booth.AlbumDisplayNames[sanitized]; ok {
-				originalName = name
-			}
+// ReconcileIndexes syncs every album's photo index with the files on disk.
+// Called once at startup to pick up files copied or deleted while the booth was off.
+func (a *App) ReconcileIndexes() {
+	for _, id := range a.albumIds() {
+		idx, err := storage.OpenIndex(filepath.Join(a.Config.Booth.PhotosBasePath, id))
+		if err != nil {
+			a.Log.Error("storage", "Failed to open index of album '%s': %v", id, err)
+			continue
+		}
+		added, removed, err := idx.Reconcile()
+		if err != nil {
+			a.Log.Error("storage", "Failed to reconcile album '%s': %v", id, err)
+			continue
+		}
+		if added > 0 || removed > 0 {
+			a.Log.Info("storage", "Album '%s' index updated: %d added, %d removed", id, added, removed)
+		}
+	}
+}
 
-			// Get capture method
-			captureMethod := "C" // Default strategy
-			if method, ok := a.Config.Booth.AlbumCaptureMethods[sanitized]; ok {
-				captureMethod = method
-			}
+// ListAlbums returns all existing albums with their original display name.
+func (a *App) ListAlbums() []AlbumInfo {
+	albums := []AlbumInfo{}
+
+	for _, sanitized := range a.albumIds() {
+		// Get original name from config map, fallback to sanitized name
+		originalName := sanitized
+		if name, ok := a.Config.Booth.AlbumDisplayNames[sanitized]; ok {
+			originalName = name
+		}
 
-			// optionally get count and size
-			count, _ := a.GetGalleryCount(sanitized)
-			size, _ := a.GetGallerySize(sanitized)
+		// Get capture method
+		captureMethod := "C" // Default strategy
+		if method, ok := a.Config.Booth.AlbumCaptureMethods[sanitized]; ok {
+			captureMethod = method
+		}
+
+		// Count and size come from the album's index (no directory scan)
+		count, size, _ := storage.AlbumStats(filepath.Join(a.Config.Booth.PhotosBasePath, sanitized))
 
-			albums = append(albums, AlbumInfo{
-				Id:            sanitized,
-				Name:          originalName,
-				Count:         count,
-				Size:          size,
-				CaptureMethod: captureMethod,
-			})
+		info := AlbumInfo{
+			Id:            sanitized,
+			Name:          originalName,
+			Count:         count,
+			Size:          size,
+			CaptureMethod: captureMethod,
+		}
+		if m, err := storage.ReadManifest(filepath.Join(a.Config.Booth.PhotosBasePath, sanitized)); err == nil && *m != (storage.Manifest{}) {
+			info.Meta = m
 		}
+		albums = append(albums, info)
 	}
 	return albums
 }
@@ -460,24 +690,8 @@ func (a *App) ListAlbums() []AlbumInfo {
 // GetGallerySize returns the total size in bytes of the album's files.
 func (a *App) GetGallerySize(name string) (int64, error) {
 	sanitized := config.SanitizeAlbumName(name)
-	base := filepath.Join(a.Config.Booth.PhotosBasePath, sanitized)
-
-	var totalSize int64
-	for _, sub := range []string{"original", "preview", "thumb"} {
-		dir := filepath.Join(base, sub)
-		entries, err := os.ReadDir(dir)
-		if err != nil {
-			continue
-		}
-		for _, e := range entries {
-			if !e.IsDir() {
-				if info, err := e.Info(); err == nil {
-					totalSize += info.Size()
-				}
-			}
-		}
-	}
-	return totalSize, nil
+	_, size, err := storage.AlbumStats(filepath.Join(a.Config.Booth.PhotosBasePath, sanitized))
+	return size, err
 }
 
 // SetAlbum sets the current album, saves original name, creates directories, returns the sanitized name.
@@ -511,67 +725,247 @@ func (a *App) SetAlbum(originalName string) (string, error) {
 	return sanitized, nil
 }
 
-// GetGalleryCount returns the number of images in the album's 'original' folder.
+// GetGalleryCount returns the number of images in the album.
 func (a *App) GetGalleryCount(name string) (int, error) {
 	sanitized := config.SanitizeAlbumName(name)
-	dir := filepath.Join(a.Config.Booth.PhotosBasePath, sanitized, "original")
-	entries, err := os.ReadDir(dir)
+	count, _, err := storage.AlbumStats(filepath.Join(a.Config.Booth.PhotosBasePath, sanitized))
+	return count, err
+}
+
+// EmptyGallery moves all photos of the album to the trash but keeps the album itself.
+func (a *App) EmptyGallery(name, client string) error {
+	sanitized := config.SanitizeAlbumName(name)
+	item, err := a.Trash.TrashAlbumContents(sanitized, client)
 	if err != nil {
-		if os.IsNotExist(err) {
-			return 0, nil
-		}
-		return 0, err
+		return err
 	}
-	count := 0
-	for _, e := range entries {
-		if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
-			ext := strings.ToLower(filepath.Ext(e.Name()))
-			if ext == ".jpg" || ext == ".jpeg" {
-				count++
-			}
+	if item != nil {
+		filenames := make([]string, 0, len(item.Records))
+		for _, rec := range item.Records {
+			filenames = append(filenames, rec.Filename)
 		}
+		a.suspendShareLinks(sanitized, filenames, item.Id)
+		a.Log.Info("system", "Emptied gallery: %s (%d photos moved to trash by %s)", sanitized, item.Count, client)
 	}
-	return count, nil
+	return nil
 }
 
-// EmptyGallery deletes all photos in the album but keeps the album itself.
-func (a *App) EmptyGallery(name string) error {
+// DeleteGallery moves the entire album directory to the trash and removes its entries in the settings.
+func (a *App) DeleteGallery(name, client string) error {
 	sanitized := config.SanitizeAlbumName(name)
-	base := filepath.Join(a.Config.Booth.PhotosBasePath, sanitized)
+	if sanitized == "default" {
+		return fmt.Errorf("cannot delete default album")
+	}
+	if sanitized == a.Config.Booth.CurrentAlbum {
+		return fmt.Errorf("cannot delete active album")
+	}
+	if _, err := os.Stat(filepath.Join(a.Config.Booth.PhotosBasePath, sanitized)); err != nil {
+		return fmt.Errorf("album '%s' not found", sanitized)
+	}
 
-	// Clean subdirs
-	for _, sub := range []string{"original", "preview", "thumb"} {
-		dir := filepath.Join(base, sub)
-		entries, err := os.ReadDir(dir)
-		if err != nil {
-			continue
+	displayName := a.Config.Booth.AlbumDisplayNames[sanitized]
+	captureMethod := a.Config.Booth.AlbumCaptureMethods[sanitized]
+	item, err := a.Trash.TrashAlbum(sanitized, displayName, captureMethod, client)
+	if err != nil {
+		return err
+	}
+	a.suspendShareLinks(sanitized, nil, item.Id)
+	if a.Config.Booth.AlbumDisplayNames != nil {
+		delete(a.Config.Booth.AlbumDisplayNames, sanitized)
+		delete(a.Config.Booth.AlbumCaptureMethods, sanitized)
+		a.Config.Save() // Save to persist the deletion from map
+	}
+	a.Log.Info("system", "Deleted gallery: %s (moved to trash by %s)", sanitized, client)
+	return nil
+}
+
+// RestoreTrash moves a trash item back into place. Restored albums get their
+// display name and capture method back.
+func (a *App) RestoreTrash(id string) (*trash.Item, error) {
+	item, err := a.Trash.Restore(id)
+	if err != nil {
+		return nil, err
+	}
+	if a.Share != nil {
+		if _, err := a.Share.Resume(item.Id); err != nil {
+			a.Log.Warn("share", "Failed to re-enable share links of %s: %v", item.Id, err)
+		}
+	}
+
+	if item.Kind == trash.KindAlbum {
+		if item.AlbumName != "" {
+			if a.Config.Booth.AlbumDisplayNames == nil {
+				a.Config.Booth.AlbumDisplayNames = make(map[string]string)
+			}
+			a.Config.Booth.AlbumDisplayNames[item.Album] = item.AlbumName
 		}
-		for _, e := range entries {
-			os.Remove(filepath.Join(dir, e.Name()))
+		if item.CaptureMethod != "" {
+			if a.Config.Booth.AlbumCaptureMethods == nil {
+				a.Config.Booth.AlbumCaptureMethods = make(map[string]string)
+			}
+			a.Config.Booth.AlbumCaptureMethods[item.Album] = item.CaptureMethod
 		}
+		a.Config.Save()
+	}
+
+	a.Log.Info("trash", "Restored %s of album '%s' (%d photos)", item.Kind, item.Album, item.Count)
+	item.Records = nil
+	a.Hub.Broadcast <- websocket.Event{
+		Type:      "trash_restored",
+		Data:      item,
+		Timestamp: time.Now().UnixMilli(),
+	}
+	return item, nil
+}
+
+// suspendShareLinks disables the guest links of trashed photos (nil: the whole
+// album) until the trash item is restored.
+func (a *App) suspendShareLinks(album string, filenames []string, trashId string) {
+	if a.Share == nil {
+		return
+	}
+	if _, err := a.Share.Suspend(album, filenames, trashId); err != nil {
+		a.Log.Warn("share", "Failed to suspend share links of album '%s': %v", album, err)
+	}
+}
+
+// DeletePhoto moves a single photo with all its derivatives and RAW sibling to the trash.
+func (a *App) DeletePhoto(album, filename, client string) error {
+	sanitized := config.SanitizeAlbumName(album)
+	item, err := a.Trash.TrashPhoto(sanitized, filename, client)
+	if err != nil {
+		return err
+	}
+	a.suspendShareLinks(sanitized, []string{filename}, item.Id)
+
+	a.mu.Lock()
+	if a.lastPhoto != nil && a.lastPhoto.Filename == filename && sanitized == config.SanitizeAlbumName(a.Config.Booth.CurrentAlbum) {
+		a.lastPhoto = nil
+	}
+	a.mu.Unlock()
+
+	a.Log.Info("storage", "Deleted photo %s from album '%s' (moved to trash by %s)", filename, sanitized, client)
+	a.Hub.Broadcast <- websocket.Event{
+		Type:      websocket.EventTypePhotoDeleted,
+		Data:      map[string]string{"album": sanitized, "filename": filename},
+		Timestamp: time.Now().UnixMilli(),
 	}
-	a.Log.Info("system", "Emptied gallery: %s", sanitized)
 	return nil
 }
 
-// DeleteGallery removes the entire album directory and its entry in the settings.
-func (a *App) DeleteGallery(name string) error {
-	sanitized := config.SanitizeAlbumName(name)
-	if sanitized == "default" {
-		return fmt.Errorf("cannot delete default album")
+// SetPhotoHidden hides a photo from the guest gallery or shows it again.
+func (a *App) SetPhotoHidden(album, filename string, hidden bool) (*storage.Photo, error) {
+	sanitized := config.SanitizeAlbumName(album)
+	rec, err := storage.SetHidden(filepath.Join(a.Config.Booth.PhotosBasePath, sanitized), filename, hidden)
+	if err != nil {
+		return nil, err
 	}
-	if sanitized == a.Config.Booth.CurrentAlbum {
-		return fmt.Errorf("cannot delete active album")
+	return a.photoUpdated(sanitized, rec), nil
+}
+
+// SetPhotoFavorite marks or unmarks a photo as favourite.
+func (a *App) SetPhotoFavorite(album, filename string, favorite bool) (*storage.Photo, error) {
+	sanitized := config.SanitizeAlbumName(album)
+	rec, err := storage.SetFavorite(filepath.Join(a.Config.Booth.PhotosBasePath, sanitized), filename, favorite)
+	if err != nil {
+		return nil, err
 	}
+	return a.photoUpdated(sanitized, rec), nil
+}
 
-	path := filepath.Join(a.Config.Booth.PhotosBasePath, sanitized)
-	err := os.RemoveAll(path)
-	if err == nil {
-		if a.Config.Booth.AlbumDisplayNames != nil {
-			delete(a.Config.Booth.AlbumDisplayNames, sanitized)
-			a.Config.Save() // Save to persist the deletion from map
+// RotatePhoto rotates the original clockwise and regenerates preview and thumbnail.
+func (a *App) RotatePhoto(album, filename string, degrees int) (*storage.Photo, error) {
+	sanitized := config.SanitizeAlbumName(album)
+	albumDir := filepath.Join(a.Config.Booth.PhotosBasePath, sanitized)
+
+	if err := storage.RotateOriginal(albumDir, filename, degrees); err != nil {
+		return nil, err
+	}
+	if err := a.Imaging.Process(filepath.Join(albumDir, "original", filename), nil); err != nil {
+		return nil, err
+	}
+	rec, err := storage.AddPhoto(albumDir, filename)
+	if err != nil {
+		return nil, err
+	}
+
+	a.Log.Info("storage", "Rotated photo %s in album '%s' by %d°", filename, sanitized, degrees)
+	return a.photoUpdated(sanitized, rec), nil
+}
+
+// QueueDerivatives recreates a missing preview and thumbnail from the original
+// in the background, e.g. after the storage cleanup removed them from an old
+// album. Photos are processed one at a time, each once however often it is
+// requested meanwhile.
+func (a *App) QueueDerivatives(albumDir, filename string) {
+	key := filepath.Join(albumDir, filename)
+	a.regenMu.Lock()
+	defer a.regenMu.Unlock()
+	if a.regenPending[key] {
+		return
+	}
+	if a.regenPending == nil {
+		a.regenPending = make(map[string]bool)
+	}
+	a.regenPending[key] = true
+	a.regenQueue = append(a.regenQueue, [2]string{albumDir, filename})
+	if !a.regenRunning {
+		a.regenRunning = true
+		go a.regenLoop()
+	}
+}
+
+func (a *App) regenLoop() {
+	for {
+		a.regenMu.Lock()
+		if len(a.regenQueue) == 0 {
+			a.regenRunning = false
+			a.regenMu.Unlock()
+			return
+		}
+		next := a.regenQueue[0]
+		a.regenQueue = a.regenQueue[1:]
+		a.regenMu.Unlock()
+
+		albumDir, filename := next[0], next[1]
+		if err := a.regenerateDerivatives(albumDir, filename); err != nil && !os.IsNotExist(err) {
+			a.Log.Warn("imaging", "Failed to regenerate derivatives of %s: %v", filename, err)
+		}
+
+		a.regenMu.Lock()
+		delete(a.regenPending, filepath.Join(albumDir, filename))
+		a.regenMu.Unlock()
+	}
+}
+
+func (a *App) regenerateDerivatives(albumDir, filename string) error {
+	if _, err := os.Stat(filepath.Join(albumDir, "preview", filename)); err == nil {
+		if _, err := os.Stat(filepath.Join(albumDir, "thumb", filename)); err == nil {
+			return nil // queued twice before the first run finished
 		}
-		a.Log.Info("system", "Deleted gallery: %s", sanitized)
 	}
+	original := filepath.Join(albumDir, "original", filename)
+	if _, err := os.Stat(original); err != nil {
+		return err
+	}
+	if err := a.Imaging.Process(original, nil); err != nil {
+		return err
+	}
+	_, err := storage.AddPhoto(albumDir, filename)
 	return err
 }
+
+// photoUpdated tells all clients about the new state of a photo.
+func (a *App) photoUpdated(album string, rec *storage.Record) *storage.Photo {
+	p := rec.Photo()
+	current := album == config.SanitizeAlbumName(a.Config.Booth.CurrentAlbum)
+	if current {
+		a.attachShareLink(&p)
+	}
+	a.Hub.Broadcast <- websocket.Event{
+		Type:      websocket.EventTypePhotoUpdated,
+		Data:      map[string]interface{}{"album": album, "current": current, "photo": p},
+		Timestamp: time.Now().UnixMilli(),
+	}
+	return &p
+}
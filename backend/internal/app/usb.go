@@ -0,0 +1,71 @@
+package app
+
+import (
+	"strings"
+	"time"
+
+	"photobooth/internal/config"
+	"photobooth/internal/disk"
+	"photobooth/internal/export"
+	"photobooth/internal/websocket"
+)
+
+// USB device events for the dashboard.
+const (
+	EventUsbDeviceAdded   = "usb_device_added"
+	EventUsbDeviceRemoved = "usb_device_removed"
+)
+
+// StartUsbWatcher pushes plugged/removed sticks to the dashboard and runs the
+// auto-export rules from the config.
+func (a *App) StartUsbWatcher() {
+	w := disk.NewUsbWatcher(2 * time.Second)
+	w.OnAdded = func(dev disk.UsbDevice) {
+		a.Hub.Broadcast <- websocket.Event{Type: EventUsbDeviceAdded, Data: dev, Timestamp: time.Now().UnixMilli()}
+		a.autoExport(dev)
+	}
+	w.OnRemoved = func(dev disk.UsbDevice) {
+		a.Hub.Broadcast <- websocket.Event{Type: EventUsbDeviceRemoved, Data: dev, Timestamp: time.Now().UnixMilli()}
+	}
+	w.Start()
+}
+
+// autoExport resumes interrupted exports of the stick or queues one if a rule
+// matches the stick's label.
+func (a *App) autoExport(dev disk.UsbDevice) {
+	if a.Export == nil {
+		return
+	}
+	if a.Export.Resume(dev) > 0 {
+		return
+	}
+
+	for _, rule := range a.Config.Usb.AutoExport {
+		if rule.Label != "*" && !strings.EqualFold(rule.Label, dev.Label) {
+			continue
+		}
+		var albums []string
+		switch strings.ToLower(rule.Albums) {
+		case "", "current":
+			albums = []string{config.SanitizeAlbumName(a.Config.Booth.CurrentAlbum)}
+		case "all":
+			albums = a.albumIds()
+		default:
+			albums = []string{config.SanitizeAlbumName(rule.Albums)}
+		}
+		a.Log.Info("usb", "Stick '%s' matches auto-export rule (%s → %s)", dev.Label, rule.Label, rule.Albums)
+		req := export.Request{
+			Device:       dev.Name,
+			Albums:       albums,
+			Contents:     rule.Contents,
+			Format:       a.Config.Usb.Format,
+			NameTemplate: a.Config.Usb.NameTemplate,
+			Slideshow:    a.Config.Usb.Slideshow,
+			Trigger:      export.TriggerRule,
+		}
+		if _, err := a.Export.Submit(req); err != nil {
+			a.Log.Warn("usb", "Auto-export to %s not started: %v", dev.Name, err)
+		}
+		return
+	}
+}
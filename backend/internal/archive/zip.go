@@ -0,0 +1,464 @@
+package archive
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"hash/fnv"
+	"io"
+	"os"
+	"sync"
+	"time"
+)
+
+// Entry is one file of an archive. Either Path (a file on disk) or Data (generated
+// content such as a manifest) is set.
+type Entry struct {
+	Name    string // path inside the archive, forward slashes
+	Path    string
+	Data    []byte
+	Size    int64
+	ModTime time.Time
+	Version string // identifies the file content for ETag (mtime, checksum); not stored
+}
+
+// Zip is an uncompressed ("stored") ZIP archive whose complete byte layout is
+// computed up front from the file sizes. That makes the total length known before
+// the first byte is sent and lets any byte range be produced on demand, so HTTP
+// range requests can resume an interrupted download without a temp file.
+//
+// Photos are already compressed, so storing them costs almost nothing in size.
+// CRCs are only known after reading a file; they go into a data descriptor after
+// each file and into the central directory at the end.
+type Zip struct {
+	entries []Entry
+	zip64   bool
+	offsets []int64 // start of each local header
+	size    int64
+	cdStart int64
+
+	mu   sync.Mutex
+	crcs map[int]uint32
+	cd   []byte // central directory + end records, built once all CRCs are known
+
+	pos  int64
+	file *os.File
+	fidx int
+
+	// running CRC for sequential reads of an entry's data
+	runIdx int
+	runPos int64
+	runCrc uint32
+}
+
+const (
+	localHeaderLen   = 30
+	centralHeaderLen = 46
+	eocdLen          = 22
+	eocd64Len        = 56
+	locator64Len     = 20
+	zip64ExtraLocal  = 4 + 16
+	zip64ExtraCentr  = 4 + 24
+
+	flagDescriptor = 0x0008
+	flagUTF8       = 0x0800
+)
+
+// NewZip lays out an archive for the given entries.
+func NewZip(entries []Entry) *Zip {
+	z := &Zip{entries: entries, crcs: make(map[int]uint32), fidx: -1, runIdx: -1}
+	for i := range entries {
+		if entries[i].Data != nil {
+			entries[i].Size = int64(len(entries[i].Data))
+			z.crcs[i] = crc32.ChecksumIEEE(entries[i].Data)
+		}
+	}
+
+	// zip64 is only used when the classic 32-bit fields would overflow, since
+	// some older unzip tools cannot read it
+	z.zip64 = len(entries) >= 0xFFFF || z.layout() >= 0xFFFFFFFF
+	if z.zip64 {
+		z.layout()
+	}
+	return z
+}
+
+// layout computes all offsets and returns the offset of the central directory.
+func (z *Zip) layout() int64 {
+	z.offsets = make([]int64, len(z.entries))
+	var off int64
+	for i, e := range z.entries {
+		z.offsets[i] = off
+		off += int64(localHeaderLen+len(e.Name)) + z.localExtraLen() + e.Size + z.descriptorLen()
+	}
+	z.cdStart = off
+
+	for _, e := range z.entries {
+		off += int64(centralHeaderLen + len(e.Name))
+		if z.zip64 {
+			off += zip64ExtraCentr
+		}
+	}
+	if z.zip64 {
+		off += eocd64Len + locator64Len
+	}
+	z.size = off + eocdLen
+	return z.cdStart
+}
+
+func (z *Zip) localExtraLen() int64 {
+	if z.zip64 {
+		return zip64ExtraLocal
+	}
+	return 0
+}
+
+func (z *Zip) descriptorLen() int64 {
+	if z.zip64 {
+		return 24
+	}
+	return 16
+}
+
+// Size is the total length of the archive in bytes.
+func (z *Zip) Size() int64 {
+	return z.size
+}
+
+// Seek implements io.Seeker.
+func (z *Zip) Seek(offset int64, whence int) (int64, error) {
+	var abs int64
+	switch whence {
+	case io.SeekStart:
+		abs = offset
+	case io.SeekCurrent:
+		abs = z.pos + offset
+	case io.SeekEnd:
+		abs = z.size + offset
+	default:
+		return 0, errors.New("zip: invalid whence")
+	}
+	if abs < 0 {
+		return 0, errors.New("zip: negative position")
+	}
+	z.pos = abs
+	return abs, nil
+}
+
+// Read implements io.Reader, producing the archive bytes at the current position.
+func (z *Zip) Read(p []byte) (int, error) {
+	if z.pos >= z.size {
+		return 0, io.EOF
+	}
+	n, err := z.readAt(p, z.pos)
+	z.pos += int64(n)
+	return n, err
+}
+
+// Close releases the open file handle.
+func (z *Zip) Close() error {
+	if z.file != nil {
+		err := z.file.Close()
+		z.file = nil
+		z.fidx = -1
+		return err
+	}
+	return nil
+}
+
+func (z *Zip) readAt(p []byte, pos int64) (int, error) {
+	if pos >= z.cdStart {
+		cd, err := z.centralDirectory()
+		if err != nil {
+			return 0, err
+		}
+		return copy(p, cd[pos-z.cdStart:]), nil
+	}
+
+	// Find the entry this position belongs to
+	i := len(z.offsets) - 1
+	for lo, hi := 0, len(z.offsets)-1; lo <= hi; {
+		mid := (lo + hi) / 2
+		if z.offsets[mid] <= pos {
+			i = mid
+			lo = mid + 1
+		} else {
+			hi = mid - 1
+		}
+	}
+	e := &z.entries[i]
+	rel := pos - z.offsets[i]
+
+	header := z.localHeader(i)
+	if rel < int64(len(header)) {
+		return copy(p, header[rel:]), nil
+	}
+	rel -= int64(len(header))
+
+	if rel < e.Size {
+		if int64(len(p)) > e.Size-rel {
+			p = p[:e.Size-rel]
+		}
+		return z.readData(i, p, rel)
+	}
+	rel -= e.Size
+
+	crc, err := z.crc(i)
+	if err != nil {
+		return 0, err
+	}
+	return copy(p, z.descriptor(i, crc)[rel:]), nil
+}
+
+// readData reads file content and keeps a running CRC while the entry is read
+// front to back, so a plain download never reads a file twice.
+func (z *Zip) readData(i int, p []byte, off int64) (int, error) {
+	e := &z.entries[i]
+	var n int
+	if e.Data != nil {
+		n = copy(p, e.Data[off:])
+	} else {
+		if z.fidx != i {
+			z.Close()
+			f, err := os.Open(e.Path)
+			if err != nil {
+				return 0, err
+			}
+			z.file, z.fidx = f, i
+		}
+		var err error
+		n, err = z.file.ReadAt(p, off)
+		if err == io.EOF && int64(n) < int64(len(p)) {
+			return n, fmt.Errorf("zip: %s shrank while being read", e.Name)
+		}
+		if err != nil && err != io.EOF {
+			return n, err
+		}
+	}
+
+	if off == 0 {
+		z.runIdx, z.runPos, z.runCrc = i, 0, 0
+	}
+	if z.runIdx == i && z.runPos == off {
+		z.runCrc = crc32.Update(z.runCrc, crc32.IEEETable, p[:n])
+		z.runPos += int64(n)
+		if z.runPos == e.Size {
+			z.mu.Lock()
+			z.crcs[i] = z.runCrc
+			z.mu.Unlock()
+			z.runIdx = -1
+		}
+	}
+	return n, nil
+}
+
+// crc returns the CRC of an entry, reading the file if it was not streamed yet
+// (e.g. a resumed download that skipped it).
+func (z *Zip) crc(i int) (uint32, error) {
+	z.mu.Lock()
+	c, ok := z.crcs[i]
+	z.mu.Unlock()
+	if ok {
+		return c, nil
+	}
+
+	f, err := os.Open(z.entries[i].Path)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	h := crc32.NewIEEE()
+	if _, err := io.Copy(h, f); err != nil {
+		return 0, err
+	}
+	c = h.Sum32()
+
+	z.mu.Lock()
+	z.crcs[i] = c
+	z.mu.Unlock()
+	return c, nil
+}
+
+func (z *Zip) version() uint16 {
+	if z.zip64 {
+		return 45
+	}
+	return 20
+}
+
+func (z *Zip) localHeader(i int) []byte {
+	e := &z.entries[i]
+	b := make([]byte, 0, localHeaderLen+len(e.Name)+zip64ExtraLocal)
+	t, d := dosTime(e.ModTime)
+
+	b = binary.LittleEndian.AppendUint32(b, 0x04034b50)
+	b = binary.LittleEndian.AppendUint16(b, z.version())
+	b = binary.LittleEndian.AppendUint16(b, flagDescriptor|flagUTF8)
+	b = binary.LittleEndian.AppendUint16(b, 0) // stored
+	b = binary.LittleEndian.AppendUint16(b, t)
+	b = binary.LittleEndian.AppendUint16(b, d)
+	b = binary.LittleEndian.AppendUint32(b, 0) // CRC follows in the descriptor
+	if z.zip64 {
+		b = binary.LittleEndian.AppendUint32(b, 0xFFFFFFFF)
+		b = binary.LittleEndian.AppendUint32(b, 0xFFFFFFFF)
+	} else {
+		b = binary.LittleEndian.AppendUint32(b, uint32(e.Size))
+		b = binary.LittleEndian.AppendUint32(b, uint32(e.Size))
+	}
+	b = binary.LittleEndian.AppendUint16(b, uint16(len(e.Name)))
+	b = binary.LittleEndian.AppendUint16(b, uint16(z.localExtraLen()))
+	b = append(b, e.Name...)
+	if z.zip64 {
+		b = binary.LittleEndian.AppendUint16(b, 0x0001)
+		b = binary.LittleEndian.AppendUint16(b, 16)
+		b = binary.LittleEndian.AppendUint64(b, uint64(e.Size))
+		b = binary.LittleEndian.AppendUint64(b, uint64(e.Size))
+	}
+	return b
+}
+
+func (z *Zip) descriptor(i int, crc uint32) []byte {
+	size := z.entries[i].Size
+	b := make([]byte, 0, 24)
+	b = binary.LittleEndian.AppendUint32(b, 0x08074b50)
+	b = binary.LittleEndian.AppendUint32(b, crc)
+	if z.zip64 {
+		b = binary.LittleEndian.AppendUint64(b, uint64(size))
+		b = binary.LittleEndian.AppendUint64(b, uint64(size))
+	} else {
+		b = binary.LittleEndian.AppendUint32(b, uint32(size))
+		b = binary.LittleEndian.AppendUint32(b, uint32(size))
+	}
+	return b
+}
+
+// centralDirectory builds the trailing records once; every CRC is needed for it.
+func (z *Zip) centralDirectory() ([]byte, error) {
+	z.mu.Lock()
+	cd := z.cd
+	z.mu.Unlock()
+	if cd != nil {
+		return cd, nil
+	}
+
+	b := make([]byte, 0, z.size-z.cdStart)
+	for i := range z.entries {
+		e := &z.entries[i]
+		crc, err := z.crc(i)
+		if err != nil {
+			return nil, err
+		}
+		t, d := dosTime(e.ModTime)
+
+		b = binary.LittleEndian.AppendUint32(b, 0x02014b50)
+		b = binary.LittleEndian.AppendUint16(b, 3<<8|z.version()) // made by: Unix
+		b = binary.LittleEndian.AppendUint16(b, z.version())
+		b = binary.LittleEndian.AppendUint16(b, flagDescriptor|flagUTF8)
+		b = binary.LittleEndian.AppendUint16(b, 0)
+		b = binary.LittleEndian.AppendUint16(b, t)
+		b = binary.LittleEndian.AppendUint16(b, d)
+		b = binary.LittleEndian.AppendUint32(b, crc)
+		if z.zip64 {
+			b = binary.LittleEndian.AppendUint32(b, 0xFFFFFFFF)
+			b = binary.LittleEndian.AppendUint32(b, 0xFFFFFFFF)
+		} else {
+			b = binary.LittleEndian.AppendUint32(b, uint32(e.Size))
+			b = binary.LittleEndian.AppendUint32(b, uint32(e.Size))
+		}
+		b = binary.LittleEndian.AppendUint16(b, uint16(len(e.Name)))
+		if z.zip64 {
+			b = binary.LittleEndian.AppendUint16(b, zip64ExtraCentr)
+		} else {
+			b = binary.LittleEndian.AppendUint16(b, 0)
+		}
+		b = binary.LittleEndian.AppendUint16(b, 0)           // comment
+		b = binary.LittleEndian.AppendUint16(b, 0)           // disk
+		b = binary.LittleEndian.AppendUint16(b, 0)           // internal attributes
+		b = binary.LittleEndian.AppendUint32(b, 0100644<<16) // regular file, rw-r--r--
+		if z.zip64 {
+			b = binary.LittleEndian.AppendUint32(b, 0xFFFFFFFF)
+		} else {
+			b = binary.LittleEndian.AppendUint32(b, uint32(z.offsets[i]))
+		}
+		b = append(b, e.Name...)
+		if z.zip64 {
+			b = binary.LittleEndian.AppendUint16(b, 0x0001)
+			b = binary.LittleEndian.AppendUint16(b, 24)
+			b = binary.LittleEndian.AppendUint64(b, uint64(e.Size))
+			b = binary.LittleEndian.AppendUint64(b, uint64(e.Size))
+			b = binary.LittleEndian.AppendUint64(b, uint64(z.offsets[i]))
+		}
+	}
+	cdSize := int64(len(b))
+	count := uint64(len(z.entries))
+
+	if z.zip64 {
+		eocd64 := z.cdStart + cdSize
+		b = binary.LittleEndian.AppendUint32(b, 0x06064b50)
+		b = binary.LittleEndian.AppendUint64(b, eocd64Len-12)
+		b = binary.LittleEndian.AppendUint16(b, 3<<8|45)
+		b = binary.LittleEndian.AppendUint16(b, 45)
+		b = binary.LittleEndian.AppendUint32(b, 0)
+		b = binary.LittleEndian.AppendUint32(b, 0)
+		b = binary.LittleEndian.AppendUint64(b, count)
+		b = binary.LittleEndian.AppendUint64(b, count)
+		b = binary.LittleEndian.AppendUint64(b, uint64(cdSize))
+		b = binary.LittleEndian.AppendUint64(b, uint64(z.cdStart))
+
+		b = binary.LittleEndian.AppendUint32(b, 0x07064b50)
+		b = binary.LittleEndian.AppendUint32(b, 0)
+		b = binary.LittleEndian.AppendUint64(b, uint64(eocd64))
+		b = binary.LittleEndian.AppendUint32(b, 1)
+	}
+
+	b = binary.LittleEndian.AppendUint32(b, 0x06054b50)
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	b = binary.LittleEndian.AppendUint16(b, 0)
+	if z.zip64 {
+		b = binary.LittleEndian.AppendUint16(b, 0xFFFF)
+		b = binary.LittleEndian.AppendUint16(b, 0xFFFF)
+		b = binary.LittleEndian.AppendUint32(b, 0xFFFFFFFF)
+		b = binary.LittleEndian.AppendUint32(b, 0xFFFFFFFF)
+	} else {
+		b = binary.LittleEndian.AppendUint16(b, uint16(count))
+		b = binary.LittleEndian.AppendUint16(b, uint16(count))
+		b = binary.LittleEndian.AppendUint32(b, uint32(cdSize))
+		b = binary.LittleEndian.AppendUint32(b, uint32(z.cdStart))
+	}
+	b = binary.LittleEndian.AppendUint16(b, 0)
+
+	if int64(len(b)) != z.size-z.cdStart {
+		return nil, fmt.Errorf("zip: central directory is %d bytes, expected %d", len(b), z.size-z.cdStart)
+	}
+
+	z.mu.Lock()
+	z.cd = b
+	z.mu.Unlock()
+	return b, nil
+}
+
+// dosTime converts to the MS-DOS time and date fields used by ZIP headers.
+func dosTime(t time.Time) (uint16, uint16) {
+	t = t.Local()
+	if t.Year() < 1980 {
+		t = time.Date(1980, 1, 1, 0, 0, 0, 0, time.Local)
+	}
+	tm := uint16(t.Hour()<<11 | t.Minute()<<5 | t.Second()/2)
+	dt := uint16((t.Year()-1980)<<9 | int(t.Month())<<5 | t.Day())
+	return tm, dt
+}
+
+// ETag identifies the layout and content. It changes whenever a file is added,
+// removed, changes size or its Version changes, so a resumed download (If-Range)
+// never mixes two layouts or two versions of a photo edited in place.
+func (z *Zip) ETag() string {
+	h := fnv.New64a()
+	for i, e := range z.entries {
+		fmt.Fprintf(h, "%s|%d|%d|%s|", e.Name, e.Size, e.ModTime.Unix(), e.Version)
+		if e.Data != nil {
+			fmt.Fprintf(h, "%08x|", z.crcs[i])
+		}
+	}
+	return fmt.Sprintf(`"%016x"`, h.Sum64())
+}
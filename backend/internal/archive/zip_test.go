@@ -0,0 +1,151 @@
+package archive
+
+import (
+	"archive/zip"
+	"bytes"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+// testEntries writes a few files of different sizes and adds a generated one.
+func testEntries(t *testing.T) ([]Entry, map[string][]byte) {
+	t.Helper()
+	dir := t.TempDir()
+	want := make(map[string][]byte)
+	var entries []Entry
+	mod := time.Date(2026, 5, 16, 18, 30, 0, 0, time.Local)
+	for i, size := range []int{0, 1, 4096, 100000} {
+		data := make([]byte, size)
+		for k := range data {
+			data[k] = byte(k*7 + i)
+		}
+		path := filepath.Join(dir, fmt.Sprintf("IMG_%04d.jpg", i))
+		if err := os.WriteFile(path, data, 0644); err != nil {
+			t.Fatal(err)
+		}
+		name := "Hochzeit Müller/original/" + filepath.Base(path)
+		entries = append(entries, Entry{Name: name, Path: path, Size: int64(size), ModTime: mod})
+		want[name] = data
+	}
+	manifest := []byte(`{"album":"hochzeit"}`)
+	entries = append(entries, Entry{Name: "Hochzeit Müller/manifest.json", Data: manifest, ModTime: mod})
+	want["Hochzeit Müller/manifest.json"] = manifest
+	return entries, want
+}
+
+func readAll(t *testing.T, z *Zip, from int64) []byte {
+	t.Helper()
+	if _, err := z.Seek(from, io.SeekStart); err != nil {
+		t.Fatal(err)
+	}
+	b, err := io.ReadAll(z)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return b
+}
+
+func TestZipReadsBack(t *testing.T) {
+	entries, want := testEntries(t)
+	z := NewZip(entries)
+	defer z.Close()
+
+	b := readAll(t, z, 0)
+	if int64(len(b)) != z.Size() {
+		t.Fatalf("read %d bytes, Size() = %d", len(b), z.Size())
+	}
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.File) != len(want) {
+		t.Fatalf("archive has %d files, want %d", len(r.File), len(want))
+	}
+	for _, f := range r.File {
+		rc, err := f.Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		// Reading to the end checks the CRC
+		got, err := io.ReadAll(rc)
+		rc.Close()
+		if err != nil {
+			t.Fatalf("%s: %v", f.Name, err)
+		}
+		if !bytes.Equal(got, want[f.Name]) {
+			t.Errorf("%s: content differs", f.Name)
+		}
+		if f.Method != zip.Store {
+			t.Errorf("%s: method %d, want stored", f.Name, f.Method)
+		}
+	}
+}
+
+func TestZipResumeMatchesFullRead(t *testing.T) {
+	entries, _ := testEntries(t)
+	full := readAll(t, NewZip(entries), 0)
+
+	for _, from := range []int64{1, 29, 31, 4200, int64(len(full)) / 2, int64(len(full)) - 30, int64(len(full)) - 1} {
+		// A fresh archive has no CRCs yet, like a resumed download after a restart
+		z := NewZip(append([]Entry(nil), entries...))
+		got := readAll(t, z, from)
+		z.Close()
+		if !bytes.Equal(got, full[from:]) {
+			t.Errorf("read from %d differs from the full read", from)
+		}
+	}
+
+	// Small reads with seeks in between, as a download manager with several connections
+	z := NewZip(append([]Entry(nil), entries...))
+	defer z.Close()
+	buf := make([]byte, 777)
+	for _, from := range []int64{int64(len(full)) - 500, 0, 5000, 100} {
+		z.Seek(from, io.SeekStart)
+		n, err := io.ReadFull(z, buf[:min(len(buf), len(full)-int(from))])
+		if err != nil {
+			t.Fatal(err)
+		}
+		if !bytes.Equal(buf[:n], full[from:from+int64(n)]) {
+			t.Errorf("read of %d bytes at %d differs", n, from)
+		}
+	}
+}
+
+func TestZip64OnlyAboveLimits(t *testing.T) {
+	small := func(n int) []Entry {
+		entries := make([]Entry, n)
+		for i := range entries {
+			entries[i] = Entry{Name: fmt.Sprintf("f%d", i), Data: []byte{byte(i)}}
+		}
+		return entries
+	}
+	if z := NewZip(small(0xFFFE)); z.zip64 {
+		t.Error("zip64 used for 65534 entries")
+	}
+	z := NewZip(small(0xFFFF))
+	if !z.zip64 {
+		t.Fatal("zip64 not used for 65535 entries")
+	}
+	b := readAll(t, z, 0)
+	r, err := zip.NewReader(bytes.NewReader(b), int64(len(b)))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(r.File) != 0xFFFF {
+		t.Errorf("zip64 archive has %d files, want 65535", len(r.File))
+	}
+
+	// Only the layout is computed, the (missing) file is never read
+	name := "big.jpg"
+	below := int64(0xFFFFFFFF) - 1 - (localHeaderLen + int64(len(name)) + 16)
+	if z := NewZip([]Entry{{Name: name, Path: "/nonexistent", Size: below}}); z.zip64 {
+		t.Error("zip64 used below 4 GiB")
+	}
+	if z := NewZip([]Entry{{Name: name, Path: "/nonexistent", Size: below + 1}}); !z.zip64 {
+		t.Error("zip64 not used at 4 GiB")
+	}
+}
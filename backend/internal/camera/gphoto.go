@@ -163,11 +163,12 @@ func (c *Controller) VerifyLastCapture() (bool, error) {
 	return false, nil
 }
 
-// DownloadLatestRaw finds the latest RAW file on the camera and downloads it to the given album directory.
-func (c *Controller) DownloadLatestRaw(albumDir string) error {
+// DownloadLatestRaw finds the latest RAW file on the camera, downloads it to the given
+// album directory and returns its filename.
+func (c *Controller) DownloadLatestRaw(albumDir string) (string, error) {
 	if c.config.Mock {
 		c.log.Info("camera", "[MOCK] Downloading mock RAW file...")
-		return nil
+		return "", nil
 	}
 
 	c.log.Info("camera", "Downloading latest RAW file...")
@@ -175,7 +176,7 @@ func (c *Controller) DownloadLatestRaw(albumDir string) error {
 	// List files in folder
 	out, err := exec.Command("gphoto2", "--list-files").CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("list-files failed: %v", err)
+		return "", fmt.Errorf("list-files failed: %v", err)
 	}
 
 	output := string(out)
@@ -213,7 +214,7 @@ func (c *Controller) DownloadLatestRaw(albumDir string) error {
 	}
 
 	if latestRawNum == -1 {
-		return fmt.Errorf("no RAW file found on camera")
+		return "", fmt.Errorf("no RAW file found on camera")
 	}
 
 	destPath := filepath.Join(albumDir, "original", latestRawName)
@@ -224,11 +225,11 @@ func (c *Controller) DownloadLatestRaw(albumDir string) error {
 	// Download the specific RAW file
 	dlOut, err := exec.Command("gphoto2", "--get-file", fmt.Sprintf("%d", latestRawNum), "--force-overwrite", "--filename", destPath).CombinedOutput()
 	if err != nil {
-		return fmt.Errorf("get-file failed: %v – %s", err, strings.TrimSpace(string(dlOut)))
+		return "", fmt.Errorf("get-file failed: %v – %s", err, strings.TrimSpace(string(dlOut)))
 	}
 
 	c.log.Info("camera", "Successfully downloaded RAW: %s to %s", latestRawName, destPath)
-	return nil
+	return latestRawName, nil
 }
 
 // DownloadAllRawToPath downloads all RAW files from the camera to the specified directory.
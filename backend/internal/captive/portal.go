@@ -0,0 +1,250 @@
+package captive
+
+import (
+	"net"
+	"net/http"
+	"os"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"photobooth/internal/config"
+	"photobooth/internal/logging"
+)
+
+// Landing pages guests are sent to from the sign-in sheet.
+const (
+	LandingGallery = "gallery"
+	LandingModes   = "modes"
+)
+
+// acceptTTL is how long a client counts as having seen the portal; a phone that
+// comes back the next day gets the sheet again.
+const acceptTTL = 12 * time.Hour
+
+// acceptPath marks the client as accepted and forwards it to the landing page.
+// Probes redirect here rather than to the page itself, so the probe that the OS
+// sends after the page loaded already succeeds.
+const acceptPath = "/captive/accept"
+
+// probe is a connectivity check of an operating system and the answer it
+// expects when there is internet access.
+type probe struct {
+	os      string
+	status  int
+	body    string
+	content string
+}
+
+// probes by path. The DNS server sends every host name to the booth, so the
+// path alone identifies the probe.
+var probes = map[string]probe{
+	"/generate_204":              {os: "android", status: http.StatusNoContent},
+	"/gen_204":                   {os: "android", status: http.StatusNoContent},
+	"/mobile/status.php":         {os: "android", status: http.StatusNoContent},
+	"/hotspot-detect.html":       {os: "apple", status: http.StatusOK, content: "text/html", body: appleSuccess},
+	"/library/test/success.html": {os: "apple", status: http.StatusOK, content: "text/html", body: appleSuccess},
+	"/connecttest.txt":           {os: "windows", status: http.StatusOK, content: "text/plain", body: "Microsoft Connect Test"},
+	"/ncsi.txt":                  {os: "windows", status: http.StatusOK, content: "text/plain", body: "Microsoft NCSI"},
+	"/redirect":                  {os: "windows", status: http.StatusOK, content: "text/plain"},
+	"/success.txt":               {os: "firefox", status: http.StatusOK, content: "text/plain", body: "success\n"},
+	"/canonical.html":            {os: "firefox", status: http.StatusOK, content: "text/html", body: `<meta http-equiv="refresh" content="0;url=https://support.mozilla.org/kb/captive-portal"/>`},
+	"/nmcheck.txt":               {os: "linux", status: http.StatusOK, content: "text/plain", body: "NetworkManager is online\n"},
+	"/kindle-wifi/wifistub.html": {os: "kindle", status: http.StatusOK, content: "text/html", body: "81ce4465-7167-4dcb-835b-dcc9e44c112a"},
+}
+
+const appleSuccess = "<HTML><HEAD><TITLE>Success</TITLE></HEAD><BODY>Success</BODY></HTML>"
+
+// Client is a device that opened the portal.
+type Client struct {
+	Ip         string    `json:"ip"`
+	Os         string    `json:"os,omitempty"`
+	AcceptedAt time.Time `json:"acceptedAt"`
+}
+
+// Portal answers the connectivity probes of phones and laptops on the hotspot.
+// Until a client has been sent to the landing page its probes are redirected,
+// which makes the OS show its sign-in sheet with the gallery (or mode select);
+// afterwards they succeed and the sheet can be closed while staying connected.
+type Portal struct {
+	wifi func() config.WifiConfig // current settings, they may change at runtime
+	log  *logging.Logger
+
+	mu       sync.Mutex
+	accepted map[string]Client // by IP
+	probing  map[string]string // OS of clients that probed but did not accept yet, by IP
+	names    map[string]bool   // host names of the booth itself
+}
+
+func NewPortal(wifi func() config.WifiConfig) *Portal {
+	p := &Portal{
+		wifi:     wifi,
+		log:      logging.Get(),
+		accepted: make(map[string]Client),
+		probing:  make(map[string]string),
+		names:    map[string]bool{"localhost": true, "photobooth.local": true},
+	}
+	if host, err := os.Hostname(); err == nil {
+		p.names[strings.ToLower(host)] = true
+		p.names[strings.ToLower(host)+".local"] = true
+	}
+	return p
+}
+
+// AddHostNames registers more names the booth is reached by, e.g. static DNS
+// records. Requests for any other name are redirected to the landing page.
+func (p *Portal) AddHostNames(names ...string) {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	for _, n := range names {
+		p.names[strings.ToLower(strings.TrimSuffix(n, "."))] = true
+	}
+}
+
+// RegisterRoutes adds the probe paths. Call it before the SPA fallback is
+// registered and wrap the fallback with Wrap.
+func (p *Portal) RegisterRoutes(mux *http.ServeMux) {
+	for path, pr := range probes {
+		pr := pr
+		mux.HandleFunc(path, func(w http.ResponseWriter, r *http.Request) {
+			p.handleProbe(w, r, pr)
+		})
+	}
+	mux.HandleFunc(acceptPath, p.handleAccept)
+}
+
+// Wrap sends requests for foreign host names (a browser opening any web site
+// while DNS points everything at the booth) to the landing page instead of
+// serving them the app under a wrong address.
+func (p *Portal) Wrap(next http.HandlerFunc) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		if p.wifi().CaptivePortal && p.foreign(r.Host) {
+			p.redirect(w, r, acceptPath)
+			return
+		}
+		next(w, r)
+	}
+}
+
+// Accepted lists the clients that have seen the portal.
+func (p *Portal) Accepted() []Client {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	p.pruneLocked()
+	list := make([]Client, 0, len(p.accepted))
+	for _, c := range p.accepted {
+		list = append(list, c)
+	}
+	sort.Slice(list, func(i, k int) bool { return list[i].AcceptedAt.After(list[k].AcceptedAt) })
+	return list
+}
+
+// Reset forgets all clients, so every phone gets the sheet again on its next probe.
+func (p *Portal) Reset() {
+	p.mu.Lock()
+	p.accepted = make(map[string]Client)
+	p.probing = make(map[string]string)
+	p.mu.Unlock()
+}
+
+func (p *Portal) handleProbe(w http.ResponseWriter, r *http.Request, pr probe) {
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	ip := clientIp(r)
+	if !p.wifi().CaptivePortal || p.isAccepted(ip) {
+		// Pretend to be online so the sheet closes (or never opens)
+		if pr.content != "" {
+			w.Header().Set("Content-Type", pr.content)
+		}
+		w.WriteHeader(pr.status)
+		if pr.body != "" {
+			w.Write([]byte(pr.body))
+		}
+		return
+	}
+	p.log.Debug("captive", "Portal probe %s from %s (%s), redirecting", r.URL.Path, ip, pr.os)
+	p.remember(ip, pr.os, false)
+	p.redirect(w, r, acceptPath)
+}
+
+func (p *Portal) handleAccept(w http.ResponseWriter, r *http.Request) {
+	ip := clientIp(r)
+	if p.remember(ip, "", true) {
+		p.log.Info("captive", "Client %s opened the portal", ip)
+	}
+	w.Header().Set("Cache-Control", "no-cache, no-store, must-revalidate")
+	p.redirect(w, r, p.landingPath())
+}
+
+// redirect answers with a 302 to path on the booth's own address. Some probes
+// only count a redirect to a different host as a portal.
+func (p *Portal) redirect(w http.ResponseWriter, r *http.Request, path string) {
+	host := p.wifi().IpAddress
+	if !p.foreign(r.Host) {
+		host = r.Host
+	}
+	http.Redirect(w, r, "http://"+host+path, http.StatusFound)
+}
+
+func (p *Portal) landingPath() string {
+	if p.wifi().PortalLanding == LandingModes {
+		return "/modes"
+	}
+	return "/gallery"
+}
+
+// remember records a client; accepted marks it as having opened the portal.
+// Reports whether it was newly accepted.
+func (p *Portal) remember(ip, osName string, accepted bool) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	if !accepted {
+		p.probing[ip] = osName
+		return false
+	}
+	p.pruneLocked()
+	prev, had := p.accepted[ip]
+	c := Client{Ip: ip, Os: prev.Os, AcceptedAt: time.Now()}
+	if o, ok := p.probing[ip]; ok {
+		c.Os = o
+		delete(p.probing, ip)
+	}
+	p.accepted[ip] = c
+	return !had
+}
+
+func (p *Portal) isAccepted(ip string) bool {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	c, ok := p.accepted[ip]
+	return ok && time.Since(c.AcceptedAt) < acceptTTL
+}
+
+func (p *Portal) pruneLocked() {
+	for ip, c := range p.accepted {
+		if time.Since(c.AcceptedAt) >= acceptTTL {
+			delete(p.accepted, ip)
+		}
+	}
+}
+
+// foreign reports whether host (from the Host header) is not the booth.
+func (p *Portal) foreign(host string) bool {
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	host = strings.ToLower(strings.TrimSuffix(host, "."))
+	if host == "" || net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return false // addressed by IP
+	}
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return !p.names[host]
+}
+
+func clientIp(r *http.Request) string {
+	if host, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+		return host
+	}
+	return r.RemoteAddr
+}
@@ -10,10 +10,20 @@ import (
 )
 
 type Config struct {
-	Wifi   WifiConfig   `json:"wifi"`
-	Camera CameraConfig `json:"camera"`
-	Image  ImageConfig  `json:"image"`
-	Booth  BoothConfig  `json:"booth"`
+	Wifi    WifiConfig    `json:"wifi"`
+	Camera  CameraConfig  `json:"camera"`
+	Image   ImageConfig   `json:"image"`
+	Booth   BoothConfig   `json:"booth"`
+	Share   ShareConfig   `json:"share"`
+	Upload  UploadConfig  `json:"upload"`
+	Sync    SyncConfig    `json:"sync"`
+	Trash   TrashConfig   `json:"trash"`
+	Mirror  MirrorConfig  `json:"mirror"`
+	Storage StorageConfig `json:"storage"`
+	Usb     UsbConfig     `json:"usb"`
+
+	Webhooks []WebhookConfig `json:"webhooks"`
+	Mqtt     MqttConfig      `json:"mqtt"`
 
 	mu       sync.Mutex `json:"-"`
 	filePath string     `json:"-"`
@@ -28,6 +38,39 @@ type WifiConfig struct {
 	DhcpRangeStart string `json:"dhcpRangeStart"`
 	DhcpRangeEnd   string `json:"dhcpRangeEnd"`
 	CaptivePortal  bool   `json:"captivePortal"`
+	PortalLanding  string `json:"portalLanding"` // page the sign-in sheet opens: "gallery" or "modes"
+	Band           string `json:"band"`          // hotspot band: "bg" (2.4 GHz) or "a" (5 GHz)
+	Channel        int    `json:"channel"`       // hotspot channel, 0 picks one automatically
+
+	// Mode is "hotspot" (own access point), "client" (join one of Networks) or
+	// "auto" (join one of Networks, fall back to the hotspot if none connects).
+	Mode            string        `json:"mode"`
+	Networks        []WifiNetwork `json:"networks"`        // venue networks, tried in order
+	ConnectTimeout  int           `json:"connectTimeout"`  // seconds to wait for a network to connect
+	LostTimeout     int           `json:"lostTimeout"`     // seconds a lost connection may take to come back before the next network (or the hotspot) is tried
+	RetryClientSecs int           `json:"retryClientSecs"` // in auto mode, how often to look for a saved network while on the hotspot and no guest is connected to it (the scan takes it down); 0 only on request
+
+	Dns DnsConfig `json:"dns"`
+}
+
+// DnsConfig controls the DNS server guests on the hotspot use.
+type DnsConfig struct {
+	// Mode is "captive" (every name points at the booth), "allowlist" (names in
+	// Allowlist are resolved upstream) or "passthrough" (everything is resolved
+	// upstream). Forwarding only happens while an upstream resolver answers;
+	// without uplink the booth falls back to captive answers.
+	Mode       string            `json:"mode"`
+	Upstream   []string          `json:"upstream"`   // resolvers as "host" or "host:port"
+	Allowlist  []string          `json:"allowlist"`  // domains, including their subdomains
+	Records    map[string]string `json:"records"`    // static A records, an empty address means the booth itself
+	LogQueries bool              `json:"logQueries"` // log every query at debug level, for troubleshooting
+}
+
+// WifiNetwork is a saved venue network for client mode.
+type WifiNetwork struct {
+	Ssid     string `json:"ssid"`
+	Password string `json:"password"` // empty for open networks
+	Hidden   bool   `json:"hidden,omitempty"`
 }
 
 type CameraConfig struct {
@@ -53,17 +96,159 @@ type BoothConfig struct {
 	AlbumCaptureMethods   map[string]string `json:"albumCaptureMethods"` // sanitized -> strategy (A, B, C)
 }
 
+// TrashConfig controls how long deleted photos and albums can be restored.
+type TrashConfig struct {
+	RetentionDays int `json:"retentionDays"` // purge items older than this, 0 = keep until space is needed
+	MinFreeMB     int `json:"minFreeMb"`     // purge oldest items while free disk space is below this
+}
+
+// UsbConfig controls what happens when a USB stick is plugged in.
+type UsbConfig struct {
+	AutoExport []UsbExportRule `json:"autoExport"` // first matching rule wins
+
+	// Defaults for exports that do not choose themselves (auto-export rules, API calls)
+	Format       string `json:"format"`       // "folder", "zip" or "zip_split"
+	NameTemplate string `json:"nameTemplate"` // e.g. "{album} - {seq}"; placeholders {album} {seq} {date} {time} {name}
+	Slideshow    bool   `json:"slideshow"`    // add an HTML page to browse the photos offline
+}
+
+// UsbExportRule starts an export when a stick with a matching label is plugged in,
+// e.g. {"label": "PB_BACKUP", "albums": "all"} or {"label": "*", "albums": "current"}.
+type UsbExportRule struct {
+	Label    string   `json:"label"`              // volume label (case-insensitive), "*" matches any stick
+	Albums   string   `json:"albums"`             // "current", "all" or an album name
+	Contents []string `json:"contents,omitempty"` // originals, raw, previews, composites, manifest (default: originals, raw, manifest)
+}
+
+// StorageConfig sets the free space guardrails of the photo drive.
+type StorageConfig struct {
+	WarnFreeMB         int  `json:"warnFreeMb"`         // broadcast a warning below this
+	ErrorFreeMB        int  `json:"errorFreeMb"`        // broadcast an error below this
+	MinFreeMB          int  `json:"minFreeMb"`          // refuse new captures below this
+	CleanupTrash       bool `json:"cleanupTrash"`       // below the warn threshold, purge trash items of other albums
+	CleanupDerivatives bool `json:"cleanupDerivatives"` // below the warn threshold, delete previews/thumbs of old albums
+	CleanupAfterDays   int  `json:"cleanupAfterDays"`   // albums without captures for this long count as old
+}
+
+// MirrorConfig copies every capture to a second location (e.g. a USB drive) right
+// after it is taken, so a dying SD card does not lose the event.
+type MirrorConfig struct {
+	Enabled      bool   `json:"enabled"`
+	Path         string `json:"path"`         // mount point of the drive or a second folder
+	RequireMount bool   `json:"requireMount"` // only write when path is on another file system than the photos
+	IncludeRaw   bool   `json:"includeRaw"`
+}
+
+// ShareConfig controls the guest download portal (/p/<token>).
+type ShareConfig struct {
+	Enabled  bool        `json:"enabled"`
+	BaseUrl  string      `json:"baseUrl"`  // e.g. http://192.168.4.1 – defaults to the WiFi IP
+	Download string      `json:"download"` // "original", "preview" or "branded"
+	Overlay  string      `json:"overlay"`  // PNG laid over the photo for "branded", e.g. a logo bar or frame
+	Email    EmailConfig `json:"email"`
+}
+
+// EmailConfig configures delivery of photos by mail via SMTP.
+type EmailConfig struct {
+	Enabled       bool   `json:"enabled"`
+	SmtpHost      string `json:"smtpHost"`
+	SmtpPort      int    `json:"smtpPort"`
+	Username      string `json:"username"`
+	Password      string `json:"password"`
+	StartTLS      bool   `json:"startTls"`
+	From          string `json:"from"`
+	Subject       string `json:"subject"`
+	Body          string `json:"body"`
+	Attachment    string `json:"attachment"`    // "original" or "preview"
+	MaxAttempts   int    `json:"maxAttempts"`   // give up after this many failed sends
+	RetrySeconds  int    `json:"retrySeconds"`  // base delay between retries (doubles per attempt)
+	RatePerMinute int    `json:"ratePerMinute"` // max mails sent per minute
+}
+
+// UploadConfig configures background upload to an S3-compatible bucket (AWS, MinIO, ...).
+type UploadConfig struct {
+	Enabled         bool   `json:"enabled"`
+	Endpoint        string `json:"endpoint"` // e.g. https://s3.eu-central-1.amazonaws.com or http://minio.local:9000
+	Region          string `json:"region"`
+	Bucket          string `json:"bucket"`
+	AccessKey       string `json:"accessKey"`
+	SecretKey       string `json:"secretKey"`
+	Prefix          string `json:"prefix"`          // key prefix, the album id is appended
+	IncludePreviews bool   `json:"includePreviews"` // also upload preview/ next to original/
+	PauseWhileBusy  bool   `json:"pauseWhileBusy"`  // only upload while the booth is idle
+	RetrySeconds    int    `json:"retrySeconds"`    // base delay between retries (doubles per attempt)
+}
+
+// SyncConfig lists remote folders (e.g. Nextcloud via WebDAV) that albums are mirrored to.
+type SyncConfig struct {
+	Targets []SyncTarget `json:"targets"`
+}
+
+// SyncTarget is one remote sync destination.
+type SyncTarget struct {
+	Name            string `json:"name"`
+	Type            string `json:"type"` // "webdav"
+	Enabled         bool   `json:"enabled"`
+	Url             string `json:"url"` // e.g. https://cloud.example.com/remote.php/dav/files/booth/Events
+	Username        string `json:"username"`
+	Password        string `json:"password"`
+	IncludePreviews bool   `json:"includePreviews"`
+	Mode            string `json:"mode"`            // "onCapture", "schedule" or "manual"
+	IntervalMinutes int    `json:"intervalMinutes"` // for mode "schedule"
+}
+
+// WebhookConfig is one outbound HTTP endpoint notified about booth events.
+type WebhookConfig struct {
+	Name    string   `json:"name"`
+	Enabled bool     `json:"enabled"`
+	Url     string   `json:"url"`
+	Events  []string `json:"events"` // e.g. ["photo_ready", "status"]; empty = everything except "log"
+	Secret  string   `json:"secret"` // optional, signs the body with HMAC-SHA256
+}
+
+// MqttConfig connects the booth to an MQTT broker (e.g. Home Assistant) for
+// lighting cues and remote triggers.
+type MqttConfig struct {
+	Enabled        bool   `json:"enabled"`
+	Broker         string `json:"broker"` // e.g. tcp://192.168.4.2:1883
+	ClientId       string `json:"clientId"`
+	Username       string `json:"username"`
+	Password       string `json:"password"`
+	Qos            byte   `json:"qos"`
+	StateTopic     string `json:"stateTopic"`     // retained, e.g. "idle", "countdown"
+	CountdownTopic string `json:"countdownTopic"` // {"remaining":2,"total":3} per tick
+	PhotoTopic     string `json:"photoTopic"`     // photo_ready payload
+	OnlineTopic    string `json:"onlineTopic"`    // retained "online"/"offline" (last will)
+	TriggerTopic   string `json:"triggerTopic"`   // any message starts a capture
+	CancelTopic    string `json:"cancelTopic"`    // any message cancels the countdown
+}
+
+// serverOnlySections are never written to user.conf.json. They hold credentials
+// and must only ever come from server.conf.json.
+var serverOnlySections = []string{"share", "upload", "sync", "webhooks", "mqtt"}
+
 func Load() (*Config, error) {
 	// Default base values in case no file exists
 	cfg := &Config{
 		Wifi: WifiConfig{
-			Enabled:        true,
-			Ssid:           "Photobooth",
-			Interface:      "wlan0",
-			IpAddress:      "192.168.4.1",
-			DhcpRangeStart: "192.168.4.10",
-			DhcpRangeEnd:   "192.168.4.100",
-			CaptivePortal:  true,
+			Enabled:         true,
+			Ssid:            "Photobooth",
+			Interface:       "wlan0",
+			IpAddress:       "192.168.4.1",
+			DhcpRangeStart:  "192.168.4.10",
+			DhcpRangeEnd:    "192.168.4.100",
+			CaptivePortal:   true,
+			PortalLanding:   "gallery",
+			Band:            "bg",
+			Mode:            "hotspot",
+			ConnectTimeout:  30,
+			LostTimeout:     60,
+			RetryClientSecs: 300,
+			Dns: DnsConfig{
+				Mode:     "captive",
+				Upstream: []string{"1.1.1.1", "9.9.9.9"},
+				Records:  map[string]string{"photobooth.local": "", "booth.lan": ""},
+			},
 		},
 		Camera: CameraConfig{
 			Enabled: true,
@@ -85,6 +270,55 @@ func Load() (*Config, error) {
 			AlbumDisplayNames:     make(map[string]string),
 			AlbumCaptureMethods:   make(map[string]string),
 		},
+		Trash: TrashConfig{
+			RetentionDays: 30,
+			MinFreeMB:     2048,
+		},
+		Storage: StorageConfig{
+			WarnFreeMB:       4096,
+			ErrorFreeMB:      1024,
+			MinFreeMB:        300,
+			CleanupAfterDays: 7,
+		},
+		Mirror: MirrorConfig{
+			Enabled:      false,
+			RequireMount: true,
+			IncludeRaw:   true,
+		},
+		Share: ShareConfig{
+			Enabled:  true,
+			Download: "original",
+			Email: EmailConfig{
+				Enabled:       false,
+				SmtpPort:      587,
+				StartTLS:      true,
+				Subject:       "Dein Foto von der Photobooth",
+				Body:          "Hallo!\n\nIm Anhang findest du dein Foto.\n\nViel Spaß!",
+				Attachment:    "preview",
+				MaxAttempts:   10,
+				RetrySeconds:  60,
+				RatePerMinute: 20,
+			},
+		},
+		Upload: UploadConfig{
+			Enabled:         false,
+			Region:          "us-east-1",
+			Prefix:          "photobooth/",
+			IncludePreviews: true,
+			PauseWhileBusy:  true,
+			RetrySeconds:    30,
+		},
+		Mqtt: MqttConfig{
+			Enabled:        false,
+			ClientId:       "photobooth",
+			Qos:            0,
+			StateTopic:     "photobooth/state",
+			CountdownTopic: "photobooth/countdown",
+			PhotoTopic:     "photobooth/photo",
+			OnlineTopic:    "photobooth/online",
+			TriggerTopic:   "photobooth/trigger",
+			CancelTopic:    "photobooth/cancel",
+		},
 	}
 	cfg.Booth.AlbumDisplayNames["default"] = "Default"
 	cfg.Booth.AlbumCaptureMethods["default"] = "C"
@@ -145,7 +379,18 @@ func (c *Config) Save() error {
 	c.mu.Lock()
 	defer c.mu.Unlock()
 
-	data, err := json.MarshalIndent(c, "", "  ")
+	raw, err := json.Marshal(c)
+	if err != nil {
+		return err
+	}
+	var sections map[string]json.RawMessage
+	if err := json.Unmarshal(raw, &sections); err != nil {
+		return err
+	}
+	for _, key := range serverOnlySections {
+		delete(sections, key)
+	}
+	data, err := json.MarshalIndent(sections, "", "  ")
 	if err != nil {
 		return err
 	}
@@ -167,6 +412,13 @@ func (c *Config) UpdateBooth(booth BoothConfig) {
 	c.mu.Unlock()
 }
 
+// UpdateWifi replaces the WiFi config. Call Save to persist it.
+func (c *Config) UpdateWifi(wifi WifiConfig) {
+	c.mu.Lock()
+	c.Wifi = wifi
+	c.mu.Unlock()
+}
+
 // SanitizeAlbumName converts a human-friendly album name to a filesystem-safe one.
 // "Hoch Zeit!" → "hoch_zeit", "test  event" → "test_event"
 func SanitizeAlbumName(name string) string {
@@ -18,3 +18,9 @@ func GetUsage(path string) (Usage, error) {
 func (u Usage) String() string {
 	return fmt.Sprintf("Total: %d, Free: %d, Used: %d (%d%%)", u.Total, u.Free, u.Used, u.UsedPercent)
 }
+
+// SameFilesystem reports whether two paths live on the same file system. Used to
+// tell a mounted drive from an empty mount point folder on the SD card.
+func SameFilesystem(a, b string) (bool, error) {
+	return sameFilesystem(a, b)
+}
@@ -27,3 +27,14 @@ func getUsage(path string) (Usage, error) {
 		UsedPercent: percent,
 	}, nil
 }
+
+func sameFilesystem(a, b string) (bool, error) {
+	var sa, sb syscall.Stat_t
+	if err := syscall.Stat(a, &sa); err != nil {
+		return false, err
+	}
+	if err := syscall.Stat(b, &sb); err != nil {
+		return false, err
+	}
+	return sa.Dev == sb.Dev, nil
+}
@@ -1,5 +1,11 @@
 package disk
 
+import (
+	"os"
+	"path/filepath"
+	"strings"
+)
+
 func getUsage(path string) (Usage, error) {
 	// Stub for Windows development
 	// Return some mock data or 0
@@ -10,3 +16,22 @@ func getUsage(path string) (Usage, error) {
 		UsedPercent: 37,
 	}, nil
 }
+
+func sameFilesystem(a, b string) (bool, error) {
+	// Drive letters are good enough for development on Windows
+	absA, err := filepath.Abs(a)
+	if err != nil {
+		return false, err
+	}
+	absB, err := filepath.Abs(b)
+	if err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(absA); err != nil {
+		return false, err
+	}
+	if _, err := os.Stat(absB); err != nil {
+		return false, err
+	}
+	return strings.EqualFold(filepath.VolumeName(absA), filepath.VolumeName(absB)), nil
+}
@@ -0,0 +1,235 @@
+package disk
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+)
+
+// Problems that make a USB device unusable for export, reported in UsbDevice
+// and UsbError so the dashboard can tell the operator what to do.
+const (
+	ProblemNoFilesystem  = "no_filesystem"  // unformatted or unknown partition
+	ProblemUnsupportedFs = "unsupported_fs" // e.g. HFS+, APFS, encrypted volumes
+	ProblemReadOnly      = "read_only"      // write-protect switch or read-only mount
+	ProblemNtfsDirty     = "ntfs_dirty"     // not shut down cleanly in Windows (or hibernated)
+	ProblemNotWritable   = "not_writable"   // mounted, but writing a test file failed
+	ProblemMountFailed   = "mount_failed"
+	ProblemNotFound      = "not_found"
+)
+
+// UsbError is a failed USB operation with a problem category.
+type UsbError struct {
+	Device  string
+	Problem string
+	Detail  string
+}
+
+func (e *UsbError) Error() string {
+	if e.Detail == "" {
+		return fmt.Sprintf("%s: %s", e.Device, e.Problem)
+	}
+	return fmt.Sprintf("%s: %s: %s", e.Device, e.Problem, e.Detail)
+}
+
+// ProblemOf returns the problem category of err, or "" if it has none.
+func ProblemOf(err error) string {
+	var ue *UsbError
+	if errors.As(err, &ue) {
+		return ue.Problem
+	}
+	return ""
+}
+
+// supportedFs lists the file systems we can mount read-write.
+var supportedFs = map[string]bool{
+	"vfat": true, "exfat": true, "ntfs": true, "ntfs3": true,
+	"ext2": true, "ext3": true, "ext4": true, "btrfs": true, "xfs": true, "f2fs": true,
+}
+
+// maxFileSize is the largest file a file system can hold, if it is limited.
+var maxFileSize = map[string]int64{
+	"vfat": 4*1024*1024*1024 - 1,
+}
+
+// staticProblem is what can be told about a device from lsblk alone.
+func staticProblem(d UsbDevice) (string, string) {
+	switch {
+	case d.FsType == "":
+		return ProblemNoFilesystem, "no file system found, format the stick as exFAT or FAT32"
+	case !supportedFs[d.FsType]:
+		return ProblemUnsupportedFs, fmt.Sprintf("file system %s is not supported, use exFAT, FAT32 or NTFS", d.FsType)
+	case d.ReadOnly:
+		return ProblemReadOnly, "the device is write-protected"
+	}
+	return "", ""
+}
+
+// mountOptions returns the mount type and options for a file system. FAT, exFAT
+// and NTFS have no owners, so files are mapped to the user running the booth;
+// otherwise everything would belong to root and the export could not write.
+func mountOptions(fsType string) (string, string) {
+	owner := fmt.Sprintf("uid=%d,gid=%d", os.Getuid(), os.Getgid())
+	switch fsType {
+	case "vfat":
+		// utf8 for umlauts in file names, flush writes early so pulling the stick loses less
+		return "vfat", owner + ",umask=022,utf8,shortname=mixed,flush,noatime"
+	case "exfat":
+		return "exfat", owner + ",umask=022,iocharset=utf8,noatime"
+	case "ntfs", "ntfs3":
+		if ntfs3Available() {
+			return "ntfs3", owner + ",umask=022,iocharset=utf8,noatime"
+		}
+		return "ntfs-3g", owner + ",umask=022,noatime,windows_names"
+	default:
+		// Linux file systems keep their own ownership
+		return fsType, "noatime"
+	}
+}
+
+// ntfs3Available reports whether the kernel NTFS driver (Linux 5.15+) is usable.
+func ntfs3Available() bool {
+	data, err := os.ReadFile("/proc/filesystems")
+	return err == nil && strings.Contains(string(data), "ntfs3")
+}
+
+// MountUsb mounts a device (e.g., "sda1") below /media with options matching its
+// file system. Write-protected sticks and NTFS volumes that were not shut down
+// cleanly are mounted read-only, which is enough for importing; PrepareUsb
+// rejects them for export. Errors are *UsbError with a problem category.
+func MountUsb(deviceName string) (string, error) {
+	dev, err := findUsb(deviceName)
+	if err != nil {
+		return "", err
+	}
+
+	if dev.MountPoint != "" {
+		return dev.MountPoint, nil // Already mounted
+	}
+	if dev.Problem == ProblemNoFilesystem || dev.Problem == ProblemUnsupportedFs {
+		return "", &UsbError{Device: dev.Name, Problem: dev.Problem, Detail: dev.Detail}
+	}
+
+	mountPath := filepath.Join("/media", dev.Name)
+	os.MkdirAll(mountPath, 0777)
+
+	fsType, opts := mountOptions(dev.FsType)
+	if dev.ReadOnly {
+		opts += ",ro"
+	}
+	out, err := exec.Command("sudo", "mount", "-t", fsType, "-o", opts, "/dev/"+dev.Name, mountPath).CombinedOutput()
+	if err != nil && mountProblem(string(out)) == ProblemNtfsDirty {
+		// ntfs3 refuses dirty volumes read-write, but reads them fine
+		out, err = exec.Command("sudo", "mount", "-t", fsType, "-o", opts+",ro", "/dev/"+dev.Name, mountPath).CombinedOutput()
+	}
+	if err != nil {
+		return "", &UsbError{Device: dev.Name, Problem: mountProblem(string(out)), Detail: strings.TrimSpace(string(out))}
+	}
+	return mountPath, nil
+}
+
+// mountProblem derives the category from the output of a failed mount.
+func mountProblem(out string) string {
+	msg := strings.ToLower(out)
+	switch {
+	case strings.Contains(msg, "dirty") || strings.Contains(msg, "unclean") || strings.Contains(msg, "hibernat"):
+		return ProblemNtfsDirty
+	case strings.Contains(msg, "write-protected") || strings.Contains(msg, "read-only"):
+		return ProblemReadOnly
+	case strings.Contains(msg, "unknown filesystem type") || strings.Contains(msg, "wrong fs type"):
+		return ProblemUnsupportedFs
+	}
+	return ProblemMountFailed
+}
+
+// isReadOnlyMount reads the mount flags of a mount point from /proc/mounts.
+func isReadOnlyMount(mountPath string) bool {
+	data, err := os.ReadFile("/proc/mounts")
+	if err != nil {
+		return false
+	}
+	for _, line := range strings.Split(string(data), "\n") {
+		fields := strings.Fields(line)
+		if len(fields) >= 4 && fields[1] == mountPath {
+			for _, o := range strings.Split(fields[3], ",") {
+				if o == "ro" {
+					return true
+				}
+			}
+		}
+	}
+	return false
+}
+
+// UsbTarget is a mounted device that was checked for export.
+type UsbTarget struct {
+	MountPoint  string `json:"mountpoint"`
+	FsType      string `json:"fstype"`
+	FreeBytes   uint64 `json:"freeBytes"`
+	TotalBytes  uint64 `json:"totalBytes"`
+	MaxFileSize int64  `json:"maxFileSize,omitempty"` // 0 if unlimited
+}
+
+// PrepareUsb mounts a device and checks that it can be written, so an export
+// fails up front with a clear reason instead of halfway through.
+func PrepareUsb(deviceName string) (*UsbTarget, error) {
+	dev, err := findUsb(deviceName)
+	if err != nil {
+		return nil, err
+	}
+	mountPoint, err := MountUsb(deviceName)
+	if err != nil {
+		return nil, err
+	}
+	if isReadOnlyMount(mountPoint) {
+		// Some drivers fall back to read-only instead of failing, e.g. ntfs-3g on an unclean volume
+		if strings.HasPrefix(dev.FsType, "ntfs") && !dev.ReadOnly {
+			return nil, &UsbError{Device: deviceName, Problem: ProblemNtfsDirty, Detail: "NTFS volume was not shut down cleanly, check it in Windows"}
+		}
+		return nil, &UsbError{Device: deviceName, Problem: ProblemReadOnly, Detail: "mounted read-only"}
+	}
+	if err := CheckWritable(mountPoint); err != nil {
+		return nil, &UsbError{Device: deviceName, Problem: ProblemNotWritable, Detail: err.Error()}
+	}
+	t := &UsbTarget{MountPoint: mountPoint, FsType: dev.FsType, MaxFileSize: maxFileSize[dev.FsType]}
+	if usage, err := GetUsage(mountPoint); err == nil {
+		t.FreeBytes, t.TotalBytes = usage.Free, usage.Total
+	}
+	return t, nil
+}
+
+// CheckWritable writes, syncs and removes a probe file in dir.
+func CheckWritable(dir string) error {
+	probe := filepath.Join(dir, ".photobooth-probe")
+	f, err := os.Create(probe)
+	if err != nil {
+		return err
+	}
+	_, err = f.WriteString("ok")
+	if err == nil {
+		err = f.Sync()
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	if rerr := os.Remove(probe); err == nil {
+		err = rerr
+	}
+	return err
+}
+
+func findUsb(deviceName string) (*UsbDevice, error) {
+	devices, err := GetUsbDevices()
+	if err != nil {
+		return nil, err
+	}
+	for i := range devices {
+		if devices[i].Name == deviceName {
+			return &devices[i], nil
+		}
+	}
+	return nil, &UsbError{Device: deviceName, Problem: ProblemNotFound, Detail: "device not found"}
+}
@@ -4,11 +4,13 @@ import (
 	"context"
 	"encoding/json"
 	"fmt"
-	"io"
 	"os"
 	"os/exec"
 	"path/filepath"
 	"strings"
+	"time"
+
+	"photobooth/internal/fsutil"
 )
 
 type UsbDevice struct {
@@ -18,31 +20,50 @@ type UsbDevice struct {
 	Size       string `json:"size"`       // 32G
 	Free       string `json:"free"`       // 15G
 	Subsystems string `json:"subsystems"` // block:scsi:usb:pci
+	FsType     string `json:"fstype"`     // vfat, exfat, ntfs, ext4, ...
+	UUID       string `json:"uuid"`
+	ReadOnly   bool   `json:"readOnly"`          // write-protect switch or read-only device
+	Problem    string `json:"problem,omitempty"` // one of the Problem* categories, empty if usable
+	Detail     string `json:"detail,omitempty"`
+}
+
+// lsblkBool accepts both forms lsblk uses for flags: true/false in newer
+// versions, "0"/"1" in older ones.
+type lsblkBool bool
+
+func (b *lsblkBool) UnmarshalJSON(data []byte) error {
+	switch strings.Trim(string(data), `"`) {
+	case "true", "1":
+		*b = true
+	default:
+		*b = false
+	}
+	return nil
+}
+
+type lsblkDevice struct {
+	Name       string    `json:"name"`
+	Label      string    `json:"label"`
+	Mountpoint string    `json:"mountpoint"`
+	Size       string    `json:"size"`
+	Fsavail    string    `json:"fsavail"`
+	Subsystems string    `json:"subsystems"`
+	FsType     string    `json:"fstype"`
+	UUID       string    `json:"uuid"`
+	RO         lsblkBool `json:"ro"`
 }
 
 // LsblkOutput matches the JSON output of `lsblk -J -O` (or similar).
 type LsblkOutput struct {
 	Blockdevices []struct {
-		Name       string `json:"name"`
-		Label      string `json:"label"`
-		Mountpoint string `json:"mountpoint"`
-		Size       string `json:"size"`
-		Fsavail    string `json:"fsavail"`
-		Subsystems string `json:"subsystems"`
-		Children   []struct {
-			Name       string `json:"name"`
-			Label      string `json:"label"`
-			Mountpoint string `json:"mountpoint"`
-			Size       string `json:"size"`
-			Fsavail    string `json:"fsavail"`
-			Subsystems string `json:"subsystems"`
-		} `json:"children"`
+		lsblkDevice
+		Children []lsblkDevice `json:"children"`
 	} `json:"blockdevices"`
 }
 
 // GetUsbDevices uses lsblk to list USB block devices (partitions).
 func GetUsbDevices() ([]UsbDevice, error) {
-	out, err := exec.Command("lsblk", "-J", "-o", "NAME,LABEL,MOUNTPOINT,SIZE,FSAVAIL,SUBSYSTEMS").Output()
+	out, err := exec.Command("lsblk", "-J", "-o", "NAME,LABEL,MOUNTPOINT,SIZE,FSAVAIL,SUBSYSTEMS,FSTYPE,UUID,RO").Output()
 	if err != nil {
 		return nil, fmt.Errorf("lsblk failed: %v", err)
 	}
@@ -58,21 +79,31 @@ func GetUsbDevices() ([]UsbDevice, error) {
 		// Only look at USB subsystems (or their children)
 		isUsb := strings.Contains(dev.Subsystems, "usb")
 
-		for _, child := range dev.Children {
+		children := dev.Children
+		if len(children) == 0 && isUsb && dev.FsType != "" {
+			// Stick formatted without a partition table ("superfloppy")
+			children = []lsblkDevice{dev.lsblkDevice}
+		}
+		for _, child := range children {
 			// Often the parent is the USB device, and the child is the partition we want to mount
 			if isUsb || strings.Contains(child.Subsystems, "usb") {
 				label := child.Label
 				if label == "" {
 					label = "USB Laufwerk"
 				}
-				devices = append(devices, UsbDevice{
+				d := UsbDevice{
 					Name:       child.Name,
 					Label:      label,
 					MountPoint: child.Mountpoint,
 					Size:       child.Size,
 					Free:       child.Fsavail,
 					Subsystems: child.Subsystems,
-				})
+					FsType:     child.FsType,
+					UUID:       child.UUID,
+					ReadOnly:   bool(child.RO || dev.RO),
+				}
+				d.Problem, d.Detail = staticProblem(d)
+				devices = append(devices, d)
 			}
 		}
 	}
@@ -80,40 +111,6 @@ func GetUsbDevices() ([]UsbDevice, error) {
 	return devices, nil
 }
 
-// MountUsb mounts a device (e.g., "sda1") to a given directory.
-func MountUsb(deviceName string) (string, error) {
-	devices, err := GetUsbDevices()
-	if err != nil {
-		return "", err
-	}
-
-	var dev *UsbDevice
-	for _, d := range devices {
-		if d.Name == deviceName {
-			dev = &d
-			break
-		}
-	}
-
-	if dev == nil {
-		return "", fmt.Errorf("device %s not found", deviceName)
-	}
-
-	if dev.MountPoint != "" {
-		return dev.MountPoint, nil // Already mounted
-	}
-
-	mountPath := filepath.Join("/media", dev.Name)
-	os.MkdirAll(mountPath, 0777)
-
-	cmd := exec.Command("sudo", "mount", "/dev/"+dev.Name, mountPath)
-	if out, err := cmd.CombinedOutput(); err != nil {
-		return "", fmt.Errorf("mount failed: %v\n%s", err, string(out))
-	}
-
-	return mountPath, nil
-}
-
 // UnmountUsb flushes the file system buffers and unmounts the USB device.
 func UnmountUsb(mountPoint string) error {
 	// First flush all file system buffers to ensure data is written to the USB drive
@@ -126,97 +123,150 @@ func UnmountUsb(mountPoint string) error {
 	return nil
 }
 
+// CopyStats counts the work of a directory copy. Skipped files were already
+// present and unchanged at the destination.
+type CopyStats struct {
+	TotalFiles   int64 `json:"totalFiles"`
+	TotalBytes   int64 `json:"totalBytes"`
+	CopiedFiles  int64 `json:"copiedFiles"`
+	CopiedBytes  int64 `json:"copiedBytes"`
+	SkippedFiles int64 `json:"skippedFiles"`
+	SkippedBytes int64 `json:"skippedBytes"`
+}
+
+// DoneBytes is the part of TotalBytes that is copied or skipped.
+func (s CopyStats) DoneBytes() int64 { return s.CopiedBytes + s.SkippedBytes }
+
+// DoneFiles is the number of files that are copied or skipped.
+func (s CopyStats) DoneFiles() int64 { return s.CopiedFiles + s.SkippedFiles }
+
 // CopyDir recursively copies a directory to a destination.
 func CopyDir(ctx context.Context, src string, dst string) error {
-	return CopyDirWithProgress(ctx, src, dst, nil)
+	_, err := CopyDirWithProgress(ctx, src, dst, nil, nil)
+	return err
 }
 
-// CopyDirWithProgress recursively copies a directory to a destination and reports progress.
-func CopyDirWithProgress(ctx context.Context, src string, dst string, onProgress func(copiedBytes, totalBytes, copiedFiles, totalFiles int64)) error {
-	var totalBytes, totalFiles, copiedBytes, copiedFiles int64
+// CopyItem is one file of a copy job.
+type CopyItem struct {
+	Src string
+	Dst string
+}
 
-	filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
-		if err == nil && !info.IsDir() {
-			totalFiles++
-			totalBytes += info.Size()
+// CopyDirWithProgress incrementally copies a directory to a destination and
+// reports progress. See CopyFilesWithProgress.
+func CopyDirWithProgress(ctx context.Context, src string, dst string, unchanged func(srcPath, dstPath string) bool, onProgress func(CopyStats)) (CopyStats, error) {
+	var items []CopyItem
+	err := filepath.Walk(src, func(path string, info os.FileInfo, err error) error {
+		if err != nil {
+			return err
+		}
+		if !info.IsDir() {
+			rel, _ := filepath.Rel(src, path)
+			items = append(items, CopyItem{Src: path, Dst: filepath.Join(dst, rel)})
 		}
 		return nil
 	})
+	if err != nil {
+		return CopyStats{}, err
+	}
+	return CopyFilesWithProgress(ctx, items, unchanged, onProgress)
+}
+
+// CopyFilesWithProgress copies a list of files and reports progress. Files for
+// which unchanged returns true are skipped (nil uses SameSizeAndTime), so an
+// export that was cancelled or interrupted by unplugging the stick continues
+// where it stopped. Every file is written to a temp name, fsynced and renamed,
+// and the file system is flushed at the end.
+func CopyFilesWithProgress(ctx context.Context, items []CopyItem, unchanged func(srcPath, dstPath string) bool, onProgress func(CopyStats)) (CopyStats, error) {
+	var stats CopyStats
+	if unchanged == nil {
+		unchanged = SameSizeAndTime
+	}
 
-	var copyRecursive func(s, d string) error
-	copyRecursive = func(s, d string) error {
-		// Check for cancellation
+	sizes := make([]int64, len(items))
+	for i, it := range items {
+		if info, err := os.Stat(it.Src); err == nil {
+			sizes[i] = info.Size()
+		}
+		stats.TotalFiles++
+		stats.TotalBytes += sizes[i]
+	}
+
+	cleaned := make(map[string]bool)
+	for i, it := range items {
+		// Check for cancellation before each file
 		select {
 		case <-ctx.Done():
-			return ctx.Err()
+			return stats, ctx.Err()
 		default:
 		}
 
-		entries, err := os.ReadDir(s)
-		if err != nil {
-			return err
+		if dir := filepath.Dir(it.Dst); !cleaned[dir] {
+			if err := os.MkdirAll(dir, 0777); err != nil {
+				return stats, err
+			}
+			removeStaleTemps(dir)
+			cleaned[dir] = true
 		}
 
-		os.MkdirAll(d, 0777)
-
-		for _, entry := range entries {
-			srcPath := filepath.Join(s, entry.Name())
-			dstPath := filepath.Join(d, entry.Name())
-
-			if entry.IsDir() {
-				err = copyRecursive(srcPath, dstPath)
-				if err != nil {
-					return err
-				}
-			} else {
-				// Check for cancellation before each file
-				select {
-				case <-ctx.Done():
-					return ctx.Err()
-				default:
-				}
-
-				info, err := entry.Info()
-				var size int64
-				if err == nil {
-					size = info.Size()
-				}
-
-				err = copyFile(srcPath, dstPath)
-				if err != nil {
-					return err
-				}
-
-				copiedFiles++
-				copiedBytes += size
-				if onProgress != nil {
-					onProgress(copiedBytes, totalBytes, copiedFiles, totalFiles)
-				}
+		if unchanged(it.Src, it.Dst) {
+			stats.SkippedFiles++
+			stats.SkippedBytes += sizes[i]
+		} else {
+			if err := CopyFile(it.Src, it.Dst); err != nil {
+				return stats, err
 			}
+			stats.CopiedFiles++
+			stats.CopiedBytes += sizes[i]
+		}
+		if onProgress != nil {
+			onProgress(stats)
 		}
-		return nil
 	}
 
-	return copyRecursive(src, dst)
+	// Per-file fsyncs cover the data; this also flushes metadata the driver may still hold
+	exec.Command("sync").Run()
+	return stats, nil
 }
 
-func copyFile(srcFile, dstFile string) error {
-	in, err := os.Open(srcFile)
+// SameSizeAndTime reports whether dstPath exists with the size and modification
+// time of srcPath. Times are compared with two seconds of tolerance because FAT
+// only stores even seconds.
+func SameSizeAndTime(srcPath, dstPath string) bool {
+	si, err := os.Stat(srcPath)
 	if err != nil {
+		return false
+	}
+	di, err := os.Stat(dstPath)
+	if err != nil || di.Size() != si.Size() {
+		return false
+	}
+	diff := di.ModTime().Sub(si.ModTime())
+	return diff > -2*time.Second && diff < 2*time.Second
+}
+
+// CopyFile copies a single file atomically (temp file, fsync, rename), overwriting
+// dstFile, and keeps the modification time of srcFile.
+func CopyFile(srcFile, dstFile string) error {
+	if err := fsutil.CopyFileAtomic(srcFile, dstFile); err != nil {
 		return err
 	}
-	defer in.Close()
+	if info, err := os.Stat(srcFile); err == nil {
+		os.Chtimes(dstFile, info.ModTime(), info.ModTime())
+	}
+	return nil
+}
 
-	out, err := os.Create(dstFile)
+// removeStaleTemps deletes temp files left behind by a copy that was interrupted.
+// Only our own temp files are removed, anything else on the stick is left alone.
+func removeStaleTemps(dir string) {
+	entries, err := os.ReadDir(dir)
 	if err != nil {
-		return err
+		return
 	}
-	defer func() {
-		if e := out.Close(); e != nil {
-			err = e
+	for _, e := range entries {
+		if !e.IsDir() && fsutil.IsTempName(e.Name()) {
+			os.Remove(filepath.Join(dir, e.Name()))
 		}
-	}()
-
-	_, err = io.Copy(out, in)
-	return err
+	}
 }
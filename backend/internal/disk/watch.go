@@ -0,0 +1,100 @@
+package disk
+
+import (
+	"sync"
+	"time"
+
+	"photobooth/internal/logging"
+)
+
+// UsbWatcher polls lsblk and reports USB partitions that appear or disappear.
+// Polling is used instead of netlink uevents so it works unprivileged and picks
+// up devices that udev/udisks mounted on their own.
+type UsbWatcher struct {
+	interval time.Duration
+	log      *logging.Logger
+
+	OnAdded   func(dev UsbDevice)
+	OnRemoved func(dev UsbDevice)
+
+	mu      sync.Mutex
+	devices map[string]UsbDevice
+}
+
+func NewUsbWatcher(interval time.Duration) *UsbWatcher {
+	if interval <= 0 {
+		interval = 2 * time.Second
+	}
+	return &UsbWatcher{
+		interval: interval,
+		log:      logging.Get(),
+	}
+}
+
+// Start polls in the background. Devices present at start are taken as known
+// and do not fire OnAdded, so a reboot does not re-trigger actions.
+func (w *UsbWatcher) Start() {
+	go func() {
+		failing := false
+		for {
+			devices, err := GetUsbDevices()
+			if err != nil {
+				if !failing {
+					w.log.Warn("usb", "USB hotplug detection unavailable: %v", err)
+					failing = true
+				}
+			} else {
+				if failing {
+					w.log.Info("usb", "USB hotplug detection working again")
+					failing = false
+				}
+				w.update(devices)
+			}
+			time.Sleep(w.interval)
+		}
+	}()
+}
+
+// Devices returns the devices seen by the last poll.
+func (w *UsbWatcher) Devices() []UsbDevice {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	list := make([]UsbDevice, 0, len(w.devices))
+	for _, d := range w.devices {
+		list = append(list, d)
+	}
+	return list
+}
+
+func (w *UsbWatcher) update(devices []UsbDevice) {
+	current := make(map[string]UsbDevice, len(devices))
+	for _, d := range devices {
+		current[d.Name] = d
+	}
+
+	w.mu.Lock()
+	first := w.devices == nil
+	previous := w.devices
+	w.devices = current
+	w.mu.Unlock()
+	if first {
+		return
+	}
+
+	for name, d := range current {
+		if _, ok := previous[name]; !ok {
+			w.log.Info("usb", "USB device %s (%s) plugged in", d.Name, d.Label)
+			if w.OnAdded != nil {
+				w.OnAdded(d)
+			}
+		}
+	}
+	for name, d := range previous {
+		if _, ok := current[name]; !ok {
+			w.log.Info("usb", "USB device %s (%s) removed", d.Name, d.Label)
+			if w.OnRemoved != nil {
+				w.OnRemoved(d)
+			}
+		}
+	}
+}
@@ -0,0 +1,315 @@
+package diskpolicy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"photobooth/internal/config"
+	"photobooth/internal/disk"
+	"photobooth/internal/logging"
+	"photobooth/internal/storage"
+	"photobooth/internal/trash"
+	"photobooth/internal/websocket"
+)
+
+// Levels of the storage status, from good to bad.
+const (
+	LevelOK    = "ok"
+	LevelWarn  = "warn"
+	LevelError = "error"
+	LevelFull  = "full" // below the hard minimum: captures are refused
+)
+
+// EventTypeAlert is broadcast whenever the level changes.
+const EventTypeAlert = "storage_alert"
+
+// defaultPhotoBytes is assumed before any photo was taken.
+const defaultPhotoBytes = 10 * 1024 * 1024
+
+// Status is the storage state shown in system_info and /api/status.
+type Status struct {
+	Level           string `json:"level"`
+	FreeBytes       uint64 `json:"freeBytes"`
+	AvgPhotoBytes   int64  `json:"avgPhotoBytes"`   // original + RAW + derivatives per capture
+	PhotosRemaining int64  `json:"photosRemaining"` // until captures are refused
+	Message         string `json:"message,omitempty"`
+}
+
+// Policy watches free space on the photo drive, raises alerts, blocks captures
+// when the drive is nearly full and optionally frees space on its own.
+type Policy struct {
+	cfg          config.StorageConfig
+	base         string
+	hub          *websocket.Hub
+	trash        *trash.Bin
+	currentAlbum func() string
+	log          *logging.Logger
+
+	mu     sync.Mutex
+	status Status
+}
+
+func NewPolicy(cfg config.StorageConfig, photosBase string, hub *websocket.Hub, bin *trash.Bin, currentAlbum func() string) *Policy {
+	return &Policy{
+		cfg:          cfg,
+		base:         photosBase,
+		hub:          hub,
+		trash:        bin,
+		currentAlbum: currentAlbum,
+		log:          logging.Get(),
+		status:       Status{Level: LevelOK, PhotosRemaining: -1},
+	}
+}
+
+// Start checks the drive right away and then every 30 seconds.
+func (p *Policy) Start() {
+	go func() {
+		p.Check()
+		for range time.Tick(30 * time.Second) {
+			p.Check()
+		}
+	}()
+}
+
+// Status returns the result of the last check.
+func (p *Policy) Status() Status {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+	return p.status
+}
+
+// CanCapture reads the free space now (a single statfs) and reports whether a
+// new photo may be taken. The reason is meant for logs and the dashboard.
+func (p *Policy) CanCapture() (bool, string) {
+	if p.cfg.MinFreeMB <= 0 {
+		return true, ""
+	}
+	usage, err := disk.GetUsage(p.base)
+	if err != nil {
+		return true, "" // never block captures because of a failed check
+	}
+	if usage.Free < mb(p.cfg.MinFreeMB) {
+		return false, fmt.Sprintf("only %d MB free, captures need at least %d MB", usage.Free/(1024*1024), p.cfg.MinFreeMB)
+	}
+	return true, ""
+}
+
+// Check updates the status, broadcasts an alert if the level changed and runs
+// the automatic cleanup when enabled.
+func (p *Policy) Check() Status {
+	usage, err := disk.GetUsage(p.base)
+	if err != nil {
+		return p.Status()
+	}
+	st := p.evaluate(usage.Free)
+
+	if st.Level != LevelOK && (p.cfg.CleanupTrash || p.cfg.CleanupDerivatives) {
+		if p.cleanup() {
+			if usage, err := disk.GetUsage(p.base); err == nil {
+				st = p.evaluate(usage.Free)
+			}
+		}
+	}
+
+	p.mu.Lock()
+	prev := p.status.Level
+	p.status = st
+	p.mu.Unlock()
+
+	if st.Level != prev {
+		switch st.Level {
+		case LevelOK:
+			p.log.Info("storage", "Disk space OK again: %s", st.Message)
+		case LevelWarn:
+			p.log.Warn("storage", "Disk space low: %s", st.Message)
+		default:
+			p.log.Error("storage", "Disk space critical: %s", st.Message)
+		}
+		p.hub.Broadcast <- websocket.Event{
+			Type:      EventTypeAlert,
+			Data:      st,
+			Timestamp: time.Now().UnixMilli(),
+		}
+	}
+	return st
+}
+
+func (p *Policy) evaluate(free uint64) Status {
+	st := Status{Level: LevelOK, FreeBytes: free, AvgPhotoBytes: p.averagePhotoSize()}
+
+	reserve := mb(p.cfg.MinFreeMB)
+	if free > reserve {
+		st.PhotosRemaining = int64(free-reserve) / st.AvgPhotoBytes
+	}
+
+	switch {
+	case p.cfg.MinFreeMB > 0 && free < mb(p.cfg.MinFreeMB):
+		st.Level = LevelFull
+	case p.cfg.ErrorFreeMB > 0 && free < mb(p.cfg.ErrorFreeMB):
+		st.Level = LevelError
+	case p.cfg.WarnFreeMB > 0 && free < mb(p.cfg.WarnFreeMB):
+		st.Level = LevelWarn
+	}
+	st.Message = fmt.Sprintf("%d MB free, about %d photos left", free/(1024*1024), st.PhotosRemaining)
+	return st
+}
+
+// averagePhotoSize is the disk usage per capture of the current album. Albums
+// with only a few photos fall back to the average over all albums. It is never
+// 0, even if the albums only hold empty files (e.g. failed captures).
+func (p *Policy) averagePhotoSize() int64 {
+	if count, size, err := storage.AlbumStats(filepath.Join(p.base, p.currentAlbum())); err == nil && count >= 5 && size/int64(count) > 0 {
+		return size / int64(count)
+	}
+	var total int64
+	var photos int
+	for _, id := range p.albumIds() {
+		if count, size, err := storage.AlbumStats(filepath.Join(p.base, id)); err == nil {
+			total += size
+			photos += count
+		}
+	}
+	if photos == 0 || total/int64(photos) <= 0 {
+		return defaultPhotoBytes
+	}
+	return total / int64(photos)
+}
+
+// cleanup frees space until the warn threshold is reached again: first trash
+// items of other albums, then previews and thumbnails of old albums (oldest
+// first), which are regenerated from the originals when they are requested.
+// Returns whether anything was removed.
+func (p *Policy) cleanup() bool {
+	target := mb(p.cfg.WarnFreeMB)
+	enough := func() bool {
+		usage, err := disk.GetUsage(p.base)
+		return err != nil || usage.Free >= target
+	}
+	current := p.currentAlbum()
+	removed := false
+
+	if p.cfg.CleanupTrash && p.trash != nil {
+		if n := p.trash.PurgeOldest(current, "automatic cleanup", enough); n > 0 {
+			p.log.Info("storage", "Cleanup: purged %d trash items", n)
+			removed = true
+		}
+	}
+
+	if p.cfg.CleanupDerivatives && !enough() {
+		for _, id := range p.oldAlbums(current) {
+			if enough() {
+				break
+			}
+			n, freed := removeDerivatives(filepath.Join(p.base, id))
+			if n > 0 {
+				p.log.Info("storage", "Cleanup: removed %d previews/thumbnails of album '%s' (%d MB)", n, id, freed/(1024*1024))
+				removed = true
+			}
+		}
+	}
+	return removed
+}
+
+// oldAlbums returns albums without captures in the last CleanupAfterDays days,
+// the longest unused first.
+func (p *Policy) oldAlbums(current string) []string {
+	cutoff := time.Now().AddDate(0, 0, -p.cfg.CleanupAfterDays)
+	type album struct {
+		id   string
+		last time.Time
+	}
+	var old []album
+	for _, id := range p.albumIds() {
+		if id == current {
+			continue
+		}
+		idx, err := storage.OpenIndex(filepath.Join(p.base, id))
+		if err != nil {
+			continue
+		}
+		recs, err := idx.All()
+		if err != nil || len(recs) == 0 {
+			continue
+		}
+		var last time.Time
+		for i := range recs {
+			if recs[i].CapturedAt.After(last) {
+				last = recs[i].CapturedAt
+			}
+		}
+		if last.Before(cutoff) {
+			old = append(old, album{id, last})
+		}
+	}
+	sort.Slice(old, func(i, j int) bool { return old[i].last.Before(old[j].last) })
+
+	ids := make([]string, len(old))
+	for i := range old {
+		ids[i] = old[i].id
+	}
+	return ids
+}
+
+// removeDerivatives deletes the previews and thumbnails of an album and updates
+// its index. Returns the number of files and bytes removed.
+func removeDerivatives(albumDir string) (int, int64) {
+	idx, err := storage.OpenIndex(albumDir)
+	if err != nil {
+		return 0, 0
+	}
+	recs, err := idx.All()
+	if err != nil {
+		return 0, 0
+	}
+	n := 0
+	var freed int64
+	for i := range recs {
+		for _, f := range []struct {
+			sub, name string
+			size      int64
+		}{
+			{"preview", recs[i].Preview, recs[i].PreviewSize},
+			{"thumb", recs[i].Thumb, recs[i].ThumbSize},
+		} {
+			if f.name == "" {
+				continue
+			}
+			if err := os.Remove(filepath.Join(albumDir, f.sub, f.name)); err == nil {
+				n++
+				freed += f.size
+			}
+		}
+	}
+	if n > 0 {
+		idx.Reconcile()
+	}
+	return n, freed
+}
+
+func (p *Policy) albumIds() []string {
+	entries, err := os.ReadDir(p.base)
+	if err != nil {
+		return nil
+	}
+	var ids []string
+	for _, e := range entries {
+		name := e.Name()
+		if !e.IsDir() || strings.HasPrefix(name, ".") || name == "original" || name == "preview" || name == "thumb" || name == "css" || name == "js" {
+			continue
+		}
+		ids = append(ids, name)
+	}
+	return ids
+}
+
+func mb(v int) uint64 {
+	if v <= 0 {
+		return 0
+	}
+	return uint64(v) * 1024 * 1024
+}
@@ -0,0 +1,45 @@
+package diskpolicy
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"photobooth/internal/config"
+	"photobooth/internal/storage"
+)
+
+// album creates an album of n empty captures, like failed 0-byte downloads.
+func album(t *testing.T, base, id string, n int) {
+	t.Helper()
+	dir := filepath.Join(base, id)
+	if err := os.MkdirAll(filepath.Join(dir, "original"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	for i := 0; i < n; i++ {
+		name := fmt.Sprintf("IMG_%04d.jpg", i)
+		if err := os.WriteFile(filepath.Join(dir, "original", name), nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+		if _, err := storage.AddPhoto(dir, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestEmptyCapturesFallBackToDefaultSize(t *testing.T) {
+	for _, n := range []int{6, 2} { // own average and all-albums fallback
+		base := t.TempDir()
+		album(t, base, "party", n)
+		p := NewPolicy(config.StorageConfig{MinFreeMB: 100}, base, nil, nil, func() string { return "party" })
+
+		st := p.evaluate(1024 * 1024 * 1024)
+		if st.AvgPhotoBytes != defaultPhotoBytes {
+			t.Errorf("%d empty captures: average = %d, want %d", n, st.AvgPhotoBytes, defaultPhotoBytes)
+		}
+		if want := int64(1024-100) * 1024 * 1024 / defaultPhotoBytes; st.PhotosRemaining != want {
+			t.Errorf("%d empty captures: %d photos remaining, want %d", n, st.PhotosRemaining, want)
+		}
+	}
+}
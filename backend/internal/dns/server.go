@@ -1,64 +1,281 @@
 package dns
 
 import (
-	"log"
+	"errors"
+	"net"
+	"strings"
+	"sync"
+	"time"
+
 	"photobooth/internal/config"
+	"photobooth/internal/logging"
 
 	"github.com/miekg/dns"
 )
 
+// DNS modes, see config.DnsConfig.
+const (
+	ModeCaptive     = "captive"
+	ModeAllowlist   = "allowlist"
+	ModePassthrough = "passthrough"
+)
+
+// ttl of the booth's own answers. Kept short so devices pick up real answers
+// soon once the booth has an uplink again.
+const ttl = 60
+
+const (
+	upstreamTimeout = 1500 * time.Millisecond
+	offlineBackoff  = 30 * time.Second // how long to answer locally after the upstream failed
+)
+
+var errOffline = errors.New("no upstream resolver reachable")
+
 type Server struct {
-	server *dns.Server
-	config config.WifiConfig
+	udp *dns.Server
+	tcp *dns.Server
+	log *logging.Logger
+
+	mu           sync.RWMutex
+	config       config.WifiConfig
+	offlineUntil time.Time
+	online       bool
 }
 
 func NewServer(cfg config.WifiConfig) *Server {
 	return &Server{
 		config: cfg,
+		log:    logging.Get(),
+		online: true, // until the first forward says otherwise
 	}
 }
 
+// Start listens on port 53 over UDP and TCP; TCP is needed for answers that
+// do not fit into a UDP packet.
 func (s *Server) Start() {
-	// Only start if WiFi and Captive Portal are enabled
-	// But for now, we assume if this is called, it should run.
-	// Ideally check config.
+	mux := dns.NewServeMux()
+	mux.HandleFunc(".", s.handleDNSRequest)
 
-	dns.HandleFunc(".", s.handleDNSRequest)
+	s.udp = &dns.Server{Addr: ":53", Net: "udp", Handler: mux}
+	s.tcp = &dns.Server{Addr: ":53", Net: "tcp", Handler: mux}
 
-	s.server = &dns.Server{Addr: ":53", Net: "udp"}
+	s.mu.RLock()
+	ip, mode := s.config.IpAddress, modeOf(s.config.Dns)
+	s.mu.RUnlock()
+	s.log.Info("dns", "DNS server starting on :53 (%s mode) -> %s", mode, ip)
+	for _, srv := range []*dns.Server{s.udp, s.tcp} {
+		go func(srv *dns.Server) {
+			if err := srv.ListenAndServe(); err != nil {
+				s.log.Error("dns", "DNS server (%s) failed: %v (port 53 might be in use or permissions missing)", srv.Net, err)
+			}
+		}(srv)
+	}
+}
 
-	go func() {
-		log.Printf("🌐 DNS Server (Captive Portal) starting on :53 -> %s", s.config.IpAddress)
-		if err := s.server.ListenAndServe(); err != nil {
-			log.Printf("⚠️ DNS Server failed: %v (Port 53 might be in use or permissions missing)", err)
-		}
-	}()
+// SetConfig points the answers at a new WiFi config, e.g. after the hotspot
+// address was changed at runtime.
+func (s *Server) SetConfig(cfg config.WifiConfig) {
+	s.mu.Lock()
+	s.config = cfg
+	s.mu.Unlock()
 }
 
 func (s *Server) Stop() {
-	if s.server != nil {
-		s.server.Shutdown()
+	for _, srv := range []*dns.Server{s.udp, s.tcp} {
+		if srv != nil {
+			srv.Shutdown()
+		}
 	}
 }
 
 func (s *Server) handleDNSRequest(w dns.ResponseWriter, r *dns.Msg) {
+	if r.Opcode != dns.OpcodeQuery || len(r.Question) != 1 {
+		m := new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNotImplemented)
+		w.WriteMsg(m)
+		return
+	}
+	q := r.Question[0]
+	name := strings.ToLower(dns.Fqdn(q.Name))
+
+	s.mu.RLock()
+	cfg := s.config
+	s.mu.RUnlock()
+
+	var m *dns.Msg
+	source := "captive"
+	if zone, addr, ok := staticRecord(cfg, name); ok {
+		m = localAnswer(r, q, addr, zone)
+		source = "static"
+	} else if zone, ok := staticZone(cfg.Dns, name); ok {
+		// Below a static record: nothing else lives there
+		m = new(dns.Msg)
+		m.SetRcode(r, dns.RcodeNameError)
+		m.Authoritative = true
+		m.Ns = []dns.RR{soa(zone)}
+		source = "static"
+	} else if forwarded(cfg.Dns, name) {
+		resp, err := s.forward(r, cfg.Dns.Upstream, isTcp(w))
+		if err == nil {
+			m = resp
+			source = "upstream"
+		}
+	}
+	if m == nil {
+		// Captive answers stand in for the whole name space
+		m = localAnswer(r, q, cfg.IpAddress, ".")
+	}
+
+	if cfg.Dns.LogQueries {
+		s.log.Debug("dns", "%s %s from %s: %s (%s)", dns.TypeToString[q.Qtype], name, clientIp(w), dns.RcodeToString[m.Rcode], source)
+	}
+	w.WriteMsg(m)
+}
+
+// localAnswer answers with addr for A queries. Other types get an empty answer
+// with an SOA (NODATA), so devices stop waiting for an IPv6 address and use the
+// IPv4 one right away instead of timing out. zone is the apex the booth answers
+// for, the owner of that SOA.
+func localAnswer(r *dns.Msg, q dns.Question, addr, zone string) *dns.Msg {
 	m := new(dns.Msg)
 	m.SetReply(r)
-	m.Compress = false
-
-	switch r.Opcode {
-	case dns.OpcodeQuery:
-		for _, q := range m.Question {
-			switch q.Qtype {
-			case dns.TypeA:
-				// Always return our IP for any A record query
-				rr, err := dns.NewRR(q.Name + " 3600 IN A " + s.config.IpAddress)
-				if err == nil {
-					m.Answer = append(m.Answer, rr)
-				}
+	m.Authoritative = true
+	ip := net.ParseIP(addr).To4()
+	if q.Qtype == dns.TypeA && ip != nil {
+		m.Answer = append(m.Answer, &dns.A{
+			Hdr: dns.RR_Header{Name: q.Name, Rrtype: dns.TypeA, Class: dns.ClassINET, Ttl: ttl},
+			A:   ip,
+		})
+		return m
+	}
+	m.Ns = []dns.RR{soa(zone)}
+	return m
+}
+
+// soa is the record that makes negative answers cacheable for ttl seconds.
+func soa(zone string) dns.RR {
+	return &dns.SOA{
+		Hdr:     dns.RR_Header{Name: zone, Rrtype: dns.TypeSOA, Class: dns.ClassINET, Ttl: ttl},
+		Ns:      "photobooth.local.",
+		Mbox:    "hostmaster.photobooth.local.",
+		Serial:  1,
+		Refresh: 3600,
+		Retry:   600,
+		Expire:  86400,
+		Minttl:  ttl,
+	}
+}
+
+// staticRecord looks name up in the configured records and returns the record's
+// name, which is the apex of its own zone, and its address; an empty address
+// stands for the booth.
+func staticRecord(cfg config.WifiConfig, name string) (string, string, bool) {
+	for host, addr := range cfg.Dns.Records {
+		if zone := dns.Fqdn(strings.ToLower(host)); zone == name {
+			if addr == "" {
+				addr = cfg.IpAddress
 			}
+			return zone, addr, true
 		}
 	}
+	return "", "", false
+}
 
-	w.WriteMsg(m)
+// staticZone reports whether name lies below a static record, e.g.
+// "www.booth.lan." for "booth.lan.". Other names of the parent domain, like
+// the venue router's "router.lan.", are left to the mode.
+func staticZone(cfg config.DnsConfig, name string) (string, bool) {
+	for host := range cfg.Records {
+		zone := dns.Fqdn(strings.ToLower(host))
+		if zone != name && dns.IsSubDomain(zone, name) {
+			return zone, true
+		}
+	}
+	return "", false
+}
+
+// forwarded reports whether name is resolved upstream in the configured mode.
+func forwarded(cfg config.DnsConfig, name string) bool {
+	switch modeOf(cfg) {
+	case ModePassthrough:
+		return true
+	case ModeAllowlist:
+		for _, domain := range cfg.Allowlist {
+			if dns.IsSubDomain(dns.Fqdn(strings.ToLower(domain)), name) {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+func modeOf(cfg config.DnsConfig) string {
+	switch cfg.Mode {
+	case ModeAllowlist, ModePassthrough:
+		return cfg.Mode
+	}
+	return ModeCaptive
+}
+
+// forward asks the upstream resolvers in turn. When none answers the booth is
+// taken to be offline and queries are answered locally for offlineBackoff,
+// so guests do not wait for timeouts on every lookup.
+func (s *Server) forward(r *dns.Msg, upstreams []string, tcp bool) (*dns.Msg, error) {
+	s.mu.RLock()
+	offline := time.Now().Before(s.offlineUntil)
+	s.mu.RUnlock()
+	if offline || len(upstreams) == 0 {
+		return nil, errOffline
+	}
+
+	c := &dns.Client{Net: "udp", Timeout: upstreamTimeout}
+	if tcp {
+		c.Net = "tcp"
+	}
+	var lastErr error
+	for _, u := range upstreams {
+		addr := u
+		if _, _, err := net.SplitHostPort(u); err != nil {
+			addr = net.JoinHostPort(u, "53")
+		}
+		resp, _, err := c.Exchange(r, addr)
+		if err != nil {
+			lastErr = err
+			continue
+		}
+		s.setOnline(true, nil)
+		return resp, nil
+	}
+	s.setOnline(false, lastErr)
+	return nil, errOffline
+}
+
+func (s *Server) setOnline(online bool, err error) {
+	s.mu.Lock()
+	changed := s.online != online
+	s.online = online
+	if !online {
+		s.offlineUntil = time.Now().Add(offlineBackoff)
+	}
+	s.mu.Unlock()
+	if !changed {
+		return
+	}
+	if online {
+		s.log.Info("dns", "Upstream DNS reachable again, forwarding queries")
+	} else {
+		s.log.Warn("dns", "Upstream DNS not reachable (%v), answering locally", err)
+	}
+}
+
+func isTcp(w dns.ResponseWriter) bool {
+	_, ok := w.RemoteAddr().(*net.TCPAddr)
+	return ok
+}
+
+func clientIp(w dns.ResponseWriter) string {
+	if host, _, err := net.SplitHostPort(w.RemoteAddr().String()); err == nil {
+		return host
+	}
+	return w.RemoteAddr().String()
 }
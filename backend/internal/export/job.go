@@ -0,0 +1,470 @@
+package export
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"photobooth/internal/archive"
+	"photobooth/internal/disk"
+	"photobooth/internal/fsutil"
+	"photobooth/internal/storage"
+	"photobooth/internal/websocket"
+)
+
+// exportDir is created on the stick; every album gets a folder below it.
+const exportDir = "Photobooth_Export"
+
+// Problems found before copying, in addition to the disk.Problem* categories.
+const (
+	ProblemNoSpace      = "no_space"
+	ProblemFileTooLarge = "file_too_large" // single file or archive above the FAT32 limit
+)
+
+// albumPlan is one album of a job with its folder name and files.
+type albumPlan struct {
+	album  string
+	title  string
+	folder string
+	files  []file
+}
+
+// runJob mounts the stick, copies and verifies every album of the job and sets
+// its final state. Progress is broadcast with the usb_export_* events.
+func (m *Manager) runJob(ctx context.Context, j *Job) {
+	m.log.Info("usb", "Starting export job %s: %s to USB device '%s'...", j.ID, strings.Join(j.Albums, ", "), j.Device)
+
+	fail := func(state, code, msg string, report *storage.VerifyReport) {
+		m.mu.Lock()
+		j.Report = report
+		m.mu.Unlock()
+		m.finish(j, state, code, msg)
+		ev := map[string]interface{}{"jobId": j.ID, "message": msg, "state": state}
+		if code != "" {
+			ev["code"] = code
+		}
+		if report != nil {
+			ev["report"] = report
+		}
+		m.broadcast("usb_export_error", ev)
+	}
+
+	// 1. Mount the job's stick (it may have a new name after replugging) and make sure it
+	// can be written before anything is copied
+	dev, err := findDevice(j.Device, j.UUID)
+	if err != nil {
+		m.log.Warn("usb", "Export job %s: %v", j.ID, err)
+		fail(StateInterrupted, disk.ProblemNotFound, "Device not found", nil)
+		return
+	}
+	if dev.Name != j.Device {
+		m.mu.Lock()
+		j.Device = dev.Name // replugged under another name
+		m.mu.Unlock()
+	}
+	target, err := disk.PrepareUsb(dev.Name)
+	if err != nil {
+		m.log.Error("usb", "Failed to prepare device %s: %v", dev.Name, err)
+		fail(StateFailed, disk.ProblemOf(err), "Mount failed: "+err.Error(), nil)
+		return
+	}
+
+	// 2. Plan all albums, then check that they fit
+	plans := make([]albumPlan, 0, len(j.Albums))
+	folders := make(map[string]bool)
+	for _, album := range j.Albums {
+		// Folder and archive names use the display name, made safe for FAT
+		title := album
+		if m.displayName != nil {
+			if name := m.displayName(album); name != "" {
+				title = name
+			}
+		}
+		folder := SafeName(title)
+		if folders[strings.ToLower(folder)] {
+			folder = SafeName(title + " (" + album + ")")
+		}
+		folders[strings.ToLower(folder)] = true
+		files, err := plan(filepath.Join(m.base, album), title, j)
+		if err != nil {
+			m.log.Error("usb", "Failed to read album '%s': %v", album, err)
+			fail(StateFailed, "", "Copy failed", nil)
+			return
+		}
+		plans = append(plans, albumPlan{album: album, title: title, folder: folder, files: files})
+	}
+	root := filepath.Join(target.MountPoint, exportDir)
+	needed, code, msg := checkFits(j, target, root, plans)
+	if code != "" {
+		m.log.Warn("usb", "Export job %s: %s", j.ID, msg)
+		fail(StateFailed, code, msg, nil)
+		return
+	}
+	m.log.Info("usb", "Device %s (%s): %d MB free, %d MB to copy", dev.Name, target.FsType, target.FreeBytes/(1024*1024), needed/(1024*1024))
+	m.broadcast("usb_export_start", map[string]interface{}{
+		"jobId":       j.ID,
+		"album":       j.Albums[0],
+		"albums":      j.Albums,
+		"fstype":      target.FsType,
+		"freeBytes":   target.FreeBytes,
+		"totalBytes":  target.TotalBytes,
+		"neededBytes": needed,
+	})
+
+	res := &Result{Path: root}
+	for i, p := range plans {
+		album := p.album
+		if len(j.Albums) == 1 && (j.Format == "" || j.Format == FormatFolder) {
+			res.Path = filepath.Join(root, p.folder)
+		}
+
+		var stats disk.CopyStats
+		var verified int
+		if j.Format == FormatZip || j.Format == FormatZipSplit {
+			stats, verified, err = m.exportZip(ctx, j, i, album, p.files, root, p.folder)
+		} else {
+			stats, verified, err = m.exportFolder(ctx, j, i, album, p.files, filepath.Join(root, p.folder))
+		}
+		res.CopiedFiles += stats.CopiedFiles
+		res.CopiedBytes += stats.CopiedBytes
+		res.SkippedFiles += stats.SkippedFiles
+		res.Verified += verified
+		if err == nil {
+			continue
+		}
+
+		var verr *verifyError
+		switch {
+		case ctx.Err() != nil:
+			m.mu.Lock()
+			byUser := j.cancelled
+			m.mu.Unlock()
+			if byUser {
+				m.log.Info("usb", "Export job %s was cancelled.", j.ID)
+				fail(StateCancelled, "", "Export cancelled", nil)
+				return
+			}
+			fail(StateInterrupted, "", "Export interrupted", nil)
+		case errors.As(err, &verr):
+			fail(StateFailed, "", verr.Error(), verr.report)
+		case errors.Is(err, errVerifyFailed):
+			m.log.Error("usb", "Failed to verify export of album '%s': %v", album, err)
+			fail(StateFailed, "", "Verification failed", nil)
+		case !devicePresent(dev.Name):
+			m.log.Warn("usb", "USB device %s was removed during export of '%s'", dev.Name, album)
+			fail(StateInterrupted, disk.ProblemNotFound, "Stick removed – export continues when it is plugged in again", nil)
+		default:
+			m.log.Error("usb", "Failed to export album '%s' to USB: %v", album, err)
+			fail(StateFailed, "", "Copy failed", nil)
+		}
+		return
+	}
+
+	// Do NOT auto-unmount – let the user press "Safely Remove"
+	m.log.Info("usb", "Export job %s done: %d copied, %d skipped, %d files verified.", j.ID, res.CopiedFiles, res.SkippedFiles, res.Verified)
+	m.mu.Lock()
+	j.Result = res
+	m.mu.Unlock()
+	m.finish(j, StateDone, "", "")
+	m.broadcast("usb_export_success", map[string]interface{}{
+		"jobId":        j.ID,
+		"album":        j.Albums[len(j.Albums)-1],
+		"albums":       j.Albums,
+		"path":         res.Path,
+		"verified":     res.Verified,
+		"copiedFiles":  res.CopiedFiles,
+		"skippedFiles": res.SkippedFiles,
+	})
+}
+
+// checkFits estimates the bytes still to be written (files already on the stick
+// with the right size are not counted) and checks them against the free space
+// and the file size limit of the file system. Returns a problem code and message
+// if the export cannot succeed.
+func checkFits(j *Job, target *disk.UsbTarget, root string, plans []albumPlan) (int64, string, string) {
+	var needed int64
+	onStick := func(path string, size int64) bool {
+		info, err := os.Stat(path)
+		return err == nil && info.Size() == size
+	}
+	for _, p := range plans {
+		if j.Format == FormatZip || j.Format == FormatZipSplit {
+			parts := zipParts(p.folder, p.files, j.Format == FormatZipSplit)
+			for i, part := range parts {
+				z := archive.NewZip(part)
+				size := z.Size()
+				z.Close()
+				if target.MaxFileSize > 0 && size > target.MaxFileSize {
+					return needed, ProblemFileTooLarge, fmt.Sprintf("The ZIP of '%s' (%d MB) is too large for %s, use split ZIPs", p.title, size/(1024*1024), target.FsType)
+				}
+				if !onStick(filepath.Join(root, zipName(p.folder, i, len(parts))), size) {
+					needed += size
+				}
+			}
+			continue
+		}
+		for _, f := range p.files {
+			if target.MaxFileSize > 0 && f.size > target.MaxFileSize {
+				return needed, ProblemFileTooLarge, fmt.Sprintf("%s in '%s' (%d MB) is too large for %s", f.dst, p.title, f.size/(1024*1024), target.FsType)
+			}
+			if !onStick(filepath.Join(root, p.folder, filepath.FromSlash(f.dst)), f.size) {
+				needed += f.size
+			}
+		}
+	}
+	if target.TotalBytes > 0 && uint64(needed) > target.FreeBytes {
+		return needed, ProblemNoSpace, fmt.Sprintf("Not enough space on the stick: %d MB needed, %d MB free", needed/(1024*1024), target.FreeBytes/(1024*1024))
+	}
+	return needed, "", ""
+}
+
+var errVerifyFailed = errors.New("verification failed")
+
+// verifyError carries the report of a copy that did not verify.
+type verifyError struct {
+	report *storage.VerifyReport
+}
+
+func (e *verifyError) Error() string {
+	return fmt.Sprintf("%d of %d files on the stick are faulty", len(e.report.Issues), e.report.Files)
+}
+
+// exportFolder copies the planned files of one album into dir, then reads the
+// originals and RAWs back against the capture checksums. Files already on the
+// stick with the right size and checksum are skipped. Returns the copy stats and
+// the number of verified files.
+func (m *Manager) exportFolder(ctx context.Context, j *Job, index int, album string, files []file, dir string) (disk.CopyStats, int, error) {
+	albumDir := filepath.Join(m.base, album)
+	var items []disk.CopyItem
+	var generated []file
+	names := make(map[string]string) // album file → path in dir, for verification
+	origOf := make(map[string]string)
+	for _, f := range files {
+		dst := filepath.Join(dir, filepath.FromSlash(f.dst))
+		if f.src == "" {
+			generated = append(generated, f)
+			continue
+		}
+		items = append(items, disk.CopyItem{Src: f.src, Dst: dst})
+		if f.orig != "" {
+			names[f.orig] = f.dst
+			origOf[dst] = f.orig
+		}
+	}
+
+	sums, err := storage.Checksums(albumDir)
+	if err != nil {
+		m.log.Warn("usb", "No checksums for album '%s', comparing size and time: %v", album, err)
+	}
+	checked := make(map[string]bool)
+	unchanged := func(srcPath, dstPath string) bool {
+		orig := origOf[dstPath]
+		want, ok := sums[orig]
+		if !ok {
+			return disk.SameSizeAndTime(srcPath, dstPath)
+		}
+		si, err := os.Stat(srcPath)
+		if err != nil {
+			return false
+		}
+		if di, err := os.Stat(dstPath); err != nil || di.Size() != si.Size() {
+			return false
+		}
+		if sum, err := storage.FileChecksum(dstPath); err != nil || sum != want {
+			return false
+		}
+		checked[orig] = true
+		return true
+	}
+
+	startTime := time.Now()
+	progress := Progress{Album: album, AlbumIndex: index + 1, AlbumCount: len(j.Albums), Phase: "copy"}
+	stats, err := disk.CopyFilesWithProgress(ctx, items, unchanged, func(st disk.CopyStats) {
+		m.reportCopy(j, &progress, st, startTime)
+	})
+	if err != nil {
+		return stats, 0, err
+	}
+	for _, f := range generated {
+		if err := fsutil.WriteFileAtomic(filepath.Join(dir, filepath.FromSlash(f.dst)), f.data, 0644); err != nil {
+			return stats, 0, err
+		}
+	}
+	if stats.SkippedFiles > 0 {
+		m.log.Info("usb", "Album '%s': %d files copied, %d already on the stick", album, stats.CopiedFiles, stats.SkippedFiles)
+	}
+	if len(names) == 0 {
+		return stats, 0, nil
+	}
+
+	// Flush every copy to the stick and read it back against the capture checksums.
+	// Skipped files were just hashed and are not read again.
+	m.log.Info("usb", "Copy of '%s' done. Verifying files on the stick...", album)
+	progress.Phase = "verify"
+	report, err := storage.VerifyCopy(ctx, albumDir, dir, names, checked, func(n, total int) {
+		m.reportVerify(j, &progress, n, total)
+	})
+	if err != nil {
+		return stats, 0, fmt.Errorf("%w: %v", errVerifyFailed, err)
+	}
+	return stats, report.OK, m.checkReport(report)
+}
+
+// exportZip writes the planned files of one album as one or more ZIPs into dir
+// and reads the originals and RAWs back out of them. An archive that is already
+// on the stick with the expected size and verifies is not written again.
+func (m *Manager) exportZip(ctx context.Context, j *Job, index int, album string, files []file, dir, folder string) (disk.CopyStats, int, error) {
+	albumDir := filepath.Join(m.base, album)
+	sums, err := storage.Checksums(albumDir)
+	if err != nil {
+		m.log.Warn("usb", "No checksums for album '%s', checking against the album files: %v", album, err)
+	}
+
+	parts := zipParts(folder, files, j.Format == FormatZipSplit)
+	zips := make([]*archive.Zip, len(parts))
+	var stats disk.CopyStats
+	for i, part := range parts {
+		zips[i] = archive.NewZip(part)
+		stats.TotalFiles += int64(len(part))
+		stats.TotalBytes += zips[i].Size()
+	}
+	if err := os.MkdirAll(dir, 0777); err != nil {
+		return stats, 0, err
+	}
+	keep := make(map[string]bool, len(parts))
+	for i := range parts {
+		keep[zipName(folder, i, len(parts))] = true
+	}
+	removeExtraParts(dir, folder, keep)
+
+	startTime := time.Now()
+	progress := Progress{Album: album, AlbumIndex: index + 1, AlbumCount: len(j.Albums), Phase: "copy"}
+	report := &storage.VerifyReport{CheckedAt: time.Now()}
+	verifyTotal := 0
+	for i := range parts {
+		verifyTotal += len(zipEntryOrigins(parts[i], files, folder))
+	}
+	verifyPart := func(i int, path string) (*storage.VerifyReport, error) {
+		progress.Phase = "verify"
+		r := &storage.VerifyReport{CheckedAt: time.Now()}
+		err := verifyZip(ctx, albumDir, path, zipEntryOrigins(parts[i], files, folder), sums, r, func() {
+			m.reportVerify(j, &progress, report.Files+r.Files, verifyTotal)
+		})
+		return r, err
+	}
+
+	for i, z := range zips {
+		path := filepath.Join(dir, zipName(folder, i, len(parts)))
+		size := z.Size()
+
+		// Unchanged archive from an earlier (possibly interrupted) export
+		if info, err := os.Stat(path); err == nil && info.Size() == size {
+			if r, err := verifyPart(i, path); err == nil && len(r.Issues) == 0 {
+				mergeReport(report, r)
+				stats.SkippedFiles += int64(len(parts[i]))
+				stats.SkippedBytes += size
+				m.reportCopy(j, &progress, stats, startTime)
+				continue
+			} else if err != nil {
+				return stats, 0, err
+			}
+		}
+
+		progress.Phase = "copy"
+		written := stats
+		pr := &progressReader{ctx: ctx, r: z, onRead: func(n int64) {
+			written.CopiedBytes += n
+			m.reportCopy(j, &progress, written, startTime)
+		}}
+		err := fsutil.WriteReaderAtomic(path, pr)
+		z.Close()
+		if err != nil {
+			if ctx.Err() != nil {
+				return stats, 0, ctx.Err()
+			}
+			return stats, 0, err
+		}
+		stats.CopiedFiles += int64(len(parts[i]))
+		stats.CopiedBytes += size
+		m.reportCopy(j, &progress, stats, startTime)
+
+		m.log.Info("usb", "Wrote %s (%d MB). Verifying...", filepath.Base(path), size/(1024*1024))
+		r, err := verifyPart(i, path)
+		if err != nil {
+			return stats, 0, err
+		}
+		mergeReport(report, r)
+	}
+	return stats, report.OK, m.checkReport(report)
+}
+
+func mergeReport(dst, src *storage.VerifyReport) {
+	dst.Files += src.Files
+	dst.OK += src.OK
+	dst.Issues = append(dst.Issues, src.Issues...)
+}
+
+// checkReport logs the issues of a verification and turns them into an error.
+func (m *Manager) checkReport(report *storage.VerifyReport) error {
+	if len(report.Issues) == 0 {
+		return nil
+	}
+	for _, issue := range report.Issues {
+		m.log.Error("usb", "Verify %s on stick: %s %s", issue.File, issue.Problem, issue.Detail)
+	}
+	return &verifyError{report: report}
+}
+
+// reportCopy stores and broadcasts copy progress.
+func (m *Manager) reportCopy(j *Job, progress *Progress, st disk.CopyStats, startTime time.Time) {
+	var etaSecs int64
+	if st.CopiedBytes > 0 && st.TotalBytes > 0 {
+		elapsed := time.Since(startTime).Seconds()
+		bytesPerSec := float64(st.CopiedBytes) / elapsed
+		if bytesPerSec > 0 {
+			etaSecs = int64(float64(st.TotalBytes-st.DoneBytes()) / bytesPerSec)
+		}
+	}
+	progress.CopiedBytes, progress.TotalBytes = st.DoneBytes(), st.TotalBytes
+	progress.CopiedFiles, progress.TotalFiles = st.DoneFiles(), st.TotalFiles
+	progress.SkippedFiles, progress.EtaSeconds = st.SkippedFiles, etaSecs
+	m.setProgress(j, *progress)
+	m.broadcast("usb_export_progress", map[string]interface{}{
+		"jobId":        j.ID,
+		"album":        progress.Album,
+		"albumIndex":   progress.AlbumIndex,
+		"albumCount":   progress.AlbumCount,
+		"copiedBytes":  progress.CopiedBytes,
+		"totalBytes":   progress.TotalBytes,
+		"copiedFiles":  progress.CopiedFiles,
+		"totalFiles":   progress.TotalFiles,
+		"skippedFiles": progress.SkippedFiles,
+		"etaSeconds":   etaSecs,
+	})
+}
+
+// reportVerify stores and broadcasts verification progress.
+func (m *Manager) reportVerify(j *Job, progress *Progress, n, total int) {
+	progress.VerifiedFiles = n
+	m.setProgress(j, *progress)
+	m.broadcast("usb_export_verify", map[string]interface{}{"jobId": j.ID, "album": progress.Album, "checkedFiles": n, "totalFiles": total})
+}
+
+func (m *Manager) setProgress(j *Job, p Progress) {
+	m.mu.Lock()
+	j.Progress = &p
+	m.mu.Unlock()
+}
+
+func (m *Manager) broadcast(eventType string, data interface{}) {
+	m.hub.Broadcast <- websocket.Event{Type: eventType, Data: data, Timestamp: time.Now().UnixMilli()}
+}
+
+func devicePresent(name string) bool {
+	_, err := findDevice(name, "")
+	return err == nil
+}
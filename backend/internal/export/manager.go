@@ -0,0 +1,478 @@
+package export
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"sync"
+	"time"
+
+	"photobooth/internal/config"
+	"photobooth/internal/disk"
+	"photobooth/internal/fsutil"
+	"photobooth/internal/logging"
+	"photobooth/internal/storage"
+	"photobooth/internal/websocket"
+)
+
+// Job states.
+const (
+	StateQueued      = "queued"
+	StateRunning     = "running"
+	StateDone        = "done"
+	StateFailed      = "failed"
+	StateCancelled   = "cancelled"
+	StateInterrupted = "interrupted" // stick pulled or booth restarted; resumes when the stick is back
+)
+
+// Contents that can be selected for an export.
+const (
+	ContentOriginals  = "originals"
+	ContentRaw        = "raw"
+	ContentPreviews   = "previews"
+	ContentComposites = "composites"
+	ContentManifest   = "manifest"
+)
+
+// Formats of an export.
+const (
+	FormatFolder   = "folder"    // plain files, browsable right away
+	FormatZip      = "zip"       // one ZIP per album
+	FormatZipSplit = "zip_split" // ZIPs of at most ~4 GB each, for FAT32 sticks
+)
+
+// DefaultContents is what an export contains if nothing is selected: the same
+// files as the album's original/ folder plus the manifest.
+var DefaultContents = []string{ContentOriginals, ContentRaw, ContentManifest}
+
+// Triggers of a job.
+const (
+	TriggerManual = "manual"
+	TriggerRule   = "rule"   // auto-export rule matched a plugged stick
+	TriggerResume = "resume" // interrupted job picked up again
+)
+
+// EventTypeJobs is broadcast with the Status whenever a job is queued or finishes.
+const EventTypeJobs = "usb_export_jobs"
+
+// historySize is the number of finished jobs kept.
+const historySize = 50
+
+// Progress of the running job, also kept for clients that connect late.
+type Progress struct {
+	Album         string `json:"album"`
+	AlbumIndex    int    `json:"albumIndex"` // 1-based
+	AlbumCount    int    `json:"albumCount"`
+	Phase         string `json:"phase"` // copy or verify
+	CopiedBytes   int64  `json:"copiedBytes"`
+	TotalBytes    int64  `json:"totalBytes"`
+	CopiedFiles   int64  `json:"copiedFiles"`
+	TotalFiles    int64  `json:"totalFiles"`
+	SkippedFiles  int64  `json:"skippedFiles"`
+	EtaSeconds    int64  `json:"etaSeconds"`
+	VerifiedFiles int    `json:"verifiedFiles,omitempty"`
+}
+
+// Result of a finished job.
+type Result struct {
+	Path         string `json:"path"`
+	CopiedFiles  int64  `json:"copiedFiles"`
+	CopiedBytes  int64  `json:"copiedBytes"`
+	SkippedFiles int64  `json:"skippedFiles"`
+	Verified     int    `json:"verified"`
+}
+
+// Job is one export of one or more albums to a USB stick.
+type Job struct {
+	ID           string                `json:"id"`
+	Device       string                `json:"device"` // e.g. sda1
+	Label        string                `json:"label"`
+	UUID         string                `json:"uuid,omitempty"` // file system UUID, identifies the stick across replugs
+	Albums       []string              `json:"albums"`
+	Contents     []string              `json:"contents"`
+	Format       string                `json:"format"`
+	NameTemplate string                `json:"nameTemplate,omitempty"` // e.g. "{album} - {seq}", empty keeps the original names
+	Slideshow    bool                  `json:"slideshow,omitempty"`    // add an HTML page to browse the photos offline, not for split ZIPs
+	Trigger      string                `json:"trigger"`
+	State        string                `json:"state"`
+	CreatedAt    time.Time             `json:"createdAt"`
+	StartedAt    time.Time             `json:"startedAt,omitempty"`
+	FinishedAt   time.Time             `json:"finishedAt,omitempty"`
+	Attempts     int                   `json:"attempts"`
+	Progress     *Progress             `json:"progress,omitempty"`
+	Result       *Result               `json:"result,omitempty"`
+	Error        string                `json:"error,omitempty"`
+	ErrorCode    string                `json:"errorCode,omitempty"` // problem category, e.g. read_only or no_space
+	Report       *storage.VerifyReport `json:"report,omitempty"`    // set when the copy did not verify
+
+	cancelled bool // cancelled by the user, as opposed to a pulled stick
+}
+
+// Status is the export state shown in /api/status.
+type Status struct {
+	Running *Job  `json:"running,omitempty"`
+	Queued  []Job `json:"queued"`
+	Last    *Job  `json:"last,omitempty"` // most recently finished job
+}
+
+// Request describes a new job.
+type Request struct {
+	Device       string
+	Albums       []string
+	Contents     []string // empty selects DefaultContents
+	Format       string   // empty selects FormatFolder
+	NameTemplate string
+	Slideshow    bool
+	Trigger      string
+}
+
+// Manager runs export jobs one after the other and keeps their history in
+// <photosBase>/.export/jobs.json.
+type Manager struct {
+	mu     sync.Mutex
+	base   string
+	path   string
+	hub    *websocket.Hub
+	log    *logging.Logger
+	jobs   []*Job // oldest first
+	wake   chan struct{}
+	cancel context.CancelFunc // of the running job
+
+	displayName func(album string) string
+}
+
+// NewManager creates the job manager. displayName returns the name shown to
+// customers for an album id (folder and file names on the stick), or "".
+func NewManager(photosBase string, hub *websocket.Hub, displayName func(album string) string) *Manager {
+	return &Manager{
+		displayName: displayName,
+		base:        photosBase,
+		path:        filepath.Join(photosBase, ".export", "jobs.json"),
+		hub:         hub,
+		log:         logging.Get(),
+		wake:        make(chan struct{}, 1),
+	}
+}
+
+// Start loads the job history and runs queued jobs. A job that was running when
+// the booth went down is marked interrupted and resumes with its stick.
+func (m *Manager) Start() {
+	m.mu.Lock()
+	if err := fsutil.ReadJSON(m.path, &m.jobs); err != nil {
+		m.log.Warn("usb", "Failed to load export jobs: %v", err)
+	}
+	interrupted := false
+	for _, j := range m.jobs {
+		if j.State == StateRunning {
+			j.State = StateInterrupted
+			j.Error = "booth restarted during export"
+		}
+		interrupted = interrupted || j.State == StateInterrupted
+	}
+	m.mu.Unlock()
+
+	// The USB watcher only reports sticks plugged in later; one that stayed in
+	// across the restart is picked up here
+	if interrupted {
+		if devices, err := disk.GetUsbDevices(); err == nil {
+			for _, dev := range devices {
+				m.Resume(dev)
+			}
+		}
+	}
+	go m.run()
+}
+
+// Submit validates a request and queues it.
+func (m *Manager) Submit(req Request) (Job, error) {
+	if req.Device == "" {
+		return Job{}, fmt.Errorf("no device selected")
+	}
+	if len(req.Albums) == 0 {
+		return Job{}, fmt.Errorf("no albums selected")
+	}
+	contents := req.Contents
+	if len(contents) == 0 {
+		contents = DefaultContents
+	}
+	for _, c := range contents {
+		switch c {
+		case ContentOriginals, ContentRaw, ContentPreviews, ContentComposites, ContentManifest:
+		default:
+			return Job{}, fmt.Errorf("unknown content %q", c)
+		}
+	}
+	format := req.Format
+	switch format {
+	case "":
+		format = FormatFolder
+	case FormatFolder, FormatZip, FormatZipSplit:
+	default:
+		return Job{}, fmt.Errorf("unknown format %q", format)
+	}
+	albums := make([]string, 0, len(req.Albums))
+	for _, a := range req.Albums {
+		id := config.SanitizeAlbumName(a)
+		if info, err := os.Stat(filepath.Join(m.base, id)); err != nil || !info.IsDir() {
+			return Job{}, fmt.Errorf("album %q not found", a)
+		}
+		albums = append(albums, id)
+	}
+	dev, err := findDevice(req.Device, "")
+	if err != nil {
+		return Job{}, err
+	}
+	trigger := req.Trigger
+	if trigger == "" {
+		trigger = TriggerManual
+	}
+
+	now := time.Now()
+	j := &Job{
+		ID:           strconv.FormatInt(now.UnixNano(), 36),
+		Device:       dev.Name,
+		Label:        dev.Label,
+		UUID:         dev.UUID,
+		Albums:       albums,
+		Contents:     contents,
+		Format:       format,
+		NameTemplate: req.NameTemplate,
+		Slideshow:    req.Slideshow,
+		Trigger:      trigger,
+		State:        StateQueued,
+		CreatedAt:    now,
+	}
+	m.mu.Lock()
+	m.jobs = append(m.jobs, j)
+	job := *j
+	m.saveLocked()
+	m.mu.Unlock()
+
+	m.log.Info("usb", "Export job %s queued: %v to '%s' (%s)", j.ID, albums, dev.Label, trigger)
+	m.changed()
+	return job, nil
+}
+
+// Resume queues the interrupted jobs of a stick again. Returns the number of jobs.
+// Jobs are matched by file system UUID only: labels are neither unique nor
+// always set, and resuming onto another customer's stick would hand them
+// photos that are not theirs.
+func (m *Manager) Resume(dev disk.UsbDevice) int {
+	if dev.UUID == "" {
+		return 0
+	}
+	m.mu.Lock()
+	n := 0
+	for _, j := range m.jobs {
+		if j.State == StateInterrupted && j.UUID == dev.UUID {
+			j.State = StateQueued
+			j.Device = dev.Name
+			j.Trigger = TriggerResume
+			j.Error, j.ErrorCode = "", ""
+			n++
+		}
+	}
+	if n > 0 {
+		m.saveLocked()
+	}
+	m.mu.Unlock()
+	if n > 0 {
+		m.log.Info("usb", "Resuming %d interrupted export(s) on '%s' (%s)", n, dev.Label, dev.UUID)
+		m.changed()
+	}
+	return n
+}
+
+// Cancel stops the job with the given id, or the running job if id is empty.
+// Returns false if there is no such queued or running job.
+func (m *Manager) Cancel(id string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, j := range m.jobs {
+		if (id == "" && j.State != StateRunning) || (id != "" && j.ID != id) {
+			continue
+		}
+		switch j.State {
+		case StateRunning:
+			j.cancelled = true
+			if m.cancel != nil {
+				m.cancel()
+			}
+			return true
+		case StateQueued, StateInterrupted:
+			j.State = StateCancelled
+			j.FinishedAt = time.Now()
+			m.saveLocked()
+			go m.changed()
+			return true
+		}
+		return false
+	}
+	return false
+}
+
+// Busy reports whether a job is currently writing to the device.
+func (m *Manager) Busy(device string) bool {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	for _, j := range m.jobs {
+		if j.State == StateRunning && (device == "" || j.Device == device) {
+			return true
+		}
+	}
+	return false
+}
+
+// Jobs returns all jobs, newest first.
+func (m *Manager) Jobs() []Job {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	list := make([]Job, 0, len(m.jobs))
+	for i := len(m.jobs) - 1; i >= 0; i-- {
+		list = append(list, m.copyOf(m.jobs[i]))
+	}
+	return list
+}
+
+// Status returns the running job with its progress, the queue and the last result.
+func (m *Manager) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	s := Status{Queued: []Job{}}
+	for _, j := range m.jobs {
+		switch j.State {
+		case StateRunning:
+			c := m.copyOf(j)
+			s.Running = &c
+		case StateQueued:
+			s.Queued = append(s.Queued, m.copyOf(j))
+		case StateDone, StateFailed, StateCancelled, StateInterrupted:
+			c := m.copyOf(j)
+			s.Last = &c
+		}
+	}
+	return s
+}
+
+func (m *Manager) copyOf(j *Job) Job {
+	c := *j
+	if j.Progress != nil {
+		p := *j.Progress
+		c.Progress = &p
+	}
+	return c
+}
+
+func (m *Manager) run() {
+	for {
+		m.mu.Lock()
+		var j *Job
+		for _, q := range m.jobs {
+			if q.State == StateQueued {
+				j = q
+				break
+			}
+		}
+		var ctx context.Context
+		if j != nil {
+			ctx, m.cancel = context.WithCancel(context.Background())
+			j.State = StateRunning
+			j.StartedAt = time.Now()
+			j.Attempts++
+			j.Progress = nil
+			j.Result = nil
+			j.Report = nil
+			m.saveLocked()
+		}
+		m.mu.Unlock()
+
+		if j == nil {
+			<-m.wake
+			continue
+		}
+		m.changed()
+		m.runJob(ctx, j)
+
+		m.mu.Lock()
+		m.cancel()
+		m.cancel = nil
+		j.FinishedAt = time.Now()
+		m.pruneLocked()
+		m.saveLocked()
+		m.mu.Unlock()
+		m.changed()
+	}
+}
+
+// finish sets the final state of the running job.
+func (m *Manager) finish(j *Job, state, code, errMsg string) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	j.State = state
+	j.Error = errMsg
+	j.ErrorCode = code
+}
+
+// pruneLocked drops the oldest finished jobs beyond historySize.
+func (m *Manager) pruneLocked() {
+	finished := 0
+	for _, j := range m.jobs {
+		if j.State != StateQueued && j.State != StateRunning {
+			finished++
+		}
+	}
+	if finished <= historySize {
+		return
+	}
+	drop := finished - historySize
+	kept := m.jobs[:0]
+	for _, j := range m.jobs {
+		if drop > 0 && j.State != StateQueued && j.State != StateRunning {
+			drop--
+			continue
+		}
+		kept = append(kept, j)
+	}
+	m.jobs = kept
+}
+
+func (m *Manager) saveLocked() {
+	if err := fsutil.WriteJSON(m.path, m.jobs); err != nil {
+		m.log.Error("usb", "Failed to persist export jobs: %v", err)
+	}
+}
+
+// changed wakes the runner and tells clients about the new queue state.
+func (m *Manager) changed() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	m.hub.Broadcast <- websocket.Event{
+		Type:      EventTypeJobs,
+		Data:      m.Status(),
+		Timestamp: time.Now().UnixMilli(),
+	}
+}
+
+// findDevice looks up a USB device by name. With a UUID the device must carry
+// that file system: a job stays bound to its stick even if the stick is
+// replugged under another name, and is never written to a different stick that
+// took over the name.
+func findDevice(name, uuid string) (disk.UsbDevice, error) {
+	devices, err := disk.GetUsbDevices()
+	if err != nil {
+		return disk.UsbDevice{}, err
+	}
+	for _, d := range devices {
+		if uuid != "" && d.UUID == uuid {
+			return d, nil
+		}
+		if uuid == "" && d.Name == name {
+			return d, nil
+		}
+	}
+	return disk.UsbDevice{}, fmt.Errorf("device %s not found", name)
+}
@@ -0,0 +1,108 @@
+package export
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"time"
+	"unicode"
+)
+
+// maxNameRunes keeps file and folder names well below the 255 UTF-16 units FAT
+// and exFAT allow per path component, leaving room for " (2)" and ".zip".
+const maxNameRunes = 120
+
+// reservedNames cannot be used as file names on Windows, with or without extension.
+var reservedNames = map[string]bool{
+	"CON": true, "PRN": true, "AUX": true, "NUL": true,
+	"COM1": true, "COM2": true, "COM3": true, "COM4": true, "COM5": true, "COM6": true, "COM7": true, "COM8": true, "COM9": true,
+	"LPT1": true, "LPT2": true, "LPT3": true, "LPT4": true, "LPT5": true, "LPT6": true, "LPT7": true, "LPT8": true, "LPT9": true,
+}
+
+// SafeName turns a display name into a file or folder name that is valid on
+// FAT32, exFAT and NTFS: no <>:"/\|?* or control characters, no trailing dots
+// or spaces, no reserved device names and a bounded length. Umlauts and other
+// Unicode letters are kept, since long file names are stored as UTF-16.
+func SafeName(name string) string {
+	var b strings.Builder
+	for _, r := range name {
+		switch {
+		case r < 0x20 || r == 0x7f:
+			continue
+		case strings.ContainsRune(`<>:"/\|?*`, r):
+			b.WriteRune('_')
+		case unicode.IsSpace(r):
+			b.WriteRune(' ')
+		default:
+			b.WriteRune(r)
+		}
+	}
+	s := strings.Join(strings.Fields(b.String()), " ")
+	if r := []rune(s); len(r) > maxNameRunes {
+		s = string(r[:maxNameRunes])
+	}
+	s = strings.TrimRight(s, ". ")
+	if s == "" {
+		return "_"
+	}
+	base := s
+	if i := strings.IndexByte(base, '.'); i >= 0 {
+		base = base[:i]
+	}
+	if reservedNames[strings.ToUpper(base)] {
+		s = "_" + s
+	}
+	return s
+}
+
+// namer builds the file names on the stick from a template. Placeholders:
+// {album} display name, {seq} running number of the exported captures, {date}
+// and {time} of the capture, {name} the original file name without extension.
+// The extension of the file is always appended. An empty template keeps the
+// original names.
+type namer struct {
+	template string
+	album    string
+	width    int
+	used     map[string]bool // lower case, FAT compares names case-insensitively
+}
+
+func newNamer(template, album string, count int) *namer {
+	template = strings.TrimSpace(template)
+	template = strings.TrimSuffix(template, ".{ext}")
+	if ext := strings.ToLower(filepath.Ext(template)); ext != "" && !strings.ContainsAny(ext, "{}") {
+		// "{album} - {seq}.jpg": the real extension is added per file
+		template = strings.TrimSuffix(template, filepath.Ext(template))
+	}
+	width := len(fmt.Sprint(count))
+	if width < 3 {
+		width = 3
+	}
+	return &namer{template: template, album: album, width: width, used: make(map[string]bool)}
+}
+
+// name returns the name for the seq-th capture. ext includes the dot.
+func (n *namer) name(seq int, original string, captured time.Time, ext string) string {
+	base := strings.TrimSuffix(original, filepath.Ext(original))
+	if n.template != "" {
+		base = strings.NewReplacer(
+			"{album}", n.album,
+			"{seq}", fmt.Sprintf("%0*d", n.width, seq),
+			"{date}", captured.Format("2006-01-02"),
+			"{time}", captured.Format("15-04-05"),
+			"{name}", base,
+		).Replace(n.template)
+		ext = strings.ToLower(ext)
+	}
+	return n.unique(SafeName(base), ext)
+}
+
+// unique appends " (2)", " (3)", ... if the name is already taken.
+func (n *namer) unique(base, ext string) string {
+	name := base + ext
+	for i := 2; n.used[strings.ToLower(name)]; i++ {
+		name = fmt.Sprintf("%s (%d)%s", base, i, ext)
+	}
+	n.used[strings.ToLower(name)] = true
+	return name
+}
@@ -0,0 +1,152 @@
+package export
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"photobooth/internal/storage"
+)
+
+// file is one file of an album export, in a folder on the stick or in a ZIP.
+type file struct {
+	src  string // on disk; empty for generated content
+	data []byte // generated content, e.g. the slideshow page
+	dst  string // relative to the album folder, forward slashes
+	orig string // album file name of originals and RAWs, which are verified
+	size int64
+	mod  time.Time
+}
+
+// plan lists the files for the selected contents of an album, named by the
+// job's template. Originals and RAWs go straight into the album folder, previews
+// and composites into sub folders, followed by the manifest and the slideshow.
+func plan(albumDir, title string, j *Job) ([]file, error) {
+	want := make(map[string]bool, len(j.Contents))
+	for _, c := range j.Contents {
+		want[c] = true
+	}
+	idx, err := storage.OpenIndex(albumDir)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := idx.All()
+	if err != nil {
+		return nil, err
+	}
+	sort.Slice(recs, func(i, k int) bool {
+		if !recs[i].CapturedAt.Equal(recs[k].CapturedAt) {
+			return recs[i].CapturedAt.Before(recs[k].CapturedAt)
+		}
+		return recs[i].Filename < recs[k].Filename
+	})
+
+	var files []file
+	var photos, previews []string // slideshow candidates
+	add := func(sub, name, dst, orig string, mod time.Time) bool {
+		src := filepath.Join(albumDir, sub, name)
+		info, err := os.Stat(src)
+		if err != nil || !info.Mode().IsRegular() {
+			return false
+		}
+		if mod.IsZero() {
+			mod = info.ModTime()
+		}
+		files = append(files, file{src: src, dst: dst, orig: orig, size: info.Size(), mod: mod})
+		return true
+	}
+
+	// {seq} numbers only the captures that are exported, so the names on the
+	// stick have no gaps
+	exported := recs[:0]
+	for i := range recs {
+		if exports(albumDir, &recs[i], want) {
+			exported = append(exported, recs[i])
+		}
+	}
+	recs = exported
+
+	n := newNamer(j.NameTemplate, title, len(recs))
+	for i := range recs {
+		r := &recs[i]
+		if r.MediaType == storage.MediaRAW {
+			name := n.name(i+1, r.Filename, r.CapturedAt, filepath.Ext(r.Filename))
+			add("original", r.Filename, name, r.Filename, r.CapturedAt)
+			continue
+		}
+		name := n.name(i+1, r.Filename, r.CapturedAt, filepath.Ext(r.Filename))
+		base := strings.TrimSuffix(name, path.Ext(name))
+		if want[ContentOriginals] && add("original", r.Filename, name, r.Filename, r.CapturedAt) && r.IsImage() {
+			photos = append(photos, name)
+		}
+		if want[ContentRaw] && r.Raw != "" {
+			add("original", r.Raw, n.unique(base, companionExt(n, r.Raw)), r.Raw, r.CapturedAt)
+		}
+		if want[ContentPreviews] && r.Preview != "" {
+			dst := "preview/" + base + companionExt(n, r.Preview)
+			if add("preview", r.Preview, dst, "", r.CapturedAt) {
+				previews = append(previews, dst)
+			}
+		}
+	}
+	if want[ContentComposites] {
+		if list, err := os.ReadDir(filepath.Join(albumDir, "composite")); err == nil {
+			for _, e := range list {
+				if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+					add("composite", e.Name(), "composite/"+SafeName(e.Name()), "", time.Time{})
+				}
+			}
+		}
+	}
+	// The album manifest travels with the photos
+	if manifest := storage.ManifestPath(albumDir); want[ContentManifest] {
+		add("", filepath.Base(manifest), filepath.Base(manifest), "", time.Time{})
+	}
+
+	// A page in the last part of a split ZIP would point at photos in the
+	// other parts, so split ZIPs get none
+	if j.Slideshow && j.Format != FormatZipSplit {
+		// Previews load much faster in a browser than full-size originals
+		if len(previews) > 0 {
+			photos = previews
+		}
+		if len(photos) > 0 {
+			page, err := slideshow(title, photos)
+			if err != nil {
+				return nil, err
+			}
+			var mod time.Time
+			if len(recs) > 0 {
+				mod = recs[len(recs)-1].CapturedAt
+			}
+			files = append(files, file{data: page, dst: slideshowName, size: int64(len(page)), mod: mod})
+		}
+	}
+	return files, nil
+}
+
+// exports reports whether any file of a capture is part of the export.
+func exports(albumDir string, r *storage.Record, want map[string]bool) bool {
+	exists := func(name string) bool {
+		info, err := os.Stat(filepath.Join(albumDir, name))
+		return err == nil && info.Mode().IsRegular()
+	}
+	if r.MediaType == storage.MediaRAW {
+		return want[ContentRaw] && exists(filepath.Join("original", r.Filename))
+	}
+	return (want[ContentOriginals] && exists(filepath.Join("original", r.Filename))) ||
+		(want[ContentRaw] && r.Raw != "" && exists(filepath.Join("original", r.Raw))) ||
+		(want[ContentPreviews] && r.Preview != "" && exists(filepath.Join("preview", r.Preview)))
+}
+
+// companionExt is the extension of a companion file, lower-cased like the main file
+// when a template is used.
+func companionExt(n *namer, name string) string {
+	if n.template != "" {
+		return strings.ToLower(filepath.Ext(name))
+	}
+	return filepath.Ext(name)
+}
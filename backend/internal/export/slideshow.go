@@ -0,0 +1,76 @@
+package export
+
+import (
+	"bytes"
+	"html/template"
+	"net/url"
+	"strings"
+)
+
+// slideshowName is the file customers open to browse the photos offline.
+const slideshowName = "Fotos ansehen.html"
+
+// slideshowTmpl is a self-contained page (no scripts or fonts from the internet)
+// with a thumbnail grid and a full-screen viewer: arrow keys, swipe and
+// click/tap to step through the photos.
+var slideshowTmpl = template.Must(template.New("slideshow").Parse(`<!DOCTYPE html>
+<html lang="de">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>{{.Title}}</title>
+<style>
+body{margin:0;background:#111;color:#eee;font-family:system-ui,sans-serif}
+h1{font-weight:500;font-size:1.4em;margin:24px}
+.grid{display:grid;grid-template-columns:repeat(auto-fill,minmax(180px,1fr));gap:8px;padding:0 24px 24px}
+.grid img{width:100%;aspect-ratio:3/2;object-fit:cover;cursor:pointer;border-radius:4px;background:#222}
+#view{display:none;position:fixed;inset:0;background:#000;align-items:center;justify-content:center}
+#view.open{display:flex}
+#view img{max-width:100%;max-height:100%}
+#view button{position:absolute;top:50%;background:none;border:0;color:#fff;font-size:48px;cursor:pointer;padding:24px}
+#prev{left:0}#next{right:0}
+#close{top:0!important;right:0}
+#count{position:absolute;bottom:12px;width:100%;text-align:center;color:#aaa}
+</style>
+</head>
+<body>
+<h1>{{.Title}} <small>({{len .Photos}} Fotos)</small></h1>
+<div class="grid">{{range $i, $p := .Photos}}
+<img src="{{$p}}" loading="lazy" alt="" data-i="{{$i}}">{{end}}
+</div>
+<div id="view"><img id="big" alt=""><button id="prev">&#8249;</button><button id="next">&#8250;</button><button id="close">&#215;</button><div id="count"></div></div>
+<script>
+var photos=[{{range $i, $p := .Photos}}{{if $i}},{{end}}{{$p}}{{end}}],cur=0,x0=null;
+var view=document.getElementById('view'),big=document.getElementById('big'),count=document.getElementById('count');
+function show(i){cur=(i+photos.length)%photos.length;big.src=photos[cur];count.textContent=(cur+1)+' / '+photos.length;view.className='open'}
+function close_(){view.className=''}
+document.querySelectorAll('.grid img').forEach(function(el){el.onclick=function(){show(+el.dataset.i)}});
+document.getElementById('prev').onclick=function(){show(cur-1)};
+document.getElementById('next').onclick=function(){show(cur+1)};
+document.getElementById('close').onclick=close_;
+document.onkeydown=function(e){if(!view.className)return;if(e.key==='ArrowLeft')show(cur-1);else if(e.key==='ArrowRight'||e.key===' ')show(cur+1);else if(e.key==='Escape')close_()};
+view.ontouchstart=function(e){x0=e.touches[0].clientX};
+view.ontouchend=function(e){if(x0===null)return;var dx=e.changedTouches[0].clientX-x0;if(Math.abs(dx)>40)show(cur+(dx<0?1:-1));x0=null};
+</script>
+</body>
+</html>
+`))
+
+// slideshow renders the page for photos given as paths relative to the page.
+func slideshow(title string, photos []string) ([]byte, error) {
+	urls := make([]string, len(photos))
+	for i, p := range photos {
+		// Escape each segment, file names may contain spaces, '#' or '?'
+		parts := strings.Split(p, "/")
+		for j := range parts {
+			parts[j] = url.PathEscape(parts[j])
+		}
+		urls[i] = strings.Join(parts, "/")
+	}
+	var buf bytes.Buffer
+	err := slideshowTmpl.Execute(&buf, struct {
+		Title  string
+		Photos []string
+	}{title, urls})
+	return buf.Bytes(), err
+}
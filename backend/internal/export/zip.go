@@ -0,0 +1,171 @@
+package export
+
+import (
+	"archive/zip"
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+
+	"photobooth/internal/archive"
+	"photobooth/internal/storage"
+)
+
+// maxZipPart keeps split archives below the 4 GB file size limit of FAT32, with
+// room for the ZIP headers.
+const maxZipPart = 4*1024*1024*1024 - 64*1024*1024
+
+// zipParts groups the files of an album into archives. Without split there is
+// a single archive. Split archives are independent ZIPs ("Album - Teil 1.zip",
+// ...) rather than a spanned archive, which Windows cannot open.
+func zipParts(folder string, files []file, split bool) [][]archive.Entry {
+	var parts [][]archive.Entry
+	var cur []archive.Entry
+	var size int64
+	for _, f := range files {
+		e := archive.Entry{Name: folder + "/" + f.dst, Path: f.src, Data: f.data, Size: f.size, ModTime: f.mod}
+		// Headers, data descriptor and central directory record per entry
+		cost := f.size + 200 + 2*int64(len(e.Name))
+		if split && len(cur) > 0 && size+cost > maxZipPart {
+			parts = append(parts, cur)
+			cur, size = nil, 0
+		}
+		cur = append(cur, e)
+		size += cost
+	}
+	if len(cur) > 0 || len(parts) == 0 {
+		parts = append(parts, cur)
+	}
+	return parts
+}
+
+// zipName is the file name of part i (0-based) of n.
+func zipName(folder string, i, n int) string {
+	if n == 1 {
+		return folder + ".zip"
+	}
+	return fmt.Sprintf("%s - Teil %d.zip", folder, i+1)
+}
+
+// removeExtraParts deletes archives of the folder left over from an earlier
+// export that needed more parts (or was split while now it is not).
+func removeExtraParts(dir, folder string, keep map[string]bool) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if !e.IsDir() && isZipPart(e.Name(), folder) && !keep[e.Name()] {
+			os.Remove(filepath.Join(dir, e.Name()))
+		}
+	}
+}
+
+// verifyZip reads an archive back and checks the originals and RAWs in it
+// against the capture checksums (sums, by album file name). Reading an entry to
+// the end also checks its CRC. entries maps entry names to album file names.
+func verifyZip(ctx context.Context, albumDir, path string, entries map[string]string, sums map[string]string, report *storage.VerifyReport, onFile func()) error {
+	r, err := zip.OpenReader(path)
+	if err != nil {
+		for _, orig := range entries {
+			report.Files++
+			report.Issues = append(report.Issues, storage.VerifyIssue{File: orig, Problem: storage.ProblemUnreadable, Detail: err.Error()})
+			onFile()
+		}
+		return nil
+	}
+	defer r.Close()
+
+	found := make(map[string]*zip.File, len(r.File))
+	for _, f := range r.File {
+		found[f.Name] = f
+	}
+	for name, orig := range entries {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		report.Files++
+		want := sums[orig]
+		if want == "" {
+			// No checksum from capture: the album's file is the reference
+			want, _ = storage.FileChecksum(filepath.Join(albumDir, "original", orig))
+		}
+		f, ok := found[name]
+		if !ok {
+			report.Issues = append(report.Issues, storage.VerifyIssue{File: orig, Problem: storage.ProblemMissing})
+		} else if sum, err := zipEntryChecksum(f); err != nil {
+			report.Issues = append(report.Issues, storage.VerifyIssue{File: orig, Problem: storage.ProblemUnreadable, Detail: err.Error()})
+		} else if want != "" && sum != want {
+			report.Issues = append(report.Issues, storage.VerifyIssue{File: orig, Problem: storage.ProblemChanged})
+		} else {
+			report.OK++
+		}
+		onFile()
+	}
+	return nil
+}
+
+func zipEntryChecksum(f *zip.File) (string, error) {
+	rc, err := f.Open()
+	if err != nil {
+		return "", err
+	}
+	defer rc.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, rc); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// progressReader counts the bytes read and stops when ctx is cancelled.
+type progressReader struct {
+	ctx    context.Context
+	r      io.Reader
+	onRead func(n int64)
+	last   time.Time
+	n      int64
+}
+
+func (p *progressReader) Read(b []byte) (int, error) {
+	if err := p.ctx.Err(); err != nil {
+		return 0, err
+	}
+	n, err := p.r.Read(b)
+	p.n += int64(n)
+	// Throttled, every read would flood the websocket
+	if time.Since(p.last) > 250*time.Millisecond || err == io.EOF {
+		p.last = time.Now()
+		p.onRead(p.n)
+		p.n = 0
+	}
+	return n, err
+}
+
+// zipEntryOrigins maps the entry names of a part to the album file names of the
+// originals and RAWs in it.
+func zipEntryOrigins(part []archive.Entry, files []file, folder string) map[string]string {
+	byName := make(map[string]string, len(files))
+	for _, f := range files {
+		if f.orig != "" {
+			byName[folder+"/"+f.dst] = f.orig
+		}
+	}
+	origins := make(map[string]string)
+	for _, e := range part {
+		if orig, ok := byName[e.Name]; ok {
+			origins[e.Name] = orig
+		}
+	}
+	return origins
+}
+
+// isZipPart reports whether name is an archive written for folder.
+func isZipPart(name, folder string) bool {
+	return name == folder+".zip" || (strings.HasPrefix(name, folder+" - Teil ") && strings.HasSuffix(name, ".zip"))
+}
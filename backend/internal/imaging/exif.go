@@ -0,0 +1,125 @@
+package imaging
+
+import (
+	"bufio"
+	"encoding/binary"
+	"io"
+	"os"
+	"strings"
+	"time"
+)
+
+// EXIF tags used to find the capture time.
+const (
+	tagExifIFD          = 0x8769
+	tagDateTime         = 0x0132
+	tagDateTimeOriginal = 0x9003
+)
+
+// CaptureTime reads DateTimeOriginal (or DateTime) from a JPEG's EXIF block.
+// The camera's local time is interpreted in the booth's time zone.
+func CaptureTime(path string) (time.Time, bool) {
+	f, err := os.Open(path)
+	if err != nil {
+		return time.Time{}, false
+	}
+	defer f.Close()
+
+	tiff, err := findExif(bufio.NewReader(f))
+	if err != nil || len(tiff) < 8 {
+		return time.Time{}, false
+	}
+
+	var order binary.ByteOrder
+	switch string(tiff[:2]) {
+	case "II":
+		order = binary.LittleEndian
+	case "MM":
+		order = binary.BigEndian
+	default:
+		return time.Time{}, false
+	}
+
+	ifd0 := order.Uint32(tiff[4:8])
+	var dateTime string
+	var exifIFD uint32
+	readIFD(tiff, order, ifd0, func(tag uint16, typ uint16, count, value uint32) {
+		switch tag {
+		case tagDateTime:
+			dateTime = asciiValue(tiff, typ, count, value)
+		case tagExifIFD:
+			exifIFD = value
+		}
+	})
+	if exifIFD != 0 {
+		readIFD(tiff, order, exifIFD, func(tag uint16, typ uint16, count, value uint32) {
+			if tag == tagDateTimeOriginal {
+				if s := asciiValue(tiff, typ, count, value); s != "" {
+					dateTime = s
+				}
+			}
+		})
+	}
+
+	t, err := time.ParseInLocation("2006:01:02 15:04:05", strings.TrimSpace(dateTime), time.Local)
+	if err != nil {
+		return time.Time{}, false
+	}
+	return t, true
+}
+
+// findExif walks the JPEG markers up to the APP1 "Exif" segment and returns its TIFF payload.
+func findExif(r *bufio.Reader) ([]byte, error) {
+	var soi [2]byte
+	if _, err := io.ReadFull(r, soi[:]); err != nil || soi != [2]byte{0xFF, 0xD8} {
+		return nil, io.ErrUnexpectedEOF
+	}
+	for {
+		var hdr [4]byte
+		if _, err := io.ReadFull(r, hdr[:]); err != nil {
+			return nil, err
+		}
+		if hdr[0] != 0xFF || hdr[1] == 0xDA { // start of scan: no EXIF before the image data
+			return nil, io.EOF
+		}
+		length := int(binary.BigEndian.Uint16(hdr[2:])) - 2
+		if length < 0 {
+			return nil, io.ErrUnexpectedEOF
+		}
+		if hdr[1] != 0xE1 {
+			if _, err := r.Discard(length); err != nil {
+				return nil, err
+			}
+			continue
+		}
+		seg := make([]byte, length)
+		if _, err := io.ReadFull(r, seg); err != nil {
+			return nil, err
+		}
+		if len(seg) > 6 && string(seg[:6]) == "Exif\x00\x00" {
+			return seg[6:], nil
+		}
+	}
+}
+
+func readIFD(tiff []byte, order binary.ByteOrder, off uint32, fn func(tag, typ uint16, count, value uint32)) {
+	if int(off)+2 > len(tiff) {
+		return
+	}
+	n := int(order.Uint16(tiff[off:]))
+	for i := 0; i < n; i++ {
+		e := int(off) + 2 + i*12
+		if e+12 > len(tiff) {
+			return
+		}
+		fn(order.Uint16(tiff[e:]), order.Uint16(tiff[e+2:]), order.Uint32(tiff[e+4:]), order.Uint32(tiff[e+8:]))
+	}
+}
+
+// asciiValue returns an ASCII tag stored at a TIFF offset (dates are always longer than 4 bytes).
+func asciiValue(tiff []byte, typ uint16, count, off uint32) string {
+	if typ != 2 || count <= 4 || int(off)+int(count) > len(tiff) {
+		return ""
+	}
+	return strings.TrimRight(string(tiff[off:off+count]), "\x00")
+}
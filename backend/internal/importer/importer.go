@@ -0,0 +1,361 @@
+package importer
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+
+	"photobooth/internal/imaging"
+	"photobooth/internal/logging"
+	"photobooth/internal/storage"
+)
+
+// Result summarizes an import run.
+type Result struct {
+	Imported   int `json:"imported"`
+	Duplicates int `json:"duplicates"`
+	Failed     int `json:"failed"`
+}
+
+// ProgressFunc has the same signature as the USB export progress callback.
+type ProgressFunc func(copiedBytes, totalBytes, copiedFiles, totalFiles int64)
+
+// source is a group of files sharing a base name in the same folder, e.g.
+// IMG_0001.JPG + IMG_0001.CR2. A group gets one new name so RAW and JPEG stay paired.
+type source struct {
+	files []string
+	sizes []int64
+}
+
+// Importer copies photos from a folder (a mounted USB stick, a camera card or a
+// backup) into an album, skipping files whose content is already there.
+type Importer struct {
+	// OnImported is called for every new photo once it is indexed, with the
+	// error of generating its derivatives, so imports take the same path as
+	// captures (mirror, uploads, sync). A RAW goes along with its JPEG.
+	OnImported func(filename string, processErr error)
+
+	albumDir string
+	proc     *imaging.Processor
+	log      *logging.Logger
+
+	hashes  map[string]bool    // SHA-256 of every original known to be in the album
+	bySize  map[int64][]string // existing originals not hashed yet, by size
+	created []string           // new originals that need derivatives
+	sums    map[string]string  // checksum of each created file, stored in the index
+}
+
+func New(albumDir string, proc *imaging.Processor) *Importer {
+	return &Importer{
+		albumDir: albumDir,
+		proc:     proc,
+		log:      logging.Get(),
+		hashes:   make(map[string]bool),
+		bySize:   make(map[int64][]string),
+		sums:     make(map[string]string),
+	}
+}
+
+// Run imports every supported photo below srcDir. Cancelling ctx stops after the
+// current file; what was imported so far stays in the album.
+func (im *Importer) Run(ctx context.Context, srcDir string, onProgress ProgressFunc) (Result, error) {
+	var res Result
+	for _, sub := range []string{"original", "preview", "thumb"} {
+		if err := os.MkdirAll(filepath.Join(im.albumDir, sub), 0755); err != nil {
+			return res, err
+		}
+	}
+	originals := filepath.Join(im.albumDir, "original")
+
+	groups, totalBytes, totalFiles, err := scan(srcDir)
+	if err != nil {
+		return res, err
+	}
+	idx, err := storage.OpenIndex(im.albumDir)
+	if err != nil {
+		return res, err
+	}
+	im.indexExisting(idx, originals)
+
+	var copiedBytes, copiedFiles int64
+	onProgress(0, totalBytes, 0, totalFiles)
+
+	for _, g := range groups {
+		if ctx.Err() != nil {
+			break
+		}
+		n, dup, failed := im.importGroup(ctx, originals, g)
+		res.Imported += n
+		res.Duplicates += dup
+		res.Failed += failed
+		for _, s := range g.sizes {
+			copiedBytes += s
+		}
+		copiedFiles += int64(len(g.files))
+		onProgress(copiedBytes, totalBytes, copiedFiles, totalFiles)
+	}
+
+	// Derivatives and index records for everything that was copied
+	var photos []string
+	processErrs := make(map[string]error)
+	for _, path := range im.created {
+		if storage.MediaTypeOf(path) == storage.MediaRAW {
+			continue
+		}
+		photos = append(photos, path)
+		if err := im.proc.Process(path, nil); err != nil {
+			processErrs[path] = err
+			if im.OnImported == nil {
+				im.log.Warn("import", "Failed to generate previews for %s: %v", filepath.Base(path), err)
+			}
+		}
+	}
+	if len(im.created) > 0 {
+		if _, _, err := idx.Reconcile(); err != nil {
+			return res, err
+		}
+		// The copies were hashed on the way in; keep those as the capture checksums
+		recs, _ := idx.All()
+		for i := range recs {
+			sum := im.sums[filepath.Join(originals, recs[i].Filename)]
+			rawSum := im.sums[filepath.Join(originals, recs[i].Raw)]
+			if sum == "" && rawSum == "" {
+				continue
+			}
+			idx.Update(recs[i].Filename, func(rec *storage.Record) error {
+				if rec.Checksum == "" {
+					rec.Checksum = sum
+				}
+				if rec.Raw != "" && rec.RawChecksum == "" {
+					rec.RawChecksum = rawSum
+				}
+				return nil
+			})
+		}
+	}
+	if im.OnImported != nil {
+		for _, path := range photos {
+			im.OnImported(filepath.Base(path), processErrs[path])
+		}
+	}
+	return res, ctx.Err()
+}
+
+// importGroup copies one group of files under a fresh IMG_YYYYMMDD_HHMMSS name.
+func (im *Importer) importGroup(ctx context.Context, originals string, g source) (imported, duplicates, failed int) {
+	captured := captureTime(g)
+	base := "IMG_" + captured.Format("20060102_150405")
+
+	// Files are copied to temp names first; the final names are only picked once
+	// we know which files are new
+	type staged struct {
+		tmp, ext, sum string
+	}
+	var keep []staged
+	for i, src := range g.files {
+		if ctx.Err() != nil {
+			break
+		}
+		tmp, sum, err := copyHashed(src, originals)
+		if err != nil {
+			im.log.Warn("import", "Failed to copy %s: %v", src, err)
+			failed++
+			continue
+		}
+		if im.isDuplicate(sum, g.sizes[i]) {
+			os.Remove(tmp)
+			duplicates++
+			continue
+		}
+		im.hashes[sum] = true
+		keep = append(keep, staged{tmp: tmp, ext: strings.ToLower(filepath.Ext(src)), sum: sum})
+	}
+	if len(keep) == 0 {
+		return
+	}
+	// Burst shots share a second: add a suffix until no file of the group collides
+	name := base
+	for n := 2; ; n++ {
+		free := true
+		for _, k := range keep {
+			if _, err := os.Stat(filepath.Join(originals, name+normalizeExt(k.ext))); err == nil {
+				free = false
+				break
+			}
+		}
+		if free {
+			break
+		}
+		name = fmt.Sprintf("%s_%d", base, n)
+	}
+
+	for _, k := range keep {
+		dst := filepath.Join(originals, name+normalizeExt(k.ext))
+		if err := os.Rename(k.tmp, dst); err != nil {
+			os.Remove(k.tmp)
+			im.log.Warn("import", "Failed to store %s: %v", filepath.Base(dst), err)
+			failed++
+			continue
+		}
+		os.Chtimes(dst, captured, captured)
+		im.created = append(im.created, dst)
+		im.sums[dst] = k.sum
+		imported++
+	}
+	return
+}
+
+// isDuplicate checks a hash against the album. Existing files are only hashed
+// when a new file has the same size, so a large album is not read in full.
+func (im *Importer) isDuplicate(sum string, size int64) bool {
+	if im.hashes[sum] {
+		return true
+	}
+	for _, p := range im.bySize[size] {
+		if h, err := storage.FileChecksum(p); err == nil {
+			im.hashes[h] = true
+		}
+	}
+	delete(im.bySize, size)
+	return im.hashes[sum]
+}
+
+// indexExisting takes the checksums stored in the album index; only files without
+// one are remembered for hashing on demand.
+func (im *Importer) indexExisting(idx *storage.Index, originals string) {
+	known := make(map[string]bool)
+	if recs, err := idx.All(); err == nil {
+		for i := range recs {
+			if recs[i].Checksum != "" {
+				im.hashes[recs[i].Checksum] = true
+				known[recs[i].Filename] = true
+			}
+			if recs[i].RawChecksum != "" {
+				im.hashes[recs[i].RawChecksum] = true
+				known[recs[i].Raw] = true
+			}
+		}
+	}
+
+	entries, err := os.ReadDir(originals)
+	if err != nil {
+		return
+	}
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") || known[e.Name()] {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			im.bySize[info.Size()] = append(im.bySize[info.Size()], filepath.Join(originals, e.Name()))
+		}
+	}
+}
+
+// scan collects supported photos below dir, grouped by folder and base name.
+func scan(dir string) ([]source, int64, int64, error) {
+	byKey := make(map[string]*source)
+	var keys []string
+	var totalBytes, totalFiles int64
+
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return nil // unreadable folders are skipped, not fatal
+		}
+		name := d.Name()
+		if d.IsDir() {
+			if path != dir && (strings.HasPrefix(name, ".") || name == "System Volume Information" || name == "$RECYCLE.BIN") {
+				return filepath.SkipDir
+			}
+			return nil
+		}
+		if strings.HasPrefix(name, ".") || storage.MediaTypeOf(name) == "" {
+			return nil
+		}
+		info, err := d.Info()
+		if err != nil || !info.Mode().IsRegular() {
+			return nil
+		}
+
+		key := filepath.Join(filepath.Dir(path), strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name))))
+		g, ok := byKey[key]
+		if !ok {
+			g = &source{}
+			byKey[key] = g
+			keys = append(keys, key)
+		}
+		g.files = append(g.files, path)
+		g.sizes = append(g.sizes, info.Size())
+		totalBytes += info.Size()
+		totalFiles++
+		return nil
+	})
+	if err != nil {
+		return nil, 0, 0, err
+	}
+
+	sort.Strings(keys)
+	groups := make([]source, 0, len(keys))
+	for _, k := range keys {
+		groups = append(groups, *byKey[k])
+	}
+	return groups, totalBytes, totalFiles, nil
+}
+
+// captureTime prefers the EXIF date of the group's JPEG and falls back to the file time.
+func captureTime(g source) time.Time {
+	for _, f := range g.files {
+		if storage.MediaTypeOf(f) == storage.MediaJPEG {
+			if t, ok := imaging.CaptureTime(f); ok {
+				return t
+			}
+		}
+	}
+	if info, err := os.Stat(g.files[0]); err == nil {
+		return info.ModTime()
+	}
+	return time.Now()
+}
+
+// normalizeExt matches the names the booth gives its own captures (".jpg").
+func normalizeExt(ext string) string {
+	if ext == ".jpeg" {
+		return ".jpg"
+	}
+	return ext
+}
+
+// copyHashed copies src into a hidden temp file inside dstDir, fsyncs it and
+// returns its SHA-256, so the source is read only once.
+func copyHashed(src, dstDir string) (string, string, error) {
+	in, err := os.Open(src)
+	if err != nil {
+		return "", "", err
+	}
+	defer in.Close()
+
+	out, err := os.CreateTemp(dstDir, ".import-*")
+	if err != nil {
+		return "", "", err
+	}
+	h := sha256.New()
+	_, err = io.Copy(io.MultiWriter(out, h), in)
+	if err == nil {
+		err = out.Sync()
+	}
+	if cerr := out.Close(); err == nil {
+		err = cerr
+	}
+	if err != nil {
+		os.Remove(out.Name())
+		return "", "", err
+	}
+	return out.Name(), hex.EncodeToString(h.Sum(nil)), nil
+}
@@ -0,0 +1,488 @@
+package mirror
+
+import (
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"photobooth/internal/config"
+	"photobooth/internal/disk"
+	"photobooth/internal/fsutil"
+	"photobooth/internal/logging"
+	"photobooth/internal/storage"
+)
+
+// mirrorDir is created inside the target so the drive can be shared with other data.
+const mirrorDir = "Photobooth_Mirror"
+
+// Failed copies stay queued and are retried with exponential backoff, from
+// retryMin up to retryMax between attempts. A file is never given up on: a full
+// or broken drive must not silently end the mirror coverage of a capture.
+const (
+	retryMin = 2 * time.Second
+	retryMax = 10 * time.Minute
+)
+
+// failingAfter is the number of attempts after which a file counts as failing
+// in the status, which the dashboard shows as an alert.
+const failingAfter = 5
+
+// Item is one file waiting to be mirrored.
+type Item struct {
+	Album    string    `json:"album"`
+	File     string    `json:"file"` // relative to the album dir, e.g. original/IMG_x.jpg
+	Size     int64     `json:"size"`
+	Attempts int       `json:"attempts"`
+	AddedAt  time.Time `json:"addedAt"`
+	RetryAt  time.Time `json:"retryAt,omitempty"` // not before this after a failed attempt
+}
+
+// Status is the mirror health shown in system_info and /api/status.
+type Status struct {
+	Enabled      bool      `json:"enabled"`
+	Available    bool      `json:"available"` // target is mounted and writable
+	Path         string    `json:"path"`
+	Pending      int       `json:"pending"`
+	PendingBytes int64     `json:"pendingBytes"`
+	Mirrored     int       `json:"mirrored"` // since start
+	LastMirrored time.Time `json:"lastMirrored,omitempty"`
+	CatchingUp   bool      `json:"catchingUp,omitempty"`
+	Failing      int       `json:"failing,omitempty"` // files that failed repeatedly, e.g. target full or broken
+	LastError    string    `json:"lastError,omitempty"`
+}
+
+// Mirror copies every capture to a second location right after it is taken.
+// The queue is persisted, so files captured while the drive is unplugged (or
+// while the booth was off) are copied once the drive is back.
+type Mirror struct {
+	mu        sync.Mutex
+	cfg       config.MirrorConfig
+	basePath  string
+	queuePath string
+	queue     []*Item
+	wake      chan struct{}
+	log       *logging.Logger
+
+	available    bool
+	needProbe    bool // a copy failed: re-test writing before the next one
+	catchingUp   bool
+	mirrored     int
+	lastMirrored time.Time
+	lastError    string
+}
+
+func NewMirror(cfg config.MirrorConfig, photosBase string) *Mirror {
+	return &Mirror{
+		cfg:       cfg,
+		basePath:  photosBase,
+		queuePath: filepath.Join(photosBase, ".mirror", "queue.json"),
+		wake:      make(chan struct{}, 1),
+		log:       logging.Get(),
+	}
+}
+
+// Start loads the persisted queue and runs the mirror loop. Does nothing if disabled.
+func (m *Mirror) Start() {
+	if !m.cfg.Enabled {
+		return
+	}
+	if m.cfg.Path == "" {
+		m.log.Error("mirror", "Mirror disabled: no target path configured")
+		m.cfg.Enabled = false
+		return
+	}
+
+	m.mu.Lock()
+	if err := fsutil.ReadJSON(m.queuePath, &m.queue); err != nil {
+		m.log.Warn("mirror", "Failed to load mirror queue: %v", err)
+	}
+	if len(m.queue) > 0 {
+		m.log.Info("mirror", "Resuming mirror queue with %d files", len(m.queue))
+	}
+	m.mu.Unlock()
+
+	m.log.Info("mirror", "Mirroring captures to %s", m.cfg.Path)
+	go m.run()
+}
+
+// Enabled reports whether mirroring is active.
+func (m *Mirror) Enabled() bool {
+	return m.cfg.Enabled
+}
+
+// EnqueueCapture queues the original of a new capture and any RAW next to it.
+// It only touches the queue file and never waits for the target.
+func (m *Mirror) EnqueueCapture(album, filename string) {
+	if !m.cfg.Enabled {
+		return
+	}
+	files := []string{path.Join("original", filename)}
+	if m.cfg.IncludeRaw {
+		base := strings.TrimSuffix(filename, filepath.Ext(filename))
+		entries, _ := os.ReadDir(filepath.Join(m.basePath, album, "original"))
+		for _, e := range entries {
+			name := e.Name()
+			if name != filename && strings.TrimSuffix(name, filepath.Ext(name)) == base && storage.MediaTypeOf(name) == storage.MediaRAW {
+				files = append(files, path.Join("original", name))
+			}
+		}
+	}
+	m.enqueue(album, files)
+}
+
+// Enqueue queues single files of an album (relative to original/), e.g. a RAW
+// that arrives after the JPEG.
+func (m *Mirror) Enqueue(album string, filenames ...string) {
+	if !m.cfg.Enabled {
+		return
+	}
+	files := make([]string, 0, len(filenames))
+	for _, f := range filenames {
+		if storage.MediaTypeOf(f) == storage.MediaRAW && !m.cfg.IncludeRaw {
+			continue
+		}
+		files = append(files, path.Join("original", f))
+	}
+	m.enqueue(album, files)
+}
+
+// MoveAlbum points the queued files of an album to its new name after the
+// album was renamed or merged into another.
+func (m *Mirror) MoveAlbum(from, to string) error {
+	return m.move(func(it *Item) bool {
+		if it.Album != from {
+			return false
+		}
+		it.Album = to
+		return true
+	})
+}
+
+// MovePhoto points the queued files of a photo to its new album and name.
+func (m *Mirror) MovePhoto(fromAlbum, fromFile, toAlbum, toFile string) error {
+	return m.move(func(it *Item) bool {
+		file, ok := storage.MovedFile(it.File, fromFile, toFile)
+		if it.Album != fromAlbum || !ok {
+			return false
+		}
+		it.Album, it.File = toAlbum, file
+		return true
+	})
+}
+
+// move rewrites the queued items fn reports as changed and persists the queue.
+func (m *Mirror) move(fn func(it *Item) bool) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	changed := false
+	for _, it := range m.queue {
+		if fn(it) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return fsutil.WriteJSON(m.queuePath, m.queue)
+}
+
+func (m *Mirror) enqueue(album string, files []string) int {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	queued := make(map[string]bool, len(m.queue))
+	for _, it := range m.queue {
+		queued[it.Album+"/"+it.File] = true
+	}
+
+	added := 0
+	now := time.Now()
+	for _, f := range files {
+		if queued[album+"/"+f] {
+			continue
+		}
+		var size int64
+		if info, err := os.Stat(filepath.Join(m.basePath, album, filepath.FromSlash(f))); err == nil {
+			size = info.Size()
+		}
+		m.queue = append(m.queue, &Item{Album: album, File: f, Size: size, AddedAt: now})
+		queued[album+"/"+f] = true
+		added++
+	}
+	if added == 0 {
+		return 0
+	}
+	if err := fsutil.WriteJSON(m.queuePath, m.queue); err != nil {
+		m.log.Error("mirror", "Failed to persist mirror queue: %v", err)
+	}
+
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+	return added
+}
+
+// Status returns the current health of the mirror.
+func (m *Mirror) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	s := Status{
+		Enabled:      m.cfg.Enabled,
+		Available:    m.available,
+		Path:         m.cfg.Path,
+		Pending:      len(m.queue),
+		Mirrored:     m.mirrored,
+		LastMirrored: m.lastMirrored,
+		CatchingUp:   m.catchingUp,
+		LastError:    m.lastError,
+	}
+	for _, it := range m.queue {
+		s.PendingBytes += it.Size
+		if it.Attempts >= failingAfter {
+			s.Failing++
+		}
+	}
+	return s
+}
+
+func (m *Mirror) run() {
+	for {
+		ok, reason := m.checkTarget()
+
+		m.mu.Lock()
+		was := m.available
+		m.available = ok
+		if !ok {
+			m.lastError = reason
+		}
+		m.mu.Unlock()
+
+		if ok && !was {
+			m.log.Info("mirror", "Mirror target %s is available", m.cfg.Path)
+			m.retryNow()
+			m.catchUp()
+		} else if !ok && was {
+			m.log.Warn("mirror", "Mirror target unavailable: %s", reason)
+		}
+
+		var item *Item
+		if ok {
+			item = m.next()
+		}
+		if item == nil {
+			// Also re-checks the target periodically to notice a replugged drive
+			select {
+			case <-m.wake:
+			case <-time.After(5 * time.Second):
+			}
+			continue
+		}
+		m.process(item)
+	}
+}
+
+// checkTarget verifies that the mirror path is a mounted, writable folder.
+func (m *Mirror) checkTarget() (bool, string) {
+	info, err := os.Stat(m.cfg.Path)
+	if err != nil || !info.IsDir() {
+		return false, "target folder not found"
+	}
+	if m.cfg.RequireMount {
+		// An unplugged drive leaves an empty mount point on the SD card – never write there
+		same, err := disk.SameFilesystem(m.cfg.Path, m.basePath)
+		if err != nil {
+			return false, err.Error()
+		}
+		if same {
+			return false, "drive not mounted"
+		}
+	}
+
+	m.mu.Lock()
+	probe := !m.available || m.needProbe
+	m.mu.Unlock()
+	if probe {
+		root := filepath.Join(m.cfg.Path, mirrorDir)
+		if err := os.MkdirAll(root, 0755); err != nil {
+			return false, "target not writable: " + err.Error()
+		}
+		probeFile := filepath.Join(root, ".probe")
+		if err := os.WriteFile(probeFile, []byte("ok"), 0644); err != nil {
+			return false, "target not writable: " + err.Error()
+		}
+		os.Remove(probeFile)
+
+		m.mu.Lock()
+		m.needProbe = false
+		m.mu.Unlock()
+	}
+	return true, ""
+}
+
+// catchUp queues every original that is missing on the target or differs in size.
+// Runs when the target (re)appears, which also covers captures made while the
+// booth was running without the drive.
+func (m *Mirror) catchUp() {
+	m.mu.Lock()
+	m.catchingUp = true
+	m.mu.Unlock()
+	defer func() {
+		m.mu.Lock()
+		m.catchingUp = false
+		m.mu.Unlock()
+	}()
+
+	albums, err := os.ReadDir(m.basePath)
+	if err != nil {
+		return
+	}
+	total := 0
+	for _, a := range albums {
+		if !a.IsDir() || strings.HasPrefix(a.Name(), ".") {
+			continue
+		}
+		entries, err := os.ReadDir(filepath.Join(m.basePath, a.Name(), "original"))
+		if err != nil {
+			continue
+		}
+		var missing []string
+		for _, e := range entries {
+			name := e.Name()
+			t := storage.MediaTypeOf(name)
+			if e.IsDir() || strings.HasPrefix(name, ".") || t == "" || (t == storage.MediaRAW && !m.cfg.IncludeRaw) {
+				continue
+			}
+			info, err := e.Info()
+			if err != nil {
+				continue
+			}
+			if dst, err := os.Stat(m.target(a.Name(), path.Join("original", name))); err == nil && dst.Size() == info.Size() {
+				continue
+			}
+			missing = append(missing, path.Join("original", name))
+		}
+		total += m.enqueue(a.Name(), missing)
+	}
+	if total > 0 {
+		m.log.Info("mirror", "Catching up: %d files missing on the mirror", total)
+	}
+}
+
+// retryNow lets failed items be tried again right away, e.g. once the drive was
+// replugged or swapped for one with free space.
+func (m *Mirror) retryNow() {
+	m.mu.Lock()
+	for _, it := range m.queue {
+		it.RetryAt = time.Time{}
+	}
+	m.mu.Unlock()
+}
+
+// next returns the oldest queued item that is due. Items waiting for a retry
+// do not hold up the ones behind them.
+func (m *Mirror) next() *Item {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	now := time.Now()
+	for _, it := range m.queue {
+		if !it.RetryAt.After(now) {
+			return it
+		}
+	}
+	return nil
+}
+
+func (m *Mirror) process(it *Item) {
+	m.mu.Lock()
+	album, file := it.Album, it.File
+	m.mu.Unlock()
+	src := filepath.Join(m.basePath, album, filepath.FromSlash(file))
+	dst := m.target(album, file)
+
+	info, err := os.Stat(src)
+	if err == nil {
+		if di, derr := os.Stat(dst); derr == nil && di.Size() == info.Size() {
+			// Already there (e.g. queued again after a restart mid-copy)
+			m.done(it, false)
+			return
+		}
+		err = fsutil.CopyFileAtomic(src, dst)
+	}
+
+	if err != nil {
+		if os.IsNotExist(err) && !fileExists(src) {
+			m.mu.Lock()
+			moved := filepath.Join(m.basePath, it.Album, filepath.FromSlash(it.File)) != src
+			m.mu.Unlock()
+			if !moved {
+				// Deleted locally in the meantime – nothing left to mirror
+				m.done(it, false)
+			}
+			return
+		}
+		m.mu.Lock()
+		it.Attempts++
+		it.RetryAt = time.Now().Add(backoff(it.Attempts))
+		m.lastError = err.Error()
+		m.needProbe = true
+		if err := fsutil.WriteJSON(m.queuePath, m.queue); err != nil {
+			m.log.Error("mirror", "Failed to persist mirror queue: %v", err)
+		}
+		m.mu.Unlock()
+
+		if it.Attempts == failingAfter {
+			m.log.Error("mirror", "Mirroring %s/%s keeps failing, retrying every few minutes: %v", album, file, err)
+		} else {
+			m.log.Warn("mirror", "Failed to mirror %s/%s (attempt %d): %v", album, file, it.Attempts, err)
+		}
+		return
+	}
+	m.log.Debug("mirror", "Mirrored %s/%s", album, file)
+	m.done(it, true)
+}
+
+// done removes an item from the queue.
+func (m *Mirror) done(it *Item, copied bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	if copied {
+		m.mirrored++
+		m.lastMirrored = time.Now()
+		m.lastError = ""
+	}
+	for i, q := range m.queue {
+		if q == it {
+			m.queue = append(m.queue[:i], m.queue[i+1:]...)
+			break
+		}
+	}
+	if err := fsutil.WriteJSON(m.queuePath, m.queue); err != nil {
+		m.log.Error("mirror", "Failed to persist mirror queue: %v", err)
+	}
+}
+
+// backoff is the wait before the next attempt after the given number of failures.
+func backoff(attempts int) time.Duration {
+	d := retryMin
+	for i := 1; i < attempts && d < retryMax; i++ {
+		d *= 2
+	}
+	if d > retryMax {
+		d = retryMax
+	}
+	return d
+}
+
+func (m *Mirror) target(album, file string) string {
+	return filepath.Join(m.cfg.Path, mirrorDir, album, filepath.FromSlash(file))
+}
+
+func fileExists(p string) bool {
+	_, err := os.Stat(p)
+	return err == nil
+}
@@ -0,0 +1,181 @@
+package mqtt
+
+import (
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	"photobooth/internal/config"
+	"photobooth/internal/logging"
+	"photobooth/internal/websocket"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// message is one pending publish.
+type message struct {
+	topic    string
+	retained bool
+	payload  []byte
+}
+
+// Client bridges booth events to MQTT and MQTT commands to the booth.
+type Client struct {
+	cfg      config.MqttConfig
+	client   paho.Client
+	outgoing chan message
+	log      *logging.Logger
+
+	mu        sync.Mutex
+	connected bool
+	lastState string
+
+	// Callbacks for business logic
+	OnTrigger func()
+	OnCancel  func() bool
+}
+
+func NewClient(cfg config.MqttConfig) *Client {
+	return &Client{
+		cfg:      cfg,
+		outgoing: make(chan message, 64),
+		log:      logging.Get(),
+	}
+}
+
+// Start connects in the background and keeps reconnecting on its own. It does
+// nothing if MQTT is disabled or no broker is configured.
+func (c *Client) Start(hub *websocket.Hub) {
+	if !c.cfg.Enabled || c.cfg.Broker == "" {
+		return
+	}
+
+	opts := paho.NewClientOptions().
+		AddBroker(c.cfg.Broker).
+		SetClientID(c.cfg.ClientId).
+		SetUsername(c.cfg.Username).
+		SetPassword(c.cfg.Password).
+		SetCleanSession(true).
+		SetAutoReconnect(true).
+		SetConnectRetry(true).
+		SetConnectRetryInterval(5 * time.Second).
+		SetMaxReconnectInterval(30 * time.Second).
+		SetKeepAlive(30 * time.Second).
+		SetOnConnectHandler(c.onConnect).
+		SetConnectionLostHandler(func(_ paho.Client, err error) {
+			c.setConnected(false)
+			c.log.Warn("mqtt", "Connection to %s lost: %v – reconnecting", c.cfg.Broker, err)
+		})
+	if c.cfg.OnlineTopic != "" {
+		opts.SetWill(c.cfg.OnlineTopic, "offline", c.cfg.Qos, true)
+	}
+
+	c.client = paho.NewClient(opts)
+	c.client.Connect() // returns immediately thanks to ConnectRetry
+
+	go c.publishLoop()
+	hub.AddListener(c.handleEvent)
+	c.log.Info("mqtt", "Connecting to broker %s...", c.cfg.Broker)
+}
+
+// Connected reports whether the broker connection is currently up.
+func (c *Client) Connected() bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.connected
+}
+
+func (c *Client) setConnected(v bool) {
+	c.mu.Lock()
+	c.connected = v
+	c.mu.Unlock()
+}
+
+// onConnect runs after every (re)connect, so subscriptions survive broker restarts.
+func (c *Client) onConnect(client paho.Client) {
+	c.setConnected(true)
+	c.log.Info("mqtt", "Connected to broker %s", c.cfg.Broker)
+
+	if c.cfg.OnlineTopic != "" {
+		client.Publish(c.cfg.OnlineTopic, c.cfg.Qos, true, "online")
+	}
+	c.mu.Lock()
+	state := c.lastState
+	c.mu.Unlock()
+	if state != "" && c.cfg.StateTopic != "" {
+		client.Publish(c.cfg.StateTopic, c.cfg.Qos, true, state)
+	}
+	if c.cfg.TriggerTopic != "" {
+		client.Subscribe(c.cfg.TriggerTopic, c.cfg.Qos, func(_ paho.Client, m paho.Message) {
+			c.log.Info("mqtt", "Trigger received on %s", m.Topic())
+			if c.OnTrigger != nil {
+				c.OnTrigger()
+			}
+		})
+	}
+	if c.cfg.CancelTopic != "" {
+		client.Subscribe(c.cfg.CancelTopic, c.cfg.Qos, func(_ paho.Client, m paho.Message) {
+			c.log.Info("mqtt", "Cancel received on %s", m.Topic())
+			if c.OnCancel != nil {
+				c.OnCancel()
+			}
+		})
+	}
+}
+
+// handleEvent is registered as hub listener and maps booth events to topics.
+func (c *Client) handleEvent(e websocket.Event) {
+	switch e.Type {
+	case websocket.EventTypeStatus:
+		if data, ok := e.Data.(map[string]interface{}); ok {
+			if state, ok := data["state"]; ok {
+				c.mu.Lock()
+				c.lastState = fmt.Sprint(state)
+				c.mu.Unlock()
+				c.publish(c.cfg.StateTopic, true, fmt.Sprint(state))
+			}
+		}
+	case websocket.EventTypeCountdown:
+		c.publish(c.cfg.CountdownTopic, false, e.Data)
+	case websocket.EventTypePhoto:
+		c.publish(c.cfg.PhotoTopic, false, e.Data)
+	}
+}
+
+// publish queues a message without blocking the hub. Strings are sent as-is,
+// everything else as JSON.
+func (c *Client) publish(topic string, retained bool, v interface{}) {
+	if topic == "" {
+		return
+	}
+
+	var payload []byte
+	if s, ok := v.(string); ok {
+		payload = []byte(s)
+	} else {
+		b, err := json.Marshal(v)
+		if err != nil {
+			return
+		}
+		payload = b
+	}
+
+	select {
+	case c.outgoing <- message{topic: topic, retained: retained, payload: payload}:
+	default:
+		// Broker unreachable for a while – drop instead of stalling the hub
+	}
+}
+
+func (c *Client) publishLoop() {
+	for m := range c.outgoing {
+		if !c.client.IsConnectionOpen() {
+			continue
+		}
+		token := c.client.Publish(m.topic, c.cfg.Qos, m.retained, m.payload)
+		if !token.WaitTimeout(5*time.Second) || token.Error() != nil {
+			c.log.Debug("mqtt", "Publish to %s failed: %v", m.topic, token.Error())
+		}
+	}
+}
@@ -0,0 +1,260 @@
+package mqtt
+
+import (
+	"sync"
+	"testing"
+	"time"
+
+	"photobooth/internal/config"
+	"photobooth/internal/websocket"
+
+	paho "github.com/eclipse/paho.mqtt.golang"
+)
+
+// done is a token of a finished operation.
+type done struct{ err error }
+
+func (t done) Wait() bool                     { return true }
+func (t done) WaitTimeout(time.Duration) bool { return true }
+func (t done) Done() <-chan struct{} {
+	ch := make(chan struct{})
+	close(ch)
+	return ch
+}
+func (t done) Error() error { return t.err }
+
+// published is one message the client sent to the broker.
+type published struct {
+	topic    string
+	retained bool
+	payload  string
+}
+
+// broker stands in for the paho client and its broker: it records publishes
+// and subscriptions and can deliver messages to the subscribers. Methods the
+// bridge does not use are left to the embedded nil interface.
+type broker struct {
+	paho.Client
+
+	mu      sync.Mutex
+	open    bool
+	sent    []published
+	subs    map[string]paho.MessageHandler
+	changed chan struct{}
+}
+
+func newBroker() *broker {
+	return &broker{open: true, subs: make(map[string]paho.MessageHandler), changed: make(chan struct{}, 100)}
+}
+
+func (b *broker) IsConnectionOpen() bool {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.open
+}
+
+func (b *broker) Publish(topic string, qos byte, retained bool, payload interface{}) paho.Token {
+	var p string
+	switch v := payload.(type) {
+	case string:
+		p = v
+	case []byte:
+		p = string(v)
+	}
+	b.mu.Lock()
+	b.sent = append(b.sent, published{topic, retained, p})
+	b.mu.Unlock()
+	b.changed <- struct{}{}
+	return done{}
+}
+
+func (b *broker) Subscribe(topic string, qos byte, callback paho.MessageHandler) paho.Token {
+	b.mu.Lock()
+	b.subs[topic] = callback
+	b.mu.Unlock()
+	return done{}
+}
+
+// deliver hands a message on topic to its subscriber, like the broker would.
+func (b *broker) deliver(t *testing.T, topic, payload string) {
+	t.Helper()
+	b.mu.Lock()
+	handler := b.subs[topic]
+	b.mu.Unlock()
+	if handler == nil {
+		t.Fatalf("no subscription on %s", topic)
+	}
+	handler(b, &incoming{topic: topic, payload: []byte(payload)})
+}
+
+// waitFor waits until n messages were published and returns them.
+func (b *broker) waitFor(t *testing.T, n int) []published {
+	t.Helper()
+	deadline := time.After(2 * time.Second)
+	for {
+		b.mu.Lock()
+		if len(b.sent) >= n {
+			sent := append([]published(nil), b.sent...)
+			b.mu.Unlock()
+			return sent
+		}
+		b.mu.Unlock()
+		select {
+		case <-b.changed:
+		case <-deadline:
+			t.Fatalf("timed out waiting for %d publishes", n)
+		}
+	}
+}
+
+type incoming struct {
+	topic   string
+	payload []byte
+}
+
+func (m *incoming) Duplicate() bool   { return false }
+func (m *incoming) Qos() byte         { return 0 }
+func (m *incoming) Retained() bool    { return false }
+func (m *incoming) Topic() string     { return m.topic }
+func (m *incoming) MessageID() uint16 { return 0 }
+func (m *incoming) Payload() []byte   { return m.payload }
+func (m *incoming) Ack()              {}
+
+var testConfig = config.MqttConfig{
+	Enabled:        true,
+	Broker:         "tcp://broker:1883",
+	TriggerTopic:   "booth/cmd/trigger",
+	CancelTopic:    "booth/cmd/cancel",
+	StateTopic:     "booth/state",
+	CountdownTopic: "booth/countdown",
+	PhotoTopic:     "booth/photo",
+	OnlineTopic:    "booth/online",
+}
+
+// connect wires a client to the stand-in broker the way Start does.
+func connect(t *testing.T, cfg config.MqttConfig) (*Client, *broker) {
+	t.Helper()
+	b := newBroker()
+	c := NewClient(cfg)
+	c.client = b
+	go c.publishLoop()
+	t.Cleanup(func() { close(c.outgoing) })
+	c.onConnect(b)
+	return c, b
+}
+
+func TestCommandsCallTheBooth(t *testing.T) {
+	c, b := connect(t, testConfig)
+	triggers, cancels := 0, 0
+	c.OnTrigger = func() { triggers++ }
+	c.OnCancel = func() bool { cancels++; return true }
+
+	b.deliver(t, "booth/cmd/trigger", "")
+	b.deliver(t, "booth/cmd/trigger", "1")
+	b.deliver(t, "booth/cmd/cancel", "")
+
+	if triggers != 2 || cancels != 1 {
+		t.Errorf("triggers = %d, cancels = %d, want 2 and 1", triggers, cancels)
+	}
+	if !c.Connected() {
+		t.Error("not connected after onConnect")
+	}
+}
+
+func TestCommandsWithoutCallbacks(t *testing.T) {
+	_, b := connect(t, testConfig)
+	// Must not panic before the app wired its callbacks
+	b.deliver(t, "booth/cmd/trigger", "")
+	b.deliver(t, "booth/cmd/cancel", "")
+}
+
+func TestNoSubscriptionWithoutTopic(t *testing.T) {
+	cfg := testConfig
+	cfg.CancelTopic = ""
+	_, b := connect(t, cfg)
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	if _, ok := b.subs["booth/cmd/trigger"]; !ok {
+		t.Error("trigger topic not subscribed")
+	}
+	if len(b.subs) != 1 {
+		t.Errorf("subscriptions = %v, want only the trigger topic", b.subs)
+	}
+}
+
+func TestEventsArePublished(t *testing.T) {
+	c, b := connect(t, testConfig)
+	sent := b.waitFor(t, 1)
+	if sent[0] != (published{"booth/online", true, "online"}) {
+		t.Errorf("first publish = %+v, want retained online", sent[0])
+	}
+
+	c.handleEvent(websocket.Event{Type: websocket.EventTypeStatus, Data: map[string]interface{}{"state": "countdown"}})
+	c.handleEvent(websocket.Event{Type: websocket.EventTypeCountdown, Data: 3})
+	c.handleEvent(websocket.Event{Type: websocket.EventTypePhoto, Data: map[string]string{"filename": "IMG_0001.jpg"}})
+	c.handleEvent(websocket.Event{Type: websocket.EventTypeLog, Data: "ignored"})
+
+	sent = b.waitFor(t, 4)[1:]
+	want := []published{
+		{"booth/state", true, "countdown"},
+		{"booth/countdown", false, "3"},
+		{"booth/photo", false, `{"filename":"IMG_0001.jpg"}`},
+	}
+	if len(sent) != len(want) {
+		t.Fatalf("published %+v, want %+v", sent, want)
+	}
+	for i := range want {
+		if sent[i] != want[i] {
+			t.Errorf("publish %d = %+v, want %+v", i, sent[i], want[i])
+		}
+	}
+}
+
+func TestReconnectRestoresStateAndSubscriptions(t *testing.T) {
+	c, b := connect(t, testConfig)
+	c.handleEvent(websocket.Event{Type: websocket.EventTypeStatus, Data: map[string]interface{}{"state": "idle"}})
+	b.waitFor(t, 2)
+
+	// Broker restarted: subscriptions are gone until the client reconnects
+	c.setConnected(false)
+	b.mu.Lock()
+	b.subs = make(map[string]paho.MessageHandler)
+	b.sent = nil
+	b.mu.Unlock()
+	c.onConnect(b)
+
+	sent := b.waitFor(t, 2)
+	if sent[1] != (published{"booth/state", true, "idle"}) {
+		t.Errorf("state after reconnect = %+v, want retained idle", sent[1])
+	}
+	triggered := false
+	c.OnTrigger = func() { triggered = true }
+	b.deliver(t, "booth/cmd/trigger", "")
+	if !triggered {
+		t.Error("trigger not handled after reconnect")
+	}
+}
+
+func TestPublishDroppedWhileDisconnected(t *testing.T) {
+	c, b := connect(t, testConfig)
+	b.waitFor(t, 1)
+
+	b.mu.Lock()
+	b.open = false
+	b.mu.Unlock()
+	c.handleEvent(websocket.Event{Type: websocket.EventTypeCountdown, Data: 2})
+	for len(c.outgoing) > 0 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(50 * time.Millisecond) // let the loop finish the dequeued message
+
+	b.mu.Lock()
+	b.open = true
+	b.mu.Unlock()
+	c.handleEvent(websocket.Event{Type: websocket.EventTypeCountdown, Data: 1})
+
+	sent := b.waitFor(t, 2)
+	if len(sent) != 2 || sent[1].payload != "1" {
+		t.Errorf("published %+v, want only the countdown sent while connected", sent)
+	}
+}
@@ -0,0 +1,126 @@
+package network
+
+import (
+	"errors"
+	"time"
+
+	"photobooth/internal/config"
+)
+
+// ErrApplyPending is returned while an earlier change still waits for a device
+// to reconnect.
+var ErrApplyPending = errors.New("another WiFi change is waiting for confirmation")
+
+// Apply switches to a new WiFi config; the saved networks are kept. If the
+// hotspot is running and its settings change it is restarted, which drops every
+// guest, and unless a device connects to the new hotspot within rollback the old
+// settings come back – a typo in the password must not lock the operator out.
+// commit is called once the config has proven itself (right away if nothing has
+// to be confirmed), typically to save it.
+func (m *Manager) Apply(cfg config.WifiConfig, rollback time.Duration, commit func(config.WifiConfig)) error {
+	if err := Validate(cfg); err != nil {
+		return err
+	}
+	if cfg.Mode == "" {
+		cfg.Mode = ModeHotspot
+	}
+
+	m.mu.Lock()
+	if m.status.RollbackAt != nil {
+		m.mu.Unlock()
+		return ErrApplyPending
+	}
+	old := m.cfg
+	cfg.Networks = old.Networks
+	m.cfg = cfg
+	onHotspot := m.status.Active == ActiveHotspot
+	m.mu.Unlock()
+	m.configChanged(cfg)
+
+	restart := onHotspot && hotspotChanged(old, cfg) && old.Mode == cfg.Mode
+	if !restart || rollback <= 0 {
+		m.log.Info("network", "WiFi settings changed (mode %s)", cfg.Mode)
+		commit(cfg)
+		if restart {
+			go func() {
+				time.Sleep(restartDelay)
+				m.restartHotspot()
+			}()
+		}
+		m.Reconnect() // the loop picks up a new mode
+		return nil
+	}
+
+	deadline := time.Now().Add(restartDelay + rollback)
+	m.log.Info("network", "Restarting hotspot as '%s', reverting in %s unless a device connects", cfg.Ssid, rollback)
+	m.setStatus(func(s *Status) { s.RollbackAt = &deadline })
+	go m.confirm(old, cfg, deadline, commit)
+	return nil
+}
+
+// restartDelay lets the answer to the request that changed the settings reach
+// the dashboard before the hotspot drops it.
+const restartDelay = time.Second
+
+// confirm restarts the hotspot, waits for a device to connect to it and commits
+// the new config, or restores the old one when the deadline passes.
+func (m *Manager) confirm(old, cfg config.WifiConfig, deadline time.Time, commit func(config.WifiConfig)) {
+	time.Sleep(restartDelay)
+	if !m.restartHotspot() {
+		m.revert(old, "the hotspot did not start with the new settings")
+		return
+	}
+	for time.Now().Before(deadline) {
+		time.Sleep(2 * time.Second)
+		stations, err := listStations(m.Iw, cfg.Interface)
+		if err != nil {
+			// Without iw there is no way to tell, and reverting blindly would
+			// undo every change
+			m.log.Warn("network", "Cannot list hotspot clients, keeping the new WiFi settings: %v", err)
+		} else if len(stations) > 0 {
+			m.log.Info("network", "Device %s connected to the new hotspot, keeping the settings", stations[0].Mac)
+		} else {
+			continue
+		}
+		commit(cfg)
+		m.setStatus(func(s *Status) { s.RollbackAt = nil })
+		return
+	}
+	m.revert(old, "no device connected to the new hotspot in time")
+}
+
+// revert restores the previous config and restarts the hotspot with it.
+func (m *Manager) revert(old config.WifiConfig, reason string) {
+	m.log.Warn("network", "Reverting WiFi settings: %s", reason)
+	m.mu.Lock()
+	old.Networks = m.cfg.Networks
+	m.cfg = old
+	m.mu.Unlock()
+	m.configChanged(old)
+	m.restartHotspot()
+	m.setStatus(func(s *Status) {
+		s.RollbackAt = nil
+		s.Message = "settings reverted: " + reason
+	})
+}
+
+// restartHotspot brings the hotspot up with the current config, keeping the
+// fallback flag. Reports whether it came up.
+func (m *Manager) restartHotspot() bool {
+	m.netMu.Lock()
+	defer m.netMu.Unlock()
+	m.startHotspot(m.Status().Fallback)
+	return m.Status().Active == ActiveHotspot
+}
+
+func (m *Manager) configChanged(cfg config.WifiConfig) {
+	if m.OnConfig != nil {
+		m.OnConfig(cfg)
+	}
+}
+
+// hotspotChanged reports whether the access point has to be restarted.
+func hotspotChanged(a, b config.WifiConfig) bool {
+	return a.Ssid != b.Ssid || a.Password != b.Password || a.Band != b.Band || a.Channel != b.Channel ||
+		a.IpAddress != b.IpAddress || a.DhcpRangeStart != b.DhcpRangeStart || a.DhcpRangeEnd != b.DhcpRangeEnd
+}
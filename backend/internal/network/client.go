@@ -0,0 +1,150 @@
+package network
+
+import (
+	"context"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+
+	"photobooth/internal/config"
+)
+
+// AccessPoint is a network found by a scan.
+type AccessPoint struct {
+	Ssid     string `json:"ssid"`
+	Signal   int    `json:"signal"`   // 0-100
+	Security string `json:"security"` // e.g. "WPA2", empty for open networks
+	Channel  int    `json:"channel"`
+	InUse    bool   `json:"inUse"`
+	Saved    bool   `json:"saved"` // one of the configured networks
+}
+
+// listAccessPoints lists the networks in range, strongest first and one entry
+// per SSID. Without rescan NetworkManager returns its cached results, which is
+// all there is while the interface runs the hotspot.
+func listAccessPoints(e Executor, iface string, rescan bool) ([]AccessPoint, error) {
+	mode := "no"
+	if rescan {
+		mode = "yes"
+	}
+	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+	defer cancel()
+	out, err := e.Run(ctx, "-t", "-f", "IN-USE,SSID,SIGNAL,SECURITY,CHAN", "device", "wifi", "list", "ifname", iface, "--rescan", mode)
+	if err != nil {
+		return nil, fmt.Errorf("scan: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	best := make(map[string]AccessPoint)
+	for _, f := range terseLines(out) {
+		if len(f) < 5 || f[1] == "" {
+			continue // hidden networks have no SSID
+		}
+		ap := AccessPoint{Ssid: f[1], Security: f[3], InUse: f[0] == "*"}
+		ap.Signal, _ = strconv.Atoi(f[2])
+		ap.Channel, _ = strconv.Atoi(f[4])
+		if ap.Security == "--" {
+			ap.Security = ""
+		}
+		if prev, ok := best[ap.Ssid]; ok {
+			// Several access points of one network: keep the strongest
+			inUse := ap.InUse || prev.InUse
+			if prev.Signal >= ap.Signal {
+				ap = prev
+			}
+			ap.InUse = inUse
+		}
+		best[ap.Ssid] = ap
+	}
+	aps := make([]AccessPoint, 0, len(best))
+	for _, ap := range best {
+		aps = append(aps, ap)
+	}
+	sort.Slice(aps, func(i, k int) bool {
+		if aps[i].Signal != aps[k].Signal {
+			return aps[i].Signal > aps[k].Signal
+		}
+		return aps[i].Ssid < aps[k].Ssid
+	})
+	return aps, nil
+}
+
+// deviceInfo is what `nmcli device show` tells about the WiFi interface.
+type deviceInfo struct {
+	connection string
+	connected  bool
+	ip         string
+}
+
+func showDevice(e Executor, iface string) (deviceInfo, error) {
+	out, err := run(e, "-t", "-f", "GENERAL.STATE,GENERAL.CONNECTION,IP4.ADDRESS", "device", "show", iface)
+	if err != nil {
+		return deviceInfo{}, fmt.Errorf("device show: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	var info deviceInfo
+	for _, line := range strings.Split(string(out), "\n") {
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok {
+			continue
+		}
+		switch {
+		case key == "GENERAL.STATE":
+			// "100 (connected)"
+			info.connected = strings.HasPrefix(value, "100")
+		case key == "GENERAL.CONNECTION":
+			info.connection = value
+		case strings.HasPrefix(key, "IP4.ADDRESS") && info.ip == "":
+			info.ip, _, _ = strings.Cut(value, "/")
+		}
+	}
+	return info, nil
+}
+
+// connectClient points the client connection at a saved network and activates
+// it, waiting up to timeout for an IP address.
+func connectClient(e Executor, iface string, n config.WifiNetwork, timeout time.Duration) error {
+	if !connectionExists(e, clientConnName) {
+		out, err := run(e, "connection", "add",
+			"type", "wifi",
+			"ifname", iface,
+			"con-name", clientConnName,
+			"autoconnect", "no", // the manager decides between hotspot and client
+			"ssid", n.Ssid,
+		)
+		if err != nil {
+			return fmt.Errorf("add client connection: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+	}
+	args := []string{"connection", "modify", clientConnName,
+		"802-11-wireless.mode", "infrastructure",
+		"802-11-wireless.ssid", n.Ssid,
+		"802-11-wireless.hidden", strconv.FormatBool(n.Hidden),
+		"ipv4.method", "auto",
+	}
+	if out, err := run(e, args...); err != nil {
+		return fmt.Errorf("configure client connection: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	if n.Password == "" {
+		run(e, "connection", "modify", clientConnName, "remove", "802-11-wireless-security")
+	} else {
+		run(e, "connection", "modify", clientConnName,
+			"802-11-wireless-security.key-mgmt", "wpa-psk",
+			"802-11-wireless-security.psk", n.Password)
+	}
+
+	secs := int(timeout / time.Second)
+	ctx, cancel := context.WithTimeout(context.Background(), timeout+10*time.Second)
+	defer cancel()
+	out, err := e.Run(ctx, "--wait", strconv.Itoa(secs), "connection", "up", clientConnName)
+	if err != nil {
+		return fmt.Errorf("%v: %s", err, strings.TrimSpace(string(out)))
+	}
+	return nil
+}
+
+// clientDown deactivates the client connection.
+func clientDown(e Executor) {
+	if connectionIsActive(e, clientConnName) {
+		run(e, "connection", "down", clientConnName)
+	}
+}
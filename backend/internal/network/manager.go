@@ -0,0 +1,370 @@
+package network
+
+import (
+	"sync"
+	"time"
+
+	"photobooth/internal/config"
+	"photobooth/internal/logging"
+	"photobooth/internal/websocket"
+)
+
+// WiFi modes of config.WifiConfig.
+const (
+	ModeHotspot = "hotspot" // own access point for the guests
+	ModeClient  = "client"  // join a venue network
+	ModeAuto    = "auto"    // join a venue network, fall back to the hotspot
+)
+
+// What the interface is doing right now.
+const (
+	ActiveNone    = "none"
+	ActiveHotspot = "hotspot"
+	ActiveClient  = "client"
+)
+
+// EventTypeStatus is broadcast whenever the connection changes.
+const EventTypeStatus = "network_status"
+
+// checkInterval is how often the connection is checked.
+const checkInterval = 10 * time.Second
+
+// Status is the WiFi state shown in /api/status.
+type Status struct {
+	Mode       string     `json:"mode"`   // configured mode
+	Active     string     `json:"active"` // none, hotspot or client
+	Ssid       string     `json:"ssid,omitempty"`
+	IpAddress  string     `json:"ipAddress,omitempty"`
+	Signal     int        `json:"signal,omitempty"`     // client mode, 0-100
+	Fallback   bool       `json:"fallback,omitempty"`   // hotspot because no saved network connected
+	Connecting string     `json:"connecting,omitempty"` // SSID being tried right now
+	Message    string     `json:"message,omitempty"`
+	Since      time.Time  `json:"since"`
+	RollbackAt *time.Time `json:"rollbackAt,omitempty"` // changed hotspot settings are reverted at this time unless a device connects
+}
+
+// Manager runs the WiFi interface either as the booth's hotspot or as a client
+// of a venue network, and switches between them in auto mode: if none of the
+// saved networks connects within the timeout the hotspot comes up, and every
+// RetryClientSecs the saved networks are tried again while no guest is
+// connected to it.
+type Manager struct {
+	// Exec runs nmcli and Iw runs iw; replace before Start to run without
+	// NetworkManager.
+	Exec       Executor
+	Iw         Executor
+	LeasesFile string // dnsmasq leases of the hotspot, default from the interface name
+
+	// OnConfig is called when the WiFi config changes at runtime (Apply or a
+	// rollback), e.g. to point the DNS server at a new address.
+	OnConfig func(cfg config.WifiConfig)
+
+	hub *websocket.Hub
+	log *logging.Logger
+
+	mu     sync.Mutex
+	cfg    config.WifiConfig
+	status Status
+
+	netMu sync.Mutex // one nmcli state change (or scan) at a time
+	wake  chan struct{}
+	stop  chan struct{}
+}
+
+func NewManager(cfg config.WifiConfig, hub *websocket.Hub) *Manager {
+	if cfg.Mode == "" {
+		cfg.Mode = ModeHotspot
+	}
+	return &Manager{
+		Exec:   Nmcli{},
+		Iw:     Command("iw"),
+		hub:    hub,
+		log:    logging.Get(),
+		cfg:    cfg,
+		status: Status{Mode: cfg.Mode, Active: ActiveNone, Since: time.Now()},
+		wake:   make(chan struct{}, 1),
+		stop:   make(chan struct{}),
+	}
+}
+
+// Start brings up the configured mode and keeps watching the connection.
+func (m *Manager) Start() {
+	if n, ok := m.Exec.(Nmcli); ok && !n.Available() {
+		m.log.Warn("network", "nmcli not found. WiFi setup skipped.")
+		m.setStatus(func(s *Status) { s.Message = "nmcli not found" })
+		return
+	}
+	go m.run()
+}
+
+// Stop ends the watch loop and removes the hotspot connection.
+func (m *Manager) Stop() {
+	close(m.stop)
+	m.netMu.Lock()
+	defer m.netMu.Unlock()
+	m.teardownHotspot()
+}
+
+// Status returns the current connection state.
+func (m *Manager) Status() Status {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	return m.status
+}
+
+// Scan lists the networks in range. While the hotspot runs the interface cannot
+// scan, so the last results NetworkManager saw are returned.
+func (m *Manager) Scan() ([]AccessPoint, error) {
+	m.netMu.Lock()
+	defer m.netMu.Unlock()
+	cfg := m.Config()
+	aps, err := listAccessPoints(m.Exec, cfg.Interface, m.Status().Active != ActiveHotspot)
+	if err != nil {
+		return nil, err
+	}
+	saved := make(map[string]bool, len(cfg.Networks))
+	for _, n := range cfg.Networks {
+		saved[n.Ssid] = true
+	}
+	for i := range aps {
+		aps[i].Saved = saved[aps[i].Ssid]
+	}
+	return aps, nil
+}
+
+// SetNetworks replaces the saved networks and tries them right away unless the
+// booth runs in hotspot mode.
+func (m *Manager) SetNetworks(networks []config.WifiNetwork) {
+	m.mu.Lock()
+	m.cfg.Networks = networks
+	m.mu.Unlock()
+	m.Reconnect()
+}
+
+// Reconnect tries the saved networks now instead of waiting for the next retry.
+func (m *Manager) Reconnect() {
+	select {
+	case m.wake <- struct{}{}:
+	default:
+	}
+}
+
+// Config returns the WiFi config in effect, including changes made at runtime.
+func (m *Manager) Config() config.WifiConfig {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	cfg := m.cfg
+	cfg.Networks = append([]config.WifiNetwork(nil), m.cfg.Networks...)
+	return cfg
+}
+
+func (m *Manager) run() {
+	ticker := time.NewTicker(checkInterval)
+	defer ticker.Stop()
+	w := &watch{}
+	for {
+		m.netMu.Lock()
+		m.check(w)
+		m.netMu.Unlock()
+		select {
+		case <-m.stop:
+			return
+		case <-m.wake:
+			w.retryAt, w.onWake, w.forced = time.Time{}, false, true
+		case <-ticker.C:
+		}
+	}
+}
+
+// watch is the state of the loop between checks.
+type watch struct {
+	retryAt   time.Time // next attempt at the saved networks; zero: now
+	onWake    bool      // no retries until Reconnect
+	forced    bool      // Reconnect asked for the next attempt, even with guests on the hotspot
+	lostSince time.Time // client connection dropped
+}
+
+// check makes sure the interface does what the mode asks for.
+func (m *Manager) check(w *watch) {
+	cfg := m.Config()
+	st := m.Status()
+
+	if cfg.Mode != ModeClient && cfg.Mode != ModeAuto {
+		if st.Active != ActiveHotspot || !connectionIsActive(m.Exec, connectionName) {
+			clientDown(m.Exec)
+			m.startHotspot(false)
+		}
+		return
+	}
+
+	if st.Active == ActiveClient {
+		info, err := showDevice(m.Exec, cfg.Interface)
+		if err == nil && info.connected && info.connection == clientConnName {
+			w.lostSince = time.Time{}
+			m.setStatus(func(s *Status) {
+				s.IpAddress, s.Message = info.ip, ""
+				s.Signal = m.signal(cfg.Interface)
+			})
+			return
+		}
+		if w.lostSince.IsZero() {
+			// NetworkManager reconnects on its own after short drop-outs
+			m.log.Warn("network", "Lost connection to '%s', waiting %ds for it to come back", st.Ssid, cfg.LostTimeout)
+			w.lostSince = time.Now()
+			m.setStatus(func(s *Status) { s.Message = "connection lost" })
+		}
+		if time.Since(w.lostSince) < seconds(cfg.LostTimeout, 60) {
+			return
+		}
+		w.lostSince, w.retryAt, w.onWake = time.Time{}, time.Time{}, false
+	}
+	if w.onWake || time.Now().Before(w.retryAt) {
+		return
+	}
+	if st.Active == ActiveHotspot && !w.forced && m.guestsConnected(cfg.Interface) {
+		// Scanning takes the hotspot down, so the timed retry waits until
+		// nobody uses it
+		w.retryAt = time.Now().Add(seconds(cfg.RetryClientSecs, 60))
+		return
+	}
+	w.forced = false
+
+	if m.connect(cfg) {
+		return
+	}
+	retry := seconds(cfg.RetryClientSecs, 0)
+	if cfg.Mode == ModeAuto {
+		// Also when it ran before: the scan took it down
+		m.startHotspot(true)
+		w.onWake = retry == 0
+	} else {
+		m.setStatus(func(s *Status) {
+			s.Active, s.Ssid, s.IpAddress, s.Signal = ActiveNone, "", "", 0
+			s.Message = "no saved network available"
+		})
+		if retry == 0 {
+			retry = time.Minute
+		}
+	}
+	w.retryAt = time.Now().Add(retry)
+}
+
+// connect tries the saved networks that are in range, in order.
+func (m *Manager) connect(cfg config.WifiConfig) bool {
+	if len(cfg.Networks) == 0 {
+		m.setStatus(func(s *Status) { s.Message = "no saved networks" })
+		return false
+	}
+
+	// Scanning needs the interface in client mode
+	m.hotspotDown()
+	visible := make(map[string]AccessPoint)
+	aps, err := listAccessPoints(m.Exec, cfg.Interface, true)
+	if err != nil {
+		m.log.Warn("network", "WiFi scan failed, trying all saved networks: %v", err)
+	}
+	for _, ap := range aps {
+		visible[ap.Ssid] = ap
+	}
+
+	timeout := seconds(cfg.ConnectTimeout, 30)
+	for _, n := range cfg.Networks {
+		ap, ok := visible[n.Ssid]
+		if err == nil && !ok && !n.Hidden {
+			continue
+		}
+		m.log.Info("network", "Connecting to WiFi '%s'...", n.Ssid)
+		m.setStatus(func(s *Status) { s.Connecting = n.Ssid })
+		if err := connectClient(m.Exec, cfg.Interface, n, timeout); err != nil {
+			m.log.Warn("network", "Failed to connect to '%s': %v", n.Ssid, err)
+			continue
+		}
+		info, _ := showDevice(m.Exec, cfg.Interface)
+		m.log.Info("network", "Connected to WiFi '%s' (%s)", n.Ssid, info.ip)
+		m.setStatus(func(s *Status) {
+			s.Active, s.Ssid, s.IpAddress, s.Signal = ActiveClient, n.Ssid, info.ip, ap.Signal
+			s.Fallback, s.Connecting, s.Message = false, "", ""
+		})
+		return true
+	}
+	m.setStatus(func(s *Status) { s.Connecting = "" })
+	m.log.Warn("network", "None of the %d saved networks connected", len(cfg.Networks))
+	return false
+}
+
+// startHotspot brings up the access point; fallback marks it as the way out of
+// a failed client connection.
+func (m *Manager) startHotspot(fallback bool) {
+	cfg := m.Config()
+	if fallback {
+		m.log.Info("network", "Falling back to the hotspot")
+	}
+	if err := m.hotspotUp(); err != nil {
+		m.log.Error("network", "Failed to start hotspot: %v", err)
+		m.setStatus(func(s *Status) {
+			s.Active, s.Ssid, s.IpAddress, s.Signal, s.Fallback = ActiveNone, "", "", 0, fallback
+			s.Message = err.Error()
+		})
+		return
+	}
+	m.setStatus(func(s *Status) {
+		s.Active, s.Ssid, s.IpAddress, s.Signal, s.Fallback = ActiveHotspot, cfg.Ssid, cfg.IpAddress, 0, fallback
+		s.Connecting, s.Message = "", ""
+		if fallback {
+			s.Message = "no saved network available"
+		}
+	})
+}
+
+// guestsConnected reports whether a device is connected to the hotspot. When
+// that cannot be told, it assumes so.
+func (m *Manager) guestsConnected(iface string) bool {
+	stations, err := listStations(m.Iw, iface)
+	if err != nil {
+		m.log.Debug("network", "Cannot list hotspot clients, postponing the WiFi retry: %v", err)
+		return true
+	}
+	return len(stations) > 0
+}
+
+// signal reads the strength of the connected network from the cached scan.
+func (m *Manager) signal(iface string) int {
+	aps, err := listAccessPoints(m.Exec, iface, false)
+	if err != nil {
+		return 0
+	}
+	for _, ap := range aps {
+		if ap.InUse {
+			return ap.Signal
+		}
+	}
+	return 0
+}
+
+// setStatus applies a change and broadcasts the status if anything but the
+// signal strength changed.
+func (m *Manager) setStatus(change func(s *Status)) {
+	m.mu.Lock()
+	old := m.status
+	change(&m.status)
+	m.status.Mode = m.cfg.Mode
+	if m.status.Active != old.Active {
+		m.status.Since = time.Now()
+	}
+	st := m.status
+	m.mu.Unlock()
+
+	cmp := old
+	cmp.Signal, cmp.Since = st.Signal, st.Since
+	if cmp != st && m.hub != nil {
+		m.hub.Broadcast <- websocket.Event{Type: EventTypeStatus, Data: st, Timestamp: time.Now().UnixMilli()}
+	}
+}
+
+// seconds converts a config value, using def for values <= 0.
+func seconds(v, def int) time.Duration {
+	if v <= 0 {
+		v = def
+	}
+	return time.Duration(v) * time.Second
+}
@@ -0,0 +1,364 @@
+package network
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"photobooth/internal/config"
+)
+
+// fakeNmcli plays NetworkManager for the manager: it keeps the connection
+// profiles and which one is active, and connects the client connection only
+// to the networks in reachable.
+type fakeNmcli struct {
+	mu        sync.Mutex
+	profiles  map[string]string // connection name -> SSID
+	active    string
+	inRange   []string        // SSIDs a scan finds
+	reachable map[string]bool // SSIDs the client connection gets an address on
+	dhcpRange string          // ipv4.shared-dhcp-range of the hotspot
+	rescans   int             // scans with --rescan yes
+	apDrops   int             // times the hotspot was taken down
+}
+
+func newFakeNmcli(inRange ...string) *fakeNmcli {
+	return &fakeNmcli{profiles: make(map[string]string), inRange: inRange, reachable: make(map[string]bool)}
+}
+
+func (f *fakeNmcli) Run(ctx context.Context, args ...string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	cmd := strings.Join(args, " ")
+	if strings.HasPrefix(cmd, "--wait ") {
+		cmd = strings.Join(args[2:], " ")
+	}
+	field := func(key string) string {
+		for i := 0; i+1 < len(args); i++ {
+			if args[i] == key {
+				return args[i+1]
+			}
+		}
+		return ""
+	}
+
+	switch {
+	case cmd == "-t -f NAME connection show":
+		var names []string
+		for name := range f.profiles {
+			names = append(names, name)
+		}
+		return []byte(strings.Join(names, "\n")), nil
+	case cmd == "-t -f NAME connection show --active":
+		return []byte(f.active), nil
+	case strings.HasPrefix(cmd, "connection add"):
+		f.profiles[field("con-name")] = field("ssid")
+	case strings.HasPrefix(cmd, "connection modify"):
+		if ssid := field("802-11-wireless.ssid"); ssid != "" {
+			f.profiles[args[2]] = ssid
+		}
+		if r := field("ipv4.shared-dhcp-range"); r != "" && args[2] == connectionName {
+			f.dhcpRange = r
+		}
+	case strings.HasPrefix(cmd, "connection up"):
+		name := args[len(args)-1]
+		if name == clientConnName && !f.reachable[f.profiles[name]] {
+			f.active = ""
+			return []byte("Error: Connection activation failed: IP configuration could not be reserved"), errors.New("exit status 4")
+		}
+		f.active = name
+	case strings.HasPrefix(cmd, "connection down"):
+		if args[2] == connectionName {
+			f.apDrops++
+		}
+		if f.active == args[2] {
+			f.active = ""
+		}
+	case strings.HasPrefix(cmd, "connection delete"):
+		delete(f.profiles, args[2])
+	case strings.HasPrefix(cmd, "-t -f IN-USE,SSID,SIGNAL,SECURITY,CHAN device wifi list"):
+		if strings.HasSuffix(cmd, "--rescan yes") {
+			if f.active == connectionName {
+				return []byte("Error: Scanning not allowed while in AP mode"), errors.New("exit status 1")
+			}
+			f.rescans++
+		}
+		var lines []string
+		for i, ssid := range f.inRange {
+			inUse := " "
+			if f.active == clientConnName && f.profiles[clientConnName] == ssid {
+				inUse = "*"
+			}
+			lines = append(lines, fmt.Sprintf("%s:%s:%d:WPA2:%d", inUse, ssid, 80-i*10, 1+i*5))
+		}
+		return []byte(strings.Join(lines, "\n")), nil
+	case strings.HasPrefix(cmd, "-t -f GENERAL.STATE,GENERAL.CONNECTION,IP4.ADDRESS device show"):
+		if f.active == "" {
+			return []byte("GENERAL.STATE:30 (disconnected)\nGENERAL.CONNECTION:\n"), nil
+		}
+		ip := "10.0.0.23/24"
+		if f.active == connectionName {
+			ip = "192.168.4.1/24"
+		}
+		return []byte("GENERAL.STATE:100 (connected)\nGENERAL.CONNECTION:" + f.active + "\nIP4.ADDRESS[1]:" + ip + "\n"), nil
+	default:
+		return []byte("Error: unexpected command"), fmt.Errorf("fake nmcli: %s", cmd)
+	}
+	return nil, nil
+}
+
+// setActive changes the connection state behind the manager's back, like a
+// network going away.
+func (f *fakeNmcli) setActive(name string) {
+	f.mu.Lock()
+	f.active = name
+	f.mu.Unlock()
+}
+
+func (f *fakeNmcli) counts() (rescans, apDrops int) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	return f.rescans, f.apDrops
+}
+
+// fakeIw answers `iw station dump` with the given stations.
+type fakeIw struct {
+	mu       sync.Mutex
+	stations []string
+}
+
+func (f *fakeIw) Run(ctx context.Context, args ...string) ([]byte, error) {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var b strings.Builder
+	for _, mac := range f.stations {
+		fmt.Fprintf(&b, "Station %s (on wlan0)\n\tsignal:  \t-45 [-45] dBm\n\tconnected time:\t120 seconds\n", mac)
+	}
+	return []byte(b.String()), nil
+}
+
+func (f *fakeIw) set(macs ...string) {
+	f.mu.Lock()
+	f.stations = macs
+	f.mu.Unlock()
+}
+
+var testWifi = config.WifiConfig{
+	Ssid:            "Photobooth",
+	Interface:       "wlan0",
+	IpAddress:       "192.168.4.1",
+	DhcpRangeStart:  "192.168.4.10",
+	DhcpRangeEnd:    "192.168.4.100",
+	Mode:            ModeAuto,
+	Networks:        []config.WifiNetwork{{Ssid: "Venue", Password: "venue-secret"}, {Ssid: "Backup"}},
+	RetryClientSecs: 300,
+}
+
+func newTestManager(cfg config.WifiConfig, nm *fakeNmcli) (*Manager, *fakeIw) {
+	iw := &fakeIw{}
+	m := NewManager(cfg, nil)
+	m.Exec, m.Iw = nm, iw
+	return m, iw
+}
+
+func TestHotspotMode(t *testing.T) {
+	cfg := testWifi
+	cfg.Mode = ModeHotspot
+	nm := newFakeNmcli("Venue")
+	nm.reachable["Venue"] = true
+	m, _ := newTestManager(cfg, nm)
+
+	m.check(&watch{})
+	st := m.Status()
+	if st.Active != ActiveHotspot || st.Ssid != "Photobooth" || st.Fallback {
+		t.Fatalf("status = %+v, want the hotspot", st)
+	}
+	if rescans, _ := nm.counts(); rescans != 0 {
+		t.Errorf("hotspot mode scanned %d times", rescans)
+	}
+
+	if nm.dhcpRange != "192.168.4.10,192.168.4.100" {
+		t.Errorf("DHCP range = %q, want the configured one", nm.dhcpRange)
+	}
+
+	// Stays up without touching the connection again
+	m.check(&watch{})
+	if _, drops := nm.counts(); drops != 0 {
+		t.Errorf("hotspot was taken down %d times", drops)
+	}
+}
+
+func TestAutoConnectsToSavedNetwork(t *testing.T) {
+	nm := newFakeNmcli("Other", "Backup")
+	nm.reachable["Backup"] = true
+	m, _ := newTestManager(testWifi, nm)
+
+	m.check(&watch{})
+	st := m.Status()
+	if st.Active != ActiveClient || st.Ssid != "Backup" || st.IpAddress != "10.0.0.23" {
+		t.Fatalf("status = %+v, want client on Backup", st)
+	}
+	if st.Signal != 70 {
+		t.Errorf("signal = %d, want 70 from the scan", st.Signal)
+	}
+}
+
+func TestAutoFallsBackToHotspot(t *testing.T) {
+	nm := newFakeNmcli("Venue")
+	m, _ := newTestManager(testWifi, nm)
+
+	w := &watch{}
+	m.check(w)
+	st := m.Status()
+	if st.Active != ActiveHotspot || !st.Fallback {
+		t.Fatalf("status = %+v, want the fallback hotspot", st)
+	}
+	if until := time.Until(w.retryAt); until < 299*time.Second || until > 300*time.Second {
+		t.Errorf("next retry in %s, want RetryClientSecs", until)
+	}
+}
+
+func TestClientModeWithoutNetworkStaysOff(t *testing.T) {
+	cfg := testWifi
+	cfg.Mode = ModeClient
+	cfg.RetryClientSecs = 0
+	nm := newFakeNmcli()
+	m, _ := newTestManager(cfg, nm)
+
+	w := &watch{}
+	m.check(w)
+	if st := m.Status(); st.Active != ActiveNone || st.Message != "no saved network available" {
+		t.Fatalf("status = %+v, want no connection", st)
+	}
+	if w.retryAt.IsZero() || w.onWake {
+		t.Errorf("client mode must keep retrying: %+v", w)
+	}
+}
+
+func TestAutoRetryWaitsForGuests(t *testing.T) {
+	nm := newFakeNmcli("Venue")
+	m, iw := newTestManager(testWifi, nm)
+	w := &watch{}
+	m.check(w)
+	if st := m.Status(); st.Active != ActiveHotspot {
+		t.Fatalf("status = %+v, want the fallback hotspot", st)
+	}
+
+	// The venue network came back, but a guest uses the hotspot
+	nm.mu.Lock()
+	nm.reachable["Venue"] = true
+	nm.mu.Unlock()
+	iw.set("aa:bb:cc:dd:ee:ff")
+	w.retryAt = time.Now().Add(-time.Second)
+	m.check(w)
+	if _, drops := nm.counts(); drops != 0 {
+		t.Fatalf("timed retry took the hotspot down with a guest connected")
+	}
+	if st := m.Status(); st.Active != ActiveHotspot {
+		t.Fatalf("status = %+v, want the hotspot kept", st)
+	}
+	if !w.retryAt.After(time.Now()) {
+		t.Errorf("retry not postponed")
+	}
+
+	// Once the guest left the timed retry goes ahead
+	iw.set()
+	w.retryAt = time.Now().Add(-time.Second)
+	m.check(w)
+	if st := m.Status(); st.Active != ActiveClient || st.Ssid != "Venue" {
+		t.Fatalf("status = %+v, want client on Venue", st)
+	}
+}
+
+func TestReconnectScansWithGuests(t *testing.T) {
+	nm := newFakeNmcli("Venue")
+	m, iw := newTestManager(testWifi, nm)
+	w := &watch{}
+	m.check(w)
+
+	nm.mu.Lock()
+	nm.reachable["Venue"] = true
+	nm.mu.Unlock()
+	iw.set("aa:bb:cc:dd:ee:ff")
+	// What run does on Reconnect
+	w.retryAt, w.onWake, w.forced = time.Time{}, false, true
+	m.check(w)
+	if st := m.Status(); st.Active != ActiveClient || st.Ssid != "Venue" {
+		t.Fatalf("status = %+v, want client on Venue", st)
+	}
+	if w.forced {
+		t.Error("forced attempt not consumed")
+	}
+}
+
+func TestLostConnectionFallsBack(t *testing.T) {
+	cfg := testWifi
+	cfg.LostTimeout = 1
+	nm := newFakeNmcli("Venue")
+	nm.reachable["Venue"] = true
+	m, _ := newTestManager(cfg, nm)
+	w := &watch{}
+	m.check(w)
+	if st := m.Status(); st.Active != ActiveClient {
+		t.Fatalf("status = %+v, want client", st)
+	}
+
+	// The venue network goes away
+	nm.mu.Lock()
+	nm.reachable["Venue"] = false
+	nm.inRange = nil
+	nm.mu.Unlock()
+	nm.setActive("")
+	m.check(w)
+	if st := m.Status(); st.Active != ActiveClient || st.Message != "connection lost" {
+		t.Fatalf("status = %+v, want to wait for the connection to come back", st)
+	}
+
+	w.lostSince = time.Now().Add(-2 * time.Second)
+	m.check(w)
+	if st := m.Status(); st.Active != ActiveHotspot || !st.Fallback {
+		t.Fatalf("status = %+v, want the fallback hotspot", st)
+	}
+}
+
+func TestValidate(t *testing.T) {
+	cases := []struct {
+		name   string
+		change func(c *config.WifiConfig)
+		ok     bool
+	}{
+		{"default", func(c *config.WifiConfig) {}, true},
+		{"short password", func(c *config.WifiConfig) { c.Password = "short" }, false},
+		{"unknown mode", func(c *config.WifiConfig) { c.Mode = "mesh" }, false},
+		{"5 GHz channel on 2.4 GHz", func(c *config.WifiConfig) { c.Channel = 36 }, false},
+		{"5 GHz", func(c *config.WifiConfig) { c.Band, c.Channel = "a", 36 }, true},
+		{"public address", func(c *config.WifiConfig) { c.IpAddress = "8.8.8.8" }, false},
+		{"range outside the network", func(c *config.WifiConfig) { c.DhcpRangeEnd = "192.168.5.100" }, false},
+		{"range contains the booth", func(c *config.WifiConfig) { c.IpAddress = "192.168.4.50" }, false},
+		{"range reversed", func(c *config.WifiConfig) { c.DhcpRangeStart, c.DhcpRangeEnd = "192.168.4.100", "192.168.4.10" }, false},
+	}
+	for _, c := range cases {
+		cfg := testWifi
+		c.change(&cfg)
+		if err := Validate(cfg); (err == nil) != c.ok {
+			t.Errorf("%s: Validate = %v", c.name, err)
+		}
+	}
+}
+
+func TestDhcpRange(t *testing.T) {
+	for ip, want := range map[string][2]string{
+		"192.168.4.1":    {"192.168.4.10", "192.168.4.100"},
+		"10.1.2.50":      {"10.1.2.150", "10.1.2.250"},
+		"not an address": {"", ""},
+	} {
+		start, end := DhcpRange(ip)
+		if start != want[0] || end != want[1] {
+			t.Errorf("DhcpRange(%s) = %s - %s, want %s - %s", ip, start, end, want[0], want[1])
+		}
+	}
+}
@@ -0,0 +1,76 @@
+package network
+
+import (
+	"context"
+	"os/exec"
+	"strings"
+	"time"
+)
+
+// Executor runs a command line tool (nmcli, iw). The manager only talks to the
+// WiFi stack through it, so a fake can replay canned output where there is no
+// WiFi hardware.
+type Executor interface {
+	Run(ctx context.Context, args ...string) ([]byte, error)
+}
+
+// Command runs a binary, e.g. Command("iw").
+type Command string
+
+func (c Command) Run(ctx context.Context, args ...string) ([]byte, error) {
+	return exec.CommandContext(ctx, string(c), args...).CombinedOutput()
+}
+
+// Nmcli runs the real nmcli binary.
+type Nmcli struct{}
+
+func (Nmcli) Run(ctx context.Context, args ...string) ([]byte, error) {
+	return Command("nmcli").Run(ctx, args...)
+}
+
+// Available reports whether nmcli is installed.
+func (Nmcli) Available() bool {
+	_, err := exec.LookPath("nmcli")
+	return err == nil
+}
+
+// cmdTimeout bounds nmcli calls that do not wait for a connection.
+const cmdTimeout = 15 * time.Second
+
+// run calls nmcli with the default timeout.
+func run(e Executor, args ...string) ([]byte, error) {
+	ctx, cancel := context.WithTimeout(context.Background(), cmdTimeout)
+	defer cancel()
+	return e.Run(ctx, args...)
+}
+
+// splitTerse splits a line of `nmcli -t` output into its fields. Colons inside
+// values are escaped as "\:" and backslashes as "\\".
+func splitTerse(line string) []string {
+	var fields []string
+	var b strings.Builder
+	for i := 0; i < len(line); i++ {
+		switch c := line[i]; {
+		case c == '\\' && i+1 < len(line):
+			i++
+			b.WriteByte(line[i])
+		case c == ':':
+			fields = append(fields, b.String())
+			b.Reset()
+		default:
+			b.WriteByte(c)
+		}
+	}
+	return append(fields, b.String())
+}
+
+// terseLines returns the non-empty lines of `nmcli -t` output split into fields.
+func terseLines(out []byte) [][]string {
+	var rows [][]string
+	for _, line := range strings.Split(string(out), "\n") {
+		if line = strings.TrimRight(line, "\r"); line != "" {
+			rows = append(rows, splitTerse(line))
+		}
+	}
+	return rows
+}
@@ -0,0 +1,146 @@
+package network
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Station is a device connected to the hotspot.
+type Station struct {
+	Mac           string `json:"mac"`
+	Ip            string `json:"ip,omitempty"`
+	Hostname      string `json:"hostname,omitempty"`
+	Signal        int    `json:"signal"`        // dBm
+	ConnectedSecs int    `json:"connectedSecs"` // since association
+	InactiveMs    int    `json:"inactiveMs"`
+}
+
+// Lease is a DHCP lease handed out by the hotspot.
+type Lease struct {
+	Mac      string    `json:"mac"`
+	Ip       string    `json:"ip"`
+	Hostname string    `json:"hostname,omitempty"`
+	Expires  time.Time `json:"expires"`
+}
+
+// listStations parses `iw dev <iface> station dump`.
+func listStations(e Executor, iface string) ([]Station, error) {
+	out, err := run(e, "dev", iface, "station", "dump")
+	if err != nil {
+		return nil, fmt.Errorf("station dump: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	var stations []Station
+	var cur *Station
+	for _, line := range strings.Split(string(out), "\n") {
+		if strings.HasPrefix(line, "Station ") {
+			// "Station aa:bb:cc:dd:ee:ff (on wlan0)"
+			fields := strings.Fields(line)
+			if len(fields) >= 2 {
+				stations = append(stations, Station{Mac: strings.ToLower(fields[1])})
+				cur = &stations[len(stations)-1]
+			}
+			continue
+		}
+		key, value, ok := strings.Cut(strings.TrimSpace(line), ":")
+		if !ok || cur == nil {
+			continue
+		}
+		// "signal:  	-45 [-45] dBm", "connected time:	120 seconds"
+		fields := strings.Fields(value)
+		if len(fields) == 0 {
+			continue
+		}
+		n, _ := strconv.Atoi(fields[0])
+		switch key {
+		case "signal":
+			cur.Signal = n
+		case "connected time":
+			cur.ConnectedSecs = n
+		case "inactive time":
+			cur.InactiveMs = n
+		}
+	}
+	return stations, nil
+}
+
+// leasesFile is where NetworkManager's dnsmasq keeps the leases of a shared connection.
+func leasesFile(iface string) string {
+	return "/var/lib/NetworkManager/dnsmasq-" + iface + ".leases"
+}
+
+// readLeases parses a dnsmasq lease file: "<expiry> <mac> <ip> <hostname> <client-id>".
+// Expired leases are left out.
+func readLeases(path string) ([]Lease, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			return nil, nil // no client yet
+		}
+		return nil, err
+	}
+	defer f.Close()
+
+	var leases []Lease
+	now := time.Now()
+	sc := bufio.NewScanner(f)
+	for sc.Scan() {
+		fields := strings.Fields(sc.Text())
+		if len(fields) < 4 {
+			continue
+		}
+		expiry, err := strconv.ParseInt(fields[0], 10, 64)
+		if err != nil {
+			continue
+		}
+		l := Lease{Mac: strings.ToLower(fields[1]), Ip: fields[2], Expires: time.Unix(expiry, 0)}
+		if fields[3] != "*" {
+			l.Hostname = fields[3]
+		}
+		if expiry != 0 && l.Expires.Before(now) {
+			continue
+		}
+		leases = append(leases, l)
+	}
+	return leases, sc.Err()
+}
+
+// Stations lists the devices connected to the hotspot, with address and host
+// name from their DHCP lease. Empty unless the hotspot is active.
+func (m *Manager) Stations() ([]Station, error) {
+	if m.Status().Active != ActiveHotspot {
+		return []Station{}, nil
+	}
+	iface := m.Config().Interface
+	stations, err := listStations(m.Iw, iface)
+	if err != nil {
+		return nil, err
+	}
+	leases, _ := m.Leases()
+	byMac := make(map[string]Lease, len(leases))
+	for _, l := range leases {
+		byMac[l.Mac] = l
+	}
+	for i := range stations {
+		if l, ok := byMac[stations[i].Mac]; ok {
+			stations[i].Ip, stations[i].Hostname = l.Ip, l.Hostname
+		}
+	}
+	return stations, nil
+}
+
+// Leases returns the current DHCP leases of the hotspot.
+func (m *Manager) Leases() ([]Lease, error) {
+	path := m.LeasesFile
+	if path == "" {
+		path = leasesFile(m.Config().Interface)
+	}
+	leases, err := readLeases(path)
+	if leases == nil {
+		leases = []Lease{}
+	}
+	return leases, err
+}
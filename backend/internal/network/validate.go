@@ -0,0 +1,105 @@
+package network
+
+import (
+	"bytes"
+	"fmt"
+	"net"
+
+	"photobooth/internal/config"
+)
+
+// channels lists the channels allowed per band (EU regulatory domain, which is
+// also fine in most other places; 5 GHz without the DFS range 52-144).
+var channels = map[string][]int{
+	"bg": {1, 2, 3, 4, 5, 6, 7, 8, 9, 10, 11, 12, 13},
+	"a":  {36, 40, 44, 48, 149, 153, 157, 161, 165},
+}
+
+// Validate checks a WiFi config before it is applied.
+func Validate(cfg config.WifiConfig) error {
+	if n := len(cfg.Ssid); n == 0 || n > 32 {
+		return fmt.Errorf("SSID must have 1 to 32 bytes")
+	}
+	if cfg.Password != "" {
+		if n := len(cfg.Password); n < 8 || n > 63 {
+			return fmt.Errorf("WPA password must have 8 to 63 characters")
+		}
+		for _, c := range []byte(cfg.Password) {
+			if c < 0x20 || c > 0x7e {
+				return fmt.Errorf("WPA password may only contain printable ASCII characters")
+			}
+		}
+	}
+
+	switch cfg.Mode {
+	case "", ModeHotspot, ModeClient, ModeAuto:
+	default:
+		return fmt.Errorf("unknown mode %q", cfg.Mode)
+	}
+	switch cfg.PortalLanding {
+	case "", "gallery", "modes":
+	default:
+		return fmt.Errorf("unknown portal landing page %q, use gallery or modes", cfg.PortalLanding)
+	}
+
+	band := cfg.Band
+	if band == "" {
+		band = "bg"
+	}
+	allowed, ok := channels[band]
+	if !ok {
+		return fmt.Errorf("unknown band %q, use bg (2.4 GHz) or a (5 GHz)", cfg.Band)
+	}
+	if cfg.Channel != 0 && !containsInt(allowed, cfg.Channel) {
+		return fmt.Errorf("channel %d is not allowed on band %s", cfg.Channel, band)
+	}
+
+	ip := net.ParseIP(cfg.IpAddress).To4()
+	if ip == nil || !ip.IsPrivate() {
+		return fmt.Errorf("IP address must be a private IPv4 address")
+	}
+	if ip[3] == 0 || ip[3] == 255 {
+		return fmt.Errorf("IP address %s is a network or broadcast address", cfg.IpAddress)
+	}
+	start, end := net.ParseIP(cfg.DhcpRangeStart).To4(), net.ParseIP(cfg.DhcpRangeEnd).To4()
+	if start == nil || end == nil {
+		return fmt.Errorf("DHCP range must be two IPv4 addresses")
+	}
+	subnet := net.CIDRMask(24, 32)
+	if !ip.Mask(subnet).Equal(start.Mask(subnet)) || !ip.Mask(subnet).Equal(end.Mask(subnet)) {
+		return fmt.Errorf("DHCP range must be in the /24 network of %s", cfg.IpAddress)
+	}
+	if bytes.Compare(start, end) > 0 {
+		return fmt.Errorf("DHCP range start is after its end")
+	}
+	if bytes.Compare(start, ip) <= 0 && bytes.Compare(ip, end) <= 0 {
+		return fmt.Errorf("DHCP range must not contain the booth's address %s", cfg.IpAddress)
+	}
+	return nil
+}
+
+// DhcpRange is the default range for a booth address: .10 to .100 of its /24,
+// or .150 to .250 if the booth itself is in there.
+func DhcpRange(ipAddress string) (string, string) {
+	ip := net.ParseIP(ipAddress).To4()
+	if ip == nil {
+		return "", ""
+	}
+	start, end := make(net.IP, 4), make(net.IP, 4)
+	copy(start, ip)
+	copy(end, ip)
+	start[3], end[3] = 10, 100
+	if ip[3] >= 10 && ip[3] <= 100 {
+		start[3], end[3] = 150, 250
+	}
+	return start.String(), end.String()
+}
+
+func containsInt(list []int, v int) bool {
+	for _, x := range list {
+		if x == v {
+			return true
+		}
+	}
+	return false
+}
@@ -2,18 +2,19 @@ package network
 
 import (
 	"fmt"
-	"log"
-	"os/exec"
+	"strconv"
 	"strings"
-
-	"photobooth/internal/config"
 )
 
-const connectionName = "photobooth-ap"
+// Connections managed by the booth, kept apart from any the OS image ships with.
+const (
+	connectionName = "photobooth-ap"
+	clientConnName = "photobooth-client"
+)
 
 // connectionExists checks if the NetworkManager connection already exists.
-func connectionExists(name string) bool {
-	out, err := exec.Command("nmcli", "-t", "-f", "NAME", "connection", "show").CombinedOutput()
+func connectionExists(e Executor, name string) bool {
+	out, err := run(e, "-t", "-f", "NAME", "connection", "show")
 	if err != nil {
 		return false
 	}
@@ -26,8 +27,8 @@ func connectionExists(name string) bool {
 }
 
 // connectionIsActive checks if the connection is currently active.
-func connectionIsActive(name string) bool {
-	out, err := exec.Command("nmcli", "-t", "-f", "NAME", "connection", "show", "--active").CombinedOutput()
+func connectionIsActive(e Executor, name string) bool {
+	out, err := run(e, "-t", "-f", "NAME", "connection", "show", "--active")
 	if err != nil {
 		return false
 	}
@@ -39,81 +40,82 @@ func connectionIsActive(name string) bool {
 	return false
 }
 
-func SetupWifi(cfg config.WifiConfig) {
-	if !cfg.Enabled {
-		return
-	}
-
-	log.Printf("📡 Setting up WiFi Hotspot: %s", cfg.Ssid)
+// hotspotUp creates or updates the access point connection and activates it.
+func (m *Manager) hotspotUp() error {
+	cfg := m.Config()
+	m.log.Info("network", "Setting up WiFi hotspot: %s", cfg.Ssid)
 
-	// Check for nmcli
-	if _, err := exec.LookPath("nmcli"); err != nil {
-		log.Println("⚠️ nmcli not found. WiFi setup skipped.")
-		return
-	}
-
-	if connectionExists(connectionName) {
-		log.Printf("   Connection '%s' already exists, updating settings...", connectionName)
+	if connectionExists(m.Exec, connectionName) {
+		m.log.Debug("network", "Connection '%s' already exists, updating settings...", connectionName)
 	} else {
-		log.Printf("   Creating new connection '%s'...", connectionName)
-		// Create connection
-		cmdAdd := exec.Command("nmcli", "connection", "add",
+		m.log.Info("network", "Creating new connection '%s'...", connectionName)
+		out, err := run(m.Exec, "connection", "add",
 			"type", "wifi",
 			"ifname", cfg.Interface,
 			"con-name", connectionName,
-			"autoconnect", "yes",
+			"autoconnect", "no", // the manager decides between hotspot and client
 			"ssid", cfg.Ssid,
 		)
-		if out, err := cmdAdd.CombinedOutput(); err != nil {
-			log.Printf("❌ Failed to add WiFi connection: %v\n%s", err, out)
-			return
+		if err != nil {
+			return fmt.Errorf("add hotspot connection: %v: %s", err, strings.TrimSpace(string(out)))
 		}
 	}
 
+	band := cfg.Band
+	if band == "" {
+		band = "bg"
+	}
+
 	// Configure / update as AP with DHCP
-	modifyArgs := []string{"connection", "modify", connectionName,
+	out, err := run(m.Exec, "connection", "modify", connectionName,
 		"802-11-wireless.mode", "ap",
-		"802-11-wireless.band", "bg",
+		"802-11-wireless.band", band,
+		"802-11-wireless.channel", strconv.Itoa(cfg.Channel),
 		"802-11-wireless.ssid", cfg.Ssid,
 		"ipv4.addresses", fmt.Sprintf("%s/24", cfg.IpAddress),
 		"ipv4.method", "shared",
-		"connection.autoconnect", "yes",
+		"connection.autoconnect", "no",
+	)
+	if err != nil {
+		return fmt.Errorf("configure AP mode: %v: %s", err, strings.TrimSpace(string(out)))
 	}
 
-	if out, err := exec.Command("nmcli", modifyArgs...).CombinedOutput(); err != nil {
-		log.Printf("❌ Failed to configure AP mode: %v\n%s", err, out)
-		return
+	// The DHCP range of the shared connection's dnsmasq; NetworkManager before
+	// 1.42 does not know the property and picks its own range in the /24
+	if cfg.DhcpRangeStart != "" && cfg.DhcpRangeEnd != "" {
+		if out, err := run(m.Exec, "connection", "modify", connectionName,
+			"ipv4.shared-dhcp-range", cfg.DhcpRangeStart+","+cfg.DhcpRangeEnd); err != nil {
+			m.log.Warn("network", "Cannot set the hotspot DHCP range %s - %s: %v: %s",
+				cfg.DhcpRangeStart, cfg.DhcpRangeEnd, err, strings.TrimSpace(string(out)))
+		}
 	}
 
 	// Security (Open or WPA)
 	if cfg.Password == "" {
-		// Open network
-		exec.Command("nmcli", "connection", "modify", connectionName, "remove", "802-11-wireless-security").Run()
+		run(m.Exec, "connection", "modify", connectionName, "remove", "802-11-wireless-security")
 	} else {
-		// WPA
-		exec.Command("nmcli", "connection", "modify", connectionName,
+		run(m.Exec, "connection", "modify", connectionName,
 			"802-11-wireless-security.key-mgmt", "wpa-psk",
-			"802-11-wireless-security.psk", cfg.Password).Run()
+			"802-11-wireless-security.psk", cfg.Password)
 	}
 
-	// Activate if not already active
-	if connectionIsActive(connectionName) {
-		log.Printf("   Connection '%s' is already active, reapplying...", connectionName)
-		// Reapply to pick up any config changes
-		if out, err := exec.Command("nmcli", "connection", "up", connectionName).CombinedOutput(); err != nil {
-			log.Printf("⚠️ Failed to reapply WiFi: %v\n%s", err, out)
-		}
-	} else {
-		if out, err := exec.Command("nmcli", "connection", "up", connectionName).CombinedOutput(); err != nil {
-			log.Printf("❌ Failed to bring up WiFi: %v\n%s", err, out)
-		} else {
-			log.Printf("✅ WiFi Hotspot active: %s @ %s", cfg.Ssid, cfg.IpAddress)
-		}
+	// Bringing it up again also reapplies changed settings of an active hotspot
+	if out, err := run(m.Exec, "connection", "up", connectionName); err != nil {
+		return fmt.Errorf("bring up hotspot: %v: %s", err, strings.TrimSpace(string(out)))
+	}
+	m.log.Info("network", "WiFi hotspot active: %s @ %s", cfg.Ssid, cfg.IpAddress)
+	return nil
+}
+
+// hotspotDown deactivates the access point, keeping its connection profile.
+func (m *Manager) hotspotDown() {
+	if connectionIsActive(m.Exec, connectionName) {
+		run(m.Exec, "connection", "down", connectionName)
 	}
 }
 
-func TeardownWifi() {
-	// nmcli connection delete photobooth-ap
-	exec.Command("nmcli", "connection", "delete", connectionName).Run()
-	log.Println("📡 WiFi Hotspot removed")
+// teardownHotspot removes the access point connection on exit.
+func (m *Manager) teardownHotspot() {
+	run(m.Exec, "connection", "delete", connectionName)
+	m.log.Info("network", "WiFi hotspot removed")
 }
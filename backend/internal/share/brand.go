@@ -0,0 +1,53 @@
+package share
+
+import (
+	"bytes"
+	"fmt"
+	"image"
+	"os"
+	"time"
+
+	"github.com/disintegration/imaging"
+)
+
+// branded lays the configured overlay (a PNG with transparency, e.g. a logo
+// bar or a frame) over a photo. The overlay is scaled to the photo's width and
+// placed at the bottom, so a frame made for the booth's aspect ratio covers the
+// whole photo. The image is built on request and not stored: edits, moves and
+// trash never leave a stale copy behind. Returns the JPEG and its modification
+// time, the newer of photo and overlay.
+func (m *Manager) branded(photoPath string) ([]byte, time.Time, error) {
+	m.renderMu.Lock()
+	defer m.renderMu.Unlock()
+
+	photoInfo, err := os.Stat(photoPath)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	overlayInfo, err := os.Stat(m.cfg.Overlay)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("overlay: %w", err)
+	}
+	photo, err := imaging.Open(photoPath, imaging.AutoOrientation(true))
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	overlay, err := imaging.Open(m.cfg.Overlay)
+	if err != nil {
+		return nil, time.Time{}, fmt.Errorf("overlay: %w", err)
+	}
+
+	bounds := photo.Bounds()
+	overlay = imaging.Resize(overlay, bounds.Dx(), 0, imaging.Lanczos)
+	out := imaging.Overlay(photo, overlay, image.Pt(0, bounds.Dy()-overlay.Bounds().Dy()), 1)
+
+	var buf bytes.Buffer
+	if err := imaging.Encode(&buf, out, imaging.JPEG, imaging.JPEGQuality(90)); err != nil {
+		return nil, time.Time{}, err
+	}
+	mod := photoInfo.ModTime()
+	if overlayInfo.ModTime().After(mod) {
+		mod = overlayInfo.ModTime()
+	}
+	return buf.Bytes(), mod, nil
+}
@@ -0,0 +1,372 @@
+package email
+
+import (
+	"crypto/rand"
+	"encoding/csv"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"io"
+	"net/mail"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"photobooth/internal/config"
+	"photobooth/internal/logging"
+)
+
+// Summary is the delivery status of one album's outbox.
+type Summary struct {
+	Album   string `json:"album"`
+	Pending int    `json:"pending"`
+	Sent    int    `json:"sent"`
+	Failed  int    `json:"failed"`
+	Online  bool   `json:"online"` // false while the SMTP relay is unreachable
+}
+
+// Queue persists mail requests per album and delivers them in the background.
+type Queue struct {
+	mu       sync.Mutex
+	cfg      config.EmailConfig
+	basePath string
+	sender   Sender
+	outboxes map[string][]*Message // album -> messages
+	online   bool
+	lastSend time.Time
+	wake     chan struct{}
+	log      *logging.Logger
+}
+
+// NewQueue creates the mail queue. Pass nil as sender to use SMTP from cfg.
+func NewQueue(cfg config.EmailConfig, photosBase string, sender Sender) *Queue {
+	if sender == nil {
+		sender = NewSMTPSender(cfg)
+	}
+	if cfg.MaxAttempts < 1 {
+		cfg.MaxAttempts = 10
+	}
+	if cfg.RetrySeconds < 1 {
+		cfg.RetrySeconds = 60
+	}
+	return &Queue{
+		cfg:      cfg,
+		basePath: photosBase,
+		sender:   sender,
+		outboxes: make(map[string][]*Message),
+		online:   true,
+		wake:     make(chan struct{}, 1),
+		log:      logging.Get(),
+	}
+}
+
+// Enabled reports whether mail delivery is switched on.
+func (q *Queue) Enabled() bool {
+	return q.cfg.Enabled
+}
+
+// Start loads all album outboxes from disk and runs the delivery loop.
+func (q *Queue) Start() {
+	entries, _ := os.ReadDir(q.basePath)
+	q.mu.Lock()
+	pending := 0
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		msgs, err := loadOutbox(filepath.Join(q.basePath, e.Name()))
+		if err != nil {
+			q.log.Warn("email", "Failed to load outbox of album '%s': %v", e.Name(), err)
+			continue
+		}
+		if len(msgs) > 0 {
+			q.outboxes[e.Name()] = msgs
+			for _, m := range msgs {
+				if m.Status == StatusPending {
+					pending++
+				}
+			}
+		}
+	}
+	q.mu.Unlock()
+
+	if pending > 0 {
+		q.log.Info("email", "Outbox contains %d pending mails", pending)
+	}
+
+	go q.run()
+}
+
+// Submit validates the address and queues the photo for delivery. It returns
+// a copy of the queued message.
+func (q *Queue) Submit(album, filename, to string) (*Message, error) {
+	addr, err := mail.ParseAddress(to)
+	if err != nil {
+		return nil, fmt.Errorf("invalid email address")
+	}
+	if filename == "" || filename != filepath.Base(filename) {
+		return nil, fmt.Errorf("invalid filename %q", filename)
+	}
+	if _, err := os.Stat(filepath.Join(q.basePath, album, "original", filename)); err != nil {
+		return nil, fmt.Errorf("photo not found")
+	}
+
+	id := make([]byte, 8)
+	rand.Read(id)
+
+	now := time.Now()
+	msg := &Message{
+		Id:          hex.EncodeToString(id),
+		Album:       album,
+		Filename:    filename,
+		To:          addr.Address,
+		Status:      StatusPending,
+		CreatedAt:   now,
+		NextAttempt: now,
+	}
+
+	q.mu.Lock()
+	q.outboxes[album] = append(q.outboxes[album], msg)
+	err = q.persist(album)
+	// The delivery loop updates the queued message under q.mu; the caller gets a copy
+	queued := *msg
+	q.mu.Unlock()
+	if err != nil {
+		return nil, err
+	}
+
+	q.log.Info("email", "Queued %s for %s", filename, addr.Address)
+	q.notify()
+	return &queued, nil
+}
+
+// Retry puts all failed mails of an album back into the queue.
+func (q *Queue) Retry(album string) (int, error) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	n := 0
+	for _, m := range q.outboxes[album] {
+		if m.Status == StatusFailed {
+			m.Status = StatusPending
+			m.Attempts = 0
+			m.NextAttempt = time.Now()
+			n++
+		}
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	q.notify()
+	return n, q.persist(album)
+}
+
+// Status returns the counts of an album's outbox. It is shown to guests on the
+// hotspot, so it never contains addresses.
+func (q *Queue) Status(album string) Summary {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	s := Summary{Album: album, Online: q.online}
+	for _, m := range q.outboxes[album] {
+		switch m.Status {
+		case StatusPending:
+			s.Pending++
+		case StatusSent:
+			s.Sent++
+		case StatusFailed:
+			s.Failed++
+		}
+	}
+	return s
+}
+
+// ExportCSV writes the album's outbox as CSV so addresses can be processed
+// manually when the booth never goes online.
+func (q *Queue) ExportCSV(album string, w io.Writer) error {
+	q.mu.Lock()
+	msgs := make([]Message, 0, len(q.outboxes[album]))
+	for _, m := range q.outboxes[album] {
+		msgs = append(msgs, *m)
+	}
+	q.mu.Unlock()
+
+	cw := csv.NewWriter(w)
+	cw.Write([]string{"id", "email", "album", "filename", "status", "attempts", "created", "sent", "lastError"})
+	for _, m := range msgs {
+		sent := ""
+		if !m.SentAt.IsZero() {
+			sent = m.SentAt.Format(time.RFC3339)
+		}
+		cw.Write([]string{
+			m.Id, m.To, m.Album, m.Filename, string(m.Status), fmt.Sprint(m.Attempts),
+			m.CreatedAt.Format(time.RFC3339), sent, m.LastError,
+		})
+	}
+	cw.Flush()
+	return cw.Error()
+}
+
+// MoveAlbum carries the outbox of an album over to its new name after the
+// album was renamed or merged into another.
+func (q *Queue) MoveAlbum(from, to string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	msgs := q.outboxes[from]
+	if len(msgs) == 0 {
+		return nil
+	}
+	for _, m := range msgs {
+		m.Album = to
+	}
+	q.outboxes[to] = append(q.outboxes[to], msgs...)
+	delete(q.outboxes, from)
+	// A merged album still has its folder until it goes to the trash
+	if err := os.Remove(filepath.Join(q.basePath, from, outboxFile)); err != nil && !os.IsNotExist(err) {
+		return err
+	}
+	return q.persist(to)
+}
+
+// MovePhoto carries the mails of a photo over to its new album and name.
+func (q *Queue) MovePhoto(fromAlbum, fromFile, toAlbum, toFile string) error {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	var keep, moved []*Message
+	for _, m := range q.outboxes[fromAlbum] {
+		if m.Filename != fromFile {
+			keep = append(keep, m)
+			continue
+		}
+		m.Album, m.Filename = toAlbum, toFile
+		moved = append(moved, m)
+	}
+	if len(moved) == 0 {
+		return nil
+	}
+	q.outboxes[toAlbum] = append(q.outboxes[toAlbum], moved...)
+	if err := q.persist(toAlbum); err != nil {
+		return err
+	}
+	q.outboxes[fromAlbum] = keep
+	return q.persist(fromAlbum)
+}
+
+func (q *Queue) notify() {
+	select {
+	case q.wake <- struct{}{}:
+	default:
+	}
+}
+
+// persist must be called with q.mu held.
+func (q *Queue) persist(album string) error {
+	return saveOutbox(filepath.Join(q.basePath, album), q.outboxes[album])
+}
+
+func (q *Queue) run() {
+	ticker := time.NewTicker(15 * time.Second)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ticker.C:
+		case <-q.wake:
+		}
+		if q.cfg.Enabled {
+			q.deliverDue()
+		}
+	}
+}
+
+// deliverDue sends all messages whose retry time has come, honouring the rate limit.
+func (q *Queue) deliverDue() {
+	for {
+		msg := q.nextDue()
+		if msg == nil {
+			return
+		}
+
+		if q.cfg.RatePerMinute > 0 {
+			gap := time.Minute / time.Duration(q.cfg.RatePerMinute)
+			if wait := gap - time.Since(q.lastSend); wait > 0 {
+				time.Sleep(wait)
+			}
+		}
+
+		q.mu.Lock()
+		to, attachment := msg.To, q.attachmentPath(msg) // the album may be renamed meanwhile
+		q.mu.Unlock()
+		err := q.sender.Send(to, q.cfg.Subject, q.cfg.Body, attachment)
+		q.lastSend = time.Now()
+
+		q.mu.Lock()
+		offline := errors.Is(err, ErrOffline)
+		q.online = !offline
+		switch {
+		case err == nil:
+			msg.Status = StatusSent
+			msg.SentAt = time.Now()
+			msg.LastError = ""
+			msg.Attempts++
+			q.log.Info("email", "Sent %s to %s", msg.Filename, msg.To)
+		case offline:
+			// Not the message's fault – postpone everything and try again later
+			msg.LastError = err.Error()
+			msg.NextAttempt = time.Now().Add(time.Duration(q.cfg.RetrySeconds) * time.Second)
+		default:
+			msg.Attempts++
+			msg.LastError = err.Error()
+			if msg.Attempts >= q.cfg.MaxAttempts {
+				msg.Status = StatusFailed
+				q.log.Error("email", "Giving up on mail to %s after %d attempts: %v", msg.To, msg.Attempts, err)
+			} else {
+				backoff := time.Duration(q.cfg.RetrySeconds) * time.Second << uint(min(msg.Attempts-1, 6))
+				if backoff > time.Hour {
+					backoff = time.Hour
+				}
+				msg.NextAttempt = time.Now().Add(backoff)
+				q.log.Warn("email", "Mail to %s failed (attempt %d): %v", msg.To, msg.Attempts, err)
+			}
+		}
+		if perr := q.persist(msg.Album); perr != nil {
+			q.log.Error("email", "Failed to persist outbox: %v", perr)
+		}
+		q.mu.Unlock()
+
+		if offline {
+			return
+		}
+	}
+}
+
+// nextDue returns the oldest pending message that is ready to be sent.
+func (q *Queue) nextDue() *Message {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	now := time.Now()
+	var best *Message
+	for _, msgs := range q.outboxes {
+		for _, m := range msgs {
+			if m.Status != StatusPending || m.NextAttempt.After(now) {
+				continue
+			}
+			if best == nil || m.CreatedAt.Before(best.CreatedAt) {
+				best = m
+			}
+		}
+	}
+	return best
+}
+
+func (q *Queue) attachmentPath(m *Message) string {
+	if q.cfg.Attachment == "preview" {
+		p := filepath.Join(q.basePath, m.Album, "preview", m.Filename)
+		if _, err := os.Stat(p); err == nil {
+			return p
+		}
+	}
+	return filepath.Join(q.basePath, m.Album, "original", m.Filename)
+}
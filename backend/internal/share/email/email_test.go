@@ -0,0 +1,390 @@
+package email
+
+import (
+	"bufio"
+	"errors"
+	"net"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"photobooth/internal/config"
+)
+
+// fakeSender records sends and answers with the queued errors in turn.
+type fakeSender struct {
+	mu   sync.Mutex
+	errs []error
+	sent []string
+}
+
+func (f *fakeSender) Send(to, subject, body, attachmentPath string) error {
+	f.mu.Lock()
+	defer f.mu.Unlock()
+	var err error
+	if len(f.errs) > 0 {
+		err, f.errs = f.errs[0], f.errs[1:]
+	}
+	if err == nil {
+		f.sent = append(f.sent, to)
+	}
+	return err
+}
+
+// newTestQueue creates a queue on a temp photo folder with one photo in album "party".
+func newTestQueue(t *testing.T, sender Sender, cfg config.EmailConfig) (*Queue, string) {
+	t.Helper()
+	base := t.TempDir()
+	dir := filepath.Join(base, "party", "original")
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(filepath.Join(dir, "IMG_0001.jpg"), []byte("jpeg data"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	cfg.Enabled = true
+	return NewQueue(cfg, base, sender), base
+}
+
+// due makes every pending message ready for the next delivery run.
+func due(q *Queue) {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, msgs := range q.outboxes {
+		for _, m := range msgs {
+			m.NextAttempt = time.Now().Add(-time.Second)
+		}
+	}
+}
+
+// queued returns the message as held by the queue; read it with q.mu held.
+func queued(t *testing.T, q *Queue, id string) *Message {
+	t.Helper()
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	for _, msgs := range q.outboxes {
+		for _, m := range msgs {
+			if m.Id == id {
+				return m
+			}
+		}
+	}
+	t.Fatalf("message %s not queued", id)
+	return nil
+}
+
+func TestDeliverSendsAndPersists(t *testing.T) {
+	sender := &fakeSender{}
+	q, base := newTestQueue(t, sender, config.EmailConfig{})
+
+	msg, err := q.Submit("party", "IMG_0001.jpg", "Guest <guest@example.com>")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if msg.To != "guest@example.com" {
+		t.Errorf("address not normalised: %q", msg.To)
+	}
+	q.deliverDue()
+
+	if len(sender.sent) != 1 {
+		t.Fatalf("sent %d mails, want 1", len(sender.sent))
+	}
+	s := q.Status("party")
+	if s.Sent != 1 || s.Pending != 0 {
+		t.Errorf("status = %+v, want 1 sent", s)
+	}
+
+	// A restarted booth sees the same outbox
+	msgs, err := loadOutbox(filepath.Join(base, "party"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Status != StatusSent {
+		t.Errorf("persisted outbox = %+v", msgs)
+	}
+}
+
+func TestSubmitRejectsBadInput(t *testing.T) {
+	q, _ := newTestQueue(t, &fakeSender{}, config.EmailConfig{})
+	cases := []struct{ file, to string }{
+		{"IMG_0001.jpg", "not an address"},
+		{"../IMG_0001.jpg", "guest@example.com"},
+		{"IMG_9999.jpg", "guest@example.com"},
+	}
+	for _, c := range cases {
+		if _, err := q.Submit("party", c.file, c.to); err == nil {
+			t.Errorf("Submit(%q, %q) succeeded", c.file, c.to)
+		}
+	}
+}
+
+func TestRetryBackoffAndGiveUp(t *testing.T) {
+	fail := errors.New("550 mailbox unavailable")
+	sender := &fakeSender{errs: []error{fail, fail, fail}}
+	q, _ := newTestQueue(t, sender, config.EmailConfig{MaxAttempts: 3, RetrySeconds: 10})
+
+	submitted, err := q.Submit("party", "IMG_0001.jpg", "guest@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := queued(t, q, submitted.Id)
+
+	// The delay doubles with every failed attempt
+	for attempt, want := range []time.Duration{10 * time.Second, 20 * time.Second} {
+		start := time.Now()
+		q.deliverDue()
+		q.mu.Lock()
+		wait := msg.NextAttempt.Sub(start)
+		status, attempts := msg.Status, msg.Attempts
+		q.mu.Unlock()
+		if status != StatusPending || attempts != attempt+1 {
+			t.Fatalf("after attempt %d: status %s, attempts %d", attempt+1, status, attempts)
+		}
+		if wait < want || wait > want+time.Second {
+			t.Errorf("after attempt %d: next attempt in %s, want %s", attempt+1, wait, want)
+		}
+
+		// Not due yet: nothing is sent
+		q.deliverDue()
+		if got := len(sender.errs); got != 2-attempt {
+			t.Fatalf("message was sent again before its retry time")
+		}
+		due(q)
+	}
+
+	q.deliverDue()
+	if s := q.Status("party"); s.Failed != 1 {
+		t.Fatalf("status = %+v, want 1 failed after MaxAttempts", s)
+	}
+
+	// A manual retry starts over and delivers
+	n, err := q.Retry("party")
+	if err != nil || n != 1 {
+		t.Fatalf("Retry = %d, %v", n, err)
+	}
+	q.deliverDue()
+	if s := q.Status("party"); s.Sent != 1 {
+		t.Errorf("status = %+v, want 1 sent after retry", s)
+	}
+}
+
+func TestBackoffIsCappedAfterManyAttempts(t *testing.T) {
+	fail := errors.New("550 mailbox unavailable")
+	sender := &fakeSender{errs: []error{fail}}
+	q, _ := newTestQueue(t, sender, config.EmailConfig{MaxAttempts: 200, RetrySeconds: 60})
+
+	submitted, err := q.Submit("party", "IMG_0001.jpg", "guest@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := queued(t, q, submitted.Id)
+	q.mu.Lock()
+	msg.Attempts = 100
+	q.mu.Unlock()
+
+	start := time.Now()
+	q.deliverDue()
+	q.mu.Lock()
+	wait := msg.NextAttempt.Sub(start)
+	q.mu.Unlock()
+	if wait < time.Hour || wait > time.Hour+time.Second {
+		t.Errorf("next attempt in %s, want the 1h cap", wait)
+	}
+}
+
+func TestOfflineDoesNotCountAsAttempt(t *testing.T) {
+	sender := &fakeSender{errs: []error{ErrOffline}}
+	q, _ := newTestQueue(t, sender, config.EmailConfig{MaxAttempts: 1, RetrySeconds: 30})
+
+	submitted, err := q.Submit("party", "IMG_0001.jpg", "guest@example.com")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := queued(t, q, submitted.Id)
+	if _, err := q.Submit("party", "IMG_0001.jpg", "other@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	q.deliverDue()
+
+	s := q.Status("party")
+	if s.Online || s.Pending != 2 {
+		t.Fatalf("status = %+v, want offline with 2 pending", s)
+	}
+	q.mu.Lock()
+	attempts := msg.Attempts
+	q.mu.Unlock()
+	if attempts != 0 {
+		t.Errorf("offline send counted as attempt %d", attempts)
+	}
+	if len(sender.sent) != 0 {
+		t.Errorf("kept sending while offline")
+	}
+
+	due(q)
+	q.deliverDue()
+	if s := q.Status("party"); !s.Online || s.Sent != 2 {
+		t.Errorf("status = %+v, want both sent once online", s)
+	}
+}
+
+// smtpStandIn is a minimal SMTP server that accepts every mail and records the
+// DATA of the last one.
+type smtpStandIn struct {
+	ln   net.Listener
+	mu   sync.Mutex
+	rcpt string
+	data string
+}
+
+func startSMTP(t *testing.T) *smtpStandIn {
+	t.Helper()
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := &smtpStandIn{ln: ln}
+	t.Cleanup(func() { ln.Close() })
+	go func() {
+		for {
+			conn, err := ln.Accept()
+			if err != nil {
+				return
+			}
+			go s.serve(conn)
+		}
+	}()
+	return s
+}
+
+func (s *smtpStandIn) serve(conn net.Conn) {
+	defer conn.Close()
+	r := bufio.NewReader(conn)
+	reply := func(line string) { conn.Write([]byte(line + "\r\n")) }
+	reply("220 localhost ESMTP")
+	for {
+		line, err := r.ReadString('\n')
+		if err != nil {
+			return
+		}
+		cmd := strings.ToUpper(strings.TrimSpace(line))
+		switch {
+		case strings.HasPrefix(cmd, "EHLO"), strings.HasPrefix(cmd, "HELO"):
+			reply("250 localhost")
+		case strings.HasPrefix(cmd, "MAIL FROM"):
+			reply("250 OK")
+		case strings.HasPrefix(cmd, "RCPT TO"):
+			s.mu.Lock()
+			s.rcpt = strings.TrimSpace(line[len("RCPT TO:"):])
+			s.mu.Unlock()
+			reply("250 OK")
+		case cmd == "DATA":
+			reply("354 go ahead")
+			var data strings.Builder
+			for {
+				l, err := r.ReadString('\n')
+				if err != nil {
+					return
+				}
+				if l == ".\r\n" {
+					break
+				}
+				data.WriteString(l)
+			}
+			s.mu.Lock()
+			s.data = data.String()
+			s.mu.Unlock()
+			reply("250 queued")
+		case cmd == "QUIT":
+			reply("221 bye")
+			return
+		default:
+			reply("502 not implemented")
+		}
+	}
+}
+
+func TestSMTPSenderAgainstStandIn(t *testing.T) {
+	srv := startSMTP(t)
+	host, port, _ := net.SplitHostPort(srv.ln.Addr().String())
+	cfg := config.EmailConfig{SmtpHost: host, From: "booth@example.com", Subject: "Dein Foto"}
+	cfg.SmtpPort, _ = strconv.Atoi(port)
+
+	q, _ := newTestQueue(t, NewSMTPSender(cfg), cfg)
+	if _, err := q.Submit("party", "IMG_0001.jpg", "guest@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	q.deliverDue()
+
+	if s := q.Status("party"); s.Sent != 1 {
+		t.Fatalf("status = %+v, want 1 sent", s)
+	}
+	srv.mu.Lock()
+	defer srv.mu.Unlock()
+	if srv.rcpt != "<guest@example.com>" {
+		t.Errorf("RCPT TO %q", srv.rcpt)
+	}
+	for _, want := range []string{"To: guest@example.com", `filename="IMG_0001.jpg"`, "anBlZyBkYXRh"} {
+		if !strings.Contains(srv.data, want) {
+			t.Errorf("mail does not contain %q", want)
+		}
+	}
+}
+
+func TestSMTPSenderUnreachableIsOffline(t *testing.T) {
+	// Grab a free port and close it again, so nothing listens there
+	ln, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	addr := ln.Addr().(*net.TCPAddr)
+	ln.Close()
+
+	s := NewSMTPSender(config.EmailConfig{SmtpHost: "127.0.0.1", SmtpPort: addr.Port, From: "booth@example.com"})
+	photo := filepath.Join(t.TempDir(), "IMG_0001.jpg")
+	os.WriteFile(photo, []byte("jpeg data"), 0644)
+	if err := s.Send("guest@example.com", "s", "b", photo); !errors.Is(err, ErrOffline) {
+		t.Errorf("err = %v, want ErrOffline", err)
+	}
+}
+
+func TestMoveKeepsMailsWithTheirPhoto(t *testing.T) {
+	sender := &fakeSender{errs: []error{ErrOffline}}
+	q, base := newTestQueue(t, sender, config.EmailConfig{RetrySeconds: 30})
+	if _, err := q.Submit("party", "IMG_0001.jpg", "guest@example.com"); err != nil {
+		t.Fatal(err)
+	}
+	q.deliverDue() // offline: stays pending
+
+	// Renamed: the folder moved along with its outbox
+	if err := os.Rename(filepath.Join(base, "party"), filepath.Join(base, "wedding")); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.MoveAlbum("party", "wedding"); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := os.Stat(filepath.Join(base, "party")); !os.IsNotExist(err) {
+		t.Errorf("old album folder was recreated: %v", err)
+	}
+
+	// Moved on into another album under a new name
+	if err := os.MkdirAll(filepath.Join(base, "archive"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := q.MovePhoto("wedding", "IMG_0001.jpg", "archive", "IMG_0001_1.jpg"); err != nil {
+		t.Fatal(err)
+	}
+	msgs, err := loadOutbox(filepath.Join(base, "archive"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(msgs) != 1 || msgs[0].Album != "archive" || msgs[0].Filename != "IMG_0001_1.jpg" {
+		t.Fatalf("archive outbox = %+v", msgs)
+	}
+	if s := q.Status("wedding"); s.Pending != 0 {
+		t.Errorf("mail still queued in the old album: %+v", s)
+	}
+}
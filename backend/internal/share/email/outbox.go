@@ -0,0 +1,45 @@
+package email
+
+import (
+	"path/filepath"
+	"time"
+
+	"photobooth/internal/fsutil"
+)
+
+// outboxFile is stored inside each album folder so pending mails travel with the album.
+const outboxFile = ".outbox.json"
+
+type Status string
+
+const (
+	StatusPending Status = "pending"
+	StatusSent    Status = "sent"
+	StatusFailed  Status = "failed" // gave up after MaxAttempts
+)
+
+// Message is one queued "mail this photo to ..." request.
+type Message struct {
+	Id          string    `json:"id"`
+	Album       string    `json:"album"`
+	Filename    string    `json:"filename"`
+	To          string    `json:"to"`
+	Status      Status    `json:"status"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"lastError,omitempty"`
+	CreatedAt   time.Time `json:"createdAt"`
+	NextAttempt time.Time `json:"nextAttempt"`
+	SentAt      time.Time `json:"sentAt,omitempty"`
+}
+
+// loadOutbox reads an album's outbox. A missing file is an empty outbox.
+func loadOutbox(albumDir string) ([]*Message, error) {
+	var msgs []*Message
+	err := fsutil.ReadJSON(filepath.Join(albumDir, outboxFile), &msgs)
+	return msgs, err
+}
+
+// saveOutbox writes the outbox atomically so a power cut never leaves a half-written queue behind.
+func saveOutbox(albumDir string, msgs []*Message) error {
+	return fsutil.WriteJSON(filepath.Join(albumDir, outboxFile), msgs)
+}
@@ -0,0 +1,144 @@
+package email
+
+import (
+	"bytes"
+	"crypto/tls"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"mime"
+	"mime/multipart"
+	"net"
+	"net/smtp"
+	"net/textproto"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"photobooth/internal/config"
+)
+
+// ErrOffline signals that the SMTP relay could not be reached at all. Such
+// failures do not count as delivery attempts – the booth is simply offline.
+var ErrOffline = errors.New("smtp server unreachable")
+
+// Sender delivers a single mail with an attached photo.
+// The SMTP implementation is used in production; tests can plug in their own.
+type Sender interface {
+	Send(to, subject, body, attachmentPath string) error
+}
+
+// SMTPSender sends mail through the configured SMTP relay.
+type SMTPSender struct {
+	cfg config.EmailConfig
+}
+
+func NewSMTPSender(cfg config.EmailConfig) *SMTPSender {
+	return &SMTPSender{cfg: cfg}
+}
+
+func (s *SMTPSender) Send(to, subject, body, attachmentPath string) error {
+	msg, err := buildMessage(s.cfg.From, to, subject, body, attachmentPath)
+	if err != nil {
+		return err
+	}
+
+	addr := net.JoinHostPort(s.cfg.SmtpHost, strconv.Itoa(s.cfg.SmtpPort))
+	conn, err := net.DialTimeout("tcp", addr, 10*time.Second)
+	if err != nil {
+		return fmt.Errorf("%w: %v", ErrOffline, err)
+	}
+	conn.SetDeadline(time.Now().Add(2 * time.Minute))
+
+	c, err := smtp.NewClient(conn, s.cfg.SmtpHost)
+	if err != nil {
+		conn.Close()
+		return err
+	}
+	defer c.Close()
+
+	if s.cfg.StartTLS {
+		if ok, _ := c.Extension("STARTTLS"); ok {
+			if err := c.StartTLS(&tls.Config{ServerName: s.cfg.SmtpHost}); err != nil {
+				return fmt.Errorf("starttls: %w", err)
+			}
+		}
+	}
+
+	if s.cfg.Username != "" {
+		auth := smtp.PlainAuth("", s.cfg.Username, s.cfg.Password, s.cfg.SmtpHost)
+		if err := c.Auth(auth); err != nil {
+			return fmt.Errorf("auth: %w", err)
+		}
+	}
+
+	if err := c.Mail(s.cfg.From); err != nil {
+		return err
+	}
+	if err := c.Rcpt(to); err != nil {
+		return err
+	}
+	wc, err := c.Data()
+	if err != nil {
+		return err
+	}
+	if _, err := wc.Write(msg); err != nil {
+		wc.Close()
+		return err
+	}
+	if err := wc.Close(); err != nil {
+		return err
+	}
+	return c.Quit()
+}
+
+// buildMessage renders a multipart/mixed mail with a text part and the photo attached.
+func buildMessage(from, to, subject, body, attachmentPath string) ([]byte, error) {
+	data, err := os.ReadFile(attachmentPath)
+	if err != nil {
+		return nil, err
+	}
+
+	var buf bytes.Buffer
+	mw := multipart.NewWriter(&buf)
+
+	fmt.Fprintf(&buf, "From: %s\r\n", from)
+	fmt.Fprintf(&buf, "To: %s\r\n", to)
+	fmt.Fprintf(&buf, "Subject: %s\r\n", mime.QEncoding.Encode("utf-8", subject))
+	fmt.Fprintf(&buf, "Date: %s\r\n", time.Now().Format(time.RFC1123Z))
+	fmt.Fprintf(&buf, "MIME-Version: 1.0\r\n")
+	fmt.Fprintf(&buf, "Content-Type: multipart/mixed; boundary=%s\r\n\r\n", mw.Boundary())
+
+	text, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"text/plain; charset=utf-8"},
+		"Content-Transfer-Encoding": {"8bit"},
+	})
+	if err != nil {
+		return nil, err
+	}
+	text.Write([]byte(body))
+
+	name := filepath.Base(attachmentPath)
+	att, err := mw.CreatePart(textproto.MIMEHeader{
+		"Content-Type":              {"image/jpeg; name=\"" + name + "\""},
+		"Content-Disposition":       {"attachment; filename=\"" + name + "\""},
+		"Content-Transfer-Encoding": {"base64"},
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	// Wrap base64 at 76 chars per RFC 2045
+	encoded := base64.StdEncoding.EncodeToString(data)
+	for len(encoded) > 76 {
+		att.Write([]byte(encoded[:76] + "\r\n"))
+		encoded = encoded[76:]
+	}
+	att.Write([]byte(encoded + "\r\n"))
+
+	if err := mw.Close(); err != nil {
+		return nil, err
+	}
+	return buf.Bytes(), nil
+}
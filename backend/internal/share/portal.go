@@ -0,0 +1,139 @@
+package share
+
+import (
+	"bytes"
+	"html/template"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+var pageTmpl = template.Must(template.New("share").Parse(`<!DOCTYPE html>
+<html lang="de">
+<head>
+<meta charset="utf-8">
+<meta name="viewport" content="width=device-width, initial-scale=1">
+<title>Dein Foto</title>
+<style>
+  body { margin: 0; background: #111; color: #eee; font-family: -apple-system, sans-serif; text-align: center; }
+  img { display: block; width: 100%; max-width: 800px; margin: 0 auto; }
+  .actions { padding: 16px; }
+  a.btn { display: block; margin: 10px auto; max-width: 400px; padding: 14px; border-radius: 8px;
+          background: #e91e63; color: #fff; text-decoration: none; font-size: 18px; }
+  a.btn.secondary { background: #333; }
+  p.hint { color: #888; font-size: 14px; padding: 0 16px; }
+</style>
+</head>
+<body>
+  <img src="/p/{{.Token}}/image?size={{if .Branded}}branded{{else}}preview{{end}}" alt="Foto">
+  <div class="actions">
+    <a class="btn" href="/p/{{.Token}}/image?download=1">Foto herunterladen</a>
+    {{if .Branded}}<a class="btn secondary" href="/p/{{.Token}}/image?size=original&download=1">Foto ohne Logo</a>
+    {{- else if .HasPreview}}<a class="btn secondary" href="/p/{{.Token}}/image?size=preview&download=1">Kleinere Version</a>{{end}}
+  </div>
+  <p class="hint">Tipp: Auf dem iPhone das Bild lange drücken und „Zu Fotos hinzufügen“ wählen.</p>
+</body>
+</html>
+`))
+
+// RegisterRoutes mounts the guest portal under /p/.
+//
+//	/p/<token>           mobile download page
+//	/p/<token>/image     the photo (?size=original|preview|branded, ?download=1)
+//	/p/<token>/qr.png    QR code pointing to the page
+func (m *Manager) RegisterRoutes(mux *http.ServeMux) {
+	mux.HandleFunc("/p/", m.handlePortal)
+}
+
+func (m *Manager) handlePortal(w http.ResponseWriter, r *http.Request) {
+	if !m.cfg.Enabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	rest := strings.Trim(strings.TrimPrefix(r.URL.Path, "/p/"), "/")
+	token, action, _ := strings.Cut(rest, "/")
+
+	link, ok := m.Lookup(token)
+	if !ok {
+		http.Error(w, "Dieser Link ist nicht mehr gültig.", http.StatusNotFound)
+		return
+	}
+
+	switch action {
+	case "":
+		w.Header().Set("Content-Type", "text/html; charset=utf-8")
+		pageTmpl.Execute(w, map[string]interface{}{
+			"Token":      link.Token,
+			"HasPreview": m.cfg.Download != "preview",
+			"Branded":    m.variant() == "branded",
+		})
+	case "image":
+		m.serveImage(w, r, link)
+	case "qr.png":
+		png, err := m.QRCode(link.Token, 256)
+		if err != nil {
+			http.Error(w, err.Error(), http.StatusInternalServerError)
+			return
+		}
+		w.Header().Set("Content-Type", "image/png")
+		w.Header().Set("Cache-Control", "public, max-age=86400")
+		w.Write(png)
+	default:
+		http.NotFound(w, r)
+	}
+}
+
+// variant is what guests get by default: the original, the preview or the
+// branded image, which needs an overlay.
+func (m *Manager) variant() string {
+	switch {
+	case m.cfg.Download == "preview":
+		return "preview"
+	case m.cfg.Download == "branded" && m.cfg.Overlay != "":
+		return "branded"
+	}
+	return "original"
+}
+
+func (m *Manager) serveImage(w http.ResponseWriter, r *http.Request, link *Link) {
+	variant := m.variant()
+	switch size := r.URL.Query().Get("size"); {
+	case size == "preview":
+		variant = "preview"
+	case size == "original" && variant != "preview":
+		variant = "original"
+	}
+
+	sub := "original"
+	if variant != "original" {
+		// The branded image is built from the preview, phones need no more
+		sub = "preview"
+	}
+	path := filepath.Join(m.basePath, link.Album, sub, link.Filename)
+	if _, err := os.Stat(path); err != nil && sub == "preview" {
+		// Preview not generated (yet) or removed to free space – fall back to
+		// the original
+		albumDir := filepath.Join(m.basePath, link.Album)
+		path = filepath.Join(albumDir, "original", link.Filename)
+		if os.IsNotExist(err) && m.OnMissingPreview != nil {
+			m.OnMissingPreview(albumDir, link.Filename)
+			w.Header().Set("Cache-Control", "no-store")
+		}
+	}
+
+	if r.URL.Query().Get("download") == "1" {
+		w.Header().Set("Content-Disposition", `attachment; filename="`+link.Filename+`"`)
+	}
+	if variant == "branded" {
+		data, mod, err := m.branded(path)
+		if err == nil {
+			http.ServeContent(w, r, link.Filename, mod, bytes.NewReader(data))
+			return
+		}
+		// A broken overlay must not keep guests from their photo
+		m.log.Warn("share", "Failed to brand %s, serving it plain: %v", link.Filename, err)
+	}
+	http.ServeFile(w, r, path)
+}
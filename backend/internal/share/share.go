@@ -0,0 +1,294 @@
+package share
+
+import (
+	"crypto/rand"
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"photobooth/internal/config"
+	"photobooth/internal/fsutil"
+	"photobooth/internal/logging"
+
+	qrcode "github.com/skip2/go-qrcode"
+)
+
+// tokenAlphabet avoids look-alike characters (0/O, 1/l/I) so tokens can be typed from a screen.
+const tokenAlphabet = "abcdefghijkmnpqrstuvwxyz23456789"
+
+const tokenLength = 10
+
+// Link maps a short share token to a photo inside an album.
+type Link struct {
+	Token    string    `json:"token"`
+	Album    string    `json:"album"`
+	Filename string    `json:"filename"`
+	Created  time.Time `json:"created"`
+
+	// SuspendedBy is the trash item holding the photo; the link does not
+	// resolve until the item is restored.
+	SuspendedBy string `json:"suspendedBy,omitempty"`
+}
+
+// Manager hands out share tokens and persists them so printed/scanned
+// QR codes keep working after a restart.
+type Manager struct {
+	// OnMissingPreview is called when a guest asks for a preview that is not
+	// there (any more), so it can be rebuilt; the original is served meanwhile.
+	OnMissingPreview func(albumDir, filename string)
+
+	mu       sync.Mutex
+	cfg      config.ShareConfig
+	baseUrl  string
+	basePath string
+	filePath string
+	links    map[string]*Link // token -> link
+	byPhoto  map[string]string
+	log      *logging.Logger
+
+	renderMu sync.Mutex // one branded image at a time, they are built on request
+}
+
+// NewManager loads existing tokens from <photosBase>/.share/links.json.
+func NewManager(cfg config.ShareConfig, wifi config.WifiConfig, photosBase string) *Manager {
+	baseUrl := strings.TrimRight(cfg.BaseUrl, "/")
+	if baseUrl == "" {
+		baseUrl = "http://" + wifi.IpAddress
+	}
+
+	m := &Manager{
+		cfg:      cfg,
+		baseUrl:  baseUrl,
+		basePath: photosBase,
+		filePath: filepath.Join(photosBase, ".share", "links.json"),
+		links:    make(map[string]*Link),
+		byPhoto:  make(map[string]string),
+		log:      logging.Get(),
+	}
+	m.load()
+	return m
+}
+
+// Enabled reports whether the share portal is switched on.
+func (m *Manager) Enabled() bool {
+	return m.cfg.Enabled
+}
+
+func (m *Manager) load() {
+	var links []*Link
+	if err := fsutil.ReadJSON(m.filePath, &links); err != nil {
+		m.log.Warn("share", "Failed to parse %s: %v", m.filePath, err)
+		return
+	}
+	for _, l := range links {
+		m.links[l.Token] = l
+		m.byPhoto[photoKey(l.Album, l.Filename)] = l.Token
+	}
+	if len(links) > 0 {
+		m.log.Info("share", "Loaded %d share links", len(links))
+	}
+}
+
+// save must be called with m.mu held.
+func (m *Manager) save() error {
+	links := make([]*Link, 0, len(m.links))
+	for _, l := range m.links {
+		links = append(links, l)
+	}
+	return fsutil.WriteJSON(m.filePath, links)
+}
+
+// Token returns the existing link for a photo or creates a new one.
+func (m *Manager) Token(album, filename string) (*Link, error) {
+	if filename == "" || filename != filepath.Base(filename) {
+		return nil, fmt.Errorf("invalid filename %q", filename)
+	}
+
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	key := photoKey(album, filename)
+	if token, ok := m.byPhoto[key]; ok && m.links[token].SuspendedBy == "" {
+		return m.links[token], nil
+	}
+	// A new photo of the same name as one in the trash gets a link of its own
+
+	var token string
+	for {
+		t, err := newToken()
+		if err != nil {
+			return nil, err
+		}
+		if _, taken := m.links[t]; !taken {
+			token = t
+			break
+		}
+	}
+
+	link := &Link{
+		Token:    token,
+		Album:    album,
+		Filename: filename,
+		Created:  time.Now(),
+	}
+	m.links[token] = link
+	m.byPhoto[key] = token
+
+	if err := m.save(); err != nil {
+		m.log.Error("share", "Failed to persist share links: %v", err)
+	}
+	return link, nil
+}
+
+// Lookup resolves a token to its link.
+func (m *Manager) Lookup(token string) (*Link, bool) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+	l, ok := m.links[token]
+	if !ok || l.SuspendedBy != "" {
+		return nil, false
+	}
+	return l, true
+}
+
+// Suspend disables the links of photos moved to the trash as item trashId, all
+// of the album if filenames is nil. Returns how many links were suspended.
+func (m *Manager) Suspend(album string, filenames []string, trashId string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	var only map[string]bool
+	if filenames != nil {
+		only = make(map[string]bool, len(filenames))
+		for _, f := range filenames {
+			only[f] = true
+		}
+	}
+	n := 0
+	for _, l := range m.links {
+		if l.Album != album || l.SuspendedBy != "" || (only != nil && !only[l.Filename]) {
+			continue
+		}
+		l.SuspendedBy = trashId
+		n++
+	}
+	if n == 0 {
+		return 0, nil
+	}
+	return n, m.save()
+}
+
+// Resume enables the links suspended for a trash item again once it was
+// restored. A link whose photo got a new one meanwhile is dropped.
+func (m *Manager) Resume(trashId string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	n, changed := 0, false
+	for token, l := range m.links {
+		if l.SuspendedBy != trashId {
+			continue
+		}
+		changed = true
+		key := photoKey(l.Album, l.Filename)
+		if current, ok := m.byPhoto[key]; ok && current != token {
+			delete(m.links, token)
+			continue
+		}
+		l.SuspendedBy = ""
+		m.byPhoto[key] = token
+		n++
+	}
+	if !changed {
+		return 0, nil
+	}
+	return n, m.save()
+}
+
+// RevokeAlbum invalidates every token belonging to an album and returns how many were removed.
+func (m *Manager) RevokeAlbum(album string) (int, error) {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	removed := 0
+	for token, l := range m.links {
+		if l.Album == album {
+			delete(m.links, token)
+			delete(m.byPhoto, photoKey(l.Album, l.Filename))
+			removed++
+		}
+	}
+	if removed == 0 {
+		return 0, nil
+	}
+	m.log.Info("share", "Revoked %d share links for album '%s'", removed, album)
+	return removed, m.save()
+}
+
+// MoveAlbum points all links of an album to its new id after a rename or merge,
+// so QR codes guests already scanned keep working.
+func (m *Manager) MoveAlbum(from, to string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	changed := false
+	for _, l := range m.links {
+		if l.Album != from {
+			continue
+		}
+		delete(m.byPhoto, photoKey(l.Album, l.Filename))
+		l.Album = to
+		m.byPhoto[photoKey(l.Album, l.Filename)] = l.Token
+		changed = true
+	}
+	if !changed {
+		return nil
+	}
+	return m.save()
+}
+
+// MovePhoto points the link of a photo to its new location.
+func (m *Manager) MovePhoto(fromAlbum, fromFile, toAlbum, toFile string) error {
+	m.mu.Lock()
+	defer m.mu.Unlock()
+
+	token, ok := m.byPhoto[photoKey(fromAlbum, fromFile)]
+	if !ok {
+		return nil
+	}
+	l := m.links[token]
+	delete(m.byPhoto, photoKey(fromAlbum, fromFile))
+	l.Album, l.Filename = toAlbum, toFile
+	m.byPhoto[photoKey(toAlbum, toFile)] = token
+	return m.save()
+}
+
+// URL returns the guest-facing URL for a token.
+func (m *Manager) URL(token string) string {
+	return m.baseUrl + "/p/" + token
+}
+
+// QRCode renders the share URL of a token as PNG.
+func (m *Manager) QRCode(token string, size int) ([]byte, error) {
+	if size <= 0 {
+		size = 256
+	}
+	return qrcode.Encode(m.URL(token), qrcode.Medium, size)
+}
+
+func photoKey(album, filename string) string {
+	return album + "/" + filename
+}
+
+func newToken() (string, error) {
+	buf := make([]byte, tokenLength)
+	if _, err := rand.Read(buf); err != nil {
+		return "", err
+	}
+	for i, b := range buf {
+		buf[i] = tokenAlphabet[int(b)%len(tokenAlphabet)]
+	}
+	return string(buf), nil
+}
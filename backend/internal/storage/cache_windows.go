@@ -0,0 +1,8 @@
+package storage
+
+import "os"
+
+func dropCache(f *os.File) error {
+	// Stub for Windows development: reads may still come from the cache
+	return nil
+}
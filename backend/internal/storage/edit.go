@@ -0,0 +1,257 @@
+package storage
+
+import (
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"photobooth/internal/logging"
+
+	"github.com/disintegration/imaging"
+)
+
+// Files returns the paths of every file belonging to a record, relative to the
+// album folder: original, preview, thumb and the attached RAW.
+func (r *Record) Files() []string {
+	files := []string{filepath.Join("original", r.Filename)}
+	if r.Preview != "" {
+		files = append(files, filepath.Join("preview", r.Preview))
+	}
+	if r.Thumb != "" {
+		files = append(files, filepath.Join("thumb", r.Thumb))
+	}
+	if r.Raw != "" {
+		files = append(files, filepath.Join("original", r.Raw))
+	}
+	return files
+}
+
+// SetHidden hides a photo from the guest gallery (or shows it again).
+func SetHidden(albumDir, filename string, hidden bool) (*Record, error) {
+	return updateRecord(albumDir, filename, func(rec *Record) { rec.Hidden = hidden })
+}
+
+// SetFavorite marks or unmarks a photo as favourite.
+func SetFavorite(albumDir, filename string, favorite bool) (*Record, error) {
+	return updateRecord(albumDir, filename, func(rec *Record) { rec.Favorite = favorite })
+}
+
+func updateRecord(albumDir, filename string, fn func(rec *Record)) (*Record, error) {
+	idx, err := OpenIndex(albumDir)
+	if err != nil {
+		return nil, err
+	}
+	var out Record
+	err = idx.Update(filename, func(rec *Record) error {
+		fn(rec)
+		out = *rec
+		return nil
+	})
+	if err != nil {
+		return nil, err
+	}
+	return &out, nil
+}
+
+// ErrNoJpegtran is returned when a JPEG should be rotated but jpegtran is not
+// installed: re-encoding would lose quality and the camera's EXIF data.
+var ErrNoJpegtran = errors.New("jpegtran is not installed (package libjpeg-turbo-progs), cannot rotate JPEGs losslessly")
+
+// RotateOriginal rotates the original of a photo clockwise by 90, 180 or 270 degrees.
+// JPEGs are rotated losslessly with jpegtran, keeping all metadata; PNGs are
+// decoded and re-encoded. Derivatives must be regenerated afterwards.
+func RotateOriginal(albumDir, filename string, degrees int) error {
+	if degrees != 90 && degrees != 180 && degrees != 270 {
+		return fmt.Errorf("invalid rotation %d, must be 90, 180 or 270", degrees)
+	}
+
+	idx, err := OpenIndex(albumDir)
+	if err != nil {
+		return err
+	}
+	rec, err := idx.Get(filename)
+	if err != nil {
+		return err
+	}
+	if rec == nil {
+		return os.ErrNotExist
+	}
+	if !rec.IsImage() {
+		return fmt.Errorf("cannot rotate %s files", rec.MediaType)
+	}
+
+	src := filepath.Join(albumDir, "original", filename)
+	tmp := filepath.Join(albumDir, "original", "."+filename+".rot")
+	defer os.Remove(tmp)
+
+	if rec.MediaType == MediaJPEG {
+		err = rotateJpegtran(src, tmp, degrees)
+	} else {
+		err = rotateImaging(src, tmp, degrees)
+	}
+	if err != nil {
+		return err
+	}
+	sum, err := FileChecksum(tmp)
+	if err != nil {
+		return err
+	}
+	if err := os.Rename(tmp, src); err != nil {
+		return err
+	}
+
+	// Bump the revision so clients do not keep showing a cached, unrotated image.
+	// The new content is intended, so it becomes the new reference checksum.
+	return idx.Update(filename, func(rec *Record) error {
+		rec.Revision++
+		rec.Checksum = sum
+		return nil
+	})
+}
+
+// rotateJpegtran performs a lossless rotation. -perfect makes jpegtran fail instead
+// of trimming edge blocks when the size is not a multiple of the MCU size; then
+// the partial blocks at the edge (a few pixels) are trimmed.
+func rotateJpegtran(src, dst string, degrees int) error {
+	if _, err := exec.LookPath("jpegtran"); err != nil {
+		return ErrNoJpegtran
+	}
+	rotate := func(edge string) error {
+		out, err := exec.Command("jpegtran",
+			"-copy", "all",
+			edge,
+			"-rotate", fmt.Sprintf("%d", degrees),
+			"-outfile", dst,
+			src).CombinedOutput()
+		if err != nil {
+			return fmt.Errorf("jpegtran: %v: %s", err, strings.TrimSpace(string(out)))
+		}
+		return nil
+	}
+	if err := rotate("-perfect"); err == nil {
+		return nil
+	}
+	logging.Get().Info("storage", "%s cannot be rotated without trimming, cutting off the partial edge blocks", filepath.Base(src))
+	return rotate("-trim")
+}
+
+func rotateImaging(src, dst string, degrees int) error {
+	img, err := imaging.Open(src, imaging.AutoOrientation(true))
+	if err != nil {
+		return err
+	}
+	// imaging rotates counter-clockwise
+	switch degrees {
+	case 90:
+		img = imaging.Rotate270(img)
+	case 180:
+		img = imaging.Rotate180(img)
+	case 270:
+		img = imaging.Rotate90(img)
+	}
+	format, err := imaging.FormatFromFilename(src)
+	if err != nil {
+		return err
+	}
+	f, err := os.Create(dst)
+	if err != nil {
+		return err
+	}
+	if err := imaging.Encode(f, img, format, imaging.JPEGQuality(95)); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Sync(); err != nil {
+		f.Close()
+		return err
+	}
+	return f.Close()
+}
+
+// MovePhoto moves a photo with all its files from one album to another and
+// carries its index record over. If the name is taken in the target album a
+// numeric suffix is added; the new record is returned.
+func MovePhoto(srcDir, dstDir, filename string) (*Record, error) {
+	src, err := OpenIndex(srcDir)
+	if err != nil {
+		return nil, err
+	}
+	dst, err := OpenIndex(dstDir)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := src.Get(filename)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, os.ErrNotExist
+	}
+
+	moved := *rec
+	ext := filepath.Ext(rec.Filename)
+	base := strings.TrimSuffix(rec.Filename, ext)
+	for n := 1; ; n++ {
+		if !anyExists(dstDir, moved.Files()) {
+			break
+		}
+		newBase := fmt.Sprintf("%s_%d", base, n)
+		moved.Filename = newBase + ext
+		if rec.Preview != "" {
+			moved.Preview = moved.Filename
+		}
+		if rec.Thumb != "" {
+			moved.Thumb = moved.Filename
+		}
+		if rec.Raw != "" {
+			moved.Raw = newBase + filepath.Ext(rec.Raw)
+		}
+	}
+
+	from, to := rec.Files(), moved.Files()
+	for i := range from {
+		if err := os.MkdirAll(filepath.Dir(filepath.Join(dstDir, to[i])), 0755); err != nil {
+			return nil, err
+		}
+		if err := os.Rename(filepath.Join(srcDir, from[i]), filepath.Join(dstDir, to[i])); err != nil && !os.IsNotExist(err) {
+			// Put back what was already moved so the photo stays complete
+			for j := 0; j < i; j++ {
+				os.Rename(filepath.Join(dstDir, to[j]), filepath.Join(srcDir, from[j]))
+			}
+			return nil, err
+		}
+	}
+
+	if err := dst.Put(&moved); err != nil {
+		return nil, err
+	}
+	if err := src.Delete(filename); err != nil {
+		return nil, err
+	}
+	return &moved, nil
+}
+
+// MovedFile maps a file of a photo, relative to the album folder with slashes
+// (e.g. "original/IMG_0001.CR2"), to its path after MovePhoto renamed the photo
+// from filename to newName. ok is false for files of other photos.
+func MovedFile(file, filename, newName string) (string, bool) {
+	dir, name := path.Split(file)
+	stem := strings.TrimSuffix(name, path.Ext(name))
+	if stem != strings.TrimSuffix(filename, filepath.Ext(filename)) {
+		return "", false
+	}
+	return dir + strings.TrimSuffix(newName, filepath.Ext(newName)) + path.Ext(name), true
+}
+
+func anyExists(dir string, files []string) bool {
+	for _, f := range files {
+		if _, err := os.Stat(filepath.Join(dir, f)); err == nil {
+			return true
+		}
+	}
+	return false
+}
@@ -0,0 +1,403 @@
+package storage
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	bolt "go.etcd.io/bbolt"
+)
+
+// indexFile lives inside each album folder next to original/, preview/ and thumb/.
+const indexFile = ".index.db"
+
+var photosBucket = []byte("photos")
+
+// Media types of index records.
+const (
+	MediaJPEG = "jpeg"
+	MediaPNG  = "png"
+	MediaRAW  = "raw" // RAW file without a matching JPEG
+)
+
+var rawExtensions = []string{".arw", ".cr2", ".cr3", ".nef", ".dng", ".raf", ".orf", ".rw2"}
+
+// Record describes one photo of an album. The key is the filename in original/.
+type Record struct {
+	Filename    string            `json:"filename"`
+	MediaType   string            `json:"mediaType"`
+	Size        int64             `json:"size"`
+	Preview     string            `json:"preview,omitempty"`
+	PreviewSize int64             `json:"previewSize,omitempty"`
+	Thumb       string            `json:"thumb,omitempty"`
+	ThumbSize   int64             `json:"thumbSize,omitempty"`
+	Raw         string            `json:"raw,omitempty"`
+	RawSize     int64             `json:"rawSize,omitempty"`
+	CapturedAt  time.Time         `json:"capturedAt"`
+	Hidden      bool              `json:"hidden,omitempty"`
+	Favorite    bool              `json:"favorite,omitempty"`
+	Revision    int               `json:"revision,omitempty"`    // bumped when the image content changes (rotation)
+	Checksum    string            `json:"checksum,omitempty"`    // SHA-256 of the original, taken at capture
+	RawChecksum string            `json:"rawChecksum,omitempty"` // SHA-256 of the attached RAW
+	Metadata    map[string]string `json:"metadata,omitempty"`
+}
+
+// IsImage reports whether the record is a displayable photo (not a lone RAW).
+func (r *Record) IsImage() bool {
+	return r.MediaType == MediaJPEG || r.MediaType == MediaPNG
+}
+
+// TotalSize is the disk usage of the photo including all derivatives.
+func (r *Record) TotalSize() int64 {
+	return r.Size + r.PreviewSize + r.ThumbSize + r.RawSize
+}
+
+// Index is the persistent per-album photo index. It replaces directory scans for
+// listing, counting and size calculations.
+type Index struct {
+	dir string
+	db  *bolt.DB
+}
+
+var (
+	indexesMu sync.Mutex
+	indexes   = make(map[string]*Index)
+)
+
+// OpenIndex returns the (cached) index of an album directory, creating it if needed.
+func OpenIndex(albumDir string) (*Index, error) {
+	albumDir = filepath.Clean(albumDir)
+
+	indexesMu.Lock()
+	defer indexesMu.Unlock()
+
+	if idx, ok := indexes[albumDir]; ok {
+		return idx, nil
+	}
+	if err := os.MkdirAll(albumDir, 0755); err != nil {
+		return nil, err
+	}
+
+	db, err := bolt.Open(filepath.Join(albumDir, indexFile), 0644, &bolt.Options{Timeout: 2 * time.Second})
+	if err != nil {
+		return nil, fmt.Errorf("open index %s: %w", albumDir, err)
+	}
+	err = db.Update(func(tx *bolt.Tx) error {
+		_, err := tx.CreateBucketIfNotExists(photosBucket)
+		return err
+	})
+	if err != nil {
+		db.Close()
+		return nil, err
+	}
+
+	idx := &Index{dir: albumDir, db: db}
+	indexes[albumDir] = idx
+	return idx, nil
+}
+
+// CloseIndex closes the index of an album so its folder can be moved or deleted.
+func CloseIndex(albumDir string) {
+	albumDir = filepath.Clean(albumDir)
+
+	indexesMu.Lock()
+	defer indexesMu.Unlock()
+
+	if idx, ok := indexes[albumDir]; ok {
+		idx.db.Close()
+		delete(indexes, albumDir)
+	}
+}
+
+// CloseAllIndexes is called on shutdown.
+func CloseAllIndexes() {
+	indexesMu.Lock()
+	defer indexesMu.Unlock()
+	for dir, idx := range indexes {
+		idx.db.Close()
+		delete(indexes, dir)
+	}
+}
+
+// Get returns the record for a filename in original/.
+func (x *Index) Get(filename string) (*Record, error) {
+	var rec *Record
+	err := x.db.View(func(tx *bolt.Tx) error {
+		data := tx.Bucket(photosBucket).Get([]byte(filename))
+		if data == nil {
+			return nil
+		}
+		rec = &Record{}
+		return json.Unmarshal(data, rec)
+	})
+	return rec, err
+}
+
+// Put inserts or replaces a record.
+func (x *Index) Put(rec *Record) error {
+	data, err := json.Marshal(rec)
+	if err != nil {
+		return err
+	}
+	return x.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(photosBucket).Put([]byte(rec.Filename), data)
+	})
+}
+
+// Update applies fn to an existing record and stores the result.
+func (x *Index) Update(filename string, fn func(rec *Record) error) error {
+	return x.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(photosBucket)
+		data := b.Get([]byte(filename))
+		if data == nil {
+			return os.ErrNotExist
+		}
+		var rec Record
+		if err := json.Unmarshal(data, &rec); err != nil {
+			return err
+		}
+		if err := fn(&rec); err != nil {
+			return err
+		}
+		out, err := json.Marshal(&rec)
+		if err != nil {
+			return err
+		}
+		return b.Put([]byte(filename), out)
+	})
+}
+
+// Delete removes a record.
+func (x *Index) Delete(filename string) error {
+	return x.db.Update(func(tx *bolt.Tx) error {
+		return tx.Bucket(photosBucket).Delete([]byte(filename))
+	})
+}
+
+// All returns every record, ordered by filename.
+func (x *Index) All() ([]Record, error) {
+	var recs []Record
+	err := x.db.View(func(tx *bolt.Tx) error {
+		return tx.Bucket(photosBucket).ForEach(func(k, v []byte) error {
+			var rec Record
+			if err := json.Unmarshal(v, &rec); err != nil {
+				return nil // skip corrupt entries, Reconcile will rebuild them
+			}
+			recs = append(recs, rec)
+			return nil
+		})
+	})
+	return recs, err
+}
+
+// Stats returns the number of images and the total size of all files.
+func (x *Index) Stats() (count int, size int64, err error) {
+	recs, err := x.All()
+	if err != nil {
+		return 0, 0, err
+	}
+	for i := range recs {
+		if recs[i].IsImage() {
+			count++
+		}
+		size += recs[i].TotalSize()
+	}
+	return count, size, nil
+}
+
+// Refresh re-reads sizes and derivatives of a single photo from disk and stores it.
+// Flags and metadata of an existing record are kept.
+func (x *Index) Refresh(filename string) (*Record, error) {
+	info, err := os.Stat(filepath.Join(x.dir, "original", filename))
+	if err != nil {
+		x.Delete(filename)
+		return nil, err
+	}
+
+	rec, err := x.Get(filename)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		rec = &Record{Filename: filename, CapturedAt: info.ModTime()}
+	}
+	x.fill(rec, info)
+	x.checksum(rec)
+	return rec, x.Put(rec)
+}
+
+// checksum fills missing checksums. Existing ones are never overwritten here: they
+// are the reference that VerifyAlbum compares the files against.
+func (x *Index) checksum(rec *Record) {
+	if rec.Checksum == "" {
+		if sum, err := FileChecksum(filepath.Join(x.dir, "original", rec.Filename)); err == nil {
+			rec.Checksum = sum
+		}
+	}
+	if rec.Raw != "" && rec.RawChecksum == "" {
+		if sum, err := FileChecksum(filepath.Join(x.dir, "original", rec.Raw)); err == nil {
+			rec.RawChecksum = sum
+		}
+	}
+}
+
+// fill updates the disk-derived fields of a record.
+func (x *Index) fill(rec *Record, info os.FileInfo) {
+	rec.MediaType = mediaType(rec.Filename)
+	rec.Size = info.Size()
+
+	rec.Preview, rec.PreviewSize = "", 0
+	if fi, err := os.Stat(filepath.Join(x.dir, "preview", rec.Filename)); err == nil {
+		rec.Preview, rec.PreviewSize = rec.Filename, fi.Size()
+	}
+	rec.Thumb, rec.ThumbSize = "", 0
+	if fi, err := os.Stat(filepath.Join(x.dir, "thumb", rec.Filename)); err == nil {
+		rec.Thumb, rec.ThumbSize = rec.Filename, fi.Size()
+	}
+	if rec.Raw != "" {
+		if fi, err := os.Stat(filepath.Join(x.dir, "original", rec.Raw)); err == nil {
+			rec.RawSize = fi.Size()
+		} else {
+			rec.Raw, rec.RawSize, rec.RawChecksum = "", 0, ""
+		}
+	}
+}
+
+// Reconcile brings the index in line with the files on disk: new files are added,
+// records of missing files are dropped and sizes/derivatives are refreshed.
+// RAW files with the same base name as a JPEG are attached to that JPEG.
+func (x *Index) Reconcile() (added, removed int, err error) {
+	entries, err := os.ReadDir(filepath.Join(x.dir, "original"))
+	if err != nil && !os.IsNotExist(err) {
+		return 0, 0, err
+	}
+
+	files := make(map[string]os.FileInfo)
+	for _, e := range entries {
+		if e.IsDir() || strings.HasPrefix(e.Name(), ".") {
+			continue
+		}
+		if mediaType(e.Name()) == "" {
+			continue
+		}
+		if info, err := e.Info(); err == nil {
+			files[e.Name()] = info
+		}
+	}
+
+	existing, err := x.All()
+	if err != nil {
+		return 0, 0, err
+	}
+	known := make(map[string]*Record, len(existing))
+	attachedRaws := make(map[string]bool)
+	for i := range existing {
+		known[existing[i].Filename] = &existing[i]
+		if _, onDisk := files[existing[i].Filename]; onDisk && existing[i].Raw != "" {
+			attachedRaws[existing[i].Raw] = true
+		}
+	}
+
+	// Match RAWs to JPEGs by base name (IMG_1234.CR2 <-> IMG_1234.JPG)
+	imagesByBase := make(map[string]string)
+	for name := range files {
+		if t := mediaType(name); t == MediaJPEG || t == MediaPNG {
+			imagesByBase[strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))] = name
+		}
+	}
+	rawOf := make(map[string]string) // image -> raw
+	for name := range files {
+		if mediaType(name) != MediaRAW || attachedRaws[name] {
+			continue
+		}
+		if img, ok := imagesByBase[strings.ToLower(strings.TrimSuffix(name, filepath.Ext(name)))]; ok {
+			rawOf[img] = name
+			attachedRaws[name] = true
+		}
+	}
+
+	err = x.db.Update(func(tx *bolt.Tx) error {
+		b := tx.Bucket(photosBucket)
+
+		// Drop records whose original is gone or whose RAW now belongs to a JPEG
+		for name := range known {
+			_, onDisk := files[name]
+			if !onDisk || (known[name].MediaType == MediaRAW && attachedRaws[name]) {
+				if err := b.Delete([]byte(name)); err != nil {
+					return err
+				}
+				delete(known, name)
+				removed++
+			}
+		}
+
+		for name, info := range files {
+			if mediaType(name) == MediaRAW && attachedRaws[name] {
+				continue
+			}
+			rec, ok := known[name]
+			if !ok {
+				rec = &Record{Filename: name, CapturedAt: info.ModTime()}
+				added++
+			}
+			if raw, ok := rawOf[name]; ok {
+				rec.Raw = raw
+			}
+			x.fill(rec, info)
+
+			data, err := json.Marshal(rec)
+			if err != nil {
+				return err
+			}
+			if err := b.Put([]byte(name), data); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+	return added, removed, err
+}
+
+// Clear removes every record (e.g. after the album was emptied).
+func (x *Index) Clear() error {
+	return x.db.Update(func(tx *bolt.Tx) error {
+		if err := tx.DeleteBucket(photosBucket); err != nil {
+			return err
+		}
+		_, err := tx.CreateBucket(photosBucket)
+		return err
+	})
+}
+
+// sortNewestFirst orders records by capture time, newest first.
+func sortNewestFirst(recs []Record) {
+	sort.Slice(recs, func(i, j int) bool {
+		return recs[i].CapturedAt.After(recs[j].CapturedAt)
+	})
+}
+
+func mediaType(name string) string {
+	ext := strings.ToLower(filepath.Ext(name))
+	switch ext {
+	case ".jpg", ".jpeg":
+		return MediaJPEG
+	case ".png":
+		return MediaPNG
+	}
+	for _, r := range rawExtensions {
+		if ext == r {
+			return MediaRAW
+		}
+	}
+	return ""
+}
+
+// MediaTypeOf returns the media type for a filename, or "" if it is not a supported photo.
+func MediaTypeOf(name string) string {
+	return mediaType(name)
+}
@@ -0,0 +1,44 @@
+package storage
+
+import (
+	"path/filepath"
+	"time"
+
+	"photobooth/internal/fsutil"
+)
+
+// manifestFile holds album metadata. It is a plain file inside the album folder
+// so it is copied along with exports and syncs.
+const manifestFile = "album.json"
+
+// Manifest is the per-album metadata edited on the dashboard.
+type Manifest struct {
+	EventDate string    `json:"eventDate,omitempty"` // YYYY-MM-DD
+	Customer  string    `json:"customer,omitempty"`
+	Notes     string    `json:"notes,omitempty"`
+	Cover     string    `json:"cover,omitempty"` // filename in original/
+	UpdatedAt time.Time `json:"updatedAt,omitempty"`
+
+	// Integrity is the result of the last VerifyAlbum run; it is not editable.
+	Integrity *VerifyReport `json:"integrity,omitempty"`
+}
+
+// ManifestPath returns the location of an album's manifest.
+func ManifestPath(albumDir string) string {
+	return filepath.Join(albumDir, manifestFile)
+}
+
+// ReadManifest loads an album's manifest. A missing file yields an empty manifest.
+func ReadManifest(albumDir string) (*Manifest, error) {
+	m := &Manifest{}
+	if err := fsutil.ReadJSON(ManifestPath(albumDir), m); err != nil {
+		return nil, err
+	}
+	return m, nil
+}
+
+// WriteManifest stores an album's manifest.
+func WriteManifest(albumDir string, m *Manifest) error {
+	m.UpdatedAt = time.Now()
+	return fsutil.WriteJSON(ManifestPath(albumDir), m)
+}
@@ -1,10 +1,9 @@
 package storage
 
 import (
+	"fmt"
 	"os"
 	"path/filepath"
-	"sort"
-	"strings"
 	"time"
 )
 
@@ -13,6 +12,12 @@ type Photo struct {
 	Timestamp time.Time `json:"timestamp"`
 	Url       string    `json:"url"` // Preview URL
 	ThumbUrl  string    `json:"thumbUrl"`
+	ShareUrl  string    `json:"shareUrl,omitempty"` // Guest download page
+	QrUrl     string    `json:"qrUrl,omitempty"`    // QR code PNG for ShareUrl
+	MediaType string    `json:"mediaType,omitempty"`
+	HasRaw    bool      `json:"hasRaw,omitempty"`
+	Favorite  bool      `json:"favorite,omitempty"`
+	Hidden    bool      `json:"hidden,omitempty"`
 }
 
 type Manager struct {
@@ -35,40 +40,88 @@ func (m *Manager) EnsureDirs() {
 	}
 }
 
+// Index returns the photo index of the current album.
+func (m *Manager) Index() (*Index, error) {
+	return OpenIndex(m.rootDir)
+}
+
+// List returns the photos of the current album shown in the guest gallery, newest first.
+// Hidden photos are left out.
 func (m *Manager) List() ([]Photo, error) {
-	dir := filepath.Join(m.rootDir, "original")
-	entries, err := os.ReadDir(dir)
+	idx, err := m.Index()
+	if err != nil {
+		return nil, err
+	}
+	recs, err := idx.All()
 	if err != nil {
 		return nil, err
 	}
+	sortNewestFirst(recs)
 
-	var photos []Photo
-	for _, e := range entries {
-		if !e.IsDir() && isImage(e.Name()) {
-			info, err := e.Info()
-			if err != nil {
-				continue
-			}
-			photos = append(photos, Photo{
-				Filename:  e.Name(),
-				Timestamp: info.ModTime(),
-				Url:       "/photos/preview/" + e.Name(),
-				ThumbUrl:  "/photos/thumb/" + e.Name(),
-			})
+	photos := []Photo{}
+	for i := range recs {
+		if recs[i].IsImage() && !recs[i].Hidden {
+			photos = append(photos, recs[i].Photo())
 		}
 	}
+	return photos, nil
+}
+
+// AddPhoto records a new capture (and its derivatives) in the album's index.
+func AddPhoto(albumDir, filename string) (*Record, error) {
+	idx, err := OpenIndex(albumDir)
+	if err != nil {
+		return nil, err
+	}
+	return idx.Refresh(filename)
+}
 
-	// Sort newest first
-	sort.Slice(photos, func(i, j int) bool {
-		return photos[i].Timestamp.After(photos[j].Timestamp)
-	})
+// AttachRaw links a RAW file in original/ to its JPEG.
+func AttachRaw(albumDir, filename, rawName string) error {
+	idx, err := OpenIndex(albumDir)
+	if err != nil {
+		return err
+	}
+	// The RAW may have been indexed on its own by an earlier reconcile
+	idx.Delete(rawName)
+	if err := idx.Update(filename, func(rec *Record) error {
+		rec.Raw = rawName
+		return nil
+	}); err != nil {
+		return err
+	}
+	_, err = idx.Refresh(filename)
+	return err
+}
 
-	return photos, nil
+// Photo converts an index record to the API representation.
+func (r *Record) Photo() Photo {
+	suffix := ""
+	if r.Revision > 0 {
+		suffix = fmt.Sprintf("?v=%d", r.Revision)
+	}
+	return Photo{
+		Filename:  r.Filename,
+		Timestamp: r.CapturedAt,
+		Url:       "/photos/preview/" + r.Filename + suffix,
+		ThumbUrl:  "/photos/thumb/" + r.Filename + suffix,
+		MediaType: r.MediaType,
+		HasRaw:    r.Raw != "",
+		Favorite:  r.Favorite,
+		Hidden:    r.Hidden,
+	}
 }
 
-func isImage(name string) bool {
-	ext := strings.ToLower(filepath.Ext(name))
-	return ext == ".jpg" || ext == ".jpeg" || ext == ".png"
+// AlbumStats returns the number of photos and total size of an album from its index.
+func AlbumStats(albumDir string) (int, int64, error) {
+	if _, err := os.Stat(albumDir); os.IsNotExist(err) {
+		return 0, 0, nil
+	}
+	idx, err := OpenIndex(albumDir)
+	if err != nil {
+		return 0, 0, err
+	}
+	return idx.Stats()
 }
 
 func (m *Manager) GetLatest() *Photo {
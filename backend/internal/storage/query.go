@@ -0,0 +1,144 @@
+package storage
+
+import (
+	"encoding/base64"
+	"fmt"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// ListOptions filters and pages a photo listing. Zero values mean "no filter".
+type ListOptions struct {
+	Limit     int       // page size, 0 = everything
+	Cursor    string    // NextCursor of the previous page
+	Since     time.Time // only photos captured after this instant (incremental updates)
+	Oldest    bool      // sort oldest first instead of newest first
+	Favorite  *bool
+	Hidden    *bool // nil: only photos shown to guests, unless AllHidden
+	AllHidden bool  // hidden and shown photos alike
+	HasRaw    *bool
+	MediaType string // "jpeg", "png" or "raw"; empty = all images
+}
+
+// ListResult is one page of a listing.
+type ListResult struct {
+	Photos     []Photo `json:"photos"`
+	Total      int     `json:"total"`   // all images in the album
+	Matched    int     `json:"matched"` // images matching the filters (across all pages)
+	NextCursor string  `json:"nextCursor,omitempty"`
+}
+
+// Query returns a filtered, sorted page of the index.
+func (x *Index) Query(opts ListOptions) (ListResult, error) {
+	recs, err := x.All()
+	if err != nil {
+		return ListResult{}, err
+	}
+
+	res := ListResult{Photos: []Photo{}}
+	matched := make([]Record, 0, len(recs))
+	for i := range recs {
+		r := &recs[i]
+		if r.IsImage() {
+			res.Total++
+		}
+		if opts.matches(r) {
+			matched = append(matched, *r)
+		}
+	}
+	res.Matched = len(matched)
+
+	sort.Slice(matched, func(i, j int) bool {
+		if opts.Oldest {
+			return recordBefore(&matched[i], &matched[j])
+		}
+		return recordBefore(&matched[j], &matched[i])
+	})
+
+	// Skip everything up to and including the cursor position
+	start := 0
+	if opts.Cursor != "" {
+		ts, name, err := decodeCursor(opts.Cursor)
+		if err != nil {
+			return ListResult{}, err
+		}
+		cur := &Record{Filename: name, CapturedAt: ts}
+		start = sort.Search(len(matched), func(i int) bool {
+			if opts.Oldest {
+				return recordBefore(cur, &matched[i])
+			}
+			return recordBefore(&matched[i], cur)
+		})
+	}
+
+	end := len(matched)
+	if opts.Limit > 0 && start+opts.Limit < end {
+		end = start + opts.Limit
+		res.NextCursor = encodeCursor(&matched[end-1])
+	}
+
+	for i := start; i < end; i++ {
+		res.Photos = append(res.Photos, matched[i].Photo())
+	}
+	return res, nil
+}
+
+func (o *ListOptions) matches(r *Record) bool {
+	if o.MediaType != "" {
+		if r.MediaType != o.MediaType {
+			return false
+		}
+	} else if !r.IsImage() {
+		return false
+	}
+	if !o.Since.IsZero() && !r.CapturedAt.After(o.Since) {
+		return false
+	}
+	if o.Favorite != nil && r.Favorite != *o.Favorite {
+		return false
+	}
+	switch {
+	case o.Hidden != nil:
+		if r.Hidden != *o.Hidden {
+			return false
+		}
+	case !o.AllHidden && r.Hidden:
+		return false
+	}
+	if o.HasRaw != nil && (r.Raw != "") != *o.HasRaw {
+		return false
+	}
+	return true
+}
+
+// recordBefore orders by capture time, then filename, so the order is total
+// and cursors stay stable even for photos taken in the same second.
+func recordBefore(a, b *Record) bool {
+	if !a.CapturedAt.Equal(b.CapturedAt) {
+		return a.CapturedAt.Before(b.CapturedAt)
+	}
+	return a.Filename < b.Filename
+}
+
+func encodeCursor(r *Record) string {
+	raw := strconv.FormatInt(r.CapturedAt.UnixNano(), 10) + "|" + r.Filename
+	return base64.RawURLEncoding.EncodeToString([]byte(raw))
+}
+
+func decodeCursor(c string) (time.Time, string, error) {
+	raw, err := base64.RawURLEncoding.DecodeString(c)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid cursor")
+	}
+	ts, name, ok := strings.Cut(string(raw), "|")
+	if !ok {
+		return time.Time{}, "", fmt.Errorf("invalid cursor")
+	}
+	nanos, err := strconv.ParseInt(ts, 10, 64)
+	if err != nil {
+		return time.Time{}, "", fmt.Errorf("invalid cursor")
+	}
+	return time.Unix(0, nanos), name, nil
+}
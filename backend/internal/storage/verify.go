@@ -0,0 +1,280 @@
+package storage
+
+import (
+	"context"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"image"
+	"io"
+	"os"
+	"path/filepath"
+	"time"
+
+	_ "image/jpeg"
+	_ "image/png"
+
+	"photobooth/internal/logging"
+)
+
+// Problems reported by VerifyAlbum and VerifyCopy.
+const (
+	ProblemMissing     = "missing"
+	ProblemChanged     = "changed"     // content differs from the checksum taken at capture
+	ProblemUnreadable  = "unreadable"  // I/O error while reading
+	ProblemUndecodable = "undecodable" // readable, but not a valid image (e.g. truncated JPEG)
+)
+
+// VerifyIssue is one file that failed verification.
+type VerifyIssue struct {
+	File    string `json:"file"`
+	Problem string `json:"problem"`
+	Detail  string `json:"detail,omitempty"`
+}
+
+// VerifyReport is the result of an integrity check. It is stored in the album
+// manifest so the state of an album is known at delivery.
+type VerifyReport struct {
+	CheckedAt time.Time     `json:"checkedAt"`
+	Files     int           `json:"files"`
+	OK        int           `json:"ok"`
+	Baselined int           `json:"baselined,omitempty"` // files that had no checksum yet and got one now
+	Issues    []VerifyIssue `json:"issues,omitempty"`
+}
+
+// VerifyProgressFunc reports the number of checked files.
+type VerifyProgressFunc func(checked, total int)
+
+func (r *VerifyReport) add(file, problem string, err error) {
+	issue := VerifyIssue{File: file, Problem: problem}
+	if err != nil {
+		issue.Detail = err.Error()
+	}
+	r.Issues = append(r.Issues, issue)
+}
+
+// FileChecksum returns the hex SHA-256 of a file.
+func FileChecksum(path string) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+	h := sha256.New()
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), nil
+}
+
+// VerifyAlbum rechecks every original (and attached RAW) of an album against the
+// checksums taken at capture. JPEGs and PNGs are also fully decoded, which catches
+// files that were already broken when they were written. Files without a checksum
+// (captured before checksums existed, or imported) get one and count as baselined.
+func VerifyAlbum(ctx context.Context, albumDir string, onProgress VerifyProgressFunc) (*VerifyReport, error) {
+	idx, err := OpenIndex(albumDir)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := idx.All()
+	if err != nil {
+		return nil, err
+	}
+
+	total := 0
+	for i := range recs {
+		total++
+		if recs[i].Raw != "" {
+			total++
+		}
+	}
+
+	report := &VerifyReport{CheckedAt: time.Now()}
+	check := func(name, want string, decode bool) string {
+		report.Files++
+		sum, err := readAndHash(filepath.Join(albumDir, "original", name), decode)
+		switch {
+		case os.IsNotExist(err):
+			report.add(name, ProblemMissing, nil)
+		case sum == "":
+			report.add(name, ProblemUnreadable, err)
+		case want != "" && sum != want:
+			report.add(name, ProblemChanged, err)
+		case err != nil:
+			report.add(name, ProblemUndecodable, err)
+		default:
+			report.OK++
+		}
+		if onProgress != nil {
+			onProgress(report.Files, total)
+		}
+		if want == "" && sum != "" {
+			report.Baselined++
+			return sum
+		}
+		return ""
+	}
+
+	for i := range recs {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		rec := &recs[i]
+		sum := check(rec.Filename, rec.Checksum, rec.IsImage())
+		rawSum := ""
+		if rec.Raw != "" {
+			rawSum = check(rec.Raw, rec.RawChecksum, false)
+		}
+		if sum != "" || rawSum != "" {
+			idx.Update(rec.Filename, func(r *Record) error {
+				if sum != "" && r.Checksum == "" {
+					r.Checksum = sum
+				}
+				if rawSum != "" && r.RawChecksum == "" && r.Raw == rec.Raw {
+					r.RawChecksum = rawSum
+				}
+				return nil
+			})
+		}
+	}
+	return report, nil
+}
+
+// Checksums returns the capture checksums of an album's originals and RAWs by
+// file name. Files without a checksum are left out.
+func Checksums(albumDir string) (map[string]string, error) {
+	idx, err := OpenIndex(albumDir)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := idx.All()
+	if err != nil {
+		return nil, err
+	}
+	sums := make(map[string]string, len(recs))
+	for i := range recs {
+		if recs[i].Checksum != "" {
+			sums[recs[i].Filename] = recs[i].Checksum
+		}
+		if recs[i].Raw != "" && recs[i].RawChecksum != "" {
+			sums[recs[i].Raw] = recs[i].RawChecksum
+		}
+	}
+	return sums, nil
+}
+
+// VerifyCopy compares a copy of an album's original/ folder (e.g. on a USB stick)
+// with the album. Every file is synced to the device and dropped from the page
+// cache before it is read back, so write errors surface here instead of on the
+// customer's computer. Only the originals and RAWs in names are checked, each at
+// the path (relative to copyDir, forward slashes) it maps to; nil checks all under
+// their own name. Files in known were already checked by the caller and count as
+// OK without being read again.
+func VerifyCopy(ctx context.Context, albumDir, copyDir string, names map[string]string, known map[string]bool, onProgress VerifyProgressFunc) (*VerifyReport, error) {
+	idx, err := OpenIndex(albumDir)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := idx.All()
+	if err != nil {
+		return nil, err
+	}
+
+	type file struct{ name, want, dst string }
+	var files []file
+	add := func(name, want string) {
+		if names == nil {
+			files = append(files, file{name, want, name})
+		} else if dst, ok := names[name]; ok {
+			files = append(files, file{name, want, dst})
+		}
+	}
+	for i := range recs {
+		add(recs[i].Filename, recs[i].Checksum)
+		if recs[i].Raw != "" {
+			add(recs[i].Raw, recs[i].RawChecksum)
+		}
+	}
+
+	report := &VerifyReport{CheckedAt: time.Now()}
+	for i, f := range files {
+		if err := ctx.Err(); err != nil {
+			return report, err
+		}
+		report.Files++
+		if known[f.name] {
+			report.OK++
+			if onProgress != nil {
+				onProgress(i+1, len(files))
+			}
+			continue
+		}
+		want := f.want
+		if want == "" {
+			// No checksum from capture: the album's file is the reference
+			if want, err = FileChecksum(filepath.Join(albumDir, "original", f.name)); err != nil {
+				want = ""
+			}
+		}
+
+		dst := filepath.Join(copyDir, filepath.FromSlash(f.dst))
+		if err := syncFile(dst); err != nil && !os.IsNotExist(err) {
+			report.add(f.name, ProblemUnreadable, err)
+		} else if sum, err := FileChecksum(dst); os.IsNotExist(err) {
+			report.add(f.name, ProblemMissing, nil)
+		} else if err != nil {
+			report.add(f.name, ProblemUnreadable, err)
+		} else if want != "" && sum != want {
+			report.add(f.name, ProblemChanged, nil)
+		} else {
+			report.OK++
+		}
+		if onProgress != nil {
+			onProgress(i+1, len(files))
+		}
+	}
+	return report, nil
+}
+
+// readAndHash hashes a file and, if decode is set, decodes it as an image in the
+// same pass. The checksum is returned whenever the file could be read completely;
+// a decode failure is then returned as the error.
+func readAndHash(path string, decode bool) (string, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return "", err
+	}
+	defer f.Close()
+
+	h := sha256.New()
+	r := io.TeeReader(f, h)
+	var decodeErr error
+	if decode {
+		if _, _, err := image.Decode(r); err != nil {
+			decodeErr = fmt.Errorf("decode: %w", err)
+		}
+	}
+	// The decoder stops at the end of the image data; hash whatever follows
+	if _, err := io.Copy(h, f); err != nil {
+		return "", err
+	}
+	return hex.EncodeToString(h.Sum(nil)), decodeErr
+}
+
+func syncFile(path string) error {
+	f, err := os.OpenFile(path, os.O_RDWR, 0)
+	if err != nil {
+		return err
+	}
+	err = f.Sync()
+	if err == nil {
+		// Best effort: without it the check only proves the data reached the cache
+		if derr := dropCache(f); derr != nil {
+			logging.Get().Debug("storage", "Could not drop %s from the page cache: %v", path, derr)
+		}
+	}
+	if cerr := f.Close(); err == nil {
+		err = cerr
+	}
+	return err
+}
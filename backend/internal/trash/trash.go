@@ -0,0 +1,481 @@
+package trash
+
+import (
+	"crypto/rand"
+	"encoding/hex"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+
+	"photobooth/internal/config"
+	"photobooth/internal/disk"
+	"photobooth/internal/fsutil"
+	"photobooth/internal/logging"
+	"photobooth/internal/storage"
+)
+
+// dirName is the trash folder below PhotosBasePath. Album listings skip dot-dirs.
+const (
+	dirName  = ".trash"
+	metaFile = "meta.json"
+	albumDir = "album" // where a whole album folder is kept inside an item
+)
+
+// Kinds of trash items.
+const (
+	KindPhoto  = "photo"  // a single photo with its derivatives
+	KindPhotos = "photos" // all photos of an emptied album
+	KindAlbum  = "album"  // a deleted album folder
+)
+
+// Item is one restorable delete operation.
+type Item struct {
+	Id            string    `json:"id"`
+	Kind          string    `json:"kind"`
+	Album         string    `json:"album"`
+	AlbumName     string    `json:"albumName,omitempty"`
+	CaptureMethod string    `json:"captureMethod,omitempty"`
+	Photos        []string  `json:"photos,omitempty"`
+	Count         int       `json:"count"`
+	Size          int64     `json:"size"`
+	DeletedAt     time.Time `json:"deletedAt"`
+	Client        string    `json:"client,omitempty"`
+
+	// Index records, so flags and metadata survive a restore
+	Records []storage.Record `json:"records,omitempty"`
+}
+
+// Bin moves deleted photos and albums into PhotosBasePath/.trash instead of
+// removing them, and purges them after the retention time or when space is needed.
+type Bin struct {
+	cfg  config.TrashConfig
+	base string
+	dir  string
+	log  *logging.Logger
+	mu   sync.Mutex
+}
+
+func NewBin(cfg config.TrashConfig, photosBase string) *Bin {
+	return &Bin{
+		cfg:  cfg,
+		base: photosBase,
+		dir:  filepath.Join(photosBase, dirName),
+		log:  logging.Get(),
+	}
+}
+
+// Start runs the purge loop in the background.
+func (b *Bin) Start() {
+	go func() {
+		b.purgeOld()
+		for range time.Tick(5 * time.Minute) {
+			b.purgeOld()
+		}
+	}()
+}
+
+// TrashPhoto moves a single photo and all its files into the trash.
+func (b *Bin) TrashPhoto(album, filename, client string) (*Item, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	src := filepath.Join(b.base, album)
+	idx, err := storage.OpenIndex(src)
+	if err != nil {
+		return nil, err
+	}
+	rec, err := idx.Get(filename)
+	if err != nil {
+		return nil, err
+	}
+	if rec == nil {
+		return nil, os.ErrNotExist
+	}
+
+	item := &Item{
+		Id:        newId(),
+		Kind:      KindPhoto,
+		Album:     album,
+		Photos:    []string{filename},
+		Count:     1,
+		Size:      rec.TotalSize(),
+		DeletedAt: time.Now(),
+		Client:    client,
+		Records:   []storage.Record{*rec},
+	}
+	if err := b.moveIn(item, src, rec.Files()); err != nil {
+		return nil, err
+	}
+	if err := idx.Delete(filename); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// TrashAlbumContents moves every file of an album's original/, preview/ and thumb/
+// folders into the trash, leaving the empty album behind.
+func (b *Bin) TrashAlbumContents(album, client string) (*Item, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	src := filepath.Join(b.base, album)
+	idx, err := storage.OpenIndex(src)
+	if err != nil {
+		return nil, err
+	}
+	recs, err := idx.All()
+	if err != nil {
+		return nil, err
+	}
+
+	var files []string
+	for _, sub := range []string{"original", "preview", "thumb"} {
+		entries, err := os.ReadDir(filepath.Join(src, sub))
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() {
+				files = append(files, filepath.Join(sub, e.Name()))
+			}
+		}
+	}
+	if len(files) == 0 {
+		return nil, nil
+	}
+
+	item := &Item{
+		Id:        newId(),
+		Kind:      KindPhotos,
+		Album:     album,
+		DeletedAt: time.Now(),
+		Client:    client,
+		Records:   recs,
+	}
+	for i := range recs {
+		if recs[i].IsImage() {
+			item.Count++
+		}
+		item.Size += recs[i].TotalSize()
+	}
+	if err := b.moveIn(item, src, files); err != nil {
+		return nil, err
+	}
+	if err := idx.Clear(); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// TrashAlbum moves a whole album folder into the trash. Display name and capture
+// method are kept so a restore brings back the album exactly as it was.
+func (b *Bin) TrashAlbum(album, displayName, captureMethod, client string) (*Item, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	src := filepath.Join(b.base, album)
+	count, size, err := storage.AlbumStats(src)
+	if err != nil {
+		return nil, err
+	}
+	storage.CloseIndex(src)
+
+	item := &Item{
+		Id:            newId(),
+		Kind:          KindAlbum,
+		Album:         album,
+		AlbumName:     displayName,
+		CaptureMethod: captureMethod,
+		Count:         count,
+		Size:          size,
+		DeletedAt:     time.Now(),
+		Client:        client,
+	}
+	dst := filepath.Join(b.dir, item.Id)
+	if err := os.MkdirAll(dst, 0755); err != nil {
+		return nil, err
+	}
+	if err := os.Rename(src, filepath.Join(dst, albumDir)); err != nil {
+		os.Remove(dst)
+		return nil, err
+	}
+	if err := fsutil.WriteJSON(filepath.Join(dst, metaFile), item); err != nil {
+		return nil, err
+	}
+	return item, nil
+}
+
+// List returns all items, newest first. Index records are left out.
+func (b *Bin) List() ([]Item, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	items, err := b.items()
+	if err != nil {
+		return nil, err
+	}
+	for i := range items {
+		items[i].Records = nil
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.After(items[j].DeletedAt)
+	})
+	return items, nil
+}
+
+// Restore moves an item back to its album. It fails if any of its files (or, for
+// albums, the album folder) exist again in the meantime.
+func (b *Bin) Restore(id string) (*Item, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	item, err := b.load(id)
+	if err != nil {
+		return nil, err
+	}
+	src := filepath.Join(b.dir, id)
+	dst := filepath.Join(b.base, item.Album)
+
+	if item.Kind == KindAlbum {
+		if _, err := os.Stat(dst); err == nil {
+			return nil, fmt.Errorf("album '%s' already exists", item.Album)
+		}
+		if err := os.Rename(filepath.Join(src, albumDir), dst); err != nil {
+			return nil, err
+		}
+		os.RemoveAll(src)
+		return item, nil
+	}
+
+	files, err := itemFiles(src)
+	if err != nil {
+		return nil, err
+	}
+	for _, rel := range files {
+		if _, err := os.Stat(filepath.Join(dst, rel)); err == nil {
+			return nil, fmt.Errorf("%s already exists in album '%s'", filepath.Base(rel), item.Album)
+		}
+	}
+	if err := moveAll(src, dst, files); err != nil {
+		return nil, err
+	}
+
+	idx, err := storage.OpenIndex(dst)
+	if err != nil {
+		return nil, err
+	}
+	for i := range item.Records {
+		if err := idx.Put(&item.Records[i]); err != nil {
+			return nil, err
+		}
+	}
+	if _, _, err := idx.Reconcile(); err != nil {
+		return nil, err
+	}
+	os.RemoveAll(src)
+	return item, nil
+}
+
+// Purge deletes an item for good.
+func (b *Bin) Purge(id string) error {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	if _, err := b.load(id); err != nil {
+		return err
+	}
+	return os.RemoveAll(filepath.Join(b.dir, id))
+}
+
+// PurgeAll empties the trash and returns the number of items removed.
+func (b *Bin) PurgeAll() (int, error) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	items, err := b.items()
+	if err != nil {
+		return 0, err
+	}
+	for _, it := range items {
+		if err := os.RemoveAll(filepath.Join(b.dir, it.Id)); err != nil {
+			return 0, err
+		}
+	}
+	return len(items), nil
+}
+
+// PurgeOldest removes the oldest items, except those of skipAlbum, until enough
+// reports true. Returns the number of items removed.
+func (b *Bin) PurgeOldest(skipAlbum, reason string, enough func() bool) int {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	items, err := b.items()
+	if err != nil {
+		return 0
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.Before(items[j].DeletedAt)
+	})
+	n := 0
+	for i := range items {
+		if enough() {
+			break
+		}
+		if items[i].Album == skipAlbum {
+			continue
+		}
+		b.remove(&items[i], reason)
+		n++
+	}
+	return n
+}
+
+// purgeOld removes items past the retention time, then the oldest items while
+// free disk space is below the configured minimum.
+func (b *Bin) purgeOld() {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	items, err := b.items()
+	if err != nil || len(items) == 0 {
+		return
+	}
+	sort.Slice(items, func(i, j int) bool {
+		return items[i].DeletedAt.Before(items[j].DeletedAt)
+	})
+
+	if b.cfg.RetentionDays > 0 {
+		cutoff := time.Now().AddDate(0, 0, -b.cfg.RetentionDays)
+		for len(items) > 0 && items[0].DeletedAt.Before(cutoff) {
+			b.remove(&items[0], "retention expired")
+			items = items[1:]
+		}
+	}
+
+	if b.cfg.MinFreeMB <= 0 {
+		return
+	}
+	minFree := uint64(b.cfg.MinFreeMB) * 1024 * 1024
+	for len(items) > 0 {
+		usage, err := disk.GetUsage(b.base)
+		if err != nil || usage.Free >= minFree {
+			return
+		}
+		b.remove(&items[0], "disk space low")
+		items = items[1:]
+	}
+}
+
+func (b *Bin) remove(it *Item, reason string) {
+	if err := os.RemoveAll(filepath.Join(b.dir, it.Id)); err != nil {
+		b.log.Error("trash", "Failed to purge %s: %v", it.Id, err)
+		return
+	}
+	b.log.Info("trash", "Purged %s from album '%s' (%d photos, %s)", it.Kind, it.Album, it.Count, reason)
+}
+
+// moveIn moves files (relative to albumDir) into a new trash item and writes its
+// metadata. On failure already moved files are put back.
+func (b *Bin) moveIn(item *Item, albumDir string, files []string) error {
+	dst := filepath.Join(b.dir, item.Id)
+	if err := moveAll(albumDir, dst, files); err != nil {
+		os.RemoveAll(dst)
+		return err
+	}
+	return fsutil.WriteJSON(filepath.Join(dst, metaFile), item)
+}
+
+func (b *Bin) load(id string) (*Item, error) {
+	if id == "" || id != filepath.Base(id) || strings.HasPrefix(id, ".") {
+		return nil, os.ErrNotExist
+	}
+	var item Item
+	path := filepath.Join(b.dir, id, metaFile)
+	if _, err := os.Stat(path); err != nil {
+		return nil, os.ErrNotExist
+	}
+	if err := fsutil.ReadJSON(path, &item); err != nil {
+		return nil, err
+	}
+	return &item, nil
+}
+
+func (b *Bin) items() ([]Item, error) {
+	entries, err := os.ReadDir(b.dir)
+	if os.IsNotExist(err) {
+		return []Item{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+	items := []Item{}
+	for _, e := range entries {
+		if !e.IsDir() {
+			continue
+		}
+		item, err := b.load(e.Name())
+		if err != nil {
+			b.log.Warn("trash", "Skipping unreadable trash item %s: %v", e.Name(), err)
+			continue
+		}
+		items = append(items, *item)
+	}
+	return items, nil
+}
+
+// moveAll renames files from srcDir to dstDir (same file system), creating
+// subfolders as needed. Missing source files are skipped; on error everything
+// moved so far is moved back.
+func moveAll(srcDir, dstDir string, files []string) error {
+	var moved []string
+	for _, rel := range files {
+		from, to := filepath.Join(srcDir, rel), filepath.Join(dstDir, rel)
+		if _, err := os.Stat(from); os.IsNotExist(err) {
+			continue
+		}
+		err := os.MkdirAll(filepath.Dir(to), 0755)
+		if err == nil {
+			err = os.Rename(from, to)
+		}
+		if err != nil {
+			for _, m := range moved {
+				os.Rename(filepath.Join(dstDir, m), filepath.Join(srcDir, m))
+			}
+			return err
+		}
+		moved = append(moved, rel)
+	}
+	return nil
+}
+
+// itemFiles lists the photo files stored in a trash item, relative to it.
+func itemFiles(dir string) ([]string, error) {
+	var files []string
+	err := filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+		if err != nil {
+			return err
+		}
+		if d.IsDir() || path == filepath.Join(dir, metaFile) {
+			return nil
+		}
+		rel, err := filepath.Rel(dir, path)
+		if err != nil {
+			return err
+		}
+		files = append(files, rel)
+		return nil
+	})
+	return files, err
+}
+
+func newId() string {
+	b := make([]byte, 3)
+	rand.Read(b)
+	return time.Now().Format("20060102-150405") + "-" + hex.EncodeToString(b)
+}
@@ -0,0 +1,370 @@
+package upload
+
+import (
+	"fmt"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"time"
+
+	"photobooth/internal/config"
+	"photobooth/internal/fsutil"
+	"photobooth/internal/logging"
+	"photobooth/internal/storage"
+)
+
+// Item is one file waiting to be uploaded.
+type Item struct {
+	Album       string    `json:"album"`
+	File        string    `json:"file"` // relative to the album dir, e.g. original/IMG_x.jpg
+	Size        int64     `json:"size"`
+	Attempts    int       `json:"attempts"`
+	LastError   string    `json:"lastError,omitempty"`
+	AddedAt     time.Time `json:"addedAt"`
+	NextAttempt time.Time `json:"nextAttempt"`
+}
+
+// Status is the uploader state shown in /api/status.
+type Status struct {
+	Enabled       bool   `json:"enabled"`
+	Paused        bool   `json:"paused"`
+	Pending       int    `json:"pending"`
+	PendingBytes  int64  `json:"pendingBytes"`
+	Uploaded      int    `json:"uploaded"` // since start
+	UploadedBytes int64  `json:"uploadedBytes"`
+	Current       string `json:"current,omitempty"`
+	LastError     string `json:"lastError,omitempty"`
+}
+
+// Uploader pushes captures to an S3-compatible bucket in the background.
+// The queue is persisted so nothing is lost across restarts or outages.
+type Uploader struct {
+	mu        sync.Mutex
+	cfg       config.UploadConfig
+	basePath  string
+	queuePath string
+	queue     []*Item
+	client    *s3Client
+	isBusy    func() bool
+	wake      chan struct{}
+	log       *logging.Logger
+
+	current       string
+	paused        bool
+	uploaded      int
+	uploadedBytes int64
+	lastError     string
+}
+
+// NewUploader creates the uploader. isBusy is polled to pause uploads while
+// the booth is capturing (see UploadConfig.PauseWhileBusy).
+func NewUploader(cfg config.UploadConfig, photosBase string, isBusy func() bool) *Uploader {
+	if cfg.RetrySeconds < 1 {
+		cfg.RetrySeconds = 30
+	}
+	return &Uploader{
+		cfg:       cfg,
+		basePath:  photosBase,
+		queuePath: filepath.Join(photosBase, ".upload", "queue.json"),
+		isBusy:    isBusy,
+		wake:      make(chan struct{}, 1),
+		log:       logging.Get(),
+	}
+}
+
+// Start loads the persisted queue and runs the upload loop. Does nothing if disabled.
+func (u *Uploader) Start() {
+	if !u.cfg.Enabled {
+		return
+	}
+
+	client, err := newS3Client(u.cfg.Endpoint, u.cfg.Region, u.cfg.Bucket, u.cfg.AccessKey, u.cfg.SecretKey)
+	if err != nil {
+		u.log.Error("upload", "Upload disabled: %v", err)
+		u.cfg.Enabled = false
+		return
+	}
+	u.client = client
+
+	u.mu.Lock()
+	if err := fsutil.ReadJSON(u.queuePath, &u.queue); err != nil {
+		u.log.Warn("upload", "Failed to load upload queue: %v", err)
+	}
+	if len(u.queue) > 0 {
+		u.log.Info("upload", "Resuming upload queue with %d files", len(u.queue))
+	}
+	u.mu.Unlock()
+
+	u.log.Info("upload", "Uploading to %s/%s", u.cfg.Endpoint, u.cfg.Bucket)
+	go u.run()
+}
+
+// Enabled reports whether uploads are active.
+func (u *Uploader) Enabled() bool {
+	return u.cfg.Enabled
+}
+
+// EnqueuePhoto queues the original (and preview if configured) of a new capture.
+// It only touches the queue file and never waits for the network.
+func (u *Uploader) EnqueuePhoto(album, filename string) {
+	if !u.cfg.Enabled {
+		return
+	}
+	files := []string{path.Join("original", filename)}
+	if u.cfg.IncludePreviews {
+		files = append(files, path.Join("preview", filename))
+	}
+	u.enqueue(album, files)
+}
+
+// EnqueueAlbum queues every file of an album (e.g. to catch up after enabling uploads).
+// Objects already present in the bucket are skipped by the worker.
+func (u *Uploader) EnqueueAlbum(album string) (int, error) {
+	if !u.cfg.Enabled {
+		return 0, fmt.Errorf("upload is disabled")
+	}
+	subs := []string{"original"}
+	if u.cfg.IncludePreviews {
+		subs = append(subs, "preview")
+	}
+
+	var files []string
+	for _, sub := range subs {
+		entries, err := os.ReadDir(filepath.Join(u.basePath, album, sub))
+		if err != nil {
+			continue
+		}
+		for _, e := range entries {
+			if !e.IsDir() && !strings.HasPrefix(e.Name(), ".") {
+				files = append(files, path.Join(sub, e.Name()))
+			}
+		}
+	}
+	return u.enqueue(album, files), nil
+}
+
+// MoveAlbum points the queued files of an album to its new name after the
+// album was renamed or merged into another.
+func (u *Uploader) MoveAlbum(from, to string) error {
+	return u.move(func(it *Item) bool {
+		if it.Album != from {
+			return false
+		}
+		it.Album = to
+		return true
+	})
+}
+
+// MovePhoto points the queued files of a photo to its new album and name.
+func (u *Uploader) MovePhoto(fromAlbum, fromFile, toAlbum, toFile string) error {
+	return u.move(func(it *Item) bool {
+		file, ok := storage.MovedFile(it.File, fromFile, toFile)
+		if it.Album != fromAlbum || !ok {
+			return false
+		}
+		it.Album, it.File = toAlbum, file
+		return true
+	})
+}
+
+// move rewrites the queued items fn reports as changed and persists the queue.
+func (u *Uploader) move(fn func(it *Item) bool) error {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	changed := false
+	for _, it := range u.queue {
+		if fn(it) {
+			changed = true
+		}
+	}
+	if !changed {
+		return nil
+	}
+	return fsutil.WriteJSON(u.queuePath, u.queue)
+}
+
+func (u *Uploader) enqueue(album string, files []string) int {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	queued := make(map[string]bool, len(u.queue))
+	for _, it := range u.queue {
+		queued[it.Album+"/"+it.File] = true
+	}
+
+	added := 0
+	now := time.Now()
+	for _, f := range files {
+		if queued[album+"/"+f] {
+			continue
+		}
+		var size int64
+		if info, err := os.Stat(filepath.Join(u.basePath, album, filepath.FromSlash(f))); err == nil {
+			size = info.Size()
+		}
+		u.queue = append(u.queue, &Item{Album: album, File: f, Size: size, AddedAt: now, NextAttempt: now})
+		added++
+	}
+	if added == 0 {
+		return 0
+	}
+	if err := fsutil.WriteJSON(u.queuePath, u.queue); err != nil {
+		u.log.Error("upload", "Failed to persist upload queue: %v", err)
+	}
+
+	select {
+	case u.wake <- struct{}{}:
+	default:
+	}
+	return added
+}
+
+// Status returns a snapshot of the backlog.
+func (u *Uploader) Status() Status {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+
+	s := Status{
+		Enabled:       u.cfg.Enabled,
+		Paused:        u.paused,
+		Pending:       len(u.queue),
+		Uploaded:      u.uploaded,
+		UploadedBytes: u.uploadedBytes,
+		Current:       u.current,
+		LastError:     u.lastError,
+	}
+	for _, it := range u.queue {
+		s.PendingBytes += it.Size
+	}
+	return s
+}
+
+func (u *Uploader) run() {
+	for {
+		item := u.next()
+		if item == nil {
+			select {
+			case <-u.wake:
+			case <-time.After(10 * time.Second):
+			}
+			continue
+		}
+
+		// Never compete with a running capture for CPU, SD card or WiFi bandwidth
+		if u.cfg.PauseWhileBusy && u.isBusy != nil && u.isBusy() {
+			u.setPaused(true)
+			time.Sleep(2 * time.Second)
+			continue
+		}
+		u.setPaused(false)
+
+		u.process(item)
+	}
+}
+
+// next returns the first queued item whose retry time has come.
+func (u *Uploader) next() *Item {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	now := time.Now()
+	for _, it := range u.queue {
+		if !it.NextAttempt.After(now) {
+			return it
+		}
+	}
+	return nil
+}
+
+func (u *Uploader) setPaused(p bool) {
+	u.mu.Lock()
+	u.paused = p
+	u.mu.Unlock()
+}
+
+func (u *Uploader) process(it *Item) {
+	u.mu.Lock()
+	key := u.objectKey(it)
+	local := filepath.Join(u.basePath, it.Album, filepath.FromSlash(it.File))
+	u.current = it.Album + "/" + it.File
+	u.mu.Unlock()
+
+	err := u.upload(key, local)
+
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	u.current = ""
+
+	if err != nil {
+		if os.IsNotExist(err) {
+			if filepath.Join(u.basePath, it.Album, filepath.FromSlash(it.File)) != local {
+				return // album renamed meanwhile, the next round uploads the file from there
+			}
+			// File was deleted locally in the meantime – nothing left to upload
+			u.remove(it)
+			return
+		}
+		it.Attempts++
+		it.LastError = err.Error()
+		u.lastError = err.Error()
+		backoff := time.Duration(u.cfg.RetrySeconds) * time.Second << uint(min(it.Attempts-1, 5))
+		it.NextAttempt = time.Now().Add(backoff)
+		u.log.Warn("upload", "Upload of %s failed (attempt %d, retry in %s): %v", key, it.Attempts, backoff, err)
+		if err := fsutil.WriteJSON(u.queuePath, u.queue); err != nil {
+			u.log.Error("upload", "Failed to persist upload queue: %v", err)
+		}
+		return
+	}
+
+	u.uploaded++
+	u.uploadedBytes += it.Size
+	u.lastError = ""
+	u.remove(it)
+	u.log.Debug("upload", "Uploaded %s", key)
+}
+
+// upload sends a file unless the bucket already holds an object of the same size,
+// which makes retries after a crash or a lost connection cheap.
+func (u *Uploader) upload(key, local string) error {
+	info, err := os.Stat(local)
+	if err != nil {
+		return err
+	}
+	if size, err := u.client.Stat(key); err == nil && size == info.Size() {
+		return nil
+	}
+	return u.client.PutFile(key, local, contentType(local))
+}
+
+// remove must be called with u.mu held.
+func (u *Uploader) remove(it *Item) {
+	for i, q := range u.queue {
+		if q == it {
+			u.queue = append(u.queue[:i], u.queue[i+1:]...)
+			break
+		}
+	}
+	if err := fsutil.WriteJSON(u.queuePath, u.queue); err != nil {
+		u.log.Error("upload", "Failed to persist upload queue: %v", err)
+	}
+}
+
+func (u *Uploader) objectKey(it *Item) string {
+	prefix := strings.Trim(u.cfg.Prefix, "/")
+	if prefix != "" {
+		prefix += "/"
+	}
+	return prefix + it.Album + "/" + it.File
+}
+
+func contentType(name string) string {
+	switch strings.ToLower(filepath.Ext(name)) {
+	case ".jpg", ".jpeg":
+		return "image/jpeg"
+	case ".png":
+		return "image/png"
+	default:
+		return "application/octet-stream"
+	}
+}
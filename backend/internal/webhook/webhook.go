@@ -0,0 +1,347 @@
+package webhook
+
+import (
+	"bytes"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"photobooth/internal/config"
+	"photobooth/internal/fsutil"
+	"photobooth/internal/logging"
+	"photobooth/internal/websocket"
+)
+
+const (
+	maxAttempts  = 8
+	maxQueueSize = 1000
+)
+
+// Delivery is a single event on its way to a single webhook.
+type Delivery struct {
+	Id          string          `json:"id"`
+	Hook        string          `json:"hook"`
+	Event       websocket.Event `json:"event"`
+	Attempts    int             `json:"attempts"`
+	LastError   string          `json:"lastError,omitempty"`
+	NextAttempt time.Time       `json:"nextAttempt"`
+}
+
+// Result is the outcome of a test delivery.
+type Result struct {
+	Hook   string `json:"hook"`
+	Status int    `json:"status"`
+	Error  string `json:"error,omitempty"`
+}
+
+// Dispatcher forwards hub events to the configured webhooks. Every webhook is
+// delivered to by its own goroutine, so a slow one does not hold up the
+// others. Failed deliveries, and events a slow webhook cannot take right now,
+// go to a persistent retry queue so short outages do not lose events.
+type Dispatcher struct {
+	hooks     []config.WebhookConfig
+	queuePath string
+	incoming  map[string]chan websocket.Event // by webhook name
+	http      *http.Client
+	log       *logging.Logger
+
+	mu      sync.Mutex
+	retry   []*Delivery
+	dirty   bool // retry changed since it was last persisted
+	dropped int  // oldest deliveries dropped from a full queue, logged by the retry loop
+}
+
+func NewDispatcher(hooks []config.WebhookConfig, photosBase string) *Dispatcher {
+	return &Dispatcher{
+		hooks:     hooks,
+		queuePath: filepath.Join(photosBase, ".webhooks", "queue.json"),
+		incoming:  make(map[string]chan websocket.Event),
+		http:      &http.Client{Timeout: 10 * time.Second},
+		log:       logging.Get(),
+	}
+}
+
+// Start loads pending retries and begins delivering. It subscribes to the hub so
+// webhooks receive exactly what websocket clients receive.
+func (d *Dispatcher) Start(hub *websocket.Hub) {
+	active := 0
+	for _, h := range d.hooks {
+		if h.Enabled {
+			active++
+		}
+	}
+	if active == 0 {
+		return
+	}
+
+	if err := fsutil.ReadJSON(d.queuePath, &d.retry); err != nil {
+		d.log.Warn("webhook", "Failed to load retry queue: %v", err)
+	}
+
+	for _, h := range d.hooks {
+		if h.Enabled {
+			ch := make(chan websocket.Event, 256)
+			d.incoming[h.Name] = ch
+			go d.deliverLoop(h, ch)
+		}
+	}
+	hub.AddListener(d.Publish)
+	go d.retryLoop()
+	d.log.Info("webhook", "%d webhook(s) active", active)
+}
+
+// Publish hands an event to the webhooks without blocking, since the hub loop
+// must never stall. A webhook whose buffer is full gets the event through the
+// retry queue instead.
+func (d *Dispatcher) Publish(e websocket.Event) {
+	for _, h := range d.hooks {
+		ch, ok := d.incoming[h.Name]
+		if !ok || !matches(h.Events, e.Type) {
+			continue
+		}
+		select {
+		case ch <- e:
+		default:
+			d.mu.Lock()
+			d.addRetryLocked(&Delivery{Id: newId(), Hook: h.Name, Event: e, NextAttempt: time.Now()})
+			d.mu.Unlock()
+		}
+	}
+}
+
+// Test sends a sample event to one webhook (or all if name is empty), ignoring
+// event filters, and reports the HTTP status of each.
+func (d *Dispatcher) Test(name string) []Result {
+	event := websocket.Event{
+		Type:      "test",
+		Data:      map[string]string{"message": "Photobooth webhook test"},
+		Timestamp: time.Now().UnixMilli(),
+	}
+
+	results := []Result{}
+	for _, h := range d.hooks {
+		if name != "" && h.Name != name {
+			continue
+		}
+		status, err := d.send(h, newId(), event)
+		r := Result{Hook: h.Name, Status: status}
+		if err != nil {
+			r.Error = err.Error()
+		}
+		results = append(results, r)
+	}
+	return results
+}
+
+// Pending returns the number of deliveries waiting for a retry.
+func (d *Dispatcher) Pending() int {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	return len(d.retry)
+}
+
+// deliverLoop sends the events of one webhook in order.
+func (d *Dispatcher) deliverLoop(h config.WebhookConfig, events <-chan websocket.Event) {
+	for e := range events {
+		id := newId()
+		if _, err := d.send(h, id, e); err != nil {
+			d.queueRetry(&Delivery{
+				Id:          id,
+				Hook:        h.Name,
+				Event:       e,
+				Attempts:    1,
+				LastError:   err.Error(),
+				NextAttempt: time.Now().Add(backoff(1)),
+			})
+		}
+	}
+}
+
+func (d *Dispatcher) retryLoop() {
+	for range time.Tick(5 * time.Second) {
+		d.mu.Lock()
+		now := time.Now()
+		due := make(map[string][]*Delivery)
+		for _, del := range d.retry {
+			if !del.NextAttempt.After(now) {
+				due[del.Hook] = append(due[del.Hook], del)
+			}
+		}
+		d.mu.Unlock()
+
+		// Webhooks in parallel, the deliveries of each in order
+		var wg sync.WaitGroup
+		for name, dels := range due {
+			wg.Add(1)
+			go func(name string, dels []*Delivery) {
+				defer wg.Done()
+				d.retryHook(name, dels)
+			}(name, dels)
+		}
+		wg.Wait()
+
+		d.mu.Lock()
+		if d.dirty {
+			d.persistLocked()
+		}
+		dropped := d.dropped
+		d.dropped = 0
+		d.mu.Unlock()
+		if dropped > 0 {
+			d.log.Warn("webhook", "Retry queue full, dropped the %d oldest event(s)", dropped)
+		}
+	}
+}
+
+// retryHook sends due deliveries of one webhook again. After the first
+// failure the rest wait for the next round, the webhook is most likely down.
+func (d *Dispatcher) retryHook(name string, dels []*Delivery) {
+	h, ok := d.hook(name)
+	for _, del := range dels {
+		var err error
+		if ok {
+			_, err = d.send(h, del.Id, del.Event)
+		}
+
+		d.mu.Lock()
+		d.dirty = true
+		switch {
+		case !ok || err == nil:
+			d.removeLocked(del)
+		default:
+			del.Attempts++
+			del.LastError = err.Error()
+			if del.Attempts >= maxAttempts {
+				d.log.Warn("webhook", "Dropping '%s' event for webhook '%s' after %d attempts: %v", del.Event.Type, del.Hook, del.Attempts, err)
+				d.removeLocked(del)
+			} else {
+				del.NextAttempt = time.Now().Add(backoff(del.Attempts))
+			}
+		}
+		d.mu.Unlock()
+		if err != nil {
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) queueRetry(del *Delivery) {
+	d.mu.Lock()
+	defer d.mu.Unlock()
+	d.addRetryLocked(del)
+	d.persistLocked()
+}
+
+// addRetryLocked queues a delivery; it is persisted with the next write of the
+// queue, at the latest by the retry loop. It must not log: Publish runs in the
+// hub loop, which log entries are broadcast through.
+func (d *Dispatcher) addRetryLocked(del *Delivery) {
+	if len(d.retry) >= maxQueueSize {
+		// Keep the newest events – a display wall cares about the latest photo
+		d.retry = d.retry[1:]
+		d.dropped++
+	}
+	d.retry = append(d.retry, del)
+	d.dirty = true
+}
+
+func (d *Dispatcher) removeLocked(del *Delivery) {
+	for i, x := range d.retry {
+		if x == del {
+			d.retry = append(d.retry[:i], d.retry[i+1:]...)
+			return
+		}
+	}
+}
+
+func (d *Dispatcher) persistLocked() {
+	d.dirty = false
+	if err := fsutil.WriteJSON(d.queuePath, d.retry); err != nil {
+		d.log.Error("webhook", "Failed to persist retry queue: %v", err)
+	}
+}
+
+func (d *Dispatcher) hook(name string) (config.WebhookConfig, bool) {
+	for _, h := range d.hooks {
+		if h.Name == name && h.Enabled {
+			return h, true
+		}
+	}
+	return config.WebhookConfig{}, false
+}
+
+// send POSTs the event as JSON. The body is identical to the websocket message.
+func (d *Dispatcher) send(h config.WebhookConfig, id string, e websocket.Event) (int, error) {
+	body, err := json.Marshal(e)
+	if err != nil {
+		return 0, err
+	}
+
+	req, err := http.NewRequest("POST", h.Url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "PhotoboothV5-Webhook")
+	req.Header.Set("X-Photobooth-Event", e.Type)
+	req.Header.Set("X-Photobooth-Delivery", id)
+	if h.Secret != "" {
+		req.Header.Set("X-Photobooth-Signature", "sha256="+Sign(h.Secret, body))
+	}
+
+	resp, err := d.http.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 4096))
+	resp.Body.Close()
+
+	if resp.StatusCode < 200 || resp.StatusCode >= 300 {
+		return resp.StatusCode, fmt.Errorf("webhook responded %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
+
+// Sign returns the hex HMAC-SHA256 of body, as sent in X-Photobooth-Signature.
+func Sign(secret string, body []byte) string {
+	m := hmac.New(sha256.New, []byte(secret))
+	m.Write(body)
+	return hex.EncodeToString(m.Sum(nil))
+}
+
+// matches reports whether an event type passes a webhook's filter. Log events are
+// only delivered when asked for explicitly, since they are noisy and a failing
+// webhook would otherwise feed on its own error logs.
+func matches(filter []string, eventType string) bool {
+	if len(filter) == 0 {
+		return eventType != websocket.EventTypeLog
+	}
+	for _, f := range filter {
+		if f == eventType || (f == "*" && eventType != websocket.EventTypeLog) {
+			return true
+		}
+	}
+	return false
+}
+
+func backoff(attempt int) time.Duration {
+	d := 10 * time.Second << uint(attempt-1)
+	if d > 30*time.Minute {
+		d = 30 * time.Minute
+	}
+	return d
+}
+
+func newId() string {
+	b := make([]byte, 8)
+	rand.Read(b)
+	return hex.EncodeToString(b)
+}
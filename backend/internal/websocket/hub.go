@@ -12,14 +12,17 @@ import (
 
 // Event types
 const (
-	EventTypeRegister  = "register"
-	EventTypeTrigger   = "trigger"
-	EventTypeStatus    = "status"
-	EventTypeCountdown = "countdown"
-	EventTypePhoto     = "photo_ready"
-	EventTypeLog       = "log"
-	EventTypeSystem    = "system_info"
-	TypeError          = "error"
+	EventTypeRegister     = "register"
+	EventTypeTrigger      = "trigger"
+	EventTypeStatus       = "status"
+	EventTypeCountdown    = "countdown"
+	EventTypePhoto        = "photo_ready"
+	EventTypePhotoUpdated = "photo_updated"
+	EventTypePhotoDeleted = "photo_deleted"
+	EventTypeAlbums       = "albums_changed"
+	EventTypeLog          = "log"
+	EventTypeSystem       = "system_info"
+	TypeError             = "error"
 )
 
 type Event struct {
@@ -44,6 +47,9 @@ type Hub struct {
 
 	// Callbacks for business logic
 	OnTrigger func()
+
+	// listeners receive every broadcast event (webhooks, MQTT, ...)
+	listeners []func(Event)
 }
 
 func NewHub() *Hub {
@@ -61,6 +67,16 @@ func (h *Hub) ClientCount() int {
 	return len(h.Clients)
 }
 
+// AddListener registers a function that receives every broadcast event, in the
+// same shape that is sent to websocket clients. Listeners are called from the
+// hub loop and must not block – in particular they must not log, since log
+// entries are broadcast through the hub themselves.
+func (h *Hub) AddListener(fn func(Event)) {
+	h.mu.Lock()
+	h.listeners = append(h.listeners, fn)
+	h.mu.Unlock()
+}
+
 func (h *Hub) Run() {
 	ticker := time.NewTicker(30 * time.Second)
 	defer ticker.Stop()
@@ -92,8 +108,13 @@ func (h *Hub) Run() {
 					delete(h.Clients, client)
 				}
 			}
+			listeners := h.listeners
 			h.mu.Unlock()
 
+			for _, fn := range listeners {
+				fn(message)
+			}
+
 		case <-ticker.C:
 			// Keep-alive
 		}
@@ -6,6 +6,8 @@ export interface Photo {
     timestamp: string
     url: string
     thumbUrl: string
+    favorite?: boolean
+    hidden?: boolean
 }
 
 export const useGalleryStore = defineStore('gallery', () => {
@@ -26,10 +28,32 @@ export const useGalleryStore = defineStore('gallery', () => {
         }
     }
 
+    // Live updates from the photo_updated / photo_deleted websocket events
+    // currentAlbum tells whether the photo belongs to the album shown here
+    function applyUpdate(photo: Photo, currentAlbum: boolean) {
+        const i = photos.value.findIndex(p => p.filename === photo.filename)
+        if (photo.hidden) {
+            if (i >= 0) photos.value.splice(i, 1)
+        } else if (i >= 0) {
+            photos.value[i] = photo
+        } else if (currentAlbum) {
+            // Shown again: insert it where /api/photos lists it, newest first
+            const t = Date.parse(photo.timestamp)
+            const at = photos.value.findIndex(p => Date.parse(p.timestamp) < t)
+            photos.value.splice(at < 0 ? photos.value.length : at, 0, photo)
+        }
+    }
+
+    function remove(filename: string) {
+        photos.value = photos.value.filter(p => p.filename !== filename)
+    }
+
     return {
         photos,
         loading,
         error,
-        fetchPhotos
+        fetchPhotos,
+        applyUpdate,
+        remove
     }
 })
@@ -1,5 +1,6 @@
 import { defineStore } from 'pinia'
 import { ref } from 'vue'
+import { useGalleryStore } from './gallery'
 
 export interface LogEntry {
     level: string
@@ -33,6 +34,78 @@ export interface DiskInfo {
     usedPercent: number
 }
 
+export interface StorageStatus {
+    level: 'ok' | 'warn' | 'error' | 'full'
+    freeBytes: number
+    avgPhotoBytes: number
+    photosRemaining: number
+    message?: string
+}
+
+export interface NetworkStatus {
+    mode: 'hotspot' | 'client' | 'auto'
+    active: 'none' | 'hotspot' | 'client'
+    ssid?: string
+    ipAddress?: string
+    signal?: number
+    fallback?: boolean
+    connecting?: string
+    message?: string
+    since: string
+    rollbackAt?: string
+}
+
+export interface NetworkSettings {
+    ssid: string
+    hasPassword: boolean
+    band: 'bg' | 'a'
+    channel: number
+    interface: string
+    ipAddress: string
+    dhcpRangeStart: string
+    dhcpRangeEnd: string
+    captivePortal: boolean
+    portalLanding: 'gallery' | 'modes'
+    mode: 'hotspot' | 'client' | 'auto'
+}
+
+export interface NetworkInfo {
+    config: NetworkSettings
+    status: NetworkStatus
+    stations: { mac: string; ip?: string; hostname?: string; signal: number; connectedSecs: number }[]
+    leases: { mac: string; ip: string; hostname?: string; expires: string }[]
+    portal: { ip: string; os?: string; acceptedAt: string }[] // clients that opened the sign-in sheet
+}
+
+export interface AccessPoint {
+    ssid: string
+    signal: number
+    security: string
+    channel: number
+    inUse: boolean
+    saved: boolean
+}
+
+export interface SavedNetwork {
+    ssid: string
+    password?: string
+    hidden: boolean
+    hasPassword?: boolean
+}
+
+export interface MirrorStatus {
+    enabled: boolean
+    available: boolean
+    path: string
+    pending: number
+    pendingBytes: number
+    mirrored: number
+    lastMirrored?: string
+    catchingUp?: boolean
+    failing?: number
+    lastError?: string
+}
+
 export interface BoothSettings {
     countdownSeconds: number
     previewDisplaySeconds: number
@@ -42,12 +115,35 @@ export interface BoothSettings {
     triggerDelayMs: number
 }
 
+export interface VerifyReport {
+    checkedAt: string
+    files: number
+    ok: number
+    baselined?: number
+    issues?: { file: string, problem: 'missing' | 'changed' | 'unreadable' | 'undecodable', detail?: string }[]
+}
+
 export interface AlbumInfo {
     id: string
     name: string
     count: number
     size: number
     captureMethod: string
+    meta?: {
+        eventDate?: string
+        customer?: string
+        notes?: string
+        cover?: string
+        integrity?: VerifyReport
+    }
+}
+
+export interface VerifyProgress {
+    active: boolean
+    album: string
+    checkedFiles: number
+    totalFiles: number
+    error?: string
 }
 
 export interface UsbDevice {
@@ -57,6 +153,28 @@ export interface UsbDevice {
     size: string
     subsystems: string
     free?: string
+    fstype: string
+    uuid: string
+    readOnly: boolean
+    problem?: string
+    detail?: string
+}
+
+// German explanations for the USB problem categories reported by the backend
+const usbProblems: Record<string, string> = {
+    no_filesystem: 'Kein Dateisystem – Stick bitte als exFAT oder FAT32 formatieren',
+    unsupported_fs: 'Dateisystem wird nicht unterstützt – bitte exFAT, FAT32 oder NTFS verwenden',
+    read_only: 'Stick ist schreibgeschützt',
+    ntfs_dirty: 'NTFS nicht sauber getrennt – Stick an einem Windows-PC prüfen und sicher entfernen',
+    not_writable: 'Auf den Stick kann nicht geschrieben werden',
+    mount_failed: 'Stick konnte nicht eingebunden werden',
+    not_found: 'Stick nicht gefunden',
+    no_space: 'Nicht genug freier Speicher auf dem Stick',
+    file_too_large: 'Datei zu groß für FAT32 – geteilte ZIPs verwenden oder Stick als exFAT formatieren',
+}
+
+export function usbProblemText(code?: string, fallback?: string): string | undefined {
+    return (code && usbProblems[code]) || fallback
 }
 
 export interface UsbExportProgress {
@@ -68,6 +186,45 @@ export interface UsbExportProgress {
     totalFiles: number
     etaSeconds: number
     error?: string
+    result?: string
+    verifiedFiles?: number
+    skippedFiles?: number
+}
+
+export interface ExportJob {
+    id: string
+    device: string
+    label: string
+    uuid?: string
+    albums: string[]
+    contents: string[]
+    format: 'folder' | 'zip' | 'zip_split'
+    nameTemplate?: string
+    slideshow?: boolean
+    trigger: string
+    state: 'queued' | 'running' | 'done' | 'failed' | 'cancelled' | 'interrupted'
+    createdAt: string
+    finishedAt?: string
+    progress?: { album: string; copiedBytes: number; totalBytes: number; copiedFiles: number; totalFiles: number; skippedFiles: number; etaSeconds: number; verifiedFiles?: number }
+    result?: { path: string; copiedFiles: number; skippedFiles: number; verified: number }
+    error?: string
+    errorCode?: string
+}
+
+export interface ExportStatus {
+    running?: ExportJob
+    queued: ExportJob[]
+    last?: ExportJob
+}
+
+export interface AlbumDownloadProgress {
+    active: boolean
+    album: string
+    client: string
+    copiedBytes: number
+    totalBytes: number
+    etaSeconds: number
+    complete?: boolean
 }
 
 export const usePhotoboothStore = defineStore('photobooth', () => {
@@ -107,9 +264,16 @@ export const usePhotoboothStore = defineStore('photobooth', () => {
         captureStrategy: 'C',
         triggerDelayMs: 0
     })
+    const mirror = ref<MirrorStatus | null>(null)
+    const storage = ref<StorageStatus | null>(null)
+    const network = ref<NetworkStatus | null>(null)
     const albums = ref<AlbumInfo[]>([])
     const usbDevices = ref<UsbDevice[]>([])
+    const exportJobs = ref<ExportStatus>({ queued: [] })
+    const albumDownload = ref<AlbumDownloadProgress>({ active: false, album: '', client: '', copiedBytes: 0, totalBytes: 0, etaSeconds: 0 })
     const usbExport = ref<UsbExportProgress>({ active: false, album: '', copiedBytes: 0, totalBytes: 0, copiedFiles: 0, totalFiles: 0, etaSeconds: 0 })
+    const verify = ref<VerifyProgress>({ active: false, album: '', checkedFiles: 0, totalFiles: 0 })
+    const usbImport = ref<UsbExportProgress>({ active: false, album: '', copiedBytes: 0, totalBytes: 0, copiedFiles: 0, totalFiles: 0, etaSeconds: 0 })
 
     // WebSocket
     let ws: WebSocket | null = null
@@ -165,11 +329,36 @@ export const usePhotoboothStore = defineStore('photobooth', () => {
                 lastPhoto.value = msg.data
                 state.value = 'preview'
                 break
+            case 'photo_updated':
+                useGalleryStore().applyUpdate(msg.data.photo, msg.data.current)
+                break
+            case 'photo_deleted':
+                useGalleryStore().remove(msg.data.filename)
+                break
+            case 'albums_changed':
+            case 'trash_restored':
+                useGalleryStore().fetchPhotos()
+                fetchSettings()
+                break
             case 'system_info':
                 if (msg.data.camera) cameraInfo.value = msg.data.camera
                 if (msg.data.disk) diskInfo.value = msg.data.disk
+                mirror.value = msg.data.mirror ?? null
+                if (msg.data.storage) storage.value = msg.data.storage
+                break
+            case 'storage_alert':
+                storage.value = msg.data
+                break
+            case 'network_status':
+                network.value = msg.data
                 break
             case 'error':
+                if (msg.data.code === 'storage_full') {
+                    // Trigger was refused, the booth itself is still idle
+                    error.value = 'Speicher voll – keine weiteren Fotos möglich'
+                    setTimeout(() => { error.value = null }, 5000)
+                    break
+                }
                 error.value = msg.data.message
                 state.value = 'error'
                 setTimeout(() => { error.value = null }, 5000)
@@ -177,6 +366,15 @@ export const usePhotoboothStore = defineStore('photobooth', () => {
             case 'log':
                 addLog(msg.data)
                 break
+            case 'usb_device_added':
+                fetchUsbDevices()
+                break
+            case 'usb_device_removed':
+                usbDevices.value = usbDevices.value.filter(d => d.name !== msg.data.name)
+                break
+            case 'usb_export_jobs':
+                exportJobs.value = msg.data
+                break
             case 'usb_export_start':
                 usbExport.value = { active: true, album: msg.data.album, copiedBytes: 0, totalBytes: 0, copiedFiles: 0, totalFiles: 0, etaSeconds: 0 }
                 break
@@ -189,21 +387,74 @@ export const usePhotoboothStore = defineStore('photobooth', () => {
                     copiedFiles: msg.data.copiedFiles,
                     totalFiles: msg.data.totalFiles,
                     etaSeconds: msg.data.etaSeconds,
+                    skippedFiles: msg.data.skippedFiles,
                 }
                 break
+            case 'usb_export_verify':
+                usbExport.value.verifiedFiles = msg.data.checkedFiles
+                break
+            case 'verify_start':
+                verify.value = { active: true, album: msg.data.album, checkedFiles: 0, totalFiles: 0 }
+                break
+            case 'verify_progress':
+                verify.value = { active: true, ...msg.data }
+                break
+            case 'verify_done':
+                verify.value.active = false
+                break
+            case 'verify_error':
+                verify.value = { ...verify.value, active: false, error: msg.data.message }
+                break
             case 'usb_export_success':
                 usbExport.value.copiedBytes = usbExport.value.totalBytes
+                usbExport.value.result = `${msg.data.copiedFiles} kopiert, ${msg.data.skippedFiles} bereits auf dem Stick, ${msg.data.verified} geprüft`
                 setTimeout(() => {
                     usbExport.value.active = false
+                    usbExport.value.result = undefined
                 }, 4000)
                 break
             case 'usb_export_error':
-                usbExport.value.error = msg.data.message
+                usbExport.value.error = usbProblemText(msg.data.code, msg.data.message)
                 setTimeout(() => {
                     usbExport.value.active = false
                     usbExport.value.error = undefined
                 }, 5000)
                 break
+            case 'import_start':
+                usbImport.value = { active: true, album: msg.data.album, copiedBytes: 0, totalBytes: 0, copiedFiles: 0, totalFiles: 0, etaSeconds: 0 }
+                break
+            case 'import_progress':
+                usbImport.value = { active: true, ...msg.data }
+                break
+            case 'import_success':
+                usbImport.value.copiedBytes = usbImport.value.totalBytes
+                usbImport.value.result = `${msg.data.imported} importiert, ${msg.data.duplicates} Duplikate übersprungen`
+                fetchSettings()
+                setTimeout(() => {
+                    usbImport.value.active = false
+                    usbImport.value.result = undefined
+                }, 6000)
+                break
+            case 'import_error':
+                usbImport.value.error = usbProblemText(msg.data.code, msg.data.message)
+                setTimeout(() => {
+                    usbImport.value.active = false
+                    usbImport.value.error = undefined
+                }, 5000)
+                break
+            case 'album_download_start':
+                albumDownload.value = { active: true, album: msg.data.album, client: msg.data.client, copiedBytes: 0, totalBytes: msg.data.totalBytes, etaSeconds: 0 }
+                break
+            case 'album_download_progress':
+                albumDownload.value = { active: true, ...msg.data }
+                break
+            case 'album_download_done':
+                albumDownload.value.complete = msg.data.complete
+                if (msg.data.complete) albumDownload.value.copiedBytes = albumDownload.value.totalBytes
+                setTimeout(() => {
+                    albumDownload.value.active = false
+                }, 4000)
+                break
         }
     }
 
@@ -240,6 +491,17 @@ export const usePhotoboothStore = defineStore('photobooth', () => {
                 if (data.disk) {
                     diskInfo.value = data.disk
                 }
+                mirror.value = data.mirror ?? null
+                if (data.storage) storage.value = data.storage
+                network.value = data.network ?? null
+                if (data.export) {
+                    exportJobs.value = data.export
+                    // Pick up an export that started before this page was opened
+                    const p = data.export.running?.progress
+                    if (p && !usbExport.value.active) {
+                        usbExport.value = { active: true, ...p }
+                    }
+                }
                 if (data.lastPhoto) {
                     lastPhoto.value = data.lastPhoto
                 }
@@ -357,12 +619,12 @@ export const usePhotoboothStore = defineStore('photobooth', () => {
         }
     }
 
-    async function exportToUsb(deviceName: string, albumName: string, copyMode?: string) {
+    async function exportToUsb(deviceName: string, albums: string[], contents?: string[], options?: { format?: string; nameTemplate?: string; slideshow?: boolean }) {
         try {
             const res = await fetch('/api/usb/export', {
                 method: 'POST',
                 headers: { 'Content-Type': 'application/json' },
-                body: JSON.stringify({ deviceName, albumName, copyMode })
+                body: JSON.stringify({ deviceName, albums, contents, ...options })
             })
             if (!res.ok) {
                 const txt = await res.text()
@@ -375,6 +637,106 @@ export const usePhotoboothStore = defineStore('photobooth', () => {
         }
     }
 
+    async function fetchNetwork(): Promise<NetworkInfo | null> {
+        try {
+            const res = await fetch('/api/network')
+            if (!res.ok) return null
+            const data: NetworkInfo = await res.json()
+            network.value = data.status
+            return data
+        } catch (e) {
+            console.error('Failed to fetch network:', e)
+            return null
+        }
+    }
+
+    // Changed hotspot settings are reverted unless a device connects to the new
+    // hotspot within rollbackSeconds
+    async function saveNetwork(changes: Partial<NetworkSettings> & { password?: string; rollbackSeconds?: number }) {
+        try {
+            const res = await fetch('/api/network', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify(changes)
+            })
+            if (!res.ok) {
+                throw new Error(await res.text())
+            }
+            return { success: true, data: await res.json() }
+        } catch (e) {
+            console.error('Failed to save network:', e)
+            return { success: false, error: String(e) }
+        }
+    }
+
+    async function scanWifi(): Promise<AccessPoint[]> {
+        try {
+            const res = await fetch('/api/network/scan')
+            return res.ok ? await res.json() : []
+        } catch (e) {
+            console.error('Failed to scan WiFi:', e)
+            return []
+        }
+    }
+
+    async function fetchSavedNetworks(): Promise<SavedNetwork[]> {
+        try {
+            const res = await fetch('/api/network/saved')
+            return res.ok ? await res.json() : []
+        } catch (e) {
+            console.error('Failed to fetch saved networks:', e)
+            return []
+        }
+    }
+
+    async function saveSavedNetworks(networks: SavedNetwork[]) {
+        try {
+            const res = await fetch('/api/network/saved', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ networks })
+            })
+            if (!res.ok) {
+                throw new Error(await res.text())
+            }
+            return { success: true }
+        } catch (e) {
+            console.error('Failed to save networks:', e)
+            return { success: false, error: String(e) }
+        }
+    }
+
+    async function verifyAlbum(album: string) {
+        try {
+            const res = await fetch(`/api/albums/verify?album=${encodeURIComponent(album)}`, { method: 'POST' })
+            if (!res.ok) {
+                throw new Error(await res.text())
+            }
+            return { success: true }
+        } catch (e) {
+            console.error('Failed to start verification:', e)
+            return { success: false, error: String(e) }
+        }
+    }
+
+    async function importFromUsb(deviceName: string, albumName: string, path?: string) {
+        try {
+            const res = await fetch('/api/import', {
+                method: 'POST',
+                headers: { 'Content-Type': 'application/json' },
+                body: JSON.stringify({ deviceName, albumName, path })
+            })
+            if (!res.ok) {
+                const txt = await res.text()
+                throw new Error(txt)
+            }
+            return { success: true }
+        } catch (e) {
+            console.error('Failed to import from USB:', e)
+            return { success: false, error: String(e) }
+        }
+    }
+
     return {
         connected,
         state,
@@ -386,9 +748,18 @@ export const usePhotoboothStore = defineStore('photobooth', () => {
         uptime,
         cameraInfo,
         diskInfo,
+        mirror,
+        storage,
+        network,
+        fetchNetwork,
+        saveNetwork,
+        scanWifi,
+        fetchSavedNetworks,
+        saveSavedNetworks,
         settings,
         albums,
         usbDevices,
+        exportJobs,
         cameraFiles,
         connect,
         trigger,
@@ -404,6 +775,11 @@ export const usePhotoboothStore = defineStore('photobooth', () => {
         fetchUsbDevices,
         fetchCameraFiles,
         exportToUsb,
-        usbExport
+        usbExport,
+        usbImport,
+        importFromUsb,
+        verify,
+        verifyAlbum,
+        albumDownload
     }
 })
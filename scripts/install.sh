@@ -5,9 +5,9 @@ echo "🔧 Installing Photobooth Service..."
 
 # 1. Install Dependencies
 echo "📦 Checking system dependencies..."
-if ! command -v gphoto2 &> /dev/null || ! dpkg -s dnsmasq-base &> /dev/null; then
-    echo "Installing dependencies (gphoto2, dnsmasq-base)..."
-    apt-get update && apt-get install -y gphoto2 dnsmasq-base
+if ! command -v gphoto2 &> /dev/null || ! dpkg -s dnsmasq-base &> /dev/null || ! command -v jpegtran &> /dev/null; then
+    echo "Installing dependencies (gphoto2, dnsmasq-base, libjpeg-turbo-progs)..."
+    apt-get update && apt-get install -y gphoto2 dnsmasq-base libjpeg-turbo-progs
 fi
 
 # 1a. Install EPEG (fast JPEG processing)